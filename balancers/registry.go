@@ -0,0 +1,69 @@
+package balancers
+
+import (
+	"fmt"
+
+	"github.com/bmorton/deployster/clients"
+	"github.com/bmorton/deployster/settings"
+)
+
+// Registry keeps the load balancers that deployster registers the endpoints of
+// instances with, by name, and picks the one that each service uses.  A
+// service uses the load balancer named by its settings, or Default if its
+// settings don't name one.  A nil Registry has no load balancers.
+type Registry struct {
+	Default   string
+	settings  *settings.Registry
+	balancers map[string]clients.LoadBalancer
+}
+
+// NewRegistry returns an empty Registry that reads which load balancer each
+// service uses from its settings.
+func NewRegistry(serviceSettings *settings.Registry, defaultName string) *Registry {
+	return &Registry{Default: defaultName, settings: serviceSettings, balancers: make(map[string]clients.LoadBalancer)}
+}
+
+// Add registers the load balancer under the given name, replacing any load
+// balancer that's already registered with that name.
+func (r *Registry) Add(name string, balancer clients.LoadBalancer) {
+	r.balancers[name] = balancer
+}
+
+// Find returns the load balancer with the given name, or nil if it isn't
+// configured.
+func (r *Registry) Find(name string) clients.LoadBalancer {
+	if r == nil {
+		return nil
+	}
+	return r.balancers[name]
+}
+
+// Validate returns an error if the load balancer with the given name isn't
+// configured.  A blank name refers to the default, which doesn't need to be
+// configured since instances then register themselves from their unit files.
+func (r *Registry) Validate(name string) error {
+	if name == "" || r.Find(name) != nil {
+		return nil
+	}
+	return fmt.Errorf("The %s load balancer isn't configured.", name)
+}
+
+// ForService returns the load balancer that the service's instances are
+// registered with, or nil if it isn't configured, in which case instances are
+// left to register themselves from their unit files.
+func (r *Registry) ForService(service string) clients.LoadBalancer {
+	if r == nil {
+		return nil
+	}
+	name := r.settings.ForService(service).LoadBalancer
+	if name == "" {
+		name = r.Default
+	}
+	return r.Find(name)
+}
+
+// Manages returns whether deployster registers the service's instances with a
+// load balancer itself.
+func (r *Registry) Manages(service string) bool {
+	return r.ForService(service) != nil
+}
@@ -0,0 +1,69 @@
+package balancers
+
+import (
+	"testing"
+
+	"github.com/bmorton/deployster/clients/mocks"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RegistryTestSuite struct {
+	suite.Suite
+	Subject  *Registry
+	Settings *settings.Registry
+	Vulcand  *mocks.LoadBalancer
+	Nginx    *mocks.LoadBalancer
+}
+
+func (suite *RegistryTestSuite) SetupTest() {
+	suite.Settings = settings.NewMemoryRegistry()
+	suite.Vulcand = new(mocks.LoadBalancer)
+	suite.Nginx = new(mocks.LoadBalancer)
+	suite.Subject = NewRegistry(suite.Settings, schema.LoadBalancerVulcand)
+	suite.Subject.Add(schema.LoadBalancerVulcand, suite.Vulcand)
+	suite.Subject.Add(schema.LoadBalancerNginx, suite.Nginx)
+}
+
+func (suite *RegistryTestSuite) TestForServiceUsesDefault() {
+	assert.True(suite.T(), suite.Subject.ForService("railsapp") == suite.Vulcand)
+	assert.True(suite.T(), suite.Subject.Manages("railsapp"))
+}
+
+func (suite *RegistryTestSuite) TestForServiceUsesServiceSettings() {
+	suite.Settings.Save("railsapp", &schema.ServiceSettings{LoadBalancer: schema.LoadBalancerNginx})
+
+	assert.True(suite.T(), suite.Subject.ForService("railsapp") == suite.Nginx)
+}
+
+func (suite *RegistryTestSuite) TestForServiceWithUnconfiguredBalancer() {
+	suite.Settings.Save("railsapp", &schema.ServiceSettings{LoadBalancer: schema.LoadBalancerHAProxy})
+
+	assert.Nil(suite.T(), suite.Subject.ForService("railsapp"))
+	assert.False(suite.T(), suite.Subject.Manages("railsapp"))
+}
+
+func (suite *RegistryTestSuite) TestForServiceWithUnconfiguredDefault() {
+	suite.Subject = NewRegistry(suite.Settings, schema.LoadBalancerVulcand)
+
+	assert.Nil(suite.T(), suite.Subject.ForService("railsapp"))
+}
+
+func (suite *RegistryTestSuite) TestNilRegistry() {
+	var registry *Registry
+
+	assert.Nil(suite.T(), registry.ForService("railsapp"))
+	assert.False(suite.T(), registry.Manages("railsapp"))
+}
+
+func (suite *RegistryTestSuite) TestValidate() {
+	assert.Nil(suite.T(), suite.Subject.Validate(""))
+	assert.Nil(suite.T(), suite.Subject.Validate(schema.LoadBalancerNginx))
+	assert.EqualError(suite.T(), suite.Subject.Validate(schema.LoadBalancerHAProxy), "The haproxy load balancer isn't configured.")
+}
+
+func TestRegistryTestSuite(t *testing.T) {
+	suite.Run(t, new(RegistryTestSuite))
+}
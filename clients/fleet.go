@@ -1,8 +1,12 @@
 package clients
 
-import fleet "github.com/coreos/fleet/schema"
+import (
+	"github.com/coreos/fleet/machine"
+	fleet "github.com/coreos/fleet/schema"
+)
 
 type Fleet interface {
+	Machines() ([]machine.MachineState, error)
 	Units() ([]*fleet.Unit, error)
 	CreateUnit(*fleet.Unit) error
 	DestroyUnit(string) error
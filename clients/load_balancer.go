@@ -0,0 +1,24 @@
+package clients
+
+// DefaultWeight is the weight that endpoints are registered with, which gives
+// them a full share of the service's traffic.
+const DefaultWeight = 100
+
+// LoadBalancer is the interface required for registering the endpoint of each
+// instance of a service with a load balancer once it's online and for
+// deregistering it before the instance is stopped or destroyed.
+type LoadBalancer interface {
+	Register(service string, endpoint string, url string) error
+	Deregister(service string, endpoint string) error
+}
+
+// WeightedLoadBalancer is a LoadBalancer that can send each endpoint of a
+// service a different share of its traffic.  Weights range from 0, which sends
+// an endpoint no new traffic, to DefaultWeight.  RegisterWeighted registers an
+// endpoint with the given weight instead of the default, and SetWeights
+// changes the weights of several registered endpoints at once.
+type WeightedLoadBalancer interface {
+	LoadBalancer
+	RegisterWeighted(service string, endpoint string, url string, weight int) error
+	SetWeights(service string, weights map[string]int) error
+}
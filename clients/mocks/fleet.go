@@ -2,12 +2,24 @@ package mocks
 
 import "github.com/stretchr/testify/mock"
 
+import "github.com/coreos/fleet/machine"
 import fleet "github.com/coreos/fleet/schema"
 
 type Fleet struct {
 	mock.Mock
 }
 
+func (m *Fleet) Machines() ([]machine.MachineState, error) {
+	ret := m.Called()
+
+	var r0 []machine.MachineState
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]machine.MachineState)
+	}
+	r1 := ret.Error(1)
+
+	return r0, r1
+}
 func (m *Fleet) Units() ([]*fleet.Unit, error) {
 	ret := m.Called()
 
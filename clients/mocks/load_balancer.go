@@ -0,0 +1,41 @@
+package mocks
+
+import "github.com/stretchr/testify/mock"
+
+type LoadBalancer struct {
+	mock.Mock
+}
+
+func (m *LoadBalancer) Register(service string, endpoint string, url string) error {
+	ret := m.Called(service, endpoint, url)
+
+	r0 := ret.Error(0)
+
+	return r0
+}
+func (m *LoadBalancer) Deregister(service string, endpoint string) error {
+	ret := m.Called(service, endpoint)
+
+	r0 := ret.Error(0)
+
+	return r0
+}
+
+type WeightedLoadBalancer struct {
+	LoadBalancer
+}
+
+func (m *WeightedLoadBalancer) RegisterWeighted(service string, endpoint string, url string, weight int) error {
+	ret := m.Called(service, endpoint, url, weight)
+
+	r0 := ret.Error(0)
+
+	return r0
+}
+func (m *WeightedLoadBalancer) SetWeights(service string, weights map[string]int) error {
+	ret := m.Called(service, weights)
+
+	r0 := ret.Error(0)
+
+	return r0
+}
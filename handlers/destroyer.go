@@ -2,23 +2,60 @@ package handlers
 
 import (
 	"log"
+	"strconv"
 
 	"github.com/bmorton/deployster/clients"
 	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/progress"
 	"github.com/bmorton/deployster/schema"
 )
 
+// Destroyer is a poller handler that destroys the previous version's instance
+// matching each new instance that comes online.  When ReplaceAll is set, which
+// it is for global deploys whose single instance runs on every machine, every
+// instance of the previous version is destroyed instead.  If a Registrar is
+// given, each instance is deregistered from the load balancer before it's
+// destroyed.  Each unit that's destroyed is reported to the optional Reporter,
+// and the optional Notifier notifies webhooks of each one that's destroyed
+// successfully.
 type Destroyer struct {
 	PreviousVersion *schema.Deploy
+	ReplaceAll      bool
 	Client          clients.Fleet
+	Registrar       *Registrar
+	Reporter        progress.Reporter
+	Notifier        *Notifier
 }
 
 func (d *Destroyer) Handle(event *poller.Event) {
-	marked := d.PreviousVersion.ServiceInstance(event.ServiceInstance.Instance)
+	if !d.ReplaceAll {
+		d.destroy(d.PreviousVersion.ServiceInstance(event.ServiceInstance.Instance))
+		return
+	}
+
+	for i := 1; i <= d.PreviousVersion.InstanceCount; i++ {
+		d.destroy(d.PreviousVersion.ServiceInstance(strconv.Itoa(i)))
+	}
+}
+
+// destroy destroys the unit of the previous version's instance.
+func (d *Destroyer) destroy(marked *schema.ServiceInstance) {
+	if d.Registrar != nil {
+		d.Registrar.Deregister(marked, d.ReplaceAll)
+	}
 	log.Printf("Destroying %s due to launched instance replacement.\n", marked.FleetUnitName())
 	err := d.Client.DestroyUnit(marked.FleetUnitName())
 	if err != nil {
 		log.Println(err)
 	}
-	return
+	if d.Reporter != nil {
+		reported := &progress.Event{Type: progress.EventUnitDestroyed, Unit: marked.FleetUnitName(), Instance: marked.Instance}
+		if err != nil {
+			reported.Error = err.Error()
+		}
+		d.Reporter.Report(reported)
+	}
+	if d.Notifier != nil && err == nil {
+		d.Notifier.Notify(marked)
+	}
 }
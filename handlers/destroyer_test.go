@@ -5,7 +5,10 @@ import (
 
 	"github.com/bmorton/deployster/clients/mocks"
 	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/progress"
 	"github.com/bmorton/deployster/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -31,6 +34,39 @@ func (suite *DestroyerTestSuite) TestDestroysUnit() {
 	suite.FleetMock.Mock.AssertExpectations(suite.T())
 }
 
+func (suite *DestroyerTestSuite) TestReportsDestroyedUnit() {
+	var reported []*progress.Event
+	suite.Subject.Reporter = progress.ReporterFunc(func(e *progress.Event) { reported = append(reported, e) })
+	suite.FleetMock.On("DestroyUnit", "railsapp:old:2006.01.02-15.04.05@1.service").Return(nil)
+
+	suite.Subject.Handle(&poller.Event{ServiceInstance: &schema.ServiceInstance{Instance: "1"}})
+
+	assert.Len(suite.T(), reported, 1)
+	assert.Equal(suite.T(), progress.EventUnitDestroyed, reported[0].Type)
+	assert.Equal(suite.T(), "railsapp:old:2006.01.02-15.04.05@1.service", reported[0].Unit)
+}
+
+func (suite *DestroyerTestSuite) TestReplaceAllDestroysEveryPreviousUnit() {
+	suite.Subject.ReplaceAll = true
+	suite.Subject.PreviousVersion.InstanceCount = 2
+	suite.FleetMock.On("DestroyUnit", "railsapp:old:2006.01.02-15.04.05@1.service").Return(nil).Times(1)
+	suite.FleetMock.On("DestroyUnit", "railsapp:old:2006.01.02-15.04.05@2.service").Return(nil).Times(1)
+
+	suite.Subject.Handle(&poller.Event{ServiceInstance: &schema.ServiceInstance{Instance: "1"}})
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DestroyerTestSuite) TestDeregistersUnitBeforeDestroying() {
+	balancer := new(mocks.LoadBalancer)
+	suite.Subject.Registrar = &Registrar{Balancer: balancer, Fleet: suite.FleetMock}
+	var calls []string
+	balancer.On("Deregister", "railsapp", "railsapp-old-2006.01.02-15.04.05-1").Return(nil).Run(func(mock.Arguments) { calls = append(calls, "Deregister") })
+	suite.FleetMock.On("DestroyUnit", "railsapp:old:2006.01.02-15.04.05@1.service").Return(nil).Run(func(mock.Arguments) { calls = append(calls, "DestroyUnit") })
+
+	suite.Subject.Handle(&poller.Event{ServiceInstance: &schema.ServiceInstance{Instance: "1"}})
+	assert.Equal(suite.T(), []string{"Deregister", "DestroyUnit"}, calls)
+}
+
 func TestDestroyerTestSuite(t *testing.T) {
 	suite.Run(t, new(DestroyerTestSuite))
 }
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/webhooks"
+)
+
+// Notifier is a poller handler that notifies the service's webhooks of Event
+// for each instance it handles.  A Destroyer can also use it to notify webhooks
+// of each previous instance that it destroys.
+type Notifier struct {
+	Deploy   *schema.Deploy
+	Event    string
+	Webhooks *webhooks.Dispatcher
+}
+
+func (n *Notifier) Handle(event *poller.Event) {
+	n.Notify(event.ServiceInstance)
+}
+
+// Notify sends the instance and its unit to the webhooks along with the
+// deploy's ID and version.
+func (n *Notifier) Notify(instance *schema.ServiceInstance) {
+	n.Webhooks.Notify(&webhooks.Payload{
+		Event:       n.Event,
+		ServiceName: n.Deploy.ServiceName,
+		DeployID:    n.Deploy.ID,
+		Version:     n.Deploy.Version,
+		Instance:    instance.Instance,
+		Unit:        instance.FleetUnitName(),
+	})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmorton/deployster/clients/mocks"
+	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/webhooks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type NotifierTestSuite struct {
+	suite.Suite
+	Subject  *Notifier
+	Server   *httptest.Server
+	Payloads chan *webhooks.Payload
+}
+
+func (suite *NotifierTestSuite) SetupTest() {
+	suite.Payloads = make(chan *webhooks.Payload, 1)
+	suite.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var payload webhooks.Payload
+		json.Unmarshal(body, &payload)
+		suite.Payloads <- &payload
+	}))
+	suite.Subject = &Notifier{
+		Deploy:   &schema.Deploy{ID: "abc123", ServiceName: "railsapp", Version: "new", Timestamp: "2006.01.02-15.04.05"},
+		Event:    schema.WebhookInstanceRunning,
+		Webhooks: webhooks.NewDispatcher([]*schema.Webhook{{URL: suite.Server.URL}}, nil, nil),
+	}
+}
+
+func (suite *NotifierTestSuite) TearDownTest() {
+	suite.Server.Close()
+}
+
+func (suite *NotifierTestSuite) TestNotifiesWebhooksOfInstance() {
+	suite.Subject.Handle(&poller.Event{ServiceInstance: suite.Subject.Deploy.ServiceInstance("2")})
+
+	payload := <-suite.Payloads
+	assert.Equal(suite.T(), schema.WebhookInstanceRunning, payload.Event)
+	assert.Equal(suite.T(), "railsapp", payload.ServiceName)
+	assert.Equal(suite.T(), "abc123", payload.DeployID)
+	assert.Equal(suite.T(), "new", payload.Version)
+	assert.Equal(suite.T(), "2", payload.Instance)
+	assert.Equal(suite.T(), "railsapp:new:2006.01.02-15.04.05@2.service", payload.Unit)
+}
+
+func (suite *NotifierTestSuite) TestDestroyerNotifiesOfDestroyedUnit() {
+	fleetMock := new(mocks.Fleet)
+	fleetMock.On("DestroyUnit", "railsapp:old:2006.01.02-15.04.05@1.service").Return(nil)
+	suite.Subject.Event = schema.WebhookPreviousDestroyed
+	destroyer := &Destroyer{
+		PreviousVersion: &schema.Deploy{ServiceName: "railsapp", Version: "old", Timestamp: "2006.01.02-15.04.05"},
+		Client:          fleetMock,
+		Notifier:        suite.Subject,
+	}
+
+	destroyer.Handle(&poller.Event{ServiceInstance: &schema.ServiceInstance{Instance: "1"}})
+
+	payload := <-suite.Payloads
+	assert.Equal(suite.T(), schema.WebhookPreviousDestroyed, payload.Event)
+	assert.Equal(suite.T(), "new", payload.Version)
+	assert.Equal(suite.T(), "railsapp:old:2006.01.02-15.04.05@1.service", payload.Unit)
+}
+
+func TestNotifierTestSuite(t *testing.T) {
+	suite.Run(t, new(NotifierTestSuite))
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/progress"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/store"
+)
+
+// Recorder is a poller handler that keeps a deploy record up to date with the
+// state transitions of each instance and persists it to the Store.  Each
+// transition is also reported to the optional Reporter.
+type Recorder struct {
+	Record   *schema.DeployRecord
+	Store    store.Store
+	Reporter progress.Reporter
+}
+
+// Handle appends a transition to the record if the instance's state differs
+// from the last state that was recorded for it.  When registered as a
+// completion handler, the final status of the deploy is recorded instead.
+func (r *Recorder) Handle(event *poller.Event) {
+	if event.Summary != nil {
+		r.Finish(event.Summary)
+		return
+	}
+
+	instance := event.ServiceInstance.Instance
+	current := r.Record.CurrentState(instance)
+	if current != nil && current.SubState == event.SystemdSubState && current.ActiveState == event.SystemdActiveState && current.LoadState == event.SystemdLoadState {
+		return
+	}
+
+	r.Record.Transitions = append(r.Record.Transitions, &schema.StateTransition{
+		Instance:    instance,
+		ActiveState: event.SystemdActiveState,
+		LoadState:   event.SystemdLoadState,
+		SubState:    event.SystemdSubState,
+		ObservedAt:  time.Now().UTC(),
+	})
+	r.save()
+
+	if r.Reporter != nil {
+		r.Reporter.Report(&progress.Event{
+			Type:        progress.EventStateChanged,
+			Unit:        event.ServiceInstance.FleetUnitName(),
+			Instance:    instance,
+			ActiveState: event.SystemdActiveState,
+			LoadState:   event.SystemdLoadState,
+			SubState:    event.SystemdSubState,
+		})
+	}
+}
+
+// Finish sets the final status of the deploy from the summary of the last
+// instances the poller watched.  If any instance failed, the deploy failed.  If
+// any instance was never resolved, the deploy timed out.  A nil summary means
+// that there was nothing left to watch, so the deploy succeeded.
+func (r *Recorder) Finish(summary *poller.Summary) {
+	status := schema.DeploySucceeded
+	if summary != nil && !summary.Succeeded() {
+		status = schema.DeployTimedOut
+		if summary.Count(poller.OutcomeFailed) > 0 {
+			status = schema.DeployFailed
+		}
+	}
+
+	r.Record.Status = status
+	r.save()
+}
+
+// save persists the record, logging any failure since poller handlers have no
+// way to return errors.
+func (r *Recorder) save() {
+	r.Record.UpdatedAt = time.Now().UTC()
+	err := r.Store.Save(r.Record)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/progress"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RecorderTestSuite struct {
+	suite.Suite
+	Subject *Recorder
+	Store   *store.MemoryStore
+	Deploy  *schema.Deploy
+}
+
+func (suite *RecorderTestSuite) SetupTest() {
+	suite.Store = store.NewMemoryStore()
+	suite.Deploy = &schema.Deploy{ID: "d3adb33f", ServiceName: "railsapp", Version: "new", Timestamp: "2006.01.02-15.04.05", InstanceCount: 2}
+	suite.Subject = &Recorder{
+		Record: schema.NewDeployRecord(suite.Deploy),
+		Store:  suite.Store,
+	}
+}
+
+func (suite *RecorderTestSuite) TestRecordsTransitions() {
+	suite.Subject.Handle(suite.event("1", "launching"))
+	suite.Subject.Handle(suite.event("1", "running"))
+
+	saved, _ := suite.Store.Find("railsapp", "d3adb33f")
+	assert.Len(suite.T(), saved.Transitions, 2)
+	assert.Equal(suite.T(), "running", saved.CurrentState("1").SubState)
+}
+
+func (suite *RecorderTestSuite) TestIgnoresRepeatedStates() {
+	suite.Subject.Handle(suite.event("1", "launching"))
+	suite.Subject.Handle(suite.event("1", "launching"))
+
+	assert.Len(suite.T(), suite.Subject.Record.Transitions, 1)
+}
+
+func (suite *RecorderTestSuite) TestReportsTransitions() {
+	var reported []*progress.Event
+	suite.Subject.Reporter = progress.ReporterFunc(func(e *progress.Event) { reported = append(reported, e) })
+
+	suite.Subject.Handle(suite.event("1", "launching"))
+	suite.Subject.Handle(suite.event("1", "launching"))
+	suite.Subject.Handle(suite.event("1", "running"))
+
+	assert.Len(suite.T(), reported, 2)
+	assert.Equal(suite.T(), progress.EventStateChanged, reported[1].Type)
+	assert.Equal(suite.T(), "1", reported[1].Instance)
+	assert.Equal(suite.T(), "running", reported[1].SubState)
+}
+
+func (suite *RecorderTestSuite) TestFinishSucceeded() {
+	suite.Subject.Finish(suite.summary(poller.OutcomeSucceeded, poller.OutcomeSucceeded))
+
+	saved, _ := suite.Store.Find("railsapp", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeploySucceeded, saved.Status)
+}
+
+func (suite *RecorderTestSuite) TestFinishFailed() {
+	suite.Subject.Finish(suite.summary(poller.OutcomeFailed, poller.OutcomeStopped))
+
+	assert.Equal(suite.T(), schema.DeployFailed, suite.Subject.Record.Status)
+}
+
+func (suite *RecorderTestSuite) TestFinishTimedOut() {
+	suite.Subject.Finish(suite.summary(poller.OutcomeSucceeded, poller.OutcomeTimedOut))
+
+	assert.Equal(suite.T(), schema.DeployTimedOut, suite.Subject.Record.Status)
+}
+
+func (suite *RecorderTestSuite) TestFinishWithNothingToWatch() {
+	suite.Subject.Finish(nil)
+
+	assert.Equal(suite.T(), schema.DeploySucceeded, suite.Subject.Record.Status)
+}
+
+func (suite *RecorderTestSuite) TestFinishesOnCompletion() {
+	suite.Subject.Handle(suite.event("1", "running"))
+	suite.Subject.Handle(suite.event("2", "running"))
+	suite.Subject.Handle(&poller.Event{Summary: suite.summary(poller.OutcomeSucceeded, poller.OutcomeSucceeded)})
+
+	saved, _ := suite.Store.Find("railsapp", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeploySucceeded, saved.Status)
+	assert.Len(suite.T(), saved.Transitions, 2)
+}
+
+// summary returns a summary with the given result for each instance, in order.
+func (suite *RecorderTestSuite) summary(results ...string) *poller.Summary {
+	summary := &poller.Summary{Deploy: suite.Deploy}
+	for i, result := range results {
+		summary.Outcomes = append(summary.Outcomes, &poller.Outcome{
+			ServiceInstance: suite.Deploy.ServiceInstance(strconv.Itoa(i + 1)),
+			Result:          result,
+		})
+	}
+	return summary
+}
+
+func (suite *RecorderTestSuite) event(instance string, state string) *poller.Event {
+	return &poller.Event{ServiceInstance: suite.Deploy.ServiceInstance(instance), SystemdSubState: state}
+}
+
+func TestRecorderTestSuite(t *testing.T) {
+	suite.Run(t, new(RecorderTestSuite))
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/bmorton/deployster/clients"
+	"github.com/bmorton/deployster/health"
+	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/progress"
+	"github.com/bmorton/deployster/schema"
+)
+
+// Registrar is a poller handler that registers the endpoint of each instance
+// that comes online with the Balancer, so that instances only receive traffic
+// once the poller has confirmed that they're running and healthy.  The address
+// that each instance's container Port is published on is found using the
+// Resolver.  The instance of a global deploy is registered once for every
+// machine it runs on.  When Drained is set, endpoints are registered with a
+// weight of 0 so that they don't receive traffic until it's shifted to them,
+// which requires a clients.WeightedLoadBalancer.  Otherwise, a Weight other
+// than zero registers endpoints with that weight instead of the default.  Each
+// endpoint that's registered or deregistered is reported to the optional
+// Reporter.
+type Registrar struct {
+	Balancer clients.LoadBalancer
+	Resolver health.Resolver
+	Fleet    clients.Fleet
+	Port     int
+	Drained  bool
+	Weight   int
+	Reporter progress.Reporter
+}
+
+// Handle registers the endpoint of the instance on every machine it's running
+// on.
+func (r *Registrar) Handle(event *poller.Event) {
+	if len(event.Machines) == 0 {
+		r.register(event.ServiceInstance, event.MachineID, EndpointID(event.ServiceInstance, ""))
+		return
+	}
+
+	for _, e := range event.Machines {
+		r.register(event.ServiceInstance, e.MachineID, EndpointID(event.ServiceInstance, e.MachineID))
+	}
+}
+
+// Deregister removes the endpoint of the instance from the Balancer so that it
+// stops receiving traffic.  The endpoints of a global instance are removed for
+// every machine that Fleet reports it on.
+func (r *Registrar) Deregister(instance *schema.ServiceInstance, global bool) {
+	if !global {
+		r.deregister(instance, EndpointID(instance, ""))
+		return
+	}
+
+	states, err := r.Fleet.UnitStates()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, state := range states {
+		if state.Name == instance.FleetUnitName() {
+			r.deregister(instance, EndpointID(instance, state.MachineID))
+		}
+	}
+}
+
+// DeregisterEndpoint removes the endpoint of the instance on the machine from
+// the Balancer.  The machine ID is only used for the endpoints of global
+// instances and is blank otherwise.
+func (r *Registrar) DeregisterEndpoint(instance *schema.ServiceInstance, machineID string) {
+	r.deregister(instance, EndpointID(instance, machineID))
+}
+
+// EndpointID returns the ID that the instance's endpoint is registered under,
+// which is its container name.  The endpoints of a global instance are
+// registered for each machine, so their IDs include the machine ID as well.
+func EndpointID(instance *schema.ServiceInstance, machineID string) string {
+	if machineID == "" {
+		return instance.ContainerName()
+	}
+	return instance.ContainerName() + "@" + machineID
+}
+
+// register resolves the address of the instance on the machine and registers
+// it under the endpoint ID.
+func (r *Registrar) register(instance *schema.ServiceInstance, machineID string, id string) {
+	url := ""
+	address, err := r.Resolver.Resolve(instance, machineID, r.Port)
+	if err == nil {
+		url = "http://" + address
+		log.Printf("Registering %s at %s.\n", id, url)
+		weighted, ok := r.Balancer.(clients.WeightedLoadBalancer)
+		if weight := r.weight(); weight != clients.DefaultWeight && ok {
+			err = weighted.RegisterWeighted(instance.Name, id, url, weight)
+		} else {
+			err = r.Balancer.Register(instance.Name, id, url)
+		}
+	}
+	if err != nil {
+		log.Println(err)
+	}
+	r.report(progress.EventEndpointRegistered, instance, url, err)
+}
+
+// weight returns the weight that endpoints are registered with.
+func (r *Registrar) weight() int {
+	if r.Drained {
+		return 0
+	}
+	if r.Weight != 0 {
+		return r.Weight
+	}
+	return clients.DefaultWeight
+}
+
+// deregister removes the endpoint with the given ID.
+func (r *Registrar) deregister(instance *schema.ServiceInstance, id string) {
+	log.Printf("Deregistering %s.\n", id)
+	err := r.Balancer.Deregister(instance.Name, id)
+	if err != nil {
+		log.Println(err)
+	}
+	r.report(progress.EventEndpointDeregistered, instance, "", err)
+}
+
+// report reports the event to the Reporter, if there is one.
+func (r *Registrar) report(eventType string, instance *schema.ServiceInstance, url string, err error) {
+	if r.Reporter == nil {
+		return
+	}
+	reported := &progress.Event{Type: eventType, Unit: instance.FleetUnitName(), Instance: instance.Instance, Endpoint: url}
+	if err != nil {
+		reported.Error = err.Error()
+	}
+	r.Reporter.Report(reported)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bmorton/deployster/clients/mocks"
+	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/progress"
+	"github.com/bmorton/deployster/schema"
+	fleet "github.com/coreos/fleet/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// machineResolver resolves every instance to the IP of the machine it's on.
+type machineResolver map[string]string
+
+func (r machineResolver) Resolve(instance *schema.ServiceInstance, machineID string, port int) (string, error) {
+	ip, ok := r[machineID]
+	if !ok {
+		return "", errors.New("The address of the instance could not be resolved.")
+	}
+	return fmt.Sprintf("%s:%d", ip, port), nil
+}
+
+type RegistrarTestSuite struct {
+	suite.Suite
+	Subject      *Registrar
+	BalancerMock *mocks.LoadBalancer
+	FleetMock    *mocks.Fleet
+	Instance     *schema.ServiceInstance
+}
+
+func (suite *RegistrarTestSuite) SetupTest() {
+	suite.BalancerMock = new(mocks.LoadBalancer)
+	suite.FleetMock = new(mocks.Fleet)
+	suite.Instance = &schema.ServiceInstance{Name: "railsapp", Version: "new", Timestamp: "2007.01.02-15.04.05", Instance: "1"}
+	suite.Subject = &Registrar{
+		Balancer: suite.BalancerMock,
+		Resolver: machineResolver{"abc": "10.0.0.1", "def": "10.0.0.2"},
+		Fleet:    suite.FleetMock,
+		Port:     8080,
+	}
+}
+
+func (suite *RegistrarTestSuite) TestRegistersInstance() {
+	suite.BalancerMock.On("Register", "railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.1:8080").Return(nil).Times(1)
+
+	suite.Subject.Handle(&poller.Event{ServiceInstance: suite.Instance, MachineID: "abc"})
+	suite.BalancerMock.AssertExpectations(suite.T())
+}
+
+func (suite *RegistrarTestSuite) TestRegistersDrainedInstanceWithoutWeight() {
+	balancer := new(mocks.WeightedLoadBalancer)
+	suite.Subject.Balancer = balancer
+	suite.Subject.Drained = true
+	balancer.On("RegisterWeighted", "railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.1:8080", 0).Return(nil).Times(1)
+
+	suite.Subject.Handle(&poller.Event{ServiceInstance: suite.Instance, MachineID: "abc"})
+	balancer.AssertExpectations(suite.T())
+}
+
+func (suite *RegistrarTestSuite) TestRegistersInstanceWithWeight() {
+	balancer := new(mocks.WeightedLoadBalancer)
+	suite.Subject.Balancer = balancer
+	suite.Subject.Weight = 25
+	balancer.On("RegisterWeighted", "railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.1:8080", 25).Return(nil).Times(1)
+
+	suite.Subject.Handle(&poller.Event{ServiceInstance: suite.Instance, MachineID: "abc"})
+	balancer.AssertExpectations(suite.T())
+}
+
+func (suite *RegistrarTestSuite) TestRegistersGlobalInstanceOnEveryMachine() {
+	suite.BalancerMock.On("Register", "railsapp", "railsapp-new-2007.01.02-15.04.05-1@abc", "http://10.0.0.1:8080").Return(nil).Times(1)
+	suite.BalancerMock.On("Register", "railsapp", "railsapp-new-2007.01.02-15.04.05-1@def", "http://10.0.0.2:8080").Return(nil).Times(1)
+
+	suite.Subject.Handle(&poller.Event{ServiceInstance: suite.Instance, Machines: []*poller.Event{
+		&poller.Event{ServiceInstance: suite.Instance, MachineID: "abc"},
+		&poller.Event{ServiceInstance: suite.Instance, MachineID: "def"},
+	}})
+	suite.BalancerMock.AssertExpectations(suite.T())
+}
+
+func (suite *RegistrarTestSuite) TestReportsRegisteredEndpoint() {
+	var reported []*progress.Event
+	suite.Subject.Reporter = progress.ReporterFunc(func(e *progress.Event) { reported = append(reported, e) })
+	suite.BalancerMock.On("Register", "railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.1:8080").Return(nil)
+
+	suite.Subject.Handle(&poller.Event{ServiceInstance: suite.Instance, MachineID: "abc"})
+
+	assert.Len(suite.T(), reported, 1)
+	assert.Equal(suite.T(), progress.EventEndpointRegistered, reported[0].Type)
+	assert.Equal(suite.T(), "railsapp:new:2007.01.02-15.04.05@1.service", reported[0].Unit)
+	assert.Equal(suite.T(), "http://10.0.0.1:8080", reported[0].Endpoint)
+	assert.Empty(suite.T(), reported[0].Error)
+}
+
+func (suite *RegistrarTestSuite) TestReportsUnresolvableInstance() {
+	var reported []*progress.Event
+	suite.Subject.Reporter = progress.ReporterFunc(func(e *progress.Event) { reported = append(reported, e) })
+
+	suite.Subject.Handle(&poller.Event{ServiceInstance: suite.Instance, MachineID: "xyz"})
+
+	suite.BalancerMock.AssertNotCalled(suite.T(), "Register", "railsapp", "railsapp-new-2007.01.02-15.04.05-1", "")
+	assert.Len(suite.T(), reported, 1)
+	assert.Equal(suite.T(), "The address of the instance could not be resolved.", reported[0].Error)
+}
+
+func (suite *RegistrarTestSuite) TestDeregistersInstance() {
+	suite.BalancerMock.On("Deregister", "railsapp", "railsapp-new-2007.01.02-15.04.05-1").Return(nil).Times(1)
+
+	suite.Subject.Deregister(suite.Instance, false)
+	suite.BalancerMock.AssertExpectations(suite.T())
+}
+
+func (suite *RegistrarTestSuite) TestDeregistersGlobalInstanceOnEveryMachine() {
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "railsapp:new:2007.01.02-15.04.05@1.service", MachineID: "abc"},
+		&fleet.UnitState{Name: "railsapp:new:2007.01.02-15.04.05@1.service", MachineID: "def"},
+		&fleet.UnitState{Name: "railsapp:old:2006.01.02-15.04.05@1.service", MachineID: "abc"},
+	}, nil)
+	suite.BalancerMock.On("Deregister", "railsapp", "railsapp-new-2007.01.02-15.04.05-1@abc").Return(nil).Times(1)
+	suite.BalancerMock.On("Deregister", "railsapp", "railsapp-new-2007.01.02-15.04.05-1@def").Return(nil).Times(1)
+
+	suite.Subject.Deregister(suite.Instance, true)
+	suite.BalancerMock.AssertExpectations(suite.T())
+}
+
+func (suite *RegistrarTestSuite) TestDeregistersEndpointOnMachine() {
+	suite.BalancerMock.On("Deregister", "railsapp", "railsapp-new-2007.01.02-15.04.05-1@abc").Return(nil).Times(1)
+
+	suite.Subject.DeregisterEndpoint(suite.Instance, "abc")
+	suite.BalancerMock.AssertExpectations(suite.T())
+}
+
+func TestRegistrarTestSuite(t *testing.T) {
+	suite.Run(t, new(RegistrarTestSuite))
+}
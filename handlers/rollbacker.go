@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/bmorton/deployster/clients"
+	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/schema"
+	fleet "github.com/coreos/fleet/schema"
+)
+
+// Rollbacker is a poller handler that undoes a deploy once one of its instances
+// fails or times out.  It destroys every instance of the new version and, if
+// the previous version was being destroyed, relaunches any of its instances
+// that have already been torn down using the previous version's unit options.
+// If a Registrar is given, the new instances are deregistered from the load
+// balancer before they're destroyed.  A deploy is only rolled back once, no
+// matter how many events are handled.
+type Rollbacker struct {
+	Deploy          *schema.Deploy
+	PreviousOptions []*fleet.UnitOption
+	Client          clients.Fleet
+	Registrar       *Registrar
+	RolledBack      bool
+}
+
+// Handle rolls back the deploy the first time it is called.
+func (r *Rollbacker) Handle(event *poller.Event) {
+	if r.RolledBack {
+		return
+	}
+	r.RolledBack = true
+
+	log.Printf("Rolling back %s:%s due to %s.\n", r.Deploy.ServiceName, r.Deploy.Version, event.ServiceInstance.FleetUnitName())
+	r.destroyNewInstances()
+	if r.Deploy.DestroyPrevious && r.Deploy.PreviousVersion != nil {
+		r.relaunchPreviousInstances()
+	}
+	return
+}
+
+// destroyNewInstances destroys every instance of the deploy being rolled back.
+func (r *Rollbacker) destroyNewInstances() {
+	for i := 1; i <= r.Deploy.InstanceCount; i++ {
+		instance := r.Deploy.ServiceInstance(strconv.Itoa(i))
+		if r.Registrar != nil {
+			r.Registrar.Deregister(instance, r.Deploy.Global)
+		}
+		log.Printf("Destroying %s due to rollback.\n", instance.FleetUnitName())
+		err := r.Client.DestroyUnit(instance.FleetUnitName())
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// relaunchPreviousInstances creates and launches any instances of the previous
+// version that no longer exist in Fleet.
+func (r *Rollbacker) relaunchPreviousInstances() {
+	allUnits, err := r.Client.Units()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	existing := make(map[string]bool)
+	for _, u := range allUnits {
+		existing[u.Name] = true
+	}
+
+	previous := r.Deploy.PreviousVersion
+	for i := 1; i <= previous.InstanceCount; i++ {
+		instance := previous.ServiceInstance(strconv.Itoa(i))
+		if existing[instance.FleetUnitName()] {
+			continue
+		}
+
+		log.Printf("Relaunching %s due to rollback.\n", instance.FleetUnitName())
+		err := r.Client.CreateUnit(&fleet.Unit{Name: instance.FleetUnitName(), Options: r.PreviousOptions})
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		err = r.Client.SetUnitTargetState(instance.FleetUnitName(), "launched")
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/bmorton/deployster/clients/mocks"
+	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/schema"
+	fleet "github.com/coreos/fleet/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RollbackerTestSuite struct {
+	suite.Suite
+	Subject         *Rollbacker
+	FleetMock       *mocks.Fleet
+	PreviousOptions []*fleet.UnitOption
+}
+
+func (suite *RollbackerTestSuite) SetupTest() {
+	suite.FleetMock = new(mocks.Fleet)
+	suite.PreviousOptions = []*fleet.UnitOption{&fleet.UnitOption{Section: "Service", Name: "ExecStart", Value: "/usr/bin/docker run mmmhm/railsapp:old"}}
+	suite.Subject = &Rollbacker{
+		Deploy: &schema.Deploy{
+			ServiceName:     "railsapp",
+			Version:         "new",
+			Timestamp:       "2007.01.02-15.04.05",
+			InstanceCount:   2,
+			DestroyPrevious: true,
+			PreviousVersion: &schema.Deploy{ServiceName: "railsapp", Version: "old", Timestamp: "2006.01.02-15.04.05", InstanceCount: 2},
+		},
+		PreviousOptions: suite.PreviousOptions,
+		Client:          suite.FleetMock,
+	}
+}
+
+func (suite *RollbackerTestSuite) TestDestroysNewAndRelaunchesDestroyedPreviousInstances() {
+	suite.FleetMock.On("DestroyUnit", "railsapp:new:2007.01.02-15.04.05@1.service").Return(nil).Times(1)
+	suite.FleetMock.On("DestroyUnit", "railsapp:new:2007.01.02-15.04.05@2.service").Return(nil).Times(1)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{Name: "railsapp:old:2006.01.02-15.04.05@2.service"},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", &fleet.Unit{Name: "railsapp:old:2006.01.02-15.04.05@1.service", Options: suite.PreviousOptions}).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "railsapp:old:2006.01.02-15.04.05@1.service", "launched").Return(nil).Times(1)
+
+	suite.Subject.Handle(suite.event("2"))
+
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	assert.True(suite.T(), suite.Subject.RolledBack)
+}
+
+func (suite *RollbackerTestSuite) TestOnlyRollsBackOnce() {
+	suite.FleetMock.On("DestroyUnit", "railsapp:new:2007.01.02-15.04.05@1.service").Return(nil).Times(1)
+	suite.FleetMock.On("DestroyUnit", "railsapp:new:2007.01.02-15.04.05@2.service").Return(nil).Times(1)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{Name: "railsapp:old:2006.01.02-15.04.05@1.service"},
+		&fleet.Unit{Name: "railsapp:old:2006.01.02-15.04.05@2.service"},
+	}, nil).Times(1)
+
+	suite.Subject.Handle(suite.event("1"))
+	suite.Subject.Handle(suite.event("2"))
+
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *RollbackerTestSuite) TestWithoutDestroyPreviousOnlyDestroysNewInstances() {
+	suite.Subject.Deploy.DestroyPrevious = false
+	suite.FleetMock.On("DestroyUnit", "railsapp:new:2007.01.02-15.04.05@1.service").Return(nil).Times(1)
+	suite.FleetMock.On("DestroyUnit", "railsapp:new:2007.01.02-15.04.05@2.service").Return(nil).Times(1)
+
+	suite.Subject.Handle(suite.event("1"))
+
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "Units")
+}
+
+func (suite *RollbackerTestSuite) TestDeregistersNewInstances() {
+	suite.Subject.Deploy.DestroyPrevious = false
+	balancer := new(mocks.LoadBalancer)
+	suite.Subject.Registrar = &Registrar{Balancer: balancer, Fleet: suite.FleetMock}
+	balancer.On("Deregister", "railsapp", "railsapp-new-2007.01.02-15.04.05-1").Return(nil).Times(1)
+	balancer.On("Deregister", "railsapp", "railsapp-new-2007.01.02-15.04.05-2").Return(nil).Times(1)
+	suite.FleetMock.On("DestroyUnit", "railsapp:new:2007.01.02-15.04.05@1.service").Return(nil)
+	suite.FleetMock.On("DestroyUnit", "railsapp:new:2007.01.02-15.04.05@2.service").Return(nil)
+
+	suite.Subject.Handle(suite.event("1"))
+
+	balancer.AssertExpectations(suite.T())
+}
+
+func (suite *RollbackerTestSuite) event(instance string) *poller.Event {
+	return &poller.Event{ServiceInstance: suite.Subject.Deploy.ServiceInstance(instance), SystemdSubState: "failed"}
+}
+
+func TestRollbackerTestSuite(t *testing.T) {
+	suite.Run(t, new(RollbackerTestSuite))
+}
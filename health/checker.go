@@ -0,0 +1,144 @@
+package health
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/schema"
+)
+
+const (
+	// defaultExpectedStatus is the status code a health check must respond
+	// with when the deploy doesn't specify one.
+	defaultExpectedStatus int = http.StatusOK
+
+	// defaultInterval is the minimum amount of time between health checks of
+	// an instance when the deploy doesn't specify one.
+	defaultInterval time.Duration = 1 * time.Second
+
+	// defaultThreshold is the number of consecutive healthy responses needed
+	// when the deploy doesn't specify one.
+	defaultThreshold int = 1
+
+	// requestTimeout is the amount of time to wait for an instance to respond
+	// to a health check before considering it unhealthy.
+	requestTimeout time.Duration = 5 * time.Second
+)
+
+// Checker is a poller.Checker that only considers a running instance ready
+// once it has passed its HTTP health check enough times in a row.  The address
+// that each instance's container Port is published on is found using the
+// Resolver.
+type Checker struct {
+	Check     *schema.HealthCheck
+	Port      int
+	Resolver  Resolver
+	Client    *http.Client
+	passes    map[string]int
+	failures  map[string]int
+	checkedAt map[string]time.Time
+}
+
+// NewChecker returns a Checker for the given health check definition that
+// checks the default container port.
+func NewChecker(check *schema.HealthCheck, resolver Resolver) *Checker {
+	return &Checker{
+		Check:     check,
+		Port:      schema.DefaultPort,
+		Resolver:  resolver,
+		Client:    &http.Client{Timeout: requestTimeout},
+		passes:    make(map[string]int),
+		failures:  make(map[string]int),
+		checkedAt: make(map[string]time.Time),
+	}
+}
+
+// Ready returns true once the instance has passed the threshold of consecutive
+// health checks.  An instance is checked at most once per interval, so polls in
+// between only report whether the threshold has already been reached.  Checks
+// are counted per machine so that the instance of a global deploy is checked on
+// every machine it runs on.
+func (c *Checker) Ready(event *poller.Event) bool {
+	name := checkKey(event)
+	if c.passes[name] >= c.threshold() {
+		return true
+	}
+	if time.Since(c.checkedAt[name]) < c.interval() {
+		return false
+	}
+
+	c.checkedAt[name] = time.Now()
+	if c.healthy(event) {
+		c.passes[name]++
+	} else {
+		c.passes[name] = 0
+	}
+
+	return c.passes[name] >= c.threshold()
+}
+
+// Unhealthy makes a health check of the instance on the event's machine and
+// returns true once it has failed the threshold of consecutive checks.  It's
+// used to keep checking instances after they've come online, so that a single
+// failed check doesn't take an instance down.
+func (c *Checker) Unhealthy(event *poller.Event) bool {
+	name := checkKey(event)
+	if c.healthy(event) {
+		c.failures[name] = 0
+	} else {
+		c.failures[name]++
+	}
+	return c.failures[name] >= c.threshold()
+}
+
+// checkKey returns the key that checks of the event's instance on its machine
+// are counted under.
+func checkKey(event *poller.Event) string {
+	return event.ServiceInstance.FleetUnitName() + "/" + event.MachineID
+}
+
+// healthy makes a single health check request to the instance.
+func (c *Checker) healthy(event *poller.Event) bool {
+	address, err := c.Resolver.Resolve(event.ServiceInstance, event.MachineID, c.Port)
+	if err != nil {
+		log.Printf("Unable to resolve %s for health check: %s\n", event.ServiceInstance.FleetUnitName(), err)
+		return false
+	}
+
+	resp, err := c.Client.Get("http://" + address + c.Check.Path)
+	if err != nil {
+		log.Printf("Health check of %s failed: %s\n", event.ServiceInstance.FleetUnitName(), err)
+		return false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != c.expectedStatus() {
+		log.Printf("Health check of %s returned %d, expected %d.\n", event.ServiceInstance.FleetUnitName(), resp.StatusCode, c.expectedStatus())
+		return false
+	}
+
+	return true
+}
+
+func (c *Checker) expectedStatus() int {
+	if c.Check.ExpectedStatus != 0 {
+		return c.Check.ExpectedStatus
+	}
+	return defaultExpectedStatus
+}
+
+func (c *Checker) interval() time.Duration {
+	if c.Check.Interval > 0 {
+		return time.Duration(c.Check.Interval) * time.Second
+	}
+	return defaultInterval
+}
+
+func (c *Checker) threshold() int {
+	if c.Check.Threshold > 0 {
+		return c.Check.Threshold
+	}
+	return defaultThreshold
+}
@@ -0,0 +1,139 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type fakeResolver struct {
+	address string
+	port    int
+	err     error
+}
+
+func (f *fakeResolver) Resolve(instance *schema.ServiceInstance, machineID string, port int) (string, error) {
+	f.port = port
+	return f.address, f.err
+}
+
+type CheckerTestSuite struct {
+	suite.Suite
+	Server   *httptest.Server
+	Status   int
+	Requests []string
+	Resolver *fakeResolver
+	Event    *poller.Event
+}
+
+func (suite *CheckerTestSuite) SetupTest() {
+	suite.Status = http.StatusOK
+	suite.Requests = nil
+	suite.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.Requests = append(suite.Requests, r.URL.Path)
+		w.WriteHeader(suite.Status)
+	}))
+	suite.Resolver = &fakeResolver{address: strings.TrimPrefix(suite.Server.URL, "http://")}
+	deploy := &schema.Deploy{ServiceName: "railsapp", Version: "new", Timestamp: "2006.01.02-15.04.05", InstanceCount: 1}
+	suite.Event = &poller.Event{ServiceInstance: deploy.ServiceInstance("1"), SystemdSubState: "running", MachineID: "abc"}
+}
+
+func (suite *CheckerTestSuite) TearDownTest() {
+	suite.Server.Close()
+}
+
+func (suite *CheckerTestSuite) TestReadyWhenHealthy() {
+	checker := NewChecker(&schema.HealthCheck{Path: "/health"}, suite.Resolver)
+
+	assert.True(suite.T(), checker.Ready(suite.Event))
+	assert.Equal(suite.T(), []string{"/health"}, suite.Requests)
+	assert.Equal(suite.T(), 3000, suite.Resolver.port)
+}
+
+func (suite *CheckerTestSuite) TestResolvesConfiguredPort() {
+	checker := NewChecker(&schema.HealthCheck{Path: "/health"}, suite.Resolver)
+	checker.Port = 8080
+
+	assert.True(suite.T(), checker.Ready(suite.Event))
+	assert.Equal(suite.T(), 8080, suite.Resolver.port)
+}
+
+func (suite *CheckerTestSuite) TestNotReadyWithUnexpectedStatus() {
+	suite.Status = http.StatusServiceUnavailable
+	checker := NewChecker(&schema.HealthCheck{Path: "/health"}, suite.Resolver)
+
+	assert.False(suite.T(), checker.Ready(suite.Event))
+}
+
+func (suite *CheckerTestSuite) TestReadyWithExpectedStatus() {
+	suite.Status = http.StatusNoContent
+	checker := NewChecker(&schema.HealthCheck{Path: "/health", ExpectedStatus: http.StatusNoContent}, suite.Resolver)
+
+	assert.True(suite.T(), checker.Ready(suite.Event))
+}
+
+func (suite *CheckerTestSuite) TestNotReadyWhenUnresolved() {
+	suite.Resolver.err = errors.New("Machine abc was not found.")
+	checker := NewChecker(&schema.HealthCheck{Path: "/health"}, suite.Resolver)
+
+	assert.False(suite.T(), checker.Ready(suite.Event))
+	assert.Empty(suite.T(), suite.Requests)
+}
+
+func (suite *CheckerTestSuite) TestRequiresThresholdOfConsecutivePasses() {
+	checker := NewChecker(&schema.HealthCheck{Path: "/health", Threshold: 2}, suite.Resolver)
+
+	assert.False(suite.T(), checker.Ready(suite.Event))
+	checker.checkedAt[checkKey(suite.Event)] = checker.checkedAt[checkKey(suite.Event)].Add(-defaultInterval)
+	assert.True(suite.T(), checker.Ready(suite.Event))
+	assert.Len(suite.T(), suite.Requests, 2)
+}
+
+func (suite *CheckerTestSuite) TestNegativeThresholdFallsBackToDefault() {
+	suite.Status = http.StatusServiceUnavailable
+	checker := NewChecker(&schema.HealthCheck{Path: "/health", Threshold: -1, Interval: -1}, suite.Resolver)
+
+	assert.False(suite.T(), checker.Ready(suite.Event))
+	assert.Equal(suite.T(), defaultInterval, checker.interval())
+	assert.Equal(suite.T(), defaultThreshold, checker.threshold())
+}
+
+func (suite *CheckerTestSuite) TestOnlyChecksOncePerInterval() {
+	checker := NewChecker(&schema.HealthCheck{Path: "/health", Threshold: 2, Interval: 60}, suite.Resolver)
+
+	assert.False(suite.T(), checker.Ready(suite.Event))
+	assert.False(suite.T(), checker.Ready(suite.Event))
+	assert.Len(suite.T(), suite.Requests, 1)
+}
+
+func (suite *CheckerTestSuite) TestCountsPassesPerMachine() {
+	checker := NewChecker(&schema.HealthCheck{Path: "/health", Threshold: 2, Interval: 60}, suite.Resolver)
+	other := &poller.Event{ServiceInstance: suite.Event.ServiceInstance, SystemdSubState: "running", MachineID: "def"}
+
+	assert.False(suite.T(), checker.Ready(suite.Event))
+	assert.False(suite.T(), checker.Ready(other))
+	assert.Len(suite.T(), suite.Requests, 2)
+}
+
+func (suite *CheckerTestSuite) TestUnhealthyAfterThresholdOfConsecutiveFailures() {
+	checker := NewChecker(&schema.HealthCheck{Path: "/health", Threshold: 2}, suite.Resolver)
+
+	suite.Status = http.StatusServiceUnavailable
+	assert.False(suite.T(), checker.Unhealthy(suite.Event))
+	suite.Status = http.StatusOK
+	assert.False(suite.T(), checker.Unhealthy(suite.Event))
+	suite.Status = http.StatusServiceUnavailable
+	assert.False(suite.T(), checker.Unhealthy(suite.Event))
+	assert.True(suite.T(), checker.Unhealthy(suite.Event))
+}
+
+func TestCheckerTestSuite(t *testing.T) {
+	suite.Run(t, new(CheckerTestSuite))
+}
@@ -0,0 +1,120 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bmorton/deployster/clients"
+	"github.com/bmorton/deployster/schema"
+	"github.com/fsouza/go-dockerclient"
+)
+
+// DefaultDockerPort is the port that the Docker API of each machine in the
+// cluster listens on unless it's configured otherwise.
+const DefaultDockerPort = 2375
+
+// Resolver finds the host:port address that an instance's container port is
+// published on.
+type Resolver interface {
+	Resolve(instance *schema.ServiceInstance, machineID string, port int) (string, error)
+}
+
+// DockerAPI describes how the Docker API of each machine in the cluster is
+// reached.  A Port of zero uses DefaultDockerPort.  When CertPath and KeyPath
+// are set, the API is reached over TLS with that client certificate and key,
+// verifying the API's certificate against the CA at CAPath.
+type DockerAPI struct {
+	Port     int
+	CertPath string
+	KeyPath  string
+	CAPath   string
+}
+
+// Endpoint returns the address of the Docker API on the machine with the
+// given IP.
+func (a *DockerAPI) Endpoint(ip string) string {
+	port := a.Port
+	if port == 0 {
+		port = DefaultDockerPort
+	}
+	return fmt.Sprintf("tcp://%s:%d", ip, port)
+}
+
+// NewClient connects to the Docker API at the endpoint, over TLS if a client
+// certificate and key are configured.
+func (a *DockerAPI) NewClient(endpoint string) (clients.Docker, error) {
+	if a.CertPath != "" && a.KeyPath != "" {
+		return docker.NewTLSClient(endpoint, a.CertPath, a.KeyPath, a.CAPath)
+	}
+	return docker.NewClient(endpoint)
+}
+
+// DockerResolver resolves an instance's address the same way the unit
+// template's ExecStartPost does: the IP of the machine the instance is running
+// on combined with the host port that Docker published for the container's
+// port.  Machine IPs are looked up in Fleet and published ports are
+// looked up using the Docker API of that machine.
+type DockerResolver struct {
+	Fleet     clients.Fleet
+	API       *DockerAPI
+	NewDocker func(endpoint string) (clients.Docker, error)
+}
+
+// NewDockerResolver returns a DockerResolver that reaches the Docker API of
+// each machine as described by api, or on DefaultDockerPort without TLS if api
+// is nil.
+func NewDockerResolver(fleetClient clients.Fleet, api *DockerAPI) *DockerResolver {
+	if api == nil {
+		api = &DockerAPI{}
+	}
+	return &DockerResolver{
+		Fleet:     fleetClient,
+		API:       api,
+		NewDocker: api.NewClient,
+	}
+}
+
+// Resolve returns the host:port address that the container port of the
+// instance running on the given Fleet machine is published on.
+func (r *DockerResolver) Resolve(instance *schema.ServiceInstance, machineID string, port int) (string, error) {
+	ip, err := r.machineIP(machineID)
+	if err != nil {
+		return "", err
+	}
+
+	dockerClient, err := r.NewDocker(r.API.Endpoint(ip))
+	if err != nil {
+		return "", err
+	}
+
+	container, err := dockerClient.InspectContainer(instance.ContainerName())
+	if err != nil {
+		return "", err
+	}
+	containerPort := docker.Port(fmt.Sprintf("%d/tcp", port))
+	if container.NetworkSettings == nil || len(container.NetworkSettings.Ports[containerPort]) == 0 {
+		return "", fmt.Errorf("Container %s has not published port %s.", instance.ContainerName(), containerPort)
+	}
+
+	return fmt.Sprintf("%s:%s", ip, container.NetworkSettings.Ports[containerPort][0].HostPort), nil
+}
+
+// machineIP returns the IP that Fleet has for the given machine.
+func (r *DockerResolver) machineIP(machineID string) (string, error) {
+	if machineID == "" {
+		return "", errors.New("Instance has not been scheduled to a machine.")
+	}
+
+	machines, err := r.Fleet.Machines()
+	if err != nil {
+		return "", err
+	}
+
+	for _, m := range machines {
+		if m.ID == machineID {
+			return m.PublicIP, nil
+		}
+	}
+
+	return "", fmt.Errorf("Machine %s was not found.", machineID)
+}
@@ -0,0 +1,100 @@
+package health
+
+import (
+	"testing"
+
+	"github.com/bmorton/deployster/clients"
+	"github.com/bmorton/deployster/clients/mocks"
+	"github.com/bmorton/deployster/schema"
+	"github.com/coreos/fleet/machine"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DockerResolverTestSuite struct {
+	suite.Suite
+	Subject    *DockerResolver
+	FleetMock  *mocks.Fleet
+	DockerMock *mocks.Docker
+	Endpoint   string
+	Instance   *schema.ServiceInstance
+}
+
+func (suite *DockerResolverTestSuite) SetupTest() {
+	suite.FleetMock = new(mocks.Fleet)
+	suite.DockerMock = new(mocks.Docker)
+	suite.Subject = NewDockerResolver(suite.FleetMock, nil)
+	suite.Subject.NewDocker = func(endpoint string) (clients.Docker, error) {
+		suite.Endpoint = endpoint
+		return suite.DockerMock, nil
+	}
+	suite.Instance = &schema.ServiceInstance{Name: "railsapp", Version: "new", Timestamp: "2006.01.02-15.04.05", Instance: "1"}
+	suite.FleetMock.On("Machines").Return([]machine.MachineState{
+		machine.MachineState{ID: "abc", PublicIP: "10.0.0.1"},
+		machine.MachineState{ID: "def", PublicIP: "10.0.0.2"},
+	}, nil)
+}
+
+func (suite *DockerResolverTestSuite) TestResolvesPublishedPort() {
+	suite.DockerMock.On("InspectContainer", "railsapp-new-2006.01.02-15.04.05-1").Return(&docker.Container{
+		NetworkSettings: &docker.NetworkSettings{
+			Ports: map[docker.Port][]docker.PortBinding{"3000/tcp": []docker.PortBinding{docker.PortBinding{HostIP: "0.0.0.0", HostPort: "49153"}}},
+		},
+	}, nil)
+
+	address, err := suite.Subject.Resolve(suite.Instance, "def", 3000)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "10.0.0.2:49153", address)
+	assert.Equal(suite.T(), "tcp://10.0.0.2:2375", suite.Endpoint)
+}
+
+func (suite *DockerResolverTestSuite) TestUsesConfiguredDockerAPIPort() {
+	suite.Subject.API = &DockerAPI{Port: 2376}
+	suite.DockerMock.On("InspectContainer", "railsapp-new-2006.01.02-15.04.05-1").Return(&docker.Container{
+		NetworkSettings: &docker.NetworkSettings{
+			Ports: map[docker.Port][]docker.PortBinding{"3000/tcp": []docker.PortBinding{docker.PortBinding{HostIP: "0.0.0.0", HostPort: "49153"}}},
+		},
+	}, nil)
+
+	address, err := suite.Subject.Resolve(suite.Instance, "abc", 3000)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "10.0.0.1:49153", address)
+	assert.Equal(suite.T(), "tcp://10.0.0.1:2376", suite.Endpoint)
+}
+
+func (suite *DockerResolverTestSuite) TestResolvesConfiguredPort() {
+	suite.DockerMock.On("InspectContainer", "railsapp-new-2006.01.02-15.04.05-1").Return(&docker.Container{
+		NetworkSettings: &docker.NetworkSettings{
+			Ports: map[docker.Port][]docker.PortBinding{
+				"3000/tcp": []docker.PortBinding{docker.PortBinding{HostIP: "0.0.0.0", HostPort: "49153"}},
+				"8080/tcp": []docker.PortBinding{docker.PortBinding{HostIP: "0.0.0.0", HostPort: "49154"}},
+			},
+		},
+	}, nil)
+
+	address, err := suite.Subject.Resolve(suite.Instance, "def", 8080)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "10.0.0.2:49154", address)
+}
+
+func (suite *DockerResolverTestSuite) TestUnknownMachine() {
+	_, err := suite.Subject.Resolve(suite.Instance, "xyz", 3000)
+
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *DockerResolverTestSuite) TestUnpublishedPort() {
+	suite.DockerMock.On("InspectContainer", "railsapp-new-2006.01.02-15.04.05-1").Return(&docker.Container{}, nil)
+
+	_, err := suite.Subject.Resolve(suite.Instance, "abc", 3000)
+
+	assert.NotNil(suite.T(), err)
+}
+
+func TestDockerResolverTestSuite(t *testing.T) {
+	suite.Run(t, new(DockerResolverTestSuite))
+}
@@ -0,0 +1,90 @@
+package lock
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLocked is returned when a service's lock is already held by another
+	// deploy.
+	ErrLocked = errors.New("Another deploy of this service is already in progress.")
+
+	// ErrNotLocked is returned when a service's lock isn't held.
+	ErrNotLocked = errors.New("Service is not locked.")
+)
+
+// Lock is held by a deploy for as long as it's running so that other deploys of
+// the same service can't be started at the same time.
+type Lock struct {
+	ServiceName string    `json:"service_name"`
+	DeployID    string    `json:"deploy_id"`
+	AcquiredAt  time.Time `json:"acquired_at"`
+}
+
+// Manager keeps track of the lock held for each service.  Locks only live in
+// memory, so they're released if deployster restarts.
+type Manager struct {
+	mutex sync.Mutex
+	locks map[string]*Lock
+}
+
+// NewManager returns a Manager with no locks held.
+func NewManager() *Manager {
+	return &Manager{locks: make(map[string]*Lock)}
+}
+
+// Acquire takes the service's lock on behalf of the deploy.  Acquiring a lock
+// that the deploy already holds succeeds, but ErrLocked is returned if it's
+// held by any other deploy.
+func (m *Manager) Acquire(serviceName string, deployID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if held, ok := m.locks[serviceName]; ok && held.DeployID != deployID {
+		return ErrLocked
+	}
+	if _, ok := m.locks[serviceName]; !ok {
+		m.locks[serviceName] = &Lock{ServiceName: serviceName, DeployID: deployID, AcquiredAt: time.Now().UTC()}
+	}
+	return nil
+}
+
+// Release gives up the service's lock if it's held by the deploy.  A deploy
+// whose lock has been forcefully released won't release a lock that another
+// deploy has since acquired.
+func (m *Manager) Release(serviceName string, deployID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if held, ok := m.locks[serviceName]; ok && held.DeployID == deployID {
+		delete(m.locks, serviceName)
+	}
+}
+
+// ForceRelease gives up the service's lock regardless of which deploy holds
+// it.  ErrNotLocked is returned if the lock isn't held.
+func (m *Manager) ForceRelease(serviceName string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.locks[serviceName]; !ok {
+		return ErrNotLocked
+	}
+	delete(m.locks, serviceName)
+	return nil
+}
+
+// Find returns a copy of the service's lock or ErrNotLocked if it isn't held.
+func (m *Manager) Find(serviceName string) (*Lock, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	held, ok := m.locks[serviceName]
+	if !ok {
+		return nil, ErrNotLocked
+	}
+	found := *held
+	return &found, nil
+}
@@ -0,0 +1,86 @@
+package lock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ManagerTestSuite struct {
+	suite.Suite
+	Subject *Manager
+}
+
+func (suite *ManagerTestSuite) SetupTest() {
+	suite.Subject = NewManager()
+}
+
+func (suite *ManagerTestSuite) TestAcquire() {
+	err := suite.Subject.Acquire("railsapp", "d3adb33f")
+
+	assert.Nil(suite.T(), err)
+	held, _ := suite.Subject.Find("railsapp")
+	assert.Equal(suite.T(), "railsapp", held.ServiceName)
+	assert.Equal(suite.T(), "d3adb33f", held.DeployID)
+	assert.False(suite.T(), held.AcquiredAt.IsZero())
+}
+
+func (suite *ManagerTestSuite) TestAcquireWhenHeldByAnotherDeploy() {
+	suite.Subject.Acquire("railsapp", "d3adb33f")
+
+	err := suite.Subject.Acquire("railsapp", "f00dcafe")
+
+	assert.Equal(suite.T(), ErrLocked, err)
+}
+
+func (suite *ManagerTestSuite) TestAcquireWhenHeldBySameDeploy() {
+	suite.Subject.Acquire("railsapp", "d3adb33f")
+
+	err := suite.Subject.Acquire("railsapp", "d3adb33f")
+
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *ManagerTestSuite) TestLocksAreScopedToServices() {
+	suite.Subject.Acquire("railsapp", "d3adb33f")
+
+	err := suite.Subject.Acquire("carousel", "f00dcafe")
+
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *ManagerTestSuite) TestRelease() {
+	suite.Subject.Acquire("railsapp", "d3adb33f")
+	suite.Subject.Release("railsapp", "d3adb33f")
+
+	_, err := suite.Subject.Find("railsapp")
+	assert.Equal(suite.T(), ErrNotLocked, err)
+}
+
+func (suite *ManagerTestSuite) TestReleaseIgnoresOtherDeploys() {
+	suite.Subject.Acquire("railsapp", "d3adb33f")
+	suite.Subject.Release("railsapp", "f00dcafe")
+
+	held, _ := suite.Subject.Find("railsapp")
+	assert.Equal(suite.T(), "d3adb33f", held.DeployID)
+}
+
+func (suite *ManagerTestSuite) TestForceRelease() {
+	suite.Subject.Acquire("railsapp", "d3adb33f")
+
+	err := suite.Subject.ForceRelease("railsapp")
+
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), suite.Subject.Acquire("railsapp", "f00dcafe"))
+}
+
+func (suite *ManagerTestSuite) TestForceReleaseWhenNotLocked() {
+	err := suite.Subject.ForceRelease("railsapp")
+
+	assert.Equal(suite.T(), ErrNotLocked, err)
+}
+
+func TestManagerTestSuite(t *testing.T) {
+	suite.Run(t, new(ManagerTestSuite))
+}
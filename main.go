@@ -2,11 +2,22 @@ package main
 
 import (
 	"flag"
-	"github.com/bmorton/deployster/server"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+
+	"github.com/bmorton/deployster/balancers"
+	"github.com/bmorton/deployster/health"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/server"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
+	"github.com/bmorton/deployster/upstreams"
+	"github.com/bmorton/deployster/vulcand"
+	"github.com/bmorton/deployster/webhooks"
 )
 
 // A version string that can be set at compile time with:
@@ -21,6 +32,22 @@ var username string
 var password string
 var certPath string
 var keyPath string
+var dataDir string
+var templateDir string
+var secretDir string
+var settingsDir string
+var etcdURL string
+var loadBalancer string
+var nginxDir string
+var nginxReload string
+var haproxyDir string
+var haproxyReload string
+var webhookURL string
+var webhookSecret string
+var dockerAPIPort int
+var dockerAPICert string
+var dockerAPIKey string
+var dockerAPICA string
 
 func init() {
 	flag.StringVar(&listen, "listen", "0.0.0.0:3000", "Specifies the IP and port that the HTTP server will listen on")
@@ -30,6 +57,22 @@ func init() {
 	flag.StringVar(&password, "password", "mmmhm", "Password that will be used to authenticate with Deployster via HTTP basic auth")
 	flag.StringVar(&certPath, "cert", "", "Path to certificate to be used for serving HTTPS")
 	flag.StringVar(&keyPath, "key", "", "Path to private key to be used for serving HTTPS")
+	flag.StringVar(&dataDir, "data-dir", "/var/lib/deployster", "Directory where the history of deploys is persisted (if blank, history is only kept in memory)")
+	flag.StringVar(&templateDir, "template-dir", "/var/lib/deployster/templates", "Directory where unit templates are loaded from and persisted (if blank, templates are only kept in memory)")
+	flag.StringVar(&secretDir, "secret-dir", "/var/lib/deployster/secrets", "Directory where the secrets referenced by deploys and tasks are read from, one file per secret (if blank, secrets can't be referenced)")
+	flag.StringVar(&settingsDir, "settings-dir", "/var/lib/deployster/settings", "Directory where the settings of each service are loaded from and persisted (if blank, settings are only kept in memory)")
+	flag.StringVar(&etcdURL, "etcd-url", "", "URL of the etcd HTTP API that deployster registers the endpoints of instances with for vulcand once they're online (if blank, unit templates register endpoints themselves)")
+	flag.StringVar(&loadBalancer, "load-balancer", "vulcand", "The load balancer that instances are registered with unless their service's settings pick another (vulcand, nginx, or haproxy)")
+	flag.StringVar(&nginxDir, "nginx-dir", "", "Directory where an nginx upstream config is written for each service that uses nginx (if blank, nginx can't be used)")
+	flag.StringVar(&nginxReload, "nginx-reload", "nginx -s reload", "Command that's run to reload nginx after its upstream configs change")
+	flag.StringVar(&haproxyDir, "haproxy-dir", "", "Directory where an HAProxy backend config is written for each service that uses HAProxy (if blank, HAProxy can't be used)")
+	flag.StringVar(&haproxyReload, "haproxy-reload", "", "Command that's run to reload HAProxy after its backend configs change")
+	flag.StringVar(&webhookURL, "webhook-url", "", "URL of a global webhook that's notified of every deploy and task event of every service (if blank, only the webhooks in service settings are notified)")
+	flag.StringVar(&webhookSecret, "webhook-secret", "", "Name of the secret that payloads sent to the global webhook are signed with (if blank, payloads aren't signed)")
+	flag.IntVar(&dockerAPIPort, "docker-api-port", health.DefaultDockerPort, "Port that the Docker API of each machine listens on, used to find the ports that instances are published on")
+	flag.StringVar(&dockerAPICert, "docker-api-cert", "", "Path to the client certificate used to reach the Docker API of each machine over TLS (if blank, TLS isn't used)")
+	flag.StringVar(&dockerAPIKey, "docker-api-key", "", "Path to the private key of the client certificate used to reach the Docker API of each machine over TLS")
+	flag.StringVar(&dockerAPICA, "docker-api-ca", "", "Path to the CA certificate that the Docker API of each machine is verified against when using TLS")
 	flag.Parse()
 }
 
@@ -42,8 +85,92 @@ func main() {
 		log.Printf("Starting deployster on %s using the public Docker Hub registry with user %s...\n", listen, dockerHubUsername)
 		imagePrefix = dockerHubUsername
 	}
-	service := server.NewDeploysterService(listen, AppVersion, username, password, imagePrefix)
 
+	var deployStore store.Store
+	if dataDir != "" {
+		fileStore, err := store.NewFileStore(dataDir)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		deployStore = fileStore
+	} else {
+		log.Println("No data directory provided, deploy history will not survive restarts.")
+		deployStore = store.NewMemoryStore()
+	}
+	if templateDir == "" {
+		log.Println("No template directory provided, registered templates will not survive restarts.")
+	}
+	unitTemplates, err := templates.NewRegistry(templateDir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if settingsDir == "" {
+		log.Println("No settings directory provided, service settings will not survive restarts.")
+	}
+	serviceSettings, err := settings.NewRegistry(settingsDir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var secretProvider secrets.Provider
+	if secretDir != "" {
+		fileProvider, err := secrets.NewFileProvider(secretDir)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		secretProvider = fileProvider
+	} else {
+		log.Println("No secret directory provided, deploys and tasks can't reference secrets.")
+		secretProvider = secrets.NewMemoryProvider(nil)
+	}
+
+	err = settings.Validate(&schema.ServiceSettings{LoadBalancer: loadBalancer})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	serviceBalancers := balancers.NewRegistry(serviceSettings, loadBalancer)
+	if etcdURL != "" {
+		log.Printf("Registering endpoints with vulcand through etcd at %s.\n", etcdURL)
+		serviceBalancers.Add(schema.LoadBalancerVulcand, vulcand.NewClient(etcdURL))
+	}
+	if nginxDir != "" {
+		log.Printf("Writing nginx upstreams to %s.\n", nginxDir)
+		writer, err := upstreams.NewNginxWriter(nginxDir, nginxReload)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		serviceBalancers.Add(schema.LoadBalancerNginx, writer)
+	}
+	if haproxyDir != "" {
+		log.Printf("Writing HAProxy backends to %s.\n", haproxyDir)
+		writer, err := upstreams.NewHAProxyWriter(haproxyDir, haproxyReload)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		serviceBalancers.Add(schema.LoadBalancerHAProxy, writer)
+	}
+
+	var globalWebhooks []*schema.Webhook
+	if webhookURL != "" {
+		hook := &schema.Webhook{URL: webhookURL, Secret: webhookSecret}
+		err = settings.ValidateWebhook(hook)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("Notifying the webhook at %s of every deploy and task event.\n", webhookURL)
+		globalWebhooks = append(globalWebhooks, hook)
+	}
+	dispatcher := webhooks.NewDispatcher(globalWebhooks, serviceSettings, secretProvider)
+
+	if (dockerAPICert == "") != (dockerAPIKey == "") {
+		log.Fatalln("Both -docker-api-cert and -docker-api-key are needed to reach the Docker API over TLS.")
+	}
+	dockerAPI := &health.DockerAPI{Port: dockerAPIPort, CertPath: dockerAPICert, KeyPath: dockerAPIKey, CAPath: dockerAPICA}
+
+	service := server.NewDeploysterService(listen, AppVersion, username, password, imagePrefix, deployStore, unitTemplates, serviceSettings, secretProvider, serviceBalancers, dispatcher, dockerAPI)
+
+	service.Start()
 	go func() {
 		var err error
 		if certPath != "" && keyPath != "" {
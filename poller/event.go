@@ -5,11 +5,19 @@ import (
 	fleet "github.com/coreos/fleet/schema"
 )
 
+// Event is passed to handlers for a state seen for a single instance.  Events
+// passed to completion handlers have no ServiceInstance or state and instead
+// carry the Summary of the whole deploy.  For global deploys, Machines holds
+// the state of the instance on every machine it's expected to run on, and the
+// event's own state is that of the machine furthest from running.
 type Event struct {
 	ServiceInstance    *schema.ServiceInstance
 	SystemdActiveState string
 	SystemdLoadState   string
 	SystemdSubState    string
+	MachineID          string
+	Machines           []*Event
+	Summary            *Summary
 }
 
 func NewEvent(instance *schema.ServiceInstance, unitState *fleet.UnitState) *Event {
@@ -18,5 +26,6 @@ func NewEvent(instance *schema.ServiceInstance, unitState *fleet.UnitState) *Eve
 		SystemdActiveState: unitState.SystemdActiveState,
 		SystemdLoadState:   unitState.SystemdLoadState,
 		SystemdSubState:    unitState.SystemdSubState,
+		MachineID:          unitState.MachineID,
 	}
 }
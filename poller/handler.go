@@ -6,6 +6,13 @@ type Handler interface {
 
 type HandlerFunc func(*Event)
 
+// Checker decides whether an instance that systemd reports as running is ready
+// to be considered a success.  Instances that aren't ready yet remain
+// unresolved and are checked again on the next poll.
+type Checker interface {
+	Ready(*Event) bool
+}
+
 func (f HandlerFunc) Handle(e *Event) {
 	f(e)
 }
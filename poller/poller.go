@@ -1,13 +1,15 @@
 package poller
 
 import (
-	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bmorton/deployster/clients"
 	"github.com/bmorton/deployster/schema"
+	"github.com/coreos/fleet/machine"
+	fleet "github.com/coreos/fleet/schema"
 )
 
 const (
@@ -25,31 +27,51 @@ type Poller struct {
 	Deploy              *schema.Deploy
 	Timeout             time.Duration
 	Delay               time.Duration
+	Checker             Checker
 	client              clients.Fleet
+	first               int
+	last                int
 	stopChan            chan string
 	successChan         chan *Event
 	failureChan         chan *Event
 	unresolvedChan      chan *Event
 	successHandlers     []Handler
+	failureHandlers     []Handler
+	timeoutHandlers     []Handler
+	completionHandlers  []Handler
+	eventHandlers       []Handler
 	unresolvedInstances map[string]*schema.ServiceInstance
+	lastEvents          map[string]*Event
+	results             map[string]string
 }
 
 func New(deploy *schema.Deploy, client clients.Fleet) *Poller {
+	return NewBatch(deploy, client, 1, deploy.InstanceCount)
+}
+
+// NewBatch returns a poller that only watches instances first through last of
+// the deploy, which is used to roll out a deploy a batch at a time.
+func NewBatch(deploy *schema.Deploy, client clients.Fleet, first int, last int) *Poller {
 	toBeResolved := make(map[string]*schema.ServiceInstance)
-	for i := 1; i <= deploy.InstanceCount; i++ {
+	for i := first; i <= last; i++ {
 		instance := deploy.ServiceInstance(strconv.Itoa(i))
 		toBeResolved[instance.FleetUnitName()] = instance
 	}
+	size := len(toBeResolved)
 	return &Poller{
 		Deploy:              deploy,
 		Timeout:             defaultTimeout,
 		Delay:               defaultDelay,
 		stopChan:            make(chan string, 1),
-		successChan:         make(chan *Event, deploy.InstanceCount),
-		failureChan:         make(chan *Event, deploy.InstanceCount),
-		unresolvedChan:      make(chan *Event, deploy.InstanceCount),
+		successChan:         make(chan *Event, size),
+		failureChan:         make(chan *Event, size),
+		unresolvedChan:      make(chan *Event, size),
 		client:              client,
+		first:               first,
+		last:                last,
 		unresolvedInstances: toBeResolved,
+		lastEvents:          make(map[string]*Event),
+		results:             make(map[string]string),
 	}
 }
 
@@ -58,9 +80,24 @@ func (p *Poller) Watch() {
 
 	for {
 		if len(p.unresolvedInstances) == 0 {
+			p.runCompletionHandlers(OutcomeStopped)
+			return
+		}
+		// A stop request takes priority over any events that are still
+		// waiting to be handled.
+		select {
+		case msg := <-p.stopChan:
+			log.Println(msg)
+			p.runCompletionHandlers(OutcomeStopped)
 			return
+		default:
+		}
+		// Only schedule the next poll once every event from the previous poll
+		// has been handled so that instances aren't reported more than once.
+		var pollStates <-chan time.Time
+		if p.pendingEvents() == 0 {
+			pollStates = time.After(p.Delay)
 		}
-		pollStates := time.After(p.Delay)
 
 		select {
 		case <-pollStates:
@@ -68,25 +105,65 @@ func (p *Poller) Watch() {
 		case event := <-p.successChan:
 			log.Printf("%s is running.\n", event.ServiceInstance.FleetUnitName())
 			p.runSuccessHandlers(event)
-			delete(p.unresolvedInstances, event.ServiceInstance.FleetUnitName())
+			p.resolve(event, OutcomeSucceeded)
 		case event := <-p.failureChan:
 			log.Printf("%s failed to launch.\n", event.ServiceInstance.FleetUnitName())
-			delete(p.unresolvedInstances, event.ServiceInstance.FleetUnitName())
+			p.runFailureHandlers(event)
+			p.resolve(event, OutcomeFailed)
 		case event := <-p.unresolvedChan:
 			log.Printf("%s is not yet resolved (state: %s).\n", event.ServiceInstance.FleetUnitName(), event.SystemdSubState)
 		case <-timeout:
-			p.stopChan <- fmt.Sprintf("Timed out polling state of %s:%s after %s.\n", p.Deploy.ServiceName, p.Deploy.Version, p.Timeout)
+			log.Printf("Timed out polling state of %s:%s after %s.\n", p.Deploy.ServiceName, p.Deploy.Version, p.Timeout)
+			p.runTimeoutHandlers()
+			p.runCompletionHandlers(OutcomeTimedOut)
+			return
 		case msg := <-p.stopChan:
 			log.Println(msg)
+			p.runCompletionHandlers(OutcomeStopped)
 			return
 		}
 	}
 }
 
+// Stop ends watching without waiting for the remaining instances to resolve.
+// It's safe to call from a handler.
+func (p *Poller) Stop(reason string) {
+	select {
+	case p.stopChan <- reason:
+	default:
+	}
+}
+
 func (p *Poller) AddSuccessHandler(newHandler Handler) {
 	p.successHandlers = append(p.successHandlers, newHandler)
 }
 
+// AddFailureHandler registers a handler that is called when an instance
+// reaches the failed state.
+func (p *Poller) AddFailureHandler(newHandler Handler) {
+	p.failureHandlers = append(p.failureHandlers, newHandler)
+}
+
+// AddTimeoutHandler registers a handler that is called for each instance that
+// is still unresolved when the timeout is reached.  The event contains the
+// last state seen for the instance, if any.
+func (p *Poller) AddTimeoutHandler(newHandler Handler) {
+	p.timeoutHandlers = append(p.timeoutHandlers, newHandler)
+}
+
+// AddCompletionHandler registers a handler that is called once when the
+// poller stops watching, whether every instance resolved, it timed out, or it
+// was stopped.  The event's Summary contains the outcome of every instance.
+func (p *Poller) AddCompletionHandler(newHandler Handler) {
+	p.completionHandlers = append(p.completionHandlers, newHandler)
+}
+
+// AddEventHandler registers a handler that is called with every event seen
+// for an unresolved instance, regardless of its state.
+func (p *Poller) AddEventHandler(newHandler Handler) {
+	p.eventHandlers = append(p.eventHandlers, newHandler)
+}
+
 func (p *Poller) runSuccessHandlers(event *Event) {
 	for _, h := range p.successHandlers {
 		h.Handle(event)
@@ -94,6 +171,53 @@ func (p *Poller) runSuccessHandlers(event *Event) {
 	return
 }
 
+func (p *Poller) runFailureHandlers(event *Event) {
+	for _, h := range p.failureHandlers {
+		h.Handle(event)
+	}
+	return
+}
+
+func (p *Poller) runTimeoutHandlers() {
+	for name, instance := range p.unresolvedInstances {
+		event, ok := p.lastEvents[name]
+		if !ok {
+			event = &Event{ServiceInstance: instance}
+		}
+		for _, h := range p.timeoutHandlers {
+			h.Handle(event)
+		}
+	}
+	return
+}
+
+func (p *Poller) runCompletionHandlers(unresolvedResult string) {
+	event := &Event{Summary: p.summarize(unresolvedResult)}
+	for _, h := range p.completionHandlers {
+		h.Handle(event)
+	}
+	return
+}
+
+func (p *Poller) runEventHandlers(event *Event) {
+	for _, h := range p.eventHandlers {
+		h.Handle(event)
+	}
+	return
+}
+
+// resolve records the result of the event's instance so that it's no longer
+// polled.
+func (p *Poller) resolve(event *Event, result string) {
+	name := event.ServiceInstance.FleetUnitName()
+	p.results[name] = result
+	delete(p.unresolvedInstances, name)
+}
+
+func (p *Poller) pendingEvents() int {
+	return len(p.successChan) + len(p.failureChan) + len(p.unresolvedChan)
+}
+
 func (p *Poller) pollStates() {
 	log.Printf("Checking state(s) of %s:%s...\n", p.Deploy.ServiceName, p.Deploy.Version)
 	events, err := p.fetchStates()
@@ -103,9 +227,15 @@ func (p *Poller) pollStates() {
 	}
 
 	for _, event := range events {
+		p.lastEvents[event.ServiceInstance.FleetUnitName()] = event
+		p.runEventHandlers(event)
 		switch event.SystemdSubState {
 		case "running":
-			p.successChan <- event
+			if p.ready(event) {
+				p.successChan <- event
+			} else {
+				p.unresolvedChan <- event
+			}
 		case "failed":
 			p.failureChan <- event
 		default:
@@ -116,6 +246,22 @@ func (p *Poller) pollStates() {
 	return
 }
 
+// ready returns true if a running instance can be considered online.  The
+// instance of a global deploy is only ready once it's running, and passes the
+// Checker, on every machine it's expected to run on.
+func (p *Poller) ready(event *Event) bool {
+	if !p.Deploy.Global {
+		return p.Checker == nil || p.Checker.Ready(event)
+	}
+
+	for _, e := range event.Machines {
+		if e.SystemdSubState != "running" || (p.Checker != nil && !p.Checker.Ready(e)) {
+			return false
+		}
+	}
+	return len(event.Machines) > 0
+}
+
 func (p *Poller) fetchStates() ([]*Event, error) {
 	var events []*Event
 	states, err := p.client.UnitStates()
@@ -123,6 +269,10 @@ func (p *Poller) fetchStates() ([]*Event, error) {
 		return events, err
 	}
 
+	if p.Deploy.Global {
+		return p.globalEvents(states)
+	}
+
 	for _, state := range states {
 		if instance, ok := p.unresolvedInstances[state.Name]; ok {
 			events = append(events, NewEvent(instance, state))
@@ -131,3 +281,82 @@ func (p *Poller) fetchStates() ([]*Event, error) {
 
 	return events, nil
 }
+
+// globalEvents returns a single event for each unresolved instance of a global
+// deploy, which Fleet runs on every machine that matches the deploy's machine
+// metadata.  Machines that haven't reported a state for the instance yet are
+// included with an empty state.  The event takes the state of the first machine
+// where the instance failed, otherwise the first where it isn't running, so
+// that it's only running once it's running everywhere.
+func (p *Poller) globalEvents(states []*fleet.UnitState) ([]*Event, error) {
+	var events []*Event
+	machines, err := p.client.Machines()
+	if err != nil {
+		return events, err
+	}
+
+	for name, instance := range p.unresolvedInstances {
+		reported := make(map[string]*fleet.UnitState)
+		for _, state := range states {
+			if state.Name == name {
+				reported[state.MachineID] = state
+			}
+		}
+
+		var perMachine []*Event
+		for _, m := range machines {
+			if !matchesMetadata(m, p.Deploy.MachineMetadata) {
+				continue
+			}
+			if state, ok := reported[m.ID]; ok {
+				perMachine = append(perMachine, NewEvent(instance, state))
+			} else {
+				perMachine = append(perMachine, &Event{ServiceInstance: instance, MachineID: m.ID})
+			}
+		}
+
+		event := &Event{ServiceInstance: instance}
+		if len(perMachine) > 0 {
+			*event = *perMachine[0]
+		}
+		for _, e := range perMachine {
+			if e.SystemdSubState == "failed" {
+				*event = *e
+				break
+			}
+			if event.SystemdSubState == "running" && e.SystemdSubState != "running" {
+				*event = *e
+			}
+		}
+		event.Machines = perMachine
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// matchesMetadata returns true if the machine has every key of the given
+// `key=value` metadata with one of the values listed for it, which is how Fleet
+// decides where to schedule units with MachineMetadata.
+func matchesMetadata(m machine.MachineState, metadata []string) bool {
+	wanted := make(map[string][]string)
+	for _, pair := range metadata {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) == 2 {
+			wanted[parts[0]] = append(wanted[parts[0]], parts[1])
+		}
+	}
+
+	for key, values := range wanted {
+		found := false
+		for _, value := range values {
+			if m.Metadata[key] == value {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/bmorton/deployster/clients/mocks"
 	"github.com/bmorton/deployster/schema"
+	"github.com/coreos/fleet/machine"
 	fleet "github.com/coreos/fleet/schema"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -23,6 +24,12 @@ func (m *MockSuccessHandler) wasCalled() bool {
 	return m.timesCalled > 0
 }
 
+type checkerFunc func(*Event) bool
+
+func (f checkerFunc) Ready(e *Event) bool {
+	return f(e)
+}
+
 type PollerTestSuite struct {
 	suite.Suite
 	Subject   *Poller
@@ -97,6 +104,299 @@ func (suite *PollerTestSuite) TestPollsMultipleInstances() {
 	assert.Equal(suite.T(), 2, handler.timesCalled)
 }
 
+func (suite *PollerTestSuite) TestEventHandlerCalledForEveryState() {
+	handler := &MockSuccessHandler{}
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForState("launching"), nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForState("running"), nil).Times(1)
+
+	suite.Subject.AddEventHandler(handler)
+	suite.Subject.Watch()
+
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	assert.Equal(suite.T(), 2, handler.timesCalled)
+}
+
+func (suite *PollerTestSuite) TestFailureHandlerCalledWhenStateFailed() {
+	handler := &MockSuccessHandler{}
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForState("failed"), nil)
+
+	suite.Subject.AddFailureHandler(handler)
+	suite.Subject.Watch()
+
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	assert.Equal(suite.T(), 1, handler.timesCalled)
+}
+
+func (suite *PollerTestSuite) TestFailureHandlerNotCalledWhenStateRunning() {
+	handler := &MockSuccessHandler{}
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForState("running"), nil)
+
+	suite.Subject.AddFailureHandler(handler)
+	suite.Subject.Watch()
+
+	assert.False(suite.T(), handler.wasCalled())
+}
+
+func (suite *PollerTestSuite) TestTimeoutHandlerCalledForUnresolvedInstances() {
+	suite.Deploy.InstanceCount = 2
+	suite.Subject = New(suite.Deploy, suite.FleetMock)
+	suite.Subject.Timeout = 20 * time.Millisecond
+	suite.Subject.Delay = time.Millisecond
+
+	states := make(map[string]string)
+	states[suite.Deploy.ServiceInstance("1").FleetUnitName()] = "running"
+	states[suite.Deploy.ServiceInstance("2").FleetUnitName()] = "launching"
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForStates(states), nil)
+
+	var timedOut []*Event
+	suite.Subject.AddTimeoutHandler(HandlerFunc(func(e *Event) {
+		timedOut = append(timedOut, e)
+	}))
+	suite.Subject.Watch()
+
+	assert.Len(suite.T(), timedOut, 1)
+	assert.Equal(suite.T(), "2", timedOut[0].ServiceInstance.Instance)
+	assert.Equal(suite.T(), "launching", timedOut[0].SystemdSubState)
+}
+
+func (suite *PollerTestSuite) TestStopFromHandlerEndsWatch() {
+	suite.Deploy.InstanceCount = 2
+	suite.Subject = New(suite.Deploy, suite.FleetMock)
+	suite.Subject.Timeout = 100 * time.Millisecond
+	suite.Subject.Delay = 0
+
+	states := make(map[string]string)
+	states[suite.Deploy.ServiceInstance("1").FleetUnitName()] = "failed"
+	states[suite.Deploy.ServiceInstance("2").FleetUnitName()] = "running"
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForStates(states), nil).Times(1)
+
+	handler := &MockSuccessHandler{}
+	suite.Subject.AddFailureHandler(HandlerFunc(func(e *Event) {
+		suite.Subject.Stop("Stopping due to failure.")
+	}))
+	suite.Subject.AddSuccessHandler(handler)
+	suite.Subject.Watch()
+
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *PollerTestSuite) TestCompletionHandlerCalledOnceWithSummary() {
+	suite.Deploy.InstanceCount = 2
+	suite.Subject = New(suite.Deploy, suite.FleetMock)
+	suite.Subject.Timeout = 100 * time.Millisecond
+	suite.Subject.Delay = 0
+
+	states := make(map[string]string)
+	states[suite.Deploy.ServiceInstance("1").FleetUnitName()] = "running"
+	states[suite.Deploy.ServiceInstance("2").FleetUnitName()] = "failed"
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForStates(states), nil).Times(1)
+
+	var completed []*Event
+	suite.Subject.AddCompletionHandler(HandlerFunc(func(e *Event) {
+		completed = append(completed, e)
+	}))
+	suite.Subject.Watch()
+
+	assert.Len(suite.T(), completed, 1)
+	summary := completed[0].Summary
+	assert.False(suite.T(), summary.Succeeded())
+	assert.Equal(suite.T(), OutcomeSucceeded, summary.Outcomes[0].Result)
+	assert.Equal(suite.T(), OutcomeFailed, summary.Outcomes[1].Result)
+	assert.Equal(suite.T(), "failed", summary.Outcomes[1].LastEvent.SystemdSubState)
+}
+
+func (suite *PollerTestSuite) TestCompletionHandlerCalledOnTimeout() {
+	suite.Subject.Timeout = 20 * time.Millisecond
+	suite.Subject.Delay = time.Millisecond
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForState("launching"), nil)
+
+	var summary *Summary
+	suite.Subject.AddCompletionHandler(HandlerFunc(func(e *Event) {
+		summary = e.Summary
+	}))
+	suite.Subject.Watch()
+
+	assert.Equal(suite.T(), 1, summary.Count(OutcomeTimedOut))
+	assert.Equal(suite.T(), "launching", summary.Outcomes[0].LastEvent.SystemdSubState)
+}
+
+func (suite *PollerTestSuite) TestCompletionHandlerCalledWhenStopped() {
+	suite.Deploy.InstanceCount = 2
+	suite.Subject = New(suite.Deploy, suite.FleetMock)
+	suite.Subject.Timeout = 100 * time.Millisecond
+	suite.Subject.Delay = 0
+
+	states := make(map[string]string)
+	states[suite.Deploy.ServiceInstance("1").FleetUnitName()] = "failed"
+	states[suite.Deploy.ServiceInstance("2").FleetUnitName()] = "launching"
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForStates(states), nil).Times(1)
+
+	var summary *Summary
+	suite.Subject.AddFailureHandler(HandlerFunc(func(e *Event) {
+		suite.Subject.Stop("Stopping due to failure.")
+	}))
+	suite.Subject.AddCompletionHandler(HandlerFunc(func(e *Event) {
+		summary = e.Summary
+	}))
+	suite.Subject.Watch()
+
+	assert.Equal(suite.T(), OutcomeFailed, summary.Outcomes[0].Result)
+	assert.Equal(suite.T(), OutcomeStopped, summary.Outcomes[1].Result)
+}
+
+func (suite *PollerTestSuite) TestBatchOnlyWatchesItsInstances() {
+	suite.Deploy.InstanceCount = 3
+	suite.Subject = NewBatch(suite.Deploy, suite.FleetMock, 2, 3)
+	suite.Subject.Timeout = 100 * time.Millisecond
+	suite.Subject.Delay = 0
+
+	states := make(map[string]string)
+	states[suite.Deploy.ServiceInstance("1").FleetUnitName()] = "failed"
+	states[suite.Deploy.ServiceInstance("2").FleetUnitName()] = "running"
+	states[suite.Deploy.ServiceInstance("3").FleetUnitName()] = "running"
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForStates(states), nil).Times(1)
+
+	var summary *Summary
+	suite.Subject.AddCompletionHandler(HandlerFunc(func(e *Event) {
+		summary = e.Summary
+	}))
+	suite.Subject.Watch()
+
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	assert.True(suite.T(), summary.Succeeded())
+	assert.Len(suite.T(), summary.Outcomes, 2)
+	assert.Equal(suite.T(), "2", summary.Outcomes[0].ServiceInstance.Instance)
+}
+
+func (suite *PollerTestSuite) TestRunningInstanceUnresolvedUntilReady() {
+	handler := &MockSuccessHandler{}
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForState("running"), nil).Times(2)
+
+	checks := 0
+	suite.Subject.Checker = checkerFunc(func(e *Event) bool {
+		checks++
+		return checks > 1
+	})
+	suite.Subject.AddSuccessHandler(handler)
+	suite.Subject.Watch()
+
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	assert.Equal(suite.T(), 2, checks)
+	assert.Equal(suite.T(), 1, handler.timesCalled)
+}
+
+func (suite *PollerTestSuite) TestGlobalSucceedsOnceRunningOnEveryMachine() {
+	suite.Deploy.Global = true
+	suite.FleetMock.On("Machines").Return([]machine.MachineState{{ID: "m1"}, {ID: "m2"}}, nil)
+	suite.FleetMock.On("UnitStates").Return(suite.globalStates(map[string]string{"m1": "running"}), nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return(suite.globalStates(map[string]string{"m1": "running", "m2": "launching"}), nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return(suite.globalStates(map[string]string{"m1": "running", "m2": "running"}), nil).Times(1)
+
+	var seen []string
+	suite.Subject.AddEventHandler(HandlerFunc(func(e *Event) {
+		seen = append(seen, e.MachineID+":"+e.SystemdSubState)
+	}))
+	handler := &MockSuccessHandler{}
+	suite.Subject.AddSuccessHandler(handler)
+	suite.Subject.Watch()
+
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	assert.Equal(suite.T(), []string{"m2:", "m2:launching", "m1:running"}, seen)
+	assert.Equal(suite.T(), 1, handler.timesCalled)
+}
+
+func (suite *PollerTestSuite) TestGlobalFailsWhenAnyMachineFails() {
+	suite.Deploy.Global = true
+	suite.FleetMock.On("Machines").Return([]machine.MachineState{{ID: "m1"}, {ID: "m2"}}, nil)
+	suite.FleetMock.On("UnitStates").Return(suite.globalStates(map[string]string{"m1": "launching", "m2": "failed"}), nil)
+
+	var summary *Summary
+	suite.Subject.AddCompletionHandler(HandlerFunc(func(e *Event) {
+		summary = e.Summary
+	}))
+	suite.Subject.Watch()
+
+	assert.Equal(suite.T(), OutcomeFailed, summary.Outcomes[0].Result)
+	assert.Equal(suite.T(), "m2", summary.Outcomes[0].LastEvent.MachineID)
+}
+
+func (suite *PollerTestSuite) TestGlobalOnlyWaitsForMachinesMatchingMetadata() {
+	suite.Deploy.Global = true
+	suite.Deploy.MachineMetadata = []string{"role=web", "region=us-east", "region=us-west"}
+	suite.FleetMock.On("Machines").Return([]machine.MachineState{
+		{ID: "m1", Metadata: map[string]string{"role": "web", "region": "us-west"}},
+		{ID: "m2", Metadata: map[string]string{"role": "worker", "region": "us-west"}},
+		{ID: "m3", Metadata: map[string]string{"role": "web"}},
+	}, nil)
+	suite.FleetMock.On("UnitStates").Return(suite.globalStates(map[string]string{"m1": "running"}), nil)
+
+	handler := &MockSuccessHandler{}
+	suite.Subject.AddSuccessHandler(handler)
+	suite.Subject.Watch()
+
+	assert.Equal(suite.T(), 1, handler.timesCalled)
+}
+
+func (suite *PollerTestSuite) TestGlobalChecksEveryMachine() {
+	suite.Deploy.Global = true
+	suite.FleetMock.On("Machines").Return([]machine.MachineState{{ID: "m1"}, {ID: "m2"}}, nil)
+	suite.FleetMock.On("UnitStates").Return(suite.globalStates(map[string]string{"m1": "running", "m2": "running"}), nil)
+
+	var checked []string
+	suite.Subject.Checker = checkerFunc(func(e *Event) bool {
+		checked = append(checked, e.MachineID)
+		return true
+	})
+	suite.Subject.Watch()
+
+	assert.Equal(suite.T(), []string{"m1", "m2"}, checked)
+}
+
+// globalStates returns the state of the deploy's global unit on each machine.
+func (suite *PollerTestSuite) TestWaitUntilStoppedOnceUnitIsGone() {
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{}, nil)
+
+	err := WaitUntilStopped(suite.FleetMock, suite.Deploy.ServiceInstance("1"), 100*time.Millisecond, time.Millisecond)
+
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *PollerTestSuite) TestWaitUntilStoppedOnceUnitIsDead() {
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForState("dead"), nil)
+
+	err := WaitUntilStopped(suite.FleetMock, suite.Deploy.ServiceInstance("1"), 100*time.Millisecond, time.Millisecond)
+
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *PollerTestSuite) TestWaitUntilStoppedWaitsOnEveryMachine() {
+	suite.FleetMock.On("UnitStates").Return(suite.globalStates(map[string]string{"abc": "dead", "def": "running"}), nil)
+
+	err := WaitUntilStopped(suite.FleetMock, suite.Deploy.ServiceInstance("1"), 10*time.Millisecond, time.Millisecond)
+
+	assert.EqualError(suite.T(), err, "railsapp:latest:2006.01.02-15.04.05@1.service didn't stop within 10ms.")
+}
+
+func (suite *PollerTestSuite) TestWaitUntilStoppedTimesOutWhileRunning() {
+	suite.FleetMock.On("UnitStates").Return(suite.expectedForState("running"), nil)
+
+	err := WaitUntilStopped(suite.FleetMock, suite.Deploy.ServiceInstance("1"), 10*time.Millisecond, time.Millisecond)
+
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *PollerTestSuite) globalStates(machines map[string]string) []*fleet.UnitState {
+	var generated []*fleet.UnitState
+	for id, state := range machines {
+		generated = append(generated, &fleet.UnitState{
+			Name:            suite.Deploy.ServiceInstance("1").FleetUnitName(),
+			MachineID:       id,
+			SystemdSubState: state,
+		})
+	}
+	return generated
+}
+
 func (suite *PollerTestSuite) expectedForState(state string) []*fleet.UnitState {
 	states := make(map[string]string)
 	states[suite.Deploy.ServiceInstance("1").FleetUnitName()] = state
@@ -0,0 +1,77 @@
+package poller
+
+import (
+	"strconv"
+
+	"github.com/bmorton/deployster/schema"
+)
+
+const (
+	// OutcomeSucceeded is the outcome of an instance that reached the running
+	// state.
+	OutcomeSucceeded = "succeeded"
+
+	// OutcomeFailed is the outcome of an instance that reached the failed
+	// state.
+	OutcomeFailed = "failed"
+
+	// OutcomeTimedOut is the outcome of an instance that was still unresolved
+	// when the poller timed out.
+	OutcomeTimedOut = "timed_out"
+
+	// OutcomeStopped is the outcome of an instance that was still unresolved
+	// when the poller was stopped.
+	OutcomeStopped = "stopped"
+)
+
+// Outcome is the result of watching a single instance.  LastEvent is the last
+// state that was seen for the instance and is nil if Fleet never reported it.
+type Outcome struct {
+	ServiceInstance *schema.ServiceInstance
+	Result          string
+	LastEvent       *Event
+}
+
+// Summary describes the outcome of every instance the poller watched once it
+// has finished.  It's passed to completion handlers as the Summary
+// field of an Event.
+type Summary struct {
+	Deploy   *schema.Deploy
+	Outcomes []*Outcome
+}
+
+// Succeeded returns true if every instance reached the running state.
+func (s *Summary) Succeeded() bool {
+	return s.Count(OutcomeSucceeded) == len(s.Outcomes)
+}
+
+// Count returns the number of instances with the given result.
+func (s *Summary) Count(result string) int {
+	count := 0
+	for _, o := range s.Outcomes {
+		if o.Result == result {
+			count++
+		}
+	}
+	return count
+}
+
+// summarize builds the summary of the watched instances, in instance order,
+// marking every instance that was never resolved with the given result.
+func (p *Poller) summarize(unresolvedResult string) *Summary {
+	summary := &Summary{Deploy: p.Deploy}
+	for i := p.first; i <= p.last; i++ {
+		instance := p.Deploy.ServiceInstance(strconv.Itoa(i))
+		name := instance.FleetUnitName()
+		result, ok := p.results[name]
+		if !ok {
+			result = unresolvedResult
+		}
+		summary.Outcomes = append(summary.Outcomes, &Outcome{
+			ServiceInstance: instance,
+			Result:          result,
+			LastEvent:       p.lastEvents[name],
+		})
+	}
+	return summary
+}
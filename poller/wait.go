@@ -0,0 +1,53 @@
+package poller
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bmorton/deployster/clients"
+	"github.com/bmorton/deployster/schema"
+	fleet "github.com/coreos/fleet/schema"
+)
+
+// WaitUntilStopped polls Fleet every delay until the instance's unit has
+// stopped on every machine, which is once Fleet no longer reports a state for
+// it or only reports it dead or failed.  It's used to make sure an instance
+// has really gone down before it's launched again.  An error is returned if
+// the instance is still up after timeout.  A zero timeout or delay uses the
+// poller's defaults.
+func WaitUntilStopped(client clients.Fleet, instance *schema.ServiceInstance, timeout time.Duration, delay time.Duration) error {
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	if delay == 0 {
+		delay = defaultDelay
+	}
+
+	name := instance.FleetUnitName()
+	expired := time.After(timeout)
+	for {
+		states, err := client.UnitStates()
+		if err != nil {
+			log.Println(err)
+		} else if isStopped(name, states) {
+			return nil
+		}
+
+		select {
+		case <-expired:
+			return fmt.Errorf("%s didn't stop within %s.", name, timeout)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// isStopped returns true if none of the states show the unit up on a machine.
+func isStopped(name string, states []*fleet.UnitState) bool {
+	for _, state := range states {
+		if state.Name == name && state.SystemdSubState != "dead" && state.SystemdSubState != "failed" {
+			return false
+		}
+	}
+	return true
+}
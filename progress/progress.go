@@ -0,0 +1,164 @@
+package progress
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bmorton/deployster/schema"
+)
+
+const (
+	// EventUnitCreated is reported when a unit is created in Fleet.
+	EventUnitCreated = "unit_created"
+
+	// EventUnitLaunched is reported when a unit's target state is set to
+	// launched.
+	EventUnitLaunched = "unit_launched"
+
+	// EventUnitStopped is reported when a unit's target state is set to
+	// inactive so that it can be restarted.
+	EventUnitStopped = "unit_stopped"
+
+	// EventStateChanged is reported when an instance is seen in a state that
+	// differs from the last one observed for it.
+	EventStateChanged = "state_changed"
+
+	// EventUnitDestroyed is reported when a previous version's unit is
+	// destroyed after being replaced.
+	EventUnitDestroyed = "unit_destroyed"
+
+	// EventEndpointRegistered is reported when an instance that came online
+	// is registered with the load balancer.
+	EventEndpointRegistered = "endpoint_registered"
+
+	// EventEndpointDeregistered is reported when an instance is removed from
+	// the load balancer before it's stopped or destroyed.
+	EventEndpointDeregistered = "endpoint_deregistered"
+
+	// EventTrafficShifted is reported when the share of traffic sent to a
+	// deploy that shifts or switches traffic changes.
+	EventTrafficShifted = "traffic_shifted"
+
+	// EventFinished is the last event reported for a deploy.  It carries the
+	// deploy record with its final status, the `canary` status for a canary
+	// deploy that's waiting to be promoted, the `shifting` status for a deploy
+	// whose instances are online while traffic is shifted to them, or the
+	// `ready` status for a blue/green deploy that's waiting to be switched.
+	EventFinished = "finished"
+)
+
+// Event is a single step in the progress of a deploy.  Only the fields that
+// apply to the type of event are set.  TrafficWeight is a pointer so that
+// shifting all traffic away from a deploy is still reported as 0.
+type Event struct {
+	Type          string               `json:"type"`
+	Unit          string               `json:"unit,omitempty"`
+	Instance      string               `json:"instance,omitempty"`
+	ActiveState   string               `json:"active_state,omitempty"`
+	LoadState     string               `json:"load_state,omitempty"`
+	SubState      string               `json:"sub_state,omitempty"`
+	Endpoint      string               `json:"endpoint,omitempty"`
+	TrafficWeight *int                 `json:"traffic_weight,omitempty"`
+	Error         string               `json:"error,omitempty"`
+	Deploy        *schema.DeployRecord `json:"deploy,omitempty"`
+	ReportedAt    time.Time            `json:"reported_at"`
+}
+
+// Reporter is implemented by anything that events can be reported to.
+type Reporter interface {
+	Report(event *Event)
+}
+
+// ReporterFunc allows a plain function to be used as a Reporter.
+type ReporterFunc func(event *Event)
+
+// Report calls the function with the event.
+func (f ReporterFunc) Report(event *Event) {
+	f(event)
+}
+
+// Hub keeps a Feed of events for each deploy that someone is following.  Events
+// reported for deploys that aren't being followed are discarded.
+type Hub struct {
+	mutex sync.Mutex
+	feeds map[string]*Feed
+}
+
+// NewHub returns a Hub with no open feeds.
+func NewHub() *Hub {
+	return &Hub{feeds: make(map[string]*Feed)}
+}
+
+// Open starts collecting events for the deploy and returns its feed.  Opening a
+// feed that's already open returns the existing feed.
+func (h *Hub) Open(deployID string) *Feed {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if feed, ok := h.feeds[deployID]; ok {
+		return feed
+	}
+	feed := &Feed{changed: make(chan struct{})}
+	h.feeds[deployID] = feed
+	return feed
+}
+
+// Close stops collecting events for the deploy.
+func (h *Hub) Close(deployID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.feeds, deployID)
+}
+
+// Publish adds the event to the deploy's feed if it's open.
+func (h *Hub) Publish(deployID string, event *Event) {
+	h.mutex.Lock()
+	feed, ok := h.feeds[deployID]
+	h.mutex.Unlock()
+
+	if ok {
+		feed.add(event)
+	}
+}
+
+// Reporter returns a Reporter that publishes events to the deploy's feed.
+func (h *Hub) Reporter(deployID string) Reporter {
+	return ReporterFunc(func(event *Event) {
+		h.Publish(deployID, event)
+	})
+}
+
+// Feed is the ordered list of events reported for a single deploy.
+type Feed struct {
+	mutex   sync.Mutex
+	events  []*Event
+	changed chan struct{}
+}
+
+// Since returns the events after the first n along with a channel that's
+// closed once another event is added, so that callers can wait for more.
+func (f *Feed) Since(n int) ([]*Event, <-chan struct{}) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if n > len(f.events) {
+		n = len(f.events)
+	}
+	return f.events[n:], f.changed
+}
+
+// add appends the event, stamping it with the current time if it hasn't been
+// already, and wakes up anyone waiting for it.
+func (f *Feed) add(event *Event) {
+	if event.ReportedAt.IsZero() {
+		event.ReportedAt = time.Now().UTC()
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.events = append(f.events, event)
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
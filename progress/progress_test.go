@@ -0,0 +1,90 @@
+package progress
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type HubTestSuite struct {
+	suite.Suite
+	Subject *Hub
+}
+
+func (suite *HubTestSuite) SetupTest() {
+	suite.Subject = NewHub()
+}
+
+func (suite *HubTestSuite) TestPublishToOpenFeed() {
+	feed := suite.Subject.Open("d3adb33f")
+
+	suite.Subject.Publish("d3adb33f", &Event{Type: EventUnitCreated, Unit: "railsapp:abc123:2006.01.02-15.04.05@1.service"})
+
+	events, _ := feed.Since(0)
+	assert.Len(suite.T(), events, 1)
+	assert.Equal(suite.T(), EventUnitCreated, events[0].Type)
+	assert.False(suite.T(), events[0].ReportedAt.IsZero())
+}
+
+func (suite *HubTestSuite) TestPublishWithoutOpenFeed() {
+	suite.Subject.Publish("d3adb33f", &Event{Type: EventUnitCreated})
+
+	events, _ := suite.Subject.Open("d3adb33f").Since(0)
+	assert.Empty(suite.T(), events)
+}
+
+func (suite *HubTestSuite) TestPublishAfterClose() {
+	feed := suite.Subject.Open("d3adb33f")
+	suite.Subject.Close("d3adb33f")
+
+	suite.Subject.Publish("d3adb33f", &Event{Type: EventUnitCreated})
+
+	events, _ := feed.Since(0)
+	assert.Empty(suite.T(), events)
+}
+
+func (suite *HubTestSuite) TestOpenReturnsExistingFeed() {
+	feed := suite.Subject.Open("d3adb33f")
+
+	assert.Equal(suite.T(), feed, suite.Subject.Open("d3adb33f"))
+}
+
+func (suite *HubTestSuite) TestReporter() {
+	feed := suite.Subject.Open("d3adb33f")
+
+	suite.Subject.Reporter("d3adb33f").Report(&Event{Type: EventUnitLaunched})
+
+	events, _ := feed.Since(0)
+	assert.Equal(suite.T(), EventUnitLaunched, events[0].Type)
+}
+
+func (suite *HubTestSuite) TestSinceSkipsSeenEvents() {
+	feed := suite.Subject.Open("d3adb33f")
+	suite.Subject.Publish("d3adb33f", &Event{Type: EventUnitCreated})
+	suite.Subject.Publish("d3adb33f", &Event{Type: EventUnitLaunched})
+
+	events, _ := feed.Since(1)
+	assert.Len(suite.T(), events, 1)
+	assert.Equal(suite.T(), EventUnitLaunched, events[0].Type)
+}
+
+func (suite *HubTestSuite) TestSinceWakesUpOnPublish() {
+	feed := suite.Subject.Open("d3adb33f")
+	_, changed := feed.Since(0)
+
+	suite.Subject.Publish("d3adb33f", &Event{Type: EventFinished})
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		suite.T().Fatal("expected the feed to change")
+	}
+	events, _ := feed.Since(0)
+	assert.Equal(suite.T(), EventFinished, events[0].Type)
+}
+
+func TestHubTestSuite(t *testing.T) {
+	suite.Run(t, new(HubTestSuite))
+}
@@ -1,15 +1,120 @@
 package schema
 
+import "time"
+
+const (
+	// StrategyRolling replaces the previous version's instances as the
+	// deploy's instances come online.  It's the default strategy.
+	StrategyRolling = "rolling"
+
+	// StrategyBlueGreen brings every instance of the deploy online alongside
+	// the previous version without sending it any traffic, then waits for all
+	// traffic to be switched to it at once.
+	StrategyBlueGreen = "blue_green"
+
+	// DefaultGracePeriod is how long the previous version of a blue/green
+	// deploy is kept once traffic has been switched away from it, when the
+	// deploy doesn't set a grace period.
+	DefaultGracePeriod time.Duration = 10 * time.Minute
+)
+
 // Deploy is the struct that defines all the options for creating a new deploy.
 // It is further populated after the initial request payload to contain all the
 // information needed to be passed around to various collaborators.
 type Deploy struct {
-	ServiceName     string  `json:"service_name,omitempty"`
-	Version         string  `json:"version"`
-	DestroyPrevious bool    `json:"destroy_previous"`
-	Timestamp       string  `json:"timestamp,omitempty"`
-	InstanceCount   int     `json:"instance_count,omitempty"`
-	PreviousVersion *Deploy `json:"previous_version,omitempty"`
+	ID                string            `json:"id,omitempty"`
+	ServiceName       string            `json:"service_name,omitempty"`
+	Version           string            `json:"version"`
+	DestroyPrevious   bool              `json:"destroy_previous"`
+	RollbackOnFailure bool              `json:"rollback_on_failure"`
+	Canary            bool              `json:"canary"`
+	Timestamp         string            `json:"timestamp,omitempty"`
+	InstanceCount     int               `json:"instance_count,omitempty"`
+	BatchSize         int               `json:"batch_size,omitempty"`
+	MaxSurge          int               `json:"max_surge,omitempty"`
+	HealthCheck       *HealthCheck      `json:"health_check,omitempty"`
+	Template          string            `json:"template,omitempty"`
+	Env               map[string]string `json:"env,omitempty"`
+	Secrets           []*SecretRef      `json:"secrets,omitempty"`
+	MachineMetadata   []string          `json:"machine_metadata,omitempty"`
+	Conflicts         []string          `json:"conflicts"`
+	MachineOf         string            `json:"machine_of,omitempty"`
+	Global            bool              `json:"global,omitempty"`
+	TrafficShift      *TrafficShift     `json:"traffic_shift,omitempty"`
+	Strategy          string            `json:"strategy,omitempty"`
+	GracePeriod       string            `json:"grace_period,omitempty"`
+	PreviousVersion   *Deploy           `json:"previous_version,omitempty"`
+}
+
+// RolloutBatchSize returns the number of instances that are launched together
+// before waiting for them to come online.  It defaults to every instance at
+// once.
+func (d *Deploy) RolloutBatchSize() int {
+	if d.BatchSize > 0 && d.BatchSize < d.InstanceCount {
+		return d.BatchSize
+	}
+	return d.InstanceCount
+}
+
+// SurgeEnd returns the last instance that can be launched along with instance
+// first without running more than MaxSurge instances above InstanceCount.
+// Each of the previous version's instances is only destroyed once the instance
+// replacing it is online, so it counts toward the surge until then.  Without a
+// MaxSurge, or when the previous version isn't destroyed as the deploy rolls
+// out, every remaining instance can be launched.
+func (d *Deploy) SurgeEnd(first int) int {
+	if d.MaxSurge <= 0 || !d.DestroyPrevious || d.PreviousVersion == nil || d.Global || d.ShiftsTraffic() || d.SwitchesTraffic() {
+		return d.InstanceCount
+	}
+	remaining := d.PreviousVersion.InstanceCount - first + 1
+	if remaining <= 0 {
+		return d.InstanceCount
+	}
+	last := d.InstanceCount + d.MaxSurge - remaining
+	if last > d.InstanceCount {
+		return d.InstanceCount
+	}
+	return last
+}
+
+// DefaultConflicts keeps the instances of a deploy on separate machines.  Fleet
+// expands `%p` to the prefix of the unit name, which every instance of a deploy
+// shares.
+const DefaultConflicts = "%p@*.service"
+
+// InstanceConflicts returns the unit name patterns that instances of the deploy
+// must not share a machine with.  Unless the deploy sets Conflicts, even to an
+// empty list, its instances are spread across machines.  Global deploys and
+// deploys that follow another unit with MachineOf don't conflict by default.
+func (d *Deploy) InstanceConflicts() []string {
+	if d.Conflicts != nil || d.Global || d.MachineOf != "" {
+		return d.Conflicts
+	}
+	return []string{DefaultConflicts}
+}
+
+// ShiftsTraffic returns whether traffic is shifted from the previous version
+// to the deploy gradually instead of the previous version being replaced
+// instance by instance.
+func (d *Deploy) ShiftsTraffic() bool {
+	return d.TrafficShift != nil && d.PreviousVersion != nil
+}
+
+// SwitchesTraffic returns whether all traffic is switched from the previous
+// version to the deploy at once, as part of a blue/green deploy.
+func (d *Deploy) SwitchesTraffic() bool {
+	return d.Strategy == StrategyBlueGreen && d.PreviousVersion != nil
+}
+
+// SwitchGracePeriod returns how long the previous version of a blue/green
+// deploy is kept once traffic has been switched away from it so that traffic
+// can be switched back.
+func (d *Deploy) SwitchGracePeriod() time.Duration {
+	if d.GracePeriod == "" {
+		return DefaultGracePeriod
+	}
+	period, _ := time.ParseDuration(d.GracePeriod)
+	return period
 }
 
 // ServiceInstance returns a single unit of a possibly-many-unit deploy given
@@ -0,0 +1,125 @@
+package schema
+
+import "time"
+
+const (
+	// DeployLaunching is the status of a deploy while its units are being
+	// created and launched via Fleet.
+	DeployLaunching = "launching"
+
+	// DeployPolling is the status of a deploy after all of its units have been
+	// launched and the poller is waiting for them to resolve.
+	DeployPolling = "polling"
+
+	// DeploySucceeded is the status of a deploy where every instance was seen
+	// running.
+	DeploySucceeded = "succeeded"
+
+	// DeployFailed is the status of a deploy where at least one instance failed
+	// to launch or the units could not be created.
+	DeployFailed = "failed"
+
+	// DeployTimedOut is the status of a deploy where the poller gave up before
+	// every instance was resolved.
+	DeployTimedOut = "timed_out"
+
+	// DeployCanary is the status of a canary deploy whose canary instance is
+	// running alongside the previous version, waiting to be promoted or
+	// aborted.
+	DeployCanary = "canary"
+
+	// DeployAborted is the status of a canary deploy that was aborted and had
+	// its canary instance destroyed, or of a deploy that was aborted while
+	// shifting or switching traffic and had its instances destroyed.
+	DeployAborted = "aborted"
+
+	// DeployShifting is the status of a deploy whose instances are all online
+	// alongside the previous version while traffic is shifted to them.
+	DeployShifting = "shifting"
+
+	// DeployReady is the status of a blue/green deploy whose instances are all
+	// online alongside the previous version, waiting for traffic to be
+	// switched to them.
+	DeployReady = "ready"
+
+	// DeploySwitched is the status of a blue/green deploy that traffic has
+	// been switched to while the previous version is kept for its grace
+	// period, in case traffic needs to be switched back.
+	DeploySwitched = "switched"
+)
+
+// DeployRecord is the persisted history of a deploy.  It embeds the Deploy
+// that was requested so that its fields are serialized alongside the status,
+// any error, whether it was rolled back, and every state transition observed
+// for its instances.  Records of a service being scaled rather than deployed
+// have ScaledFrom set to the number of instances that were running before, and
+// records of a service being restarted have Restarted set.  TrafficWeight is
+// the percentage of traffic that's been shifted or switched to a deploy that
+// shifts or switches traffic.
+type DeployRecord struct {
+	*Deploy
+	Status        string             `json:"status"`
+	Error         string             `json:"error,omitempty"`
+	RolledBack    bool               `json:"rolled_back"`
+	ScaledFrom    int                `json:"scaled_from,omitempty"`
+	Restarted     bool               `json:"restarted,omitempty"`
+	TrafficWeight int                `json:"traffic_weight,omitempty"`
+	Transitions   []*StateTransition `json:"transitions"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+}
+
+// StateTransition is a change in the systemd state of a single instance of a
+// deploy as observed by the poller.
+type StateTransition struct {
+	Instance    string    `json:"instance"`
+	ActiveState string    `json:"active_state"`
+	LoadState   string    `json:"load_state"`
+	SubState    string    `json:"sub_state"`
+	ObservedAt  time.Time `json:"observed_at"`
+}
+
+// NewDeployRecord returns a record for the given deploy with a launching
+// status.
+func NewDeployRecord(deploy *Deploy) *DeployRecord {
+	now := time.Now().UTC()
+	return &DeployRecord{
+		Deploy:      deploy,
+		Status:      DeployLaunching,
+		Transitions: []*StateTransition{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// CurrentState returns the most recent transition recorded for the given
+// instance or nil if no state has been observed yet.
+func (r *DeployRecord) CurrentState(instance string) *StateTransition {
+	for i := len(r.Transitions) - 1; i >= 0; i-- {
+		if r.Transitions[i].Instance == instance {
+			return r.Transitions[i]
+		}
+	}
+	return nil
+}
+
+// Copy returns a copy of the record that can be handed off while the original
+// continues to be updated by the poller.  Transitions are never modified once
+// recorded, so they are shared between the copies.
+func (r *DeployRecord) Copy() *DeployRecord {
+	deploy := *r.Deploy
+	record := *r
+	record.Deploy = &deploy
+	record.Transitions = make([]*StateTransition, len(r.Transitions))
+	copy(record.Transitions, r.Transitions)
+	return &record
+}
+
+// IsFinished returns true once the deploy has reached a final status.
+func (r *DeployRecord) IsFinished() bool {
+	switch r.Status {
+	case DeploySucceeded, DeployFailed, DeployTimedOut, DeployAborted:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+package schema
+
+// HealthCheck defines the HTTP request used to decide whether a running
+// instance is ready to serve traffic.  The instance is ready once Threshold
+// consecutive requests for Path, made at least Interval seconds apart, have
+// responded with ExpectedStatus.
+type HealthCheck struct {
+	Path           string `json:"path"`
+	ExpectedStatus int    `json:"expected_status,omitempty"`
+	Interval       int    `json:"interval,omitempty"`
+	Threshold      int    `json:"threshold,omitempty"`
+}
@@ -0,0 +1,18 @@
+package schema
+
+// SecretRef references a secret that is resolved by deployster when a deploy
+// or task is launched and passed to the container as the environment variable
+// Env.  If Env is blank, the name of the secret is used.
+type SecretRef struct {
+	Name string `json:"name"`
+	Env  string `json:"env,omitempty"`
+}
+
+// EnvName returns the name of the environment variable the secret is passed
+// as.
+func (s *SecretRef) EnvName() string {
+	if s.Env != "" {
+		return s.Env
+	}
+	return s.Name
+}
@@ -15,3 +15,9 @@ type ServiceInstance struct {
 func (s *ServiceInstance) FleetUnitName() string {
 	return fmt.Sprintf("%s:%s:%s@%s.service", s.Name, s.Version, s.Timestamp, s.Instance)
 }
+
+// ContainerName returns the name of the Docker container that the unit
+// template runs for this instance.
+func (s *ServiceInstance) ContainerName() string {
+	return fmt.Sprintf("%s-%s-%s-%s", s.Name, s.Version, s.Timestamp, s.Instance)
+}
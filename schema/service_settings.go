@@ -0,0 +1,54 @@
+package schema
+
+// DefaultPort is the port that a service's HTTP server is expected to be
+// exposed on inside its container unless the service's settings say otherwise.
+const DefaultPort = 3000
+
+// The load balancers that a service's instances can be registered with.
+const (
+	LoadBalancerVulcand = "vulcand"
+	LoadBalancerNginx   = "nginx"
+	LoadBalancerHAProxy = "haproxy"
+)
+
+// LoadBalancers are the names of every supported load balancer.
+var LoadBalancers = []string{LoadBalancerVulcand, LoadBalancerNginx, LoadBalancerHAProxy}
+
+// ServiceSettings are the options that every container of a service is run
+// with, whether it's launched by a deploy or a task.  Ports are published on
+// random host ports and the first is the port the service serves HTTP on.
+// Memory is a Docker memory limit such as `512m`.  Volumes are bind mounts in
+// Docker's `host:container[:ro]` form, ExtraHosts are `/etc/hosts` entries in
+// the form `host:ip`, and RestartPolicy is one of Docker's restart policies.
+// LoadBalancer is the name of the load balancer that instances are registered
+// with, overriding deployster's default.  Webhooks are notified of the
+// service's deploys and tasks along with any global webhooks.
+type ServiceSettings struct {
+	Ports         []int             `json:"ports,omitempty"`
+	Memory        string            `json:"memory,omitempty"`
+	CPUShares     int64             `json:"cpu_shares,omitempty"`
+	Volumes       []string          `json:"volumes,omitempty"`
+	ExtraHosts    []string          `json:"extra_hosts,omitempty"`
+	RestartPolicy string            `json:"restart_policy,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	LoadBalancer  string            `json:"load_balancer,omitempty"`
+	Webhooks      []*Webhook        `json:"webhooks,omitempty"`
+}
+
+// HTTPPort returns the port that the service serves HTTP on inside its
+// container.
+func (s *ServiceSettings) HTTPPort() int {
+	if len(s.Ports) > 0 {
+		return s.Ports[0]
+	}
+	return DefaultPort
+}
+
+// PublishedPorts returns every port that is published for the service's
+// containers.
+func (s *ServiceSettings) PublishedPorts() []int {
+	if len(s.Ports) > 0 {
+		return s.Ports
+	}
+	return []int{DefaultPort}
+}
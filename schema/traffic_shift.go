@@ -0,0 +1,60 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultTrafficSteps are the percentages of traffic that are shifted to a
+// deploy when it doesn't define its own steps.
+var DefaultTrafficSteps = []int{10, 25, 50, 100}
+
+// TrafficShift defines how traffic is moved from the previous version to a
+// deploy once all of its instances are online.  Steps are the percentages of
+// traffic sent to the new version, in increasing order, ending with 100.  If
+// an Interval such as `5m` is given, traffic moves to the next step on that
+// schedule, otherwise each step waits to be requested.
+type TrafficShift struct {
+	Steps    []int  `json:"steps,omitempty"`
+	Interval string `json:"interval,omitempty"`
+}
+
+// TrafficSteps returns the steps of the shift, or the default steps if it
+// doesn't define any.
+func (t *TrafficShift) TrafficSteps() []int {
+	if len(t.Steps) > 0 {
+		return t.Steps
+	}
+	return DefaultTrafficSteps
+}
+
+// StepInterval returns the amount of time between steps, or 0 if steps are
+// requested manually.
+func (t *TrafficShift) StepInterval() time.Duration {
+	interval, _ := time.ParseDuration(t.Interval)
+	return interval
+}
+
+// Validate returns an error describing the first problem with the shift, or nil
+// if it's valid.
+func (t *TrafficShift) Validate() error {
+	previous := 0
+	for _, step := range t.Steps {
+		if step <= previous || step > 100 {
+			return errors.New("Traffic steps must be percentages between 1 and 100 in increasing order.")
+		}
+		previous = step
+	}
+	if len(t.Steps) > 0 && previous != 100 {
+		return errors.New("The last traffic step must be 100.")
+	}
+
+	if t.Interval != "" {
+		interval, err := time.ParseDuration(t.Interval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("The traffic shift interval %q must be a positive duration such as 5m.", t.Interval)
+		}
+	}
+	return nil
+}
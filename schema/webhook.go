@@ -0,0 +1,48 @@
+package schema
+
+// The events that webhooks are notified of.
+const (
+	WebhookDeployStarted     = "deploy_started"
+	WebhookInstanceRunning   = "instance_running"
+	WebhookInstanceFailed    = "instance_failed"
+	WebhookPreviousDestroyed = "previous_destroyed"
+	WebhookDeploySucceeded   = "deploy_succeeded"
+	WebhookDeployFailed      = "deploy_failed"
+	WebhookDeployTimedOut    = "deploy_timed_out"
+	WebhookTaskFinished      = "task_finished"
+)
+
+// WebhookEvents are the names of every event that webhooks can be notified of.
+var WebhookEvents = []string{
+	WebhookDeployStarted,
+	WebhookInstanceRunning,
+	WebhookInstanceFailed,
+	WebhookPreviousDestroyed,
+	WebhookDeploySucceeded,
+	WebhookDeployFailed,
+	WebhookDeployTimedOut,
+	WebhookTaskFinished,
+}
+
+// Webhook is an HTTP endpoint that's sent a JSON payload whenever one of its
+// Events happens, or every event if it doesn't list any.  Secret is the name of
+// the deployster secret that payloads are signed with, if any, so that its
+// value never has to be stored in settings.
+type Webhook struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events,omitempty"`
+}
+
+// Wants returns whether the webhook is notified of the event.
+func (w *Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
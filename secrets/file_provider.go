@@ -0,0 +1,44 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileProvider is a Provider that reads each secret from its own file so that
+// secrets can be managed with whatever tooling already writes files to the
+// machine deployster runs on.  Secrets are laid out as `{dir}/{name}` and a
+// trailing newline is ignored.
+type FileProvider struct {
+	dir string
+}
+
+// NewFileProvider returns a FileProvider rooted at the given directory,
+// creating the directory if it doesn't already exist.  The directory is only
+// readable by the user deployster runs as.
+func NewFileProvider(dir string) (*FileProvider, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileProvider{dir: dir}, nil
+}
+
+// Secret returns the contents of the secret's file.
+func (fp *FileProvider) Secret(name string) (string, error) {
+	if !isValidName(name) {
+		return "", ErrInvalidName
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(fp.dir, name))
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), nil
+}
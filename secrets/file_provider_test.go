@@ -0,0 +1,51 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type FileProviderTestSuite struct {
+	suite.Suite
+	Subject *FileProvider
+	Dir     string
+}
+
+func (suite *FileProviderTestSuite) SetupTest() {
+	suite.Dir, _ = ioutil.TempDir("", "deployster-secrets")
+	suite.Subject, _ = NewFileProvider(suite.Dir)
+}
+
+func (suite *FileProviderTestSuite) TearDownTest() {
+	os.RemoveAll(suite.Dir)
+}
+
+func (suite *FileProviderTestSuite) TestSecret() {
+	ioutil.WriteFile(filepath.Join(suite.Dir, "database-url"), []byte("postgres://secret@db/carousel\n"), 0600)
+
+	value, err := suite.Subject.Secret("database-url")
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "postgres://secret@db/carousel", value)
+}
+
+func (suite *FileProviderTestSuite) TestSecretNotFound() {
+	_, err := suite.Subject.Secret("database-url")
+
+	assert.Equal(suite.T(), ErrNotFound, err)
+}
+
+func (suite *FileProviderTestSuite) TestSecretInvalidName() {
+	_, err := suite.Subject.Secret("../passwd")
+
+	assert.Equal(suite.T(), ErrInvalidName, err)
+}
+
+func TestFileProviderTestSuite(t *testing.T) {
+	suite.Run(t, new(FileProviderTestSuite))
+}
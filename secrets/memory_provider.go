@@ -0,0 +1,31 @@
+package secrets
+
+import "sync"
+
+// MemoryProvider is a Provider that keeps secrets in memory.  It's used when
+// no secret directory is configured and in tests.
+type MemoryProvider struct {
+	secrets map[string]string
+	mutex   sync.RWMutex
+}
+
+// NewMemoryProvider returns a MemoryProvider with a copy of the given secrets.
+func NewMemoryProvider(secrets map[string]string) *MemoryProvider {
+	mp := &MemoryProvider{secrets: make(map[string]string)}
+	for name, value := range secrets {
+		mp.secrets[name] = value
+	}
+	return mp
+}
+
+// Secret returns the value of the secret.
+func (mp *MemoryProvider) Secret(name string) (string, error) {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+
+	value, ok := mp.secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
@@ -0,0 +1,147 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bmorton/deployster/schema"
+)
+
+var (
+	// ErrNotFound is returned when a secret with the given name doesn't exist.
+	ErrNotFound = errors.New("Secret not found.")
+
+	// ErrInvalidName is returned when a secret name can't safely be used as a
+	// file name.
+	ErrInvalidName = errors.New("Secret names must only contain letters, numbers, dashes, underscores, and periods.")
+)
+
+// Redacted replaces the value of every secret in unit files and logs that are
+// shown to users.
+const Redacted = "[REDACTED]"
+
+// Provider is the interface required for resolving the secrets that deploys
+// and tasks reference so that their values never have to be sent to or stored
+// by deployster's clients.
+type Provider interface {
+	// Secret returns the value of the secret with the given name, or
+	// ErrNotFound if it doesn't exist.
+	Secret(string) (string, error)
+}
+
+// Environment is the set of environment variables passed to a container,
+// including the resolved values of any secrets.  It remembers which variables
+// are secret so that they can be redacted.
+type Environment struct {
+	values  map[string]string
+	secrets map[string]bool
+}
+
+// Resolve returns the environment made up of the given variables and the
+// referenced secrets, whose values are looked up with the provider.  An error
+// is returned if a variable name is invalid, a variable is set more than once,
+// or a secret can't be resolved.
+func Resolve(provider Provider, env map[string]string, refs []*schema.SecretRef) (*Environment, error) {
+	e := &Environment{values: map[string]string{}, secrets: map[string]bool{}}
+	for name, value := range env {
+		if !isValidEnvName(name) {
+			return nil, fmt.Errorf("The environment variable name %q is invalid.  Names must only contain letters, numbers, and underscores and must not begin with a number.", name)
+		}
+		e.values[name] = value
+	}
+
+	for _, ref := range refs {
+		name := ref.EnvName()
+		if !isValidEnvName(name) {
+			return nil, fmt.Errorf("The environment variable name %q is invalid.  Names must only contain letters, numbers, and underscores and must not begin with a number.", name)
+		}
+		if _, ok := e.values[name]; ok {
+			return nil, fmt.Errorf("The %s environment variable is set more than once.", name)
+		}
+
+		value, err := provider.Secret(ref.Name)
+		if err != nil {
+			return nil, fmt.Errorf("The %s secret could not be resolved: %s", ref.Name, err)
+		}
+		e.values[name] = value
+		e.secrets[name] = true
+	}
+
+	return e, nil
+}
+
+// Map returns a copy of the environment's variables.
+func (e *Environment) Map() map[string]string {
+	values := make(map[string]string, len(e.values))
+	for name, value := range e.values {
+		values[name] = value
+	}
+	return values
+}
+
+// List returns the environment's variables formatted as `NAME=value`, sorted
+// by name, as expected by Docker.  It returns nil if the environment is empty.
+func (e *Environment) List() []string {
+	names := make([]string, 0, len(e.values))
+	for name := range e.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var vars []string
+	for _, name := range names {
+		vars = append(vars, name+"="+e.values[name])
+	}
+	return vars
+}
+
+// Redacted returns a copy of the environment with the value of every secret
+// replaced by Redacted.
+func (e *Environment) Redacted() *Environment {
+	redacted := &Environment{values: e.Map(), secrets: map[string]bool{}}
+	for name := range e.secrets {
+		redacted.values[name] = Redacted
+		redacted.secrets[name] = true
+	}
+	return redacted
+}
+
+// Redact replaces every occurrence of a secret's value in s with Redacted.
+func (e *Environment) Redact(s string) string {
+	for name := range e.secrets {
+		if value := e.values[name]; value != "" {
+			s = strings.Replace(s, value, Redacted, -1)
+		}
+	}
+	return s
+}
+
+// isValidEnvName returns true if the name can be used as an environment
+// variable in a shell.
+func isValidEnvName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidName returns true if the secret name can safely be used as a file
+// name.
+func isValidName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"testing"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EnvironmentTestSuite struct {
+	suite.Suite
+	Provider *MemoryProvider
+}
+
+func (suite *EnvironmentTestSuite) SetupTest() {
+	suite.Provider = NewMemoryProvider(map[string]string{"database-url": "postgres://secret@db/carousel"})
+}
+
+func (suite *EnvironmentTestSuite) TestResolve() {
+	env, err := Resolve(suite.Provider, map[string]string{"RAILS_ENV": "production"}, []*schema.SecretRef{{Name: "database-url", Env: "DATABASE_URL"}})
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), map[string]string{"RAILS_ENV": "production", "DATABASE_URL": "postgres://secret@db/carousel"}, env.Map())
+	assert.Equal(suite.T(), []string{"DATABASE_URL=postgres://secret@db/carousel", "RAILS_ENV=production"}, env.List())
+}
+
+func (suite *EnvironmentTestSuite) TestResolveUsesSecretNameAsVariable() {
+	suite.Provider = NewMemoryProvider(map[string]string{"API_KEY": "d3adb33f"})
+
+	env, err := Resolve(suite.Provider, nil, []*schema.SecretRef{{Name: "API_KEY"}})
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{"API_KEY=d3adb33f"}, env.List())
+}
+
+func (suite *EnvironmentTestSuite) TestResolveMissingSecret() {
+	_, err := Resolve(suite.Provider, nil, []*schema.SecretRef{{Name: "api-key", Env: "API_KEY"}})
+
+	assert.EqualError(suite.T(), err, "The api-key secret could not be resolved: Secret not found.")
+}
+
+func (suite *EnvironmentTestSuite) TestResolveInvalidName() {
+	_, err := Resolve(suite.Provider, map[string]string{"1BAD": "value"}, nil)
+
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *EnvironmentTestSuite) TestResolveDuplicateName() {
+	_, err := Resolve(suite.Provider, map[string]string{"DATABASE_URL": "value"}, []*schema.SecretRef{{Name: "database-url", Env: "DATABASE_URL"}})
+
+	assert.EqualError(suite.T(), err, "The DATABASE_URL environment variable is set more than once.")
+}
+
+func (suite *EnvironmentTestSuite) TestRedacted() {
+	env, _ := Resolve(suite.Provider, map[string]string{"RAILS_ENV": "production"}, []*schema.SecretRef{{Name: "database-url", Env: "DATABASE_URL"}})
+
+	assert.Equal(suite.T(), []string{"DATABASE_URL=[REDACTED]", "RAILS_ENV=production"}, env.Redacted().List())
+	assert.Equal(suite.T(), "postgres://secret@db/carousel", env.Map()["DATABASE_URL"])
+}
+
+func (suite *EnvironmentTestSuite) TestRedact() {
+	env, _ := Resolve(suite.Provider, map[string]string{"RAILS_ENV": "production"}, []*schema.SecretRef{{Name: "database-url", Env: "DATABASE_URL"}})
+
+	redacted := env.Redact("could not connect to postgres://secret@db/carousel in production")
+
+	assert.Equal(suite.T(), "could not connect to [REDACTED] in production", redacted)
+}
+
+func TestEnvironmentTestSuite(t *testing.T) {
+	suite.Run(t, new(EnvironmentTestSuite))
+}
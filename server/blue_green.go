@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bmorton/deployster/clients"
+	"github.com/bmorton/deployster/progress"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/store"
+)
+
+// blueGreenSwitch tracks a blue/green deploy whose instances are online
+// alongside the previous version, waiting for traffic to be switched to them or
+// for the previous version's grace period to end.  Switches, aborts, and the
+// end of the grace period are serialized by the mutex.  Grace is the timer for
+// the current grace period, which is nil while traffic is on the previous
+// version, and done is set once the deploy has finished.
+type blueGreenSwitch struct {
+	mutex  sync.Mutex
+	record *schema.DeployRecord
+	grace  *time.Timer
+	done   bool
+}
+
+// Switch is the POST endpoint for switching all traffic of a blue/green deploy
+// from the previous version to the deploy's instances in one step.  The
+// previous version is kept for the deploy's grace period, during which
+// switching again sends all traffic straight back to it.  Once the grace period
+// ends with traffic on the deploy, the previous version is destroyed and the
+// deploy succeeds.
+//
+// This function assumes that it is nested inside
+// `/services/{name}/deploys/{id}/switch` and that Tigertonic is extracting the
+// service name and deploy ID and providing them via query params.
+func (dr *DeploysResource) Switch(u *url.URL, h http.Header, req interface{}) (int, http.Header, *DeployResponse, error) {
+	s, status, err := dr.findSwitch(u.Query().Get("name"), u.Query().Get("id"))
+	if err != nil {
+		return status, nil, nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.done {
+		return http.StatusConflict, nil, nil, errors.New("Deploy is not a blue/green deploy waiting to be switched.")
+	}
+
+	if s.grace != nil {
+		err = dr.switchBack(s)
+	} else {
+		err = dr.switchTraffic(s)
+	}
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	return http.StatusOK, nil, &DeployResponse{Deploy: s.record.Copy()}, nil
+}
+
+// awaitSwitch waits for traffic to be switched to a blue/green deploy once all
+// of its instances are online.  They were registered without any traffic, so
+// the previous version keeps serving the service.  The service stays locked
+// until the deploy succeeds or is aborted.
+func (dr *DeploysResource) awaitSwitch(record *schema.DeployRecord) {
+	s := &blueGreenSwitch{record: record}
+	dr.switchesMutex.Lock()
+	if dr.switches == nil {
+		dr.switches = make(map[string]*blueGreenSwitch)
+	}
+	dr.switches[record.ID] = s
+	dr.switchesMutex.Unlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	log.Printf("Waiting for %s traffic to be switched to %s.\n", record.ServiceName, record.Version)
+	record.Status = schema.DeployReady
+	dr.save(record)
+	dr.Progress.Publish(record.ID, &progress.Event{Type: progress.EventFinished, Deploy: record.Copy()})
+}
+
+// switchTraffic sends all traffic to the deploy and starts the previous
+// version's grace period.  The switch's mutex must be held.
+func (dr *DeploysResource) switchTraffic(s *blueGreenSwitch) error {
+	record := s.record
+	log.Printf("Switching all %s traffic to %s.\n", record.ServiceName, record.Version)
+	err := dr.shiftTraffic(record.Deploy, 100)
+	if err != nil {
+		return err
+	}
+	record.Status = schema.DeploySwitched
+	dr.recordWeight(record, 100)
+
+	var grace *time.Timer
+	grace = time.AfterFunc(record.SwitchGracePeriod(), func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.done || s.grace != grace {
+			return
+		}
+		dr.destroyPrevious(record.Deploy)
+		dr.endSwitch(s, schema.DeploySucceeded)
+	})
+	s.grace = grace
+	return nil
+}
+
+// switchBack sends all traffic back to the previous version during its grace
+// period, leaving the deploy's instances online so that traffic can be
+// switched to them again.  The switch's mutex must be held.
+func (dr *DeploysResource) switchBack(s *blueGreenSwitch) error {
+	record := s.record
+	log.Printf("Switching all %s traffic back to %s.\n", record.ServiceName, record.PreviousVersion.Version)
+	err := dr.shiftTraffic(record.Deploy, 0)
+	if err != nil {
+		return err
+	}
+	s.grace.Stop()
+	s.grace = nil
+	record.Status = schema.DeployReady
+	dr.recordWeight(record, 0)
+	return nil
+}
+
+// abortSwitch sends all traffic back to the previous version, destroys the
+// deploy's instances, and finishes the deploy as aborted.  The switch's mutex
+// must be held.
+func (dr *DeploysResource) abortSwitch(s *blueGreenSwitch) {
+	if s.grace != nil {
+		s.grace.Stop()
+	}
+	dr.shiftBack(s.record)
+	dr.endSwitch(s, schema.DeployAborted)
+}
+
+// endSwitch stops tracking the switch and finishes the deploy with the given
+// status, releasing the service's lock.
+func (dr *DeploysResource) endSwitch(s *blueGreenSwitch, status string) {
+	s.done = true
+	dr.switchesMutex.Lock()
+	delete(dr.switches, s.record.ID)
+	dr.switchesMutex.Unlock()
+
+	s.record.Status = status
+	dr.save(s.record)
+	dr.finish(s.record)
+}
+
+// findSwitch returns the switch of a blue/green deploy that's waiting for
+// traffic to be switched or is in its grace period, along with the status code
+// to respond with if it can't be found or isn't waiting.
+func (dr *DeploysResource) findSwitch(serviceName string, id string) (*blueGreenSwitch, int, error) {
+	record, err := dr.Store.Find(serviceName, id)
+	if err == store.ErrNotFound {
+		return nil, http.StatusNotFound, err
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+
+	dr.switchesMutex.Lock()
+	defer dr.switchesMutex.Unlock()
+	s, ok := dr.switches[record.ID]
+	if !ok {
+		return nil, http.StatusConflict, errors.New("Deploy is not a blue/green deploy waiting to be switched.")
+	}
+	return s, http.StatusOK, nil
+}
+
+// validateBlueGreen returns an error if the deploy can't be deployed as
+// blue/green.  Traffic is switched by weighting the endpoints of each version,
+// so the service's load balancer must be managed by deployster and support
+// weights.
+func (dr *DeploysResource) validateBlueGreen(deploy *schema.Deploy) error {
+	if deploy.Canary || deploy.Global || deploy.TrafficShift != nil {
+		return errors.New("Blue/green deploys can't be canaries, global, or shift traffic gradually.")
+	}
+
+	if deploy.GracePeriod != "" {
+		period, err := time.ParseDuration(deploy.GracePeriod)
+		if err != nil || period < 0 {
+			return fmt.Errorf("The grace period %q must be a duration such as 10m.", deploy.GracePeriod)
+		}
+	}
+
+	if _, ok := dr.Balancers.ForService(deploy.ServiceName).(clients.WeightedLoadBalancer); !ok {
+		return errors.New("Traffic can only be switched with a load balancer that supports weights, such as nginx or HAProxy.")
+	}
+	return nil
+}
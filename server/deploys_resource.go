@@ -1,29 +1,72 @@
 package server
 
 import (
-	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
-	"text/template"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/bmorton/deployster/balancers"
 	"github.com/bmorton/deployster/clients"
 	"github.com/bmorton/deployster/handlers"
+	"github.com/bmorton/deployster/health"
+	"github.com/bmorton/deployster/lock"
 	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/progress"
 	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
 	"github.com/bmorton/deployster/units"
+	"github.com/bmorton/deployster/webhooks"
 	fleet "github.com/coreos/fleet/schema"
 	"github.com/coreos/fleet/unit"
 )
 
 // DeploysResource is the HTTP resource responsible for creating and destroying
-// deployments of services.
+// deployments of services.  Every deploy that is created is recorded in the
+// Store so that its progress can be queried later.  The optional PollTimeout
+// and PollDelay override the poller's defaults when watching new deploys.  The
+// Resolver finds the address of instances for deploys with a health check.
+// Settings holds the settings that the containers of deploys are run with.
+// Balancers holds the load balancers that instances are registered with, which
+// are reconciled every EndpointCheckInterval.  Webhooks are notified of the
+// events of each deploy.
 type DeploysResource struct {
 	Fleet       clients.Fleet
+	Balancers   *balancers.Registry
 	ImagePrefix string
+	Store       store.Store
+	Templates   *templates.Registry
+	Settings    *settings.Registry
+	Secrets     secrets.Provider
+	Locks       *lock.Manager
+	Progress    *progress.Hub
+	Resolver    health.Resolver
+	PollTimeout time.Duration
+	PollDelay   time.Duration
+	Webhooks    *webhooks.Dispatcher
+
+	ShiftCheckInterval    time.Duration
+	EndpointCheckInterval time.Duration
+
+	shiftsMutex    sync.Mutex
+	shifts         map[string]*trafficShift
+	switchesMutex  sync.Mutex
+	switches       map[string]*blueGreenSwitch
+	endpointsMutex sync.Mutex
+	endpoints      map[string]*managedEndpoint
 }
 
 // DeployRequest is the wrapper struct used to deserialize the JSON payload that
@@ -32,29 +75,177 @@ type DeployRequest struct {
 	Deploy *schema.Deploy `json:"deploy"`
 }
 
-// UnitTemplate is the view model that is passed to the template parser that
-// renders a unit file.
-type UnitTemplate struct {
-	Name        string
-	Version     string
-	ImagePrefix string
-	Timestamp   string
+// DeployResponse is the wrapper struct for the JSON payload returned by the
+// Create and Show actions.  A dry run of Create returns the Plan instead of a
+// deploy record.  If the deploy's unit file is invalid, only the Problems with
+// it are returned.
+type DeployResponse struct {
+	Deploy   *schema.DeployRecord `json:"deploy,omitempty"`
+	Plan     *DeployPlan          `json:"plan,omitempty"`
+	Problems []*templates.Problem `json:"problems,omitempty"`
+}
+
+// DeployPlan describes what Create would do for a deploy without doing it: the
+// deploy with its computed instance count and previous version, the unit file
+// that would be rendered for it, and the names of the Fleet units that would be
+// created and destroyed.
+type DeployPlan struct {
+	Deploy       *schema.Deploy `json:"deploy"`
+	UnitFile     string         `json:"unit_file"`
+	CreateUnits  []string       `json:"create_units"`
+	DestroyUnits []string       `json:"destroy_units"`
+}
+
+// ScaleRequest is the wrapper struct used to deserialize the JSON payload that
+// is sent for scaling a service.
+type ScaleRequest struct {
+	Scale *Scale `json:"scale"`
+}
+
+// Scale is the number of instances that a service should be scaled to.
+type Scale struct {
+	InstanceCount int `json:"instance_count"`
+}
+
+// DeploysResponse is the wrapper struct for the JSON payload returned by the
+// Index action.
+type DeploysResponse struct {
+	Deploys []*schema.DeployRecord `json:"deploys"`
 }
 
 // Create is the POST endpoint for kicking off a new deployment of the service
 // and version provided.  It uses these parameters to spin up tasks that will
-// asyncronously start new units via Fleet and optionally wait for units to
-// complete launching so that it can destroy old versions of the service that
-// are no longer desired.
+// asyncronously start new units via Fleet and wait for units to complete
+// launching so that it can record the outcome of the deploy and optionally
+// destroy old versions of the service that are no longer desired.  The
+// response contains the deploy record, including the ID that can be used to
+// check on the deploy's progress.
+//
+// Passing `dry_run=true` in the query string validates the deploy and responds
+// with a plan of what it would do, without locking the service, recording the
+// deploy, or creating any units.
 //
 // This function assumes that it is nested inside `/services/{name}`
 // and that Tigertonic is extracting the service name and providing it via query
 // params.
-func (dr *DeploysResource) Create(u *url.URL, h http.Header, req *DeployRequest) (int, http.Header, interface{}, error) {
+func (dr *DeploysResource) Create(u *url.URL, h http.Header, req *DeployRequest) (int, http.Header, *DeployResponse, error) {
+	var err error
 	req.Deploy.ServiceName = u.Query().Get("name")
+	if u.Query().Get("dry_run") == "true" {
+		return dr.create(req.Deploy, true)
+	}
+
+	req.Deploy.ID, err = generateDeployID()
+	if err != nil {
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	return dr.withLock(req.Deploy.ServiceName, req.Deploy.ID, func() (int, http.Header, *DeployResponse, error) {
+		return dr.create(req.Deploy, false)
+	})
+}
+
+// Follow is the POST endpoint for creating a deploy, just like Create, and then
+// streaming its progress back as server-sent events until it finishes.  The
+// first event is the new deploy record, followed by an event for each unit that
+// is created and launched, each state transition of its instances, and each
+// unit of the previous version that's destroyed.  The last event carries the
+// deploy record with its final status.  If the deploy can't be created, the
+// error is returned as JSON instead, just like Create.  The stream stops early
+// if the client disconnects, while the deploy carries on in the background.
+//
+// This function assumes that it is nested inside `/services/{name}`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (dr *DeploysResource) Follow(w http.ResponseWriter, r *http.Request) {
+	var req DeployRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err == nil && req.Deploy == nil {
+		err = errors.New("A deploy must be provided.")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	deploy := req.Deploy
+	deploy.ServiceName = r.URL.Query().Get("name")
+	deploy.ID, err = generateDeployID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	feed := dr.Progress.Open(deploy.ID)
+	defer dr.Progress.Close(deploy.ID)
+
+	code, headers, response, err := dr.withLock(deploy.ServiceName, deploy.ID, func() (int, http.Header, *DeployResponse, error) {
+		return dr.create(deploy, false)
+	})
+	if err != nil {
+		writeError(w, code, err)
+		return
+	}
+	if code >= http.StatusBadRequest {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	for key, values := range headers {
+		w.Header()[key] = values
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(code)
+
+	var disconnected <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		disconnected = notifier.CloseNotify()
+	}
+
+	fw := newFlushWriter(w)
+	if writeServerSentEvent(&fw, "deploy", response) != nil {
+		return
+	}
+	for seen := 0; ; {
+		events, changed := feed.Since(seen)
+		for _, event := range events {
+			if writeServerSentEvent(&fw, event.Type, event) != nil || event.Type == progress.EventFinished {
+				return
+			}
+		}
+		seen += len(events)
+		select {
+		case <-changed:
+		case <-disconnected:
+			return
+		}
+	}
+}
+
+// create validates the requested deploy, determines the previous version and
+// number of instances, and either launches it or, for a dry run, responds with
+// the plan for launching it.
+func (dr *DeploysResource) create(deploy *schema.Deploy, dryRun bool) (int, http.Header, *DeployResponse, error) {
+	err := dr.validate(deploy)
+	if err != nil {
+		return http.StatusBadRequest, nil, nil, err
+	}
+
+	// A canary runs alongside the previous version until it's promoted, at
+	// which point the previous version is replaced.  Traffic is shifted from the
+	// previous version to the new instances once they're all online, and a
+	// blue/green deploy brings all of its instances online alongside the
+	// previous version before traffic is switched to them, so the previous
+	// version isn't destroyed until then.
+	if deploy.Canary || deploy.TrafficShift != nil || deploy.Strategy == schema.StrategyBlueGreen {
+		deploy.DestroyPrevious = true
+	}
 
-	if req.Deploy.Timestamp == "" {
-		req.Deploy.Timestamp = time.Now().UTC().Format("2006.01.02-15.04.05")
+	if deploy.Timestamp == "" {
+		deploy.Timestamp = time.Now().UTC().Format("2006.01.02-15.04.05")
 	}
 
 	allUnits, err := dr.Fleet.Units()
@@ -63,140 +254,1595 @@ func (dr *DeploysResource) Create(u *url.URL, h http.Header, req *DeployRequest)
 		return http.StatusInternalServerError, nil, nil, err
 	}
 
-	previousVersions := units.FindTimestampedServiceVersions(req.Deploy.ServiceName, allUnits)
-	previousUnits := units.FindServiceUnits(req.Deploy.ServiceName, "", allUnits)
+	previousVersions := units.FindTimestampedServiceVersions(deploy.ServiceName, allUnits)
+	previousUnits := units.FindServiceUnits(deploy.ServiceName, "", allUnits)
 
-	if req.Deploy.DestroyPrevious {
+	if deploy.DestroyPrevious {
 		if len(previousVersions) > 1 {
 			return http.StatusBadRequest, nil, nil, errors.New("Too many versions are running.  Destroying previous units is not supported when more than one version is currently running.")
 		}
 
-		if req.Deploy.InstanceCount != 0 && req.Deploy.InstanceCount < len(previousUnits) {
+		if deploy.InstanceCount != 0 && deploy.InstanceCount < len(previousUnits) {
 			return http.StatusBadRequest, nil, nil, errors.New("A greater number of instances than what was specified is already running.  Make sure this number is less than or equal to the number already running or disable destroying previous units.")
 		}
 
 		if len(previousVersions) == 1 {
-			req.Deploy.PreviousVersion = &schema.Deploy{
-				ServiceName:   req.Deploy.ServiceName,
+			deploy.PreviousVersion = &schema.Deploy{
+				ServiceName:   deploy.ServiceName,
 				Version:       previousUnits[0].Version,
 				Timestamp:     previousUnits[0].Timestamp,
 				InstanceCount: len(previousUnits),
 			}
 		} else {
-			req.Deploy.DestroyPrevious = false
+			deploy.DestroyPrevious = false
 		}
 	}
 
-	req.Deploy.InstanceCount = determineNumberOfInstances(req.Deploy.InstanceCount, len(previousVersions), len(previousUnits))
-	err = dr.startUnits(req.Deploy)
-	if err != nil {
-		return http.StatusInternalServerError, nil, nil, err
+	deploy.InstanceCount = determineNumberOfInstances(deploy.InstanceCount, len(previousVersions), len(previousUnits))
+	if deploy.Global {
+		deploy.InstanceCount = 1
+	}
+
+	if dryRun {
+		plan, err := dr.plan(deploy)
+		if err != nil {
+			return rejectUnitFile(err)
+		}
+		return http.StatusOK, nil, &DeployResponse{Plan: plan}, nil
 	}
 
-	return http.StatusCreated, nil, nil, nil
+	return dr.launch(deploy, allUnits)
 }
 
-// Destroy is the DELETE endpoint for destroying the units associated with
-// the service name and version provided.  It will destroy all instances of a
-// unit that exists within Fleet.  If a timestamp query parameter is provided,
-// only units that match that timestamp will be destroyed.
+// Rollback is the POST endpoint for redeploying the last known-good version of
+// a service in place of the version that is currently running.  The last
+// known-good version is the newest successful deploy in the service's history
+// of a version that isn't currently running.  If the history has no such
+// deploy, an older version that is still running alongside the current one is
+// used instead.  The new deploy replaces the current version's instances as it
+// comes online, as if it had been created with `destroy_previous`, and uses the
+// settings of the newest recorded deploy of the version, including its instance
+// count if nothing is running.
 //
-// This function assumes that it is nested inside
-// `/services/{name}/versions/{version}` and that Tigertonic is extracting the
-// service name/version and providing it via query params.
-func (dr *DeploysResource) Destroy(u *url.URL, h http.Header, req interface{}) (int, http.Header, interface{}, error) {
-	deploy := &schema.Deploy{
-		ServiceName: u.Query().Get("name"),
-		Version:     u.Query().Get("version"),
+// This function assumes that it is nested inside `/services/{name}/rollback`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (dr *DeploysResource) Rollback(u *url.URL, h http.Header, req interface{}) (int, http.Header, *DeployResponse, error) {
+	serviceName := u.Query().Get("name")
+	id, err := generateDeployID()
+	if err != nil {
+		return http.StatusInternalServerError, nil, nil, err
 	}
 
+	return dr.withLock(serviceName, id, func() (int, http.Header, *DeployResponse, error) {
+		return dr.rollback(serviceName, id)
+	})
+}
+
+// rollback finds the last known-good version of the service and launches a
+// deploy of it with the given ID.
+func (dr *DeploysResource) rollback(serviceName string, id string) (int, http.Header, *DeployResponse, error) {
 	allUnits, err := dr.Fleet.Units()
 	if err != nil {
 		log.Println(err)
 		return http.StatusInternalServerError, nil, nil, err
 	}
-	serviceUnits := units.FindServiceUnits(deploy.ServiceName, deploy.Version, allUnits)
 
-	for _, unit := range serviceUnits {
-		if shouldDestroyUnit(u.Query().Get("timestamp"), unit.Timestamp) {
-			instance := deploy.ServiceInstance(unit.Instance)
-			instance.Timestamp = unit.Timestamp
-			err := dr.Fleet.DestroyUnit(instance.FleetUnitName())
-			if err != nil {
-				return http.StatusInternalServerError, nil, nil, err
+	running := sortedVersions(units.FindTimestampedServiceVersions(serviceName, allUnits))
+	var current *schema.Deploy
+	if len(running) > 0 {
+		current = running[len(running)-1]
+		current.ServiceName = serviceName
+	}
+
+	version, err := dr.lastKnownGoodVersion(serviceName, current, running)
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	if version == "" {
+		return http.StatusConflict, nil, nil, errors.New("No known-good version was found to roll back to.")
+	}
+
+	deploy := &schema.Deploy{
+		ID:            id,
+		ServiceName:   serviceName,
+		Version:       version,
+		Timestamp:     time.Now().UTC().Format("2006.01.02-15.04.05"),
+		InstanceCount: 1,
+	}
+	previous, err := latestDeploy(dr.Store, serviceName, version)
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	if previous != nil {
+		inheritSettings(deploy, previous)
+		if previous.InstanceCount > 0 {
+			deploy.InstanceCount = previous.InstanceCount
+		}
+	}
+	if current != nil {
+		for _, unit := range units.FindServiceUnits(serviceName, current.Version, allUnits) {
+			if unit.Timestamp == current.Timestamp {
+				current.InstanceCount++
 			}
 		}
+		deploy.DestroyPrevious = true
+		deploy.PreviousVersion = current
+		deploy.InstanceCount = current.InstanceCount
+	}
+	if deploy.Global {
+		deploy.InstanceCount = 1
 	}
 
-	return http.StatusNoContent, nil, nil, nil
+	err = dr.validate(deploy)
+	if err != nil {
+		return http.StatusBadRequest, nil, nil, err
+	}
+
+	log.Printf("Rolling back %s to %s.\n", serviceName, version)
+	return dr.launch(deploy, allUnits)
 }
 
-// startUnits is a helper function for ensuring that Fleet has all the units
-// configured and for launching those units.
-func (dr *DeploysResource) startUnits(deploy *schema.Deploy) error {
-	options := getUnitOptions(UnitTemplate{deploy.ServiceName, deploy.Version, dr.ImagePrefix, deploy.Timestamp})
+// Scale is the PUT endpoint for changing the number of instances of the version
+// that is currently running without deploying a new version, so that running
+// containers aren't restarted.  Scaling up creates units for new instances,
+// numbered after the highest running instance, with the same unit options as
+// the running instances and watches them come online in the background just
+// like a deploy.  Scaling down destroys the highest-numbered instances.  Every
+// scale is recorded in the service's deploy history as a deploy of the running
+// version whose `scaled_from` is the number of instances that were running, and
+// the service is locked until any new instances come online.
+//
+// This function assumes that it is nested inside `/services/{name}/scale`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (dr *DeploysResource) Scale(u *url.URL, h http.Header, req *ScaleRequest) (int, http.Header, *DeployResponse, error) {
+	if req.Scale == nil || req.Scale.InstanceCount < 1 {
+		return http.StatusBadRequest, nil, nil, errors.New("The instance count must be at least 1.")
+	}
 
-	if deploy.DestroyPrevious {
-		log.Printf("Polling %s:%s.\n", deploy.ServiceName, deploy.Version)
-		poller := poller.New(deploy, dr.Fleet)
-		poller.AddSuccessHandler(&handlers.Destroyer{PreviousVersion: deploy.PreviousVersion, Client: dr.Fleet})
-		go poller.Watch()
+	serviceName := u.Query().Get("name")
+	id, err := generateDeployID()
+	if err != nil {
+		return http.StatusInternalServerError, nil, nil, err
 	}
 
-	for i := 1; i <= deploy.InstanceCount; i++ {
-		instance := deploy.ServiceInstance(strconv.Itoa(i))
-		log.Printf("Creating %s.\n", instance.FleetUnitName())
-		err := dr.Fleet.CreateUnit(&fleet.Unit{Name: instance.FleetUnitName(), Options: options})
+	return dr.withLock(serviceName, id, func() (int, http.Header, *DeployResponse, error) {
+		return dr.scale(serviceName, id, req.Scale.InstanceCount)
+	})
+}
+
+// scale creates or destroys instances of the running version of the service
+// until it has count instances, recording it as a deploy with the given ID.
+func (dr *DeploysResource) scale(serviceName string, id string, count int) (int, http.Header, *DeployResponse, error) {
+	allUnits, err := dr.Fleet.Units()
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	versions := units.FindTimestampedServiceVersions(serviceName, allUnits)
+	if len(versions) == 0 {
+		return http.StatusNotFound, nil, nil, errors.New("No running version was found to scale.")
+	}
+	if len(versions) > 1 {
+		return http.StatusConflict, nil, nil, errors.New("Too many versions are running.  Scaling is not supported when more than one version is currently running.")
+	}
+	current := sortedVersions(versions)[0]
+	current.ServiceName = serviceName
+
+	instances, options := runningInstances(current, allUnits)
+	deploy, err := dr.runningDeploy(current, id, options)
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	if deploy.Global {
+		return http.StatusBadRequest, nil, nil, errors.New("Global services run on every machine and can't be scaled.")
+	}
+	deploy.InstanceCount = count
+
+	record := schema.NewDeployRecord(deploy)
+	record.ScaledFrom = len(instances)
+
+	if count <= len(instances) {
+		log.Printf("Scaling %s:%s from %d to %d instances.\n", serviceName, current.Version, len(instances), count)
+		dr.notify(record, schema.WebhookDeployStarted)
+		record.Status = schema.DeploySucceeded
+		for i := len(instances) - 1; i >= count; i-- {
+			instance := deploy.ServiceInstance(strconv.Itoa(instances[i]))
+			if registrar := dr.registrar(deploy); registrar != nil {
+				registrar.Deregister(instance, deploy.Global)
+			}
+			log.Printf("Destroying %s.\n", instance.FleetUnitName())
+			err = dr.Fleet.DestroyUnit(instance.FleetUnitName())
+			if err != nil {
+				log.Println(err)
+				record.Status = schema.DeployFailed
+				record.Error = err.Error()
+				break
+			}
+			dr.Progress.Publish(deploy.ID, &progress.Event{Type: progress.EventUnitDestroyed, Unit: instance.FleetUnitName(), Instance: instance.Instance})
+		}
+		dr.save(record)
+		dr.finish(record)
 		if err != nil {
-			return err
+			return http.StatusInternalServerError, nil, nil, err
 		}
+		return http.StatusOK, nil, &DeployResponse{Deploy: record.Copy()}, nil
+	}
 
-		log.Printf("Launching %s.\n", instance.FleetUnitName())
-		err = dr.Fleet.SetUnitTargetState(instance.FleetUnitName(), "launched")
+	env, err := dr.environment(deploy)
+	if err != nil {
+		return rejectUnitFile(err)
+	}
+	if options == nil {
+		options, err = dr.unitOptions(deploy, env)
 		if err != nil {
-			return err
+			return rejectUnitFile(err)
 		}
 	}
 
-	return nil
+	err = dr.Store.Save(record)
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	log.Printf("Scaling %s:%s from %d to %d instances.\n", serviceName, current.Version, len(instances), count)
+	dr.notify(record, schema.WebhookDeployStarted)
+	first := instances[len(instances)-1] + 1
+	last := first + count - len(instances) - 1
+	err = dr.createUnits(deploy, options, env, first, last)
+	if err != nil {
+		record.Status = schema.DeployFailed
+		record.Error = err.Error()
+		dr.save(record)
+		dr.notify(record, schema.WebhookDeployFailed)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	record.Status = schema.DeployPolling
+	dr.save(record)
+	response := &DeployResponse{Deploy: record.Copy()}
+
+	recorder := &handlers.Recorder{Record: record, Store: dr.Store, Reporter: dr.Progress.Reporter(record.ID)}
+	go func() {
+		defer dr.finish(record)
+		summary := dr.pollBatch(deploy, first, last, false, recorder, nil)
+		recorder.Finish(summary)
+	}()
+
+	headers := http.Header{"Location": []string{fmt.Sprintf("/v1/services/%s/deploys/%s", serviceName, deploy.ID)}}
+	return http.StatusCreated, headers, response, nil
 }
 
-// determineNumberOfInstances is a helper function to either return the number
-// of instances specified or provide a default value based on the number of
-// running versions and units.
-func determineNumberOfInstances(instanceCount int, numberOfVersions int, numberOfUnits int) int {
-	if instanceCount != 0 {
-		return instanceCount
+// Restart is the POST endpoint for restarting the instances of the version that
+// is currently running without deploying a new version.  Instances are
+// restarted one at a time by setting the target state of their units to
+// inactive, waiting for Fleet to report them stopped, and then setting it back
+// to launched.  The next instance is only restarted once the poller sees the
+// previous one running again, passing the health check of the running version
+// if it has one.  A global service's single unit
+// is restarted on every machine at once.  Every restart is recorded in the
+// service's deploy history as a deploy of the running version that has
+// `restarted` set, and the service is locked until the restart finishes.
+//
+// This function assumes that it is nested inside `/services/{name}/restart`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (dr *DeploysResource) Restart(u *url.URL, h http.Header, req interface{}) (int, http.Header, *DeployResponse, error) {
+	serviceName := u.Query().Get("name")
+	id, err := generateDeployID()
+	if err != nil {
+		return http.StatusInternalServerError, nil, nil, err
 	}
 
-	if numberOfVersions == 1 {
-		return numberOfUnits
-	} else {
-		return 1
+	return dr.withLock(serviceName, id, func() (int, http.Header, *DeployResponse, error) {
+		return dr.restart(serviceName, id)
+	})
+}
+
+// restart records a restart of the running version of the service with the
+// given ID and restarts its instances in the background.
+func (dr *DeploysResource) restart(serviceName string, id string) (int, http.Header, *DeployResponse, error) {
+	allUnits, err := dr.Fleet.Units()
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	versions := units.FindTimestampedServiceVersions(serviceName, allUnits)
+	if len(versions) == 0 {
+		return http.StatusNotFound, nil, nil, errors.New("No running version was found to restart.")
+	}
+	if len(versions) > 1 {
+		return http.StatusConflict, nil, nil, errors.New("Too many versions are running.  Restarting is not supported when more than one version is currently running.")
+	}
+	current := sortedVersions(versions)[0]
+	current.ServiceName = serviceName
+
+	instances, options := runningInstances(current, allUnits)
+	deploy, err := dr.runningDeploy(current, id, options)
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	deploy.InstanceCount = len(instances)
+
+	record := schema.NewDeployRecord(deploy)
+	record.Restarted = true
+	record.Status = schema.DeployPolling
+	err = dr.Store.Save(record)
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	response := &DeployResponse{Deploy: record.Copy()}
+
+	log.Printf("Restarting %d instances of %s:%s.\n", len(instances), serviceName, current.Version)
+	dr.notify(record, schema.WebhookDeployStarted)
+	recorder := &handlers.Recorder{Record: record, Store: dr.Store, Reporter: dr.Progress.Reporter(record.ID)}
+	go func() {
+		defer dr.finish(record)
+		var summary *poller.Summary
+		for _, n := range instances {
+			err := dr.relaunchUnit(deploy, deploy.ServiceInstance(strconv.Itoa(n)))
+			if err != nil {
+				log.Println(err)
+				record.Status = schema.DeployFailed
+				record.Error = err.Error()
+				dr.save(record)
+				return
+			}
+
+			summary = dr.pollBatch(deploy, n, n, false, recorder, nil)
+			if !summary.Succeeded() {
+				log.Printf("Halting restart of %s:%s since instance %d didn't come back online.\n", serviceName, current.Version, n)
+				break
+			}
+		}
+		recorder.Finish(summary)
+	}()
+
+	headers := http.Header{"Location": []string{fmt.Sprintf("/v1/services/%s/deploys/%s", serviceName, deploy.ID)}}
+	return http.StatusCreated, headers, response, nil
+}
+
+// relaunchUnit restarts the instance's unit by setting its target state to
+// inactive and then back to launched.  It isn't launched again until Fleet
+// reports it stopped, so that the poller can't mistake the state from before
+// the restart for the instance coming back online.  The instance is
+// deregistered from the load balancer first.
+func (dr *DeploysResource) relaunchUnit(deploy *schema.Deploy, instance *schema.ServiceInstance) error {
+	if registrar := dr.registrar(deploy); registrar != nil {
+		registrar.Deregister(instance, deploy.Global)
+	}
+	log.Printf("Stopping %s.\n", instance.FleetUnitName())
+	err := dr.Fleet.SetUnitTargetState(instance.FleetUnitName(), "inactive")
+	if err != nil {
+		return err
+	}
+	err = poller.WaitUntilStopped(dr.Fleet, instance, dr.PollTimeout, dr.PollDelay)
+	if err != nil {
+		return err
 	}
+	dr.Progress.Publish(deploy.ID, &progress.Event{Type: progress.EventUnitStopped, Unit: instance.FleetUnitName(), Instance: instance.Instance})
+
+	log.Printf("Launching %s.\n", instance.FleetUnitName())
+	err = dr.Fleet.SetUnitTargetState(instance.FleetUnitName(), "launched")
+	if err != nil {
+		return err
+	}
+	dr.Progress.Publish(deploy.ID, &progress.Event{Type: progress.EventUnitLaunched, Unit: instance.FleetUnitName(), Instance: instance.Instance})
+	return nil
 }
 
-// getUnitOptions renders the unit file and converts it to an array of
-// UnitOption structs.
-func getUnitOptions(unitViewTemplate UnitTemplate) []*fleet.UnitOption {
-	var unitTemplate bytes.Buffer
-	t, _ := template.New("test").Parse(dockerUnitTemplate)
-	t.Execute(&unitTemplate, unitViewTemplate)
+// Stop is the POST endpoint for stopping the units of a service without
+// destroying them, so that they can be started again later with Start.  Units
+// are moved to the `loaded` target state by default, which stops them but
+// leaves them scheduled on their machines, or to `inactive` if `state=inactive`
+// is passed in the query string, which unschedules them too.  If a version
+// query parameter is provided, only units of that version are stopped, and if a
+// timestamp is provided as well, only units that match that timestamp.  Units
+// are deregistered from the load balancer before they're stopped.  The service
+// is locked while its units are stopped.
+//
+// This function assumes that it is nested inside `/services/{name}/stop`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (dr *DeploysResource) Stop(u *url.URL, h http.Header, req interface{}) (int, http.Header, *UnitsResponse, error) {
+	state := u.Query().Get("state")
+	if state == "" {
+		state = "loaded"
+	}
+	if state != "loaded" && state != "inactive" {
+		return http.StatusBadRequest, nil, nil, errors.New("Units can only be stopped to the loaded or inactive state.")
+	}
 
-	unitFile, _ := unit.NewUnitFile(unitTemplate.String())
+	return dr.setTargetState(u, state)
+}
 
-	return fleet.MapUnitFileToSchemaUnitOptions(unitFile)
+// Start is the POST endpoint for launching the units of a service that were
+// stopped with Stop.  The same version and timestamp query parameters are
+// supported to only start the units of a version.  Instances are registered
+// with the load balancer in the background as they come back online.  The
+// service is locked while its units are started.
+//
+// This function assumes that it is nested inside `/services/{name}/start`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (dr *DeploysResource) Start(u *url.URL, h http.Header, req interface{}) (int, http.Header, *UnitsResponse, error) {
+	return dr.setTargetState(u, "launched")
 }
 
-// shouldDestroyUnit takes an optional timestamp (from the query string) and, if
-// specified, ensures that it matches the unitTimestamp.  If the optional
-// timestamp is left blank, we'll return true.  If the optional timestamp is
-// present and it doesn't match the timestamp, we'll return false.
-func shouldDestroyUnit(blankOrTimestampToMatch string, unitTimestamp string) bool {
-	if blankOrTimestampToMatch == "" {
-		return true
-	} else if blankOrTimestampToMatch == unitTimestamp {
-		return true
+// setTargetState sets the target state of the service's units that match the
+// version and timestamp query parameters while holding the service's lock, and
+// responds with the units that were changed.
+func (dr *DeploysResource) setTargetState(u *url.URL, state string) (int, http.Header, *UnitsResponse, error) {
+	serviceName := u.Query().Get("name")
+	id, err := generateDeployID()
+	if err != nil {
+		return http.StatusInternalServerError, nil, nil, err
 	}
-	return false
+	err = dr.Locks.Acquire(serviceName, id)
+	if err != nil {
+		return http.StatusConflict, nil, nil, err
+	}
+	defer dr.Locks.Release(serviceName, id)
+
+	allUnits, err := dr.Fleet.Units()
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	var index *deployIndex
+	if dr.Balancers.Manages(serviceName) {
+		index, err = dr.newDeployIndex(serviceName, allUnits)
+		if err != nil {
+			log.Println(err)
+			return http.StatusInternalServerError, nil, nil, err
+		}
+	}
+
+	response := &UnitsResponse{Units: []units.VersionedUnit{}}
+	for _, unit := range units.FindServiceUnits(serviceName, u.Query().Get("version"), allUnits) {
+		if !shouldDestroyUnit(u.Query().Get("timestamp"), unit.Timestamp) {
+			continue
+		}
+		instance := &schema.ServiceInstance{Name: serviceName, Version: unit.Version, Timestamp: unit.Timestamp, Instance: unit.Instance}
+		var deploy *schema.Deploy
+		if index != nil {
+			deploy = index.unitDeploy(unit)
+			if state != "launched" {
+				dr.registrar(deploy).Deregister(instance, deploy.Global)
+			}
+		}
+
+		log.Printf("Setting target state of %s to %s.\n", instance.FleetUnitName(), state)
+		err = dr.Fleet.SetUnitTargetState(instance.FleetUnitName(), state)
+		if err != nil {
+			log.Println(err)
+			return http.StatusInternalServerError, nil, nil, err
+		}
+		if deploy != nil && state == "launched" {
+			dr.registerWhenOnline(deploy, dr.registrar(deploy), instance)
+		}
+		unit.DesiredState = state
+		response.Units = append(response.Units, unit)
+	}
+	if len(response.Units) == 0 {
+		return http.StatusNotFound, nil, nil, errors.New("No units were found for the service.")
+	}
+
+	return http.StatusOK, nil, response, nil
+}
+
+// deployIndex finds the deploys that a service's units belong to from a single
+// listing of the service's deploy history, so that acting on many units doesn't
+// list the history again for each one.
+type deployIndex struct {
+	allUnits []*fleet.Unit
+	records  []*schema.DeployRecord
+	latest   map[string]*schema.Deploy
+	deploys  map[string]*schema.Deploy
+}
+
+// newDeployIndex lists the service's deploy history and indexes the newest
+// recorded deploy of each version.
+func (dr *DeploysResource) newDeployIndex(serviceName string, allUnits []*fleet.Unit) (*deployIndex, error) {
+	records, err := dr.Store.List(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]*schema.Deploy)
+	for _, record := range records {
+		if _, ok := latest[record.Version]; !ok {
+			latest[record.Version] = record.Deploy
+		}
+	}
+	return &deployIndex{allUnits: allUnits, records: records, latest: latest, deploys: make(map[string]*schema.Deploy)}, nil
+}
+
+// unitDeploy returns the deploy that the unit belongs to, with the health check
+// and scheduling options of the newest recorded deploy of its version.  Units of
+// the same version and timestamp share a deploy.
+func (i *deployIndex) unitDeploy(unit units.VersionedUnit) *schema.Deploy {
+	key := unit.Version + ":" + unit.Timestamp
+	if deploy, ok := i.deploys[key]; ok {
+		return deploy
+	}
+	version := &schema.Deploy{ServiceName: unit.Service, Version: unit.Version, Timestamp: unit.Timestamp}
+	_, options := runningInstances(version, i.allUnits)
+	deploy := runningDeployOf(version, i.latest[unit.Version], options)
+	i.deploys[key] = deploy
+	return deploy
+}
+
+// registerWhenOnline polls the instance in the background and registers it
+// with the load balancer once it's online.
+func (dr *DeploysResource) registerWhenOnline(deploy *schema.Deploy, registrar *handlers.Registrar, instance *schema.ServiceInstance) {
+	n, err := strconv.Atoi(instance.Instance)
+	if err != nil {
+		return
+	}
+	p := dr.newPoller(deploy, n, n)
+	p.AddSuccessHandler(registrar)
+	go p.Watch()
+}
+
+// Index is the GET endpoint for listing the recorded deploys of a service,
+// newest first.
+//
+// This function assumes that it is nested inside `/services/{name}`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (dr *DeploysResource) Index(u *url.URL, h http.Header, req interface{}) (int, http.Header, *DeploysResponse, error) {
+	records, err := dr.Store.List(u.Query().Get("name"))
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	return http.StatusOK, nil, &DeploysResponse{Deploys: records}, nil
+}
+
+// Show is the GET endpoint for retrieving the record of a single deploy,
+// including its status and the state transitions of its instances.
+//
+// This function assumes that it is nested inside `/services/{name}/deploys/{id}`
+// and that Tigertonic is extracting the service name and deploy ID and
+// providing them via query params.
+func (dr *DeploysResource) Show(u *url.URL, h http.Header, req interface{}) (int, http.Header, *DeployResponse, error) {
+	record, err := dr.Store.Find(u.Query().Get("name"), u.Query().Get("id"))
+	if err == store.ErrNotFound {
+		return http.StatusNotFound, nil, nil, err
+	}
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	return http.StatusOK, nil, &DeployResponse{Deploy: record}, nil
+}
+
+// Promote is the POST endpoint for rolling out the rest of a canary deploy once
+// its canary instance is running.  The previous version's first instance is
+// destroyed in favor of the canary and the remaining instances are rolled out
+// as if the deploy had been created without a canary, replacing the previous
+// version as they come online.
+//
+// This function assumes that it is nested inside
+// `/services/{name}/deploys/{id}/promote` and that Tigertonic is extracting the
+// service name and deploy ID and providing them via query params.
+func (dr *DeploysResource) Promote(u *url.URL, h http.Header, req interface{}) (int, http.Header, *DeployResponse, error) {
+	record, status, err := dr.claimCanary(u.Query().Get("name"), u.Query().Get("id"), schema.DeployPolling)
+	if err != nil {
+		return status, nil, nil, err
+	}
+
+	status, headers, response, err := dr.withLock(record.ServiceName, record.ID, func() (int, http.Header, *DeployResponse, error) {
+		return dr.promote(record)
+	})
+	if err != nil && record.Status == schema.DeployPolling {
+		// Nothing was rolled out, so the canary can still be promoted or
+		// aborted.
+		record.Status = schema.DeployCanary
+		dr.save(record)
+	}
+	return status, headers, response, err
+}
+
+// promote replaces the previous version's first instance with the canary and
+// starts rolling out the rest of the deploy.
+func (dr *DeploysResource) promote(record *schema.DeployRecord) (int, http.Header, *DeployResponse, error) {
+	deploy := record.Deploy
+
+	allUnits, err := dr.Fleet.Units()
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	previousOptions := dr.previousUnitOptions(deploy.PreviousVersion, allUnits)
+
+	log.Printf("Promoting canary of %s:%s.\n", deploy.ServiceName, deploy.Version)
+	if deploy.DestroyPrevious && deploy.PreviousVersion != nil {
+		destroyer := &handlers.Destroyer{PreviousVersion: deploy.PreviousVersion, Client: dr.Fleet, Registrar: dr.registrar(deploy), Reporter: dr.Progress.Reporter(deploy.ID), Notifier: dr.notifier(deploy, schema.WebhookPreviousDestroyed)}
+		destroyer.Handle(&poller.Event{ServiceInstance: deploy.ServiceInstance("1")})
+	}
+
+	if deploy.InstanceCount > 1 {
+		err = dr.startUnits(deploy, 2, batchEnd(deploy, 2))
+		if err != nil {
+			record.Status = schema.DeployFailed
+			record.Error = err.Error()
+			dr.save(record)
+			return http.StatusInternalServerError, nil, nil, err
+		}
+	}
+
+	record.Status = schema.DeployPolling
+	dr.save(record)
+	response := &DeployResponse{Deploy: record.Copy()}
+	dr.watch(record, previousOptions, 2)
+
+	return http.StatusOK, nil, response, nil
+}
+
+// Abort is the POST endpoint for abandoning a canary deploy, a deploy that's
+// shifting traffic, or a blue/green deploy that hasn't succeeded yet.  The
+// canary instance is deregistered and destroyed, the previous version is left
+// running untouched, and the deploy is finished.  Deploys that shift or switch
+// traffic first send all of it back to the previous version before their
+// instances are destroyed.
+//
+// This function assumes that it is nested inside
+// `/services/{name}/deploys/{id}/abort` and that Tigertonic is extracting the
+// service name and deploy ID and providing them via query params.
+func (dr *DeploysResource) Abort(u *url.URL, h http.Header, req interface{}) (int, http.Header, *DeployResponse, error) {
+	shift, _, err := dr.findShift(u.Query().Get("name"), u.Query().Get("id"))
+	if err == nil {
+		shift.mutex.Lock()
+		defer shift.mutex.Unlock()
+		if shift.done {
+			return http.StatusConflict, nil, nil, errors.New("Deploy is not shifting traffic.")
+		}
+		dr.abortShift(shift, schema.DeployAborted, nil)
+		return http.StatusOK, nil, &DeployResponse{Deploy: shift.record.Copy()}, nil
+	}
+
+	s, _, err := dr.findSwitch(u.Query().Get("name"), u.Query().Get("id"))
+	if err == nil {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.done {
+			return http.StatusConflict, nil, nil, errors.New("Deploy is not a blue/green deploy waiting to be switched.")
+		}
+		dr.abortSwitch(s)
+		return http.StatusOK, nil, &DeployResponse{Deploy: s.record.Copy()}, nil
+	}
+
+	record, status, err := dr.claimCanary(u.Query().Get("name"), u.Query().Get("id"), schema.DeployAborted)
+	if err != nil {
+		return status, nil, nil, err
+	}
+
+	canary := record.Deploy.ServiceInstance("1")
+	log.Printf("Aborting canary %s.\n", canary.FleetUnitName())
+	if registrar := dr.registrar(record.Deploy); registrar != nil {
+		registrar.Deregister(canary, false)
+	}
+	err = dr.Fleet.DestroyUnit(canary.FleetUnitName())
+	if err != nil {
+		log.Println(err)
+		record.Status = schema.DeployCanary
+		dr.save(record)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	dr.finish(record)
+
+	return http.StatusOK, nil, &DeployResponse{Deploy: record.Copy()}, nil
+}
+
+// Destroy is the DELETE endpoint for destroying the units associated with
+// the service name and version provided.  It will destroy all instances of a
+// unit that exists within Fleet.  If a timestamp query parameter is provided,
+// only units that match that timestamp will be destroyed.  Instances are
+// deregistered from the load balancer before they're destroyed.
+//
+// This function assumes that it is nested inside `/services/{name}/deploys/{id}`
+// and that Tigertonic is extracting the service name/version and providing it
+// via query params.  Tigertonic only supports a single parameter name for each
+// path segment, so the version is provided as the `id` parameter that is shared
+// with the Show endpoint.
+func (dr *DeploysResource) Destroy(u *url.URL, h http.Header, req interface{}) (int, http.Header, interface{}, error) {
+	deploy := &schema.Deploy{
+		ServiceName: u.Query().Get("name"),
+		Version:     u.Query().Get("id"),
+	}
+
+	allUnits, err := dr.Fleet.Units()
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	serviceUnits := units.FindServiceUnits(deploy.ServiceName, deploy.Version, allUnits)
+
+	var index *deployIndex
+	if dr.Balancers.Manages(deploy.ServiceName) {
+		index, err = dr.newDeployIndex(deploy.ServiceName, allUnits)
+		if err != nil {
+			log.Println(err)
+			return http.StatusInternalServerError, nil, nil, err
+		}
+	}
+
+	for _, unit := range serviceUnits {
+		if shouldDestroyUnit(u.Query().Get("timestamp"), unit.Timestamp) {
+			instance := deploy.ServiceInstance(unit.Instance)
+			instance.Timestamp = unit.Timestamp
+			if index != nil {
+				unitDeploy := index.unitDeploy(unit)
+				dr.registrar(unitDeploy).Deregister(instance, unitDeploy.Global)
+			}
+			err := dr.Fleet.DestroyUnit(instance.FleetUnitName())
+			if err != nil {
+				return http.StatusInternalServerError, nil, nil, err
+			}
+		}
+	}
+
+	return http.StatusNoContent, nil, nil, nil
+}
+
+// launch records the deploy, starts its first batch of units, and begins
+// watching it in the background.  The deploy is expected to be fully
+// populated, including its ID.  A deploy whose secrets can't be resolved or
+// whose unit file can't be rendered from its template is rejected before
+// anything is recorded.  The response contains the new deploy record along with
+// a Location header pointing at it.
+func (dr *DeploysResource) launch(deploy *schema.Deploy, allUnits []*fleet.Unit) (int, http.Header, *DeployResponse, error) {
+	env, err := dr.environment(deploy)
+	if err != nil {
+		return rejectUnitFile(err)
+	}
+	_, err = dr.renderUnitFile(deploy, env)
+	if err != nil {
+		return rejectUnitFile(err)
+	}
+
+	record := schema.NewDeployRecord(deploy)
+	err = dr.Store.Save(record)
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	dr.notify(record, schema.WebhookDeployStarted)
+
+	last := batchEnd(deploy, 1)
+	if deploy.Canary {
+		last = 1
+	}
+	err = dr.startUnits(deploy, 1, last)
+	if err != nil {
+		record.Status = schema.DeployFailed
+		record.Error = err.Error()
+		dr.save(record)
+		dr.notify(record, schema.WebhookDeployFailed)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	record.Status = schema.DeployPolling
+	dr.save(record)
+	response := &DeployResponse{Deploy: record.Copy()}
+	previousOptions := dr.previousUnitOptions(deploy.PreviousVersion, allUnits)
+	if deploy.Canary {
+		dr.watchCanary(record, previousOptions)
+	} else {
+		dr.watch(record, previousOptions, 1)
+	}
+
+	headers := http.Header{"Location": []string{fmt.Sprintf("/v1/services/%s/deploys/%s", deploy.ServiceName, deploy.ID)}}
+	return http.StatusCreated, headers, response, nil
+}
+
+// runningInstances returns the instance numbers of the version's units in
+// Fleet, from lowest to highest, along with the unit options they were created
+// with.
+func runningInstances(version *schema.Deploy, allUnits []*fleet.Unit) ([]int, []*fleet.UnitOption) {
+	var instances []int
+	var options []*fleet.UnitOption
+	for _, unit := range units.FindServiceUnits(version.ServiceName, version.Version, allUnits) {
+		if unit.Timestamp != version.Timestamp {
+			continue
+		}
+		n, err := strconv.Atoi(unit.Instance)
+		if err != nil {
+			continue
+		}
+		instances = append(instances, n)
+		for _, u := range allUnits {
+			if u.Name == version.ServiceInstance(unit.Instance).FleetUnitName() && len(u.Options) > 0 {
+				options = u.Options
+			}
+		}
+	}
+	sort.Ints(instances)
+	return instances, options
+}
+
+// runningDeploy returns a deploy with the given ID of the running version,
+// carrying over the settings of the newest recorded deploy of the version.  The
+// deploy is global if the running units were created with `Global=true`.
+func (dr *DeploysResource) runningDeploy(current *schema.Deploy, id string, options []*fleet.UnitOption) (*schema.Deploy, error) {
+	deploy := &schema.Deploy{
+		ID:          id,
+		ServiceName: current.ServiceName,
+		Version:     current.Version,
+		Timestamp:   current.Timestamp,
+	}
+	previous, err := latestDeploy(dr.Store, current.ServiceName, current.Version)
+	if err != nil {
+		return nil, err
+	}
+	return runningDeployOf(deploy, previous, options), nil
+}
+
+// runningDeployOf carries over the settings of previous, the newest recorded
+// deploy of the running version if there is one, onto the deploy and marks it
+// global if the running units were created with `Global=true`.
+func runningDeployOf(deploy *schema.Deploy, previous *schema.Deploy, options []*fleet.UnitOption) *schema.Deploy {
+	if previous != nil {
+		inheritSettings(deploy, previous)
+	}
+	deploy.Global = false
+	for _, option := range options {
+		if option.Section == "X-Fleet" && option.Name == "Global" && option.Value == "true" {
+			deploy.Global = true
+		}
+	}
+	return deploy
+}
+
+// inheritSettings copies the settings that a recorded deploy of a version was
+// launched with onto a new deploy of the same version, so that it's launched
+// the same way.
+func inheritSettings(deploy *schema.Deploy, previous *schema.Deploy) {
+	deploy.HealthCheck = previous.HealthCheck
+	deploy.Template = previous.Template
+	deploy.Env = previous.Env
+	deploy.Secrets = previous.Secrets
+	deploy.MachineMetadata = previous.MachineMetadata
+	deploy.Conflicts = previous.Conflicts
+	deploy.MachineOf = previous.MachineOf
+	deploy.Global = previous.Global
+	deploy.Strategy = previous.Strategy
+	deploy.GracePeriod = previous.GracePeriod
+	deploy.BatchSize = previous.BatchSize
+	deploy.MaxSurge = previous.MaxSurge
+}
+
+// lastKnownGoodVersion returns the version that a rollback should redeploy or
+// an empty string if there isn't one.  The service's history is searched for
+// the newest successful deploy of a version other than the current one.  If
+// there is none, the newest of the other running versions is used.
+func (dr *DeploysResource) lastKnownGoodVersion(serviceName string, current *schema.Deploy, running []*schema.Deploy) (string, error) {
+	currentVersion := ""
+	if current != nil {
+		currentVersion = current.Version
+	}
+
+	records, err := dr.Store.List(serviceName)
+	if err != nil {
+		return "", err
+	}
+	for _, record := range records {
+		if record.Status == schema.DeploySucceeded && record.Version != currentVersion {
+			return record.Version, nil
+		}
+	}
+
+	for i := len(running) - 1; i >= 0; i-- {
+		if running[i].Version != currentVersion {
+			return running[i].Version, nil
+		}
+	}
+
+	return "", nil
+}
+
+// latestDeploy returns the newest recorded deploy of the version of the
+// service, or nil if the version has never been recorded.
+func latestDeploy(deployStore store.Store, serviceName string, version string) (*schema.Deploy, error) {
+	records, err := deployStore.List(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.Version == version {
+			return record.Deploy, nil
+		}
+	}
+	return nil, nil
+}
+
+// plan describes the units that launching the deploy would create and, if it
+// destroys the previous version, the units it would destroy.  The values of
+// the deploy's secrets are redacted from the unit file.  An error is returned if
+// the secrets can't be resolved or the unit file can't be rendered.
+func (dr *DeploysResource) plan(deploy *schema.Deploy) (*DeployPlan, error) {
+	env, err := dr.environment(deploy)
+	if err != nil {
+		return nil, err
+	}
+	unitFile, err := dr.renderUnitFile(deploy, env.Redacted())
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &DeployPlan{
+		Deploy:       deploy,
+		UnitFile:     unitFile,
+		CreateUnits:  []string{},
+		DestroyUnits: []string{},
+	}
+
+	for i := 1; i <= deploy.InstanceCount; i++ {
+		plan.CreateUnits = append(plan.CreateUnits, deploy.ServiceInstance(strconv.Itoa(i)).FleetUnitName())
+	}
+
+	if deploy.DestroyPrevious && deploy.PreviousVersion != nil {
+		for i := 1; i <= deploy.PreviousVersion.InstanceCount; i++ {
+			plan.DestroyUnits = append(plan.DestroyUnits, deploy.PreviousVersion.ServiceInstance(strconv.Itoa(i)).FleetUnitName())
+		}
+	}
+
+	return plan, nil
+}
+
+// startUnits is a helper function for ensuring that Fleet has units configured
+// for instances first through last and for launching those units.  The values
+// of the deploy's secrets are redacted from any error so that they're never
+// recorded or logged.
+func (dr *DeploysResource) startUnits(deploy *schema.Deploy, first int, last int) error {
+	env, err := dr.environment(deploy)
+	if err != nil {
+		return err
+	}
+	options, err := dr.unitOptions(deploy, env)
+	if err != nil {
+		return err
+	}
+	return dr.createUnits(deploy, options, env, first, last)
+}
+
+// createUnits creates and launches units with the given options for instances
+// first through last of the deploy, redacting the values of the secrets in env
+// from any error.
+func (dr *DeploysResource) createUnits(deploy *schema.Deploy, options []*fleet.UnitOption, env *secrets.Environment, first int, last int) error {
+	for i := first; i <= last; i++ {
+		instance := deploy.ServiceInstance(strconv.Itoa(i))
+		log.Printf("Creating %s.\n", instance.FleetUnitName())
+		err := dr.Fleet.CreateUnit(&fleet.Unit{Name: instance.FleetUnitName(), Options: options})
+		if err != nil {
+			return redact(env, err)
+		}
+		dr.Progress.Publish(deploy.ID, &progress.Event{Type: progress.EventUnitCreated, Unit: instance.FleetUnitName(), Instance: instance.Instance})
+
+		log.Printf("Launching %s.\n", instance.FleetUnitName())
+		err = dr.Fleet.SetUnitTargetState(instance.FleetUnitName(), "launched")
+		if err != nil {
+			return redact(env, err)
+		}
+		dr.Progress.Publish(deploy.ID, &progress.Event{Type: progress.EventUnitLaunched, Unit: instance.FleetUnitName(), Instance: instance.Instance})
+	}
+
+	return nil
+}
+
+// watch rolls out the deploy in the background, starting with the batch that
+// begins at instance from, which is expected to have already been launched.
+// Every state transition is recorded and, once the rollout stops, the final
+// status of the deploy is saved and the service's lock is released.
+// previousOptions are the unit options used to relaunch the previous version if
+// the deploy is rolled back.
+func (dr *DeploysResource) watch(record *schema.DeployRecord, previousOptions []*fleet.UnitOption, from int) {
+	recorder := &handlers.Recorder{Record: record, Store: dr.Store, Reporter: dr.Progress.Reporter(record.ID)}
+	rollbacker := dr.newRollbacker(record.Deploy, previousOptions)
+
+	go func() {
+		summary, err := dr.rollout(record.Deploy, from, recorder, rollbacker)
+		if rollbacker != nil {
+			record.RolledBack = rollbacker.RolledBack
+			dr.registerRelaunched(rollbacker)
+		}
+		if err != nil {
+			record.Status = schema.DeployFailed
+			record.Error = err.Error()
+			dr.save(record)
+			dr.finish(record)
+			return
+		}
+		if record.Deploy.ShiftsTraffic() && summary != nil && summary.Succeeded() {
+			dr.startShift(record)
+			return
+		}
+		if record.Deploy.SwitchesTraffic() && summary != nil && summary.Succeeded() {
+			dr.awaitSwitch(record)
+			return
+		}
+		recorder.Finish(summary)
+		dr.finish(record)
+	}()
+}
+
+// watchCanary polls the canary instance of the deploy in the background.  The
+// previous version is left running alongside it and, once the canary is
+// running, the deploy waits to be promoted or aborted while keeping the
+// service locked.  If the canary doesn't come online, the final status of the
+// deploy is saved and the lock is released instead.
+func (dr *DeploysResource) watchCanary(record *schema.DeployRecord, previousOptions []*fleet.UnitOption) {
+	recorder := &handlers.Recorder{Record: record, Store: dr.Store, Reporter: dr.Progress.Reporter(record.ID)}
+	rollbacker := dr.newRollbacker(record.Deploy, previousOptions)
+
+	go func() {
+		summary := dr.pollBatch(record.Deploy, 1, 1, false, recorder, rollbacker)
+		if summary.Succeeded() {
+			record.Status = schema.DeployCanary
+			dr.save(record)
+			dr.Progress.Publish(record.ID, &progress.Event{Type: progress.EventFinished, Deploy: record.Copy()})
+			return
+		}
+		if rollbacker != nil {
+			record.RolledBack = rollbacker.RolledBack
+		}
+		recorder.Finish(summary)
+		dr.finish(record)
+	}()
+}
+
+// rollout polls each batch of the deploy's instances in turn, starting with the
+// batch that begins at instance from, and only launches the next batch once
+// every instance in the current one is running.  Batches are limited by both
+// the deploy's batch size and its max surge, so only the first batch is started
+// when the deploy is created.  A batch that doesn't succeed
+// halts the rollout.  The summary of the last batch that was polled is
+// returned, which is nil if there were no instances left to roll out.  An error
+// is returned if the units for a later batch can't be started.
+func (dr *DeploysResource) rollout(deploy *schema.Deploy, from int, recorder *handlers.Recorder, rollbacker *handlers.Rollbacker) (*poller.Summary, error) {
+	var summary *poller.Summary
+	for first := from; first <= deploy.InstanceCount; first = batchEnd(deploy, first) + 1 {
+		last := batchEnd(deploy, first)
+
+		if first > from {
+			err := dr.startUnits(deploy, first, last)
+			if err != nil {
+				log.Println(err)
+				if rollbacker != nil {
+					rollbacker.Handle(&poller.Event{ServiceInstance: deploy.ServiceInstance(strconv.Itoa(first))})
+				}
+				return summary, err
+			}
+		}
+
+		summary = dr.pollBatch(deploy, first, last, deploy.DestroyPrevious && !deploy.ShiftsTraffic() && !deploy.SwitchesTraffic(), recorder, rollbacker)
+		if !summary.Succeeded() {
+			log.Printf("Halting rollout of %s:%s since instances %d-%d didn't all come online.\n", deploy.ServiceName, deploy.Version, first, last)
+			return summary, nil
+		}
+	}
+
+	return summary, nil
+}
+
+// pollBatch waits for instances first through last of the deploy to resolve and
+// returns the summary of their outcomes.  If destroyPrevious is set, the previous
+// version's matching instances are destroyed as new instances come online.  If
+// deployster manages the load balancer, each new instance is registered with
+// it as it comes online, before any previous instance is deregistered and
+// destroyed.  Webhooks are notified of each instance that comes online or
+// fails.  If a rollbacker is given, the deploy is rolled back as soon as an
+// instance fails or the batch times out.
+func (dr *DeploysResource) pollBatch(deploy *schema.Deploy, first int, last int, destroyPrevious bool, recorder *handlers.Recorder, rollbacker *handlers.Rollbacker) *poller.Summary {
+	log.Printf("Polling %s:%s instances %d-%d.\n", deploy.ServiceName, deploy.Version, first, last)
+	p := dr.newPoller(deploy, first, last)
+	p.AddEventHandler(recorder)
+	registrar := dr.registrar(deploy)
+	if registrar != nil {
+		p.AddSuccessHandler(registrar)
+	}
+	p.AddSuccessHandler(dr.notifier(deploy, schema.WebhookInstanceRunning))
+	if destroyPrevious {
+		p.AddSuccessHandler(&handlers.Destroyer{PreviousVersion: deploy.PreviousVersion, ReplaceAll: deploy.Global, Client: dr.Fleet, Registrar: registrar, Reporter: dr.Progress.Reporter(deploy.ID), Notifier: dr.notifier(deploy, schema.WebhookPreviousDestroyed)})
+	}
+	p.AddFailureHandler(dr.notifier(deploy, schema.WebhookInstanceFailed))
+	if rollbacker != nil {
+		p.AddFailureHandler(poller.HandlerFunc(func(e *poller.Event) {
+			p.Stop(fmt.Sprintf("Stopped polling %s:%s to roll back.", deploy.ServiceName, deploy.Version))
+			rollbacker.Handle(e)
+		}))
+		p.AddTimeoutHandler(rollbacker)
+	}
+
+	var summary *poller.Summary
+	p.AddCompletionHandler(poller.HandlerFunc(func(e *poller.Event) {
+		summary = e.Summary
+	}))
+	p.Watch()
+
+	return summary
+}
+
+// newRollbacker returns a rollbacker for the deploy if it should be rolled back
+// on failure, otherwise nil.
+func (dr *DeploysResource) newRollbacker(deploy *schema.Deploy, previousOptions []*fleet.UnitOption) *handlers.Rollbacker {
+	if !deploy.RollbackOnFailure {
+		return nil
+	}
+	return &handlers.Rollbacker{Deploy: deploy, PreviousOptions: previousOptions, Client: dr.Fleet, Registrar: dr.registrar(deploy)}
+}
+
+// registerRelaunched registers the previous version's instances with the load
+// balancer as they come back online if the rollbacker relaunched them.
+func (dr *DeploysResource) registerRelaunched(rollbacker *handlers.Rollbacker) {
+	deploy := rollbacker.Deploy
+	if !dr.Balancers.Manages(deploy.ServiceName) || !rollbacker.RolledBack || !deploy.DestroyPrevious || deploy.PreviousVersion == nil {
+		return
+	}
+
+	previous := deploy.PreviousVersion
+	registrar := dr.registrar(previous)
+	for i := 1; i <= previous.InstanceCount; i++ {
+		dr.registerWhenOnline(previous, registrar, previous.ServiceInstance(strconv.Itoa(i)))
+	}
+}
+
+// registrar returns the handler that registers the deploy's instances with the
+// service's load balancer once they're online, at the addresses found by the
+// Resolver, or nil if deployster doesn't manage its load balancer.  Instances
+// are deregistered with it before they're stopped or destroyed.
+func (dr *DeploysResource) registrar(deploy *schema.Deploy) *handlers.Registrar {
+	balancer := dr.Balancers.ForService(deploy.ServiceName)
+	if balancer == nil {
+		return nil
+	}
+	return &handlers.Registrar{
+		Balancer: balancer,
+		Resolver: dr.Resolver,
+		Fleet:    dr.Fleet,
+		Port:     dr.Settings.ForService(deploy.ServiceName).HTTPPort(),
+		Drained:  deploy.ShiftsTraffic() || deploy.SwitchesTraffic(),
+		Reporter: dr.Progress.Reporter(deploy.ID),
+	}
+}
+
+// previousUnitOptions returns the unit options of the previous version so that
+// it can be relaunched if the deploy is rolled back.  The options are taken from
+// Fleet when available and otherwise rendered from the unit template.
+func (dr *DeploysResource) previousUnitOptions(previous *schema.Deploy, allUnits []*fleet.Unit) []*fleet.UnitOption {
+	if previous == nil {
+		return nil
+	}
+
+	for i := 1; i <= previous.InstanceCount; i++ {
+		name := previous.ServiceInstance(strconv.Itoa(i)).FleetUnitName()
+		for _, u := range allUnits {
+			if u.Name == name && len(u.Options) > 0 {
+				return u.Options
+			}
+		}
+	}
+
+	env, err := dr.environment(previous)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	options, err := dr.unitOptions(previous, env)
+	if err != nil {
+		log.Println(err)
+	}
+	return options
+}
+
+// newPoller returns a poller for instances first through last of the deploy
+// using the timeout and delay configured on the resource, if any.  If the
+// deploy has a health check, instances are only resolved once it passes on the
+// port the service serves HTTP on.
+func (dr *DeploysResource) newPoller(deploy *schema.Deploy, first int, last int) *poller.Poller {
+	p := poller.NewBatch(deploy, dr.Fleet, first, last)
+	if deploy.HealthCheck != nil {
+		checker := health.NewChecker(deploy.HealthCheck, dr.Resolver)
+		checker.Port = dr.Settings.ForService(deploy.ServiceName).HTTPPort()
+		p.Checker = checker
+	}
+	if dr.PollTimeout != 0 {
+		p.Timeout = dr.PollTimeout
+	}
+	if dr.PollDelay != 0 {
+		p.Delay = dr.PollDelay
+	}
+	return p
+}
+
+// interruptedStatuses maps the statuses of deploys that are only driven from
+// memory, and so can't be picked up again after deployster restarts, to what
+// the deploy was doing.
+var interruptedStatuses = map[string]string{
+	schema.DeployLaunching: "launching its instances",
+	schema.DeployPolling:   "waiting for its instances to come online",
+	schema.DeployShifting:  "shifting traffic",
+	schema.DeployReady:     "waiting to be switched",
+	schema.DeploySwitched:  "in its grace period",
+}
+
+// FailInterruptedDeploys marks every recorded deploy that deployster was
+// still driving when it last stopped as failed, since nothing would otherwise
+// ever finish it.  The deploy's instances and traffic are left as they were.
+// It should be called once on startup, before any deploys are created.
+func (dr *DeploysResource) FailInterruptedDeploys() error {
+	serviceNames, err := dr.Store.Services()
+	if err != nil {
+		return err
+	}
+
+	for _, serviceName := range serviceNames {
+		records, err := dr.Store.List(serviceName)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			doing, ok := interruptedStatuses[record.Status]
+			if !ok {
+				continue
+			}
+			status := record.Status
+			record.Error = interruptedError(record, doing)
+			record.Status = schema.DeployFailed
+			record.UpdatedAt = time.Now().UTC()
+			err = dr.Store.SaveIfStatus(record, status)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			log.Printf("Marked deploy %s of %s as failed since it was %s.\n", record.ID, serviceName, doing)
+			dr.finish(record)
+		}
+	}
+	return nil
+}
+
+// interruptedError explains why a deploy that was interrupted by a restart
+// failed.  Deploys that were moving traffic also record how much they had.
+func interruptedError(record *schema.DeployRecord, doing string) string {
+	switch record.Status {
+	case schema.DeployShifting, schema.DeployReady, schema.DeploySwitched:
+		return fmt.Sprintf("Deployster restarted while the deploy was %s, so both versions were left running with %d%% of traffic on this one.", doing, record.TrafficWeight)
+	}
+	return fmt.Sprintf("Deployster restarted while the deploy was %s, so its instances were left as they were.", doing)
+}
+
+// finish releases the service's lock now that the deploy is over and reports
+// its final status to anyone following it.  Webhooks are notified of deploys
+// that succeeded, failed, or timed out.
+func (dr *DeploysResource) finish(record *schema.DeployRecord) {
+	dr.Locks.Release(record.ServiceName, record.ID)
+	dr.Progress.Publish(record.ID, &progress.Event{Type: progress.EventFinished, Deploy: record.Copy()})
+
+	switch record.Status {
+	case schema.DeploySucceeded:
+		dr.notify(record, schema.WebhookDeploySucceeded)
+	case schema.DeployFailed:
+		dr.notify(record, schema.WebhookDeployFailed)
+	case schema.DeployTimedOut:
+		dr.notify(record, schema.WebhookDeployTimedOut)
+	}
+}
+
+// notify sends a copy of the deploy record to the service's webhooks that want
+// the event, such as a deploy starting, one of its instances coming online or
+// failing, the previous version's instances being destroyed, or the deploy
+// finishing.
+func (dr *DeploysResource) notify(record *schema.DeployRecord, event string) {
+	dr.Webhooks.Notify(&webhooks.Payload{Event: event, ServiceName: record.ServiceName, DeployID: record.ID, Version: record.Version, Deploy: record.Copy()})
+}
+
+// notifier returns the handler that notifies the service's webhooks of the
+// event for each of the deploy's instances it handles.
+func (dr *DeploysResource) notifier(deploy *schema.Deploy, event string) *handlers.Notifier {
+	return &handlers.Notifier{Deploy: deploy, Event: event, Webhooks: dr.Webhooks}
+}
+
+// withLock runs fn while holding the service's lock on behalf of the deploy,
+// responding with a 409 if another deploy already holds it.  The lock is
+// released if fn fails or responds with an error status, such as when it lists
+// the problems with a unit file, otherwise it's up to the deploy to release it
+// once it finishes.
+func (dr *DeploysResource) withLock(serviceName string, deployID string, fn func() (int, http.Header, *DeployResponse, error)) (int, http.Header, *DeployResponse, error) {
+	err := dr.Locks.Acquire(serviceName, deployID)
+	if err != nil {
+		return http.StatusConflict, nil, nil, err
+	}
+
+	status, headers, response, err := fn()
+	if err != nil || status >= http.StatusBadRequest {
+		dr.Locks.Release(serviceName, deployID)
+	}
+	return status, headers, response, err
+}
+
+// claimCanary moves a canary deploy that is waiting to be promoted or aborted
+// to the given status and returns its record, along with the status code to
+// respond with if it can't be found or isn't waiting.  The record is only
+// saved if it's still a canary, so concurrent requests can't both claim it.
+func (dr *DeploysResource) claimCanary(serviceName string, id string, status string) (*schema.DeployRecord, int, error) {
+	errNotCanary := errors.New("Deploy is not a canary waiting to be promoted or aborted.")
+	record, err := dr.Store.Find(serviceName, id)
+	if err == store.ErrNotFound {
+		return nil, http.StatusNotFound, err
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if record.Status != schema.DeployCanary {
+		return nil, http.StatusConflict, errNotCanary
+	}
+
+	record.Status = status
+	record.UpdatedAt = time.Now().UTC()
+	err = dr.Store.SaveIfStatus(record, schema.DeployCanary)
+	if err == store.ErrStatusChanged {
+		return nil, http.StatusConflict, errNotCanary
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return record, http.StatusOK, nil
+}
+
+// save persists the record, logging any failure.  It's used once Fleet has
+// been asked to create units, at which point a storage failure shouldn't change
+// the response.
+func (dr *DeploysResource) save(record *schema.DeployRecord) {
+	record.UpdatedAt = time.Now().UTC()
+	err := dr.Store.Save(record)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// generateDeployID returns a random hex-encoded identifier for a new deploy.
+func generateDeployID() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// batchEnd returns the last instance of the batch that begins at instance
+// first.  The batch is cut short if launching all of it would surge past the
+// deploy's MaxSurge.
+func batchEnd(deploy *schema.Deploy, first int) int {
+	last := first + deploy.RolloutBatchSize() - 1
+	if surgeEnd := deploy.SurgeEnd(first); last > surgeEnd {
+		return surgeEnd
+	}
+	return last
+}
+
+// sortedVersions converts version:timestamp combinations into deploys, sorted
+// from oldest to newest by timestamp.
+func sortedVersions(versions []string) []*schema.Deploy {
+	deploys := []*schema.Deploy{}
+	for _, v := range versions {
+		i := strings.LastIndex(v, ":")
+		deploys = append(deploys, &schema.Deploy{Version: v[:i], Timestamp: v[i+1:]})
+	}
+	sort.Sort(byTimestamp(deploys))
+	return deploys
+}
+
+// byTimestamp sorts deploys by their timestamps, which sort chronologically
+// since they're formatted as `2006.01.02-15.04.05`.
+type byTimestamp []*schema.Deploy
+
+func (s byTimestamp) Len() int           { return len(s) }
+func (s byTimestamp) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byTimestamp) Less(i, j int) bool { return s[i].Timestamp < s[j].Timestamp }
+
+// determineNumberOfInstances is a helper function to either return the number
+// of instances specified or provide a default value based on the number of
+// running versions and units.
+func determineNumberOfInstances(instanceCount int, numberOfVersions int, numberOfUnits int) int {
+	if instanceCount != 0 {
+		return instanceCount
+	}
+
+	if numberOfVersions == 1 {
+		return numberOfUnits
+	} else {
+		return 1
+	}
+}
+
+// environment resolves the environment variables of the deploy and the secrets
+// it references using Secrets.
+func (dr *DeploysResource) environment(deploy *schema.Deploy) (*secrets.Environment, error) {
+	return secrets.Resolve(dr.Secrets, deploy.Env, deploy.Secrets)
+}
+
+// renderUnitFile renders and validates the unit file of the deploy with the
+// given environment.
+func (dr *DeploysResource) renderUnitFile(deploy *schema.Deploy, env *secrets.Environment) (string, error) {
+	_, unitFile, err := renderDeployUnitFile(dr.Templates, dr.Settings, dr.ImagePrefix, dr.Balancers, deploy, env)
+	return unitFile, err
+}
+
+// rejectUnitFile responds with a 400 for a deploy whose unit file couldn't be
+// rendered.  If the unit file was rendered but is invalid, the response lists
+// the problems with it instead of the error.
+func rejectUnitFile(err error) (int, http.Header, *DeployResponse, error) {
+	if invalid, ok := err.(*templates.ValidationError); ok {
+		return http.StatusBadRequest, nil, &DeployResponse{Problems: invalid.Problems}, nil
+	}
+	return http.StatusBadRequest, nil, nil, err
+}
+
+// unitOptions renders the unit file of the deploy with the given environment
+// and converts it to an array of UnitOption structs.
+func (dr *DeploysResource) unitOptions(deploy *schema.Deploy, env *secrets.Environment) ([]*fleet.UnitOption, error) {
+	unitFile, err := dr.renderUnitFile(deploy, env)
+	if err != nil {
+		return nil, err
+	}
+	options, err := getUnitOptions(unitFile)
+	return options, redact(env, err)
+}
+
+// redact replaces the values of any secrets in the environment that appear in
+// the error so that it can safely be recorded and logged.
+func redact(env *secrets.Environment, err error) error {
+	if err == nil {
+		return nil
+	}
+	return errors.New(env.Redact(err.Error()))
+}
+
+// getUnitOptions parses the unit file and converts it to an array of
+// UnitOption structs.
+func getUnitOptions(unitFile string) ([]*fleet.UnitOption, error) {
+	parsed, err := unit.NewUnitFile(unitFile)
+	if err != nil {
+		return nil, fmt.Errorf("The rendered unit file could not be parsed: %s", err)
+	}
+
+	return fleet.MapUnitFileToSchemaUnitOptions(parsed), nil
+}
+
+// shouldDestroyUnit takes an optional timestamp (from the query string) and, if
+// specified, ensures that it matches the unitTimestamp.  If the optional
+// timestamp is left blank, we'll return true.  If the optional timestamp is
+// present and it doesn't match the timestamp, we'll return false.
+func shouldDestroyUnit(blankOrTimestampToMatch string, unitTimestamp string) bool {
+	if blankOrTimestampToMatch == "" {
+		return true
+	} else if blankOrTimestampToMatch == unitTimestamp {
+		return true
+	}
+	return false
+}
+
+// machineMetadata matches a single `key=value` pair of Fleet machine metadata.
+var machineMetadata = regexp.MustCompile(`^[^=\s]+=\S+$`)
+
+// unitName matches a unit name or glob that can be rendered into an
+// `[X-Fleet]` directive.
+var unitName = regexp.MustCompile(`^\S+$`)
+
+// validate checks the settings of the deploy that don't depend on what's
+// running, returning an error to respond to with a 400 Bad Request if any of
+// them are invalid.
+func (dr *DeploysResource) validate(deploy *schema.Deploy) error {
+	if deploy.BatchSize < 0 || deploy.MaxSurge < 0 {
+		return errors.New("The batch size and max surge must not be negative.")
+	}
+
+	err := validateHealthCheck(deploy.HealthCheck)
+	if err != nil {
+		return err
+	}
+
+	err = validateScheduling(deploy)
+	if err != nil {
+		return err
+	}
+
+	if deploy.TrafficShift != nil {
+		err = dr.validateTrafficShift(deploy)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch deploy.Strategy {
+	case "", schema.StrategyRolling:
+	case schema.StrategyBlueGreen:
+		return dr.validateBlueGreen(deploy)
+	default:
+		return fmt.Errorf("The strategy %q isn't supported.  Use rolling or blue_green.", deploy.Strategy)
+	}
+	return nil
+}
+
+// validateTrafficShift returns an error if traffic can't be shifted to the
+// deploy.  Traffic is shifted by weighting the endpoints of each version, so
+// the service's load balancer must be managed by deployster and support
+// weights.
+func (dr *DeploysResource) validateTrafficShift(deploy *schema.Deploy) error {
+	if deploy.Canary || deploy.Global {
+		return errors.New("Traffic shifting isn't supported for canary or global deploys.")
+	}
+
+	err := deploy.TrafficShift.Validate()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := dr.Balancers.ForService(deploy.ServiceName).(clients.WeightedLoadBalancer); !ok {
+		return errors.New("Traffic can only be shifted with a load balancer that supports weights, such as nginx or HAProxy.")
+	}
+	return nil
+}
+
+// validateHealthCheck checks that the deploy's health check, if it has one, can
+// be made.  An interval or threshold of zero falls back to its default.
+func validateHealthCheck(check *schema.HealthCheck) error {
+	if check == nil {
+		return nil
+	}
+	if !strings.HasPrefix(check.Path, "/") {
+		return errors.New("The health check path must begin with a slash.")
+	}
+	if check.Interval < 0 || check.Threshold < 0 {
+		return errors.New("The health check interval and threshold must not be negative.")
+	}
+	return nil
+}
+
+// validateScheduling checks that the Fleet scheduling options of the deploy
+// can be rendered into its unit file and combined with each other.
+func validateScheduling(deploy *schema.Deploy) error {
+	if deploy.Global && (deploy.MachineOf != "" || len(deploy.Conflicts) > 0) {
+		return errors.New("Global deploys run on every machine and can't set machine_of or conflicts.")
+	}
+	if deploy.Global && deploy.Canary {
+		return errors.New("Global deploys run on every machine and can't be canaries.")
+	}
+	if deploy.Global && deploy.InstanceCount > 1 {
+		return errors.New("Global deploys run a single unit on every machine, so the instance count can't be more than 1.")
+	}
+	for _, metadata := range deploy.MachineMetadata {
+		if !machineMetadata.MatchString(metadata) {
+			return fmt.Errorf("The machine metadata %q must be a single key=value pair.", metadata)
+		}
+	}
+	for _, conflict := range deploy.Conflicts {
+		if !unitName.MatchString(conflict) {
+			return fmt.Errorf("The conflict %q must be a unit name or glob without whitespace.", conflict)
+		}
+	}
+	if deploy.MachineOf != "" && !unitName.MatchString(deploy.MachineOf) {
+		return fmt.Errorf("The machine_of unit %q must be a unit name without whitespace.", deploy.MachineOf)
+	}
+	return nil
 }
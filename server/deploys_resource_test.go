@@ -1,52 +1,90 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/bmorton/deployster/balancers"
 	"github.com/bmorton/deployster/clients/mocks"
+	"github.com/bmorton/deployster/lock"
+	"github.com/bmorton/deployster/progress"
 	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
+	"github.com/bmorton/deployster/webhooks"
+	"github.com/coreos/fleet/machine"
 	fleet "github.com/coreos/fleet/schema"
 	"github.com/rcrowley/go-tigertonic/mocking"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 )
 
 type DeploysResourceTestSuite struct {
 	suite.Suite
-	Subject   DeploysResource
+	Subject   *DeploysResource
 	FleetMock *mocks.Fleet
+	Store     *store.MemoryStore
+	Locks     *lock.Manager
+	Templates *templates.Registry
+	Settings  *settings.Registry
 	Service   *DeploysterService
 }
 
 func (suite *DeploysResourceTestSuite) SetupSuite() {
-	suite.Service = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm")
+	suite.Service = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm", store.NewMemoryStore(), templates.NewMemoryRegistry(), settings.NewMemoryRegistry(), secrets.NewMemoryProvider(nil), nil, nil, nil)
 }
 
 func (suite *DeploysResourceTestSuite) SetupTest() {
+	suite.Settings = settings.NewMemoryRegistry()
 	suite.FleetMock = new(mocks.Fleet)
-	suite.Subject = DeploysResource{suite.FleetMock, "mmmhm"}
+	suite.Store = store.NewMemoryStore()
+	suite.Locks = lock.NewManager()
+	suite.Templates = templates.NewMemoryRegistry()
+	suite.Subject = &DeploysResource{
+		Fleet:       suite.FleetMock,
+		ImagePrefix: "mmmhm",
+		Store:       suite.Store,
+		Templates:   suite.Templates,
+		Settings:    suite.Settings,
+		Secrets:     secrets.NewMemoryProvider(map[string]string{"database-url": "postgres://secret@db/carousel"}),
+		Locks:       suite.Locks,
+		Progress:    progress.NewHub(),
+		PollTimeout: 100 * time.Millisecond,
+		PollDelay:   time.Millisecond,
+	}
 }
 
 func (suite *DeploysResourceTestSuite) TestCreateWithoutPassedInstancesAndNoInstancesRunning() {
-	expectedOptions := getUnitOptions(UnitTemplate{"carousel", "abc123", "mmmhm", "2006.01.02-15.04.05"})
+	expectedOptions := defaultUnitOptions("abc123", "2006.01.02-15.04.05")
 	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
 
 	// Should only start 1 unit
 	suite.FleetMock.On("CreateUnit", &fleet.Unit{Name: "carousel:abc123:2006.01.02-15.04.05@1.service", Options: expectedOptions}).Return(nil)
 	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2006.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2006.01.02-15.04.05@1.service"), nil)
 
-	suite.Subject.Create(
+	_, _, response, _ := suite.Subject.Create(
 		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
 		mocking.Header(nil),
 		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: false, Timestamp: "2006.01.02-15.04.05"}},
 	)
 
+	suite.waitForDeploy(response.Deploy.ID)
 	suite.FleetMock.Mock.AssertExpectations(suite.T())
 }
 
 func (suite *DeploysResourceTestSuite) TestCreateWithoutPassedInstancesAndMultipleInstancesRunning() {
-	expectedOptions := getUnitOptions(UnitTemplate{"carousel", "abc123", "mmmhm", "2006.01.02-15.04.05"})
+	expectedOptions := defaultUnitOptions("abc123", "2006.01.02-15.04.05")
 	suite.FleetMock.On("Units").Return([]*fleet.Unit{
 		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
 		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
@@ -57,18 +95,20 @@ func (suite *DeploysResourceTestSuite) TestCreateWithoutPassedInstancesAndMultip
 	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2006.01.02-15.04.05@1.service", "launched").Return(nil)
 	suite.FleetMock.On("CreateUnit", &fleet.Unit{Name: "carousel:abc123:2006.01.02-15.04.05@2.service", Options: expectedOptions}).Return(nil)
 	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2006.01.02-15.04.05@2.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2006.01.02-15.04.05@1.service", "carousel:abc123:2006.01.02-15.04.05@2.service"), nil)
 
-	suite.Subject.Create(
+	_, _, response, _ := suite.Subject.Create(
 		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
 		mocking.Header(nil),
 		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: false, Timestamp: "2006.01.02-15.04.05"}},
 	)
 
+	suite.waitForDeploy(response.Deploy.ID)
 	suite.FleetMock.Mock.AssertExpectations(suite.T())
 }
 
 func (suite *DeploysResourceTestSuite) TestCreateWithoutPassedInstancesAndFailedInstances() {
-	expectedOptions := getUnitOptions(UnitTemplate{"carousel", "abc123", "mmmhm", "2008.01.02-15.04.05"})
+	expectedOptions := defaultUnitOptions("abc123", "2008.01.02-15.04.05")
 	suite.FleetMock.On("Units").Return([]*fleet.Unit{
 		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
 		&fleet.Unit{"failed", "failed", "efefeff", "carousel:efefeff:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
@@ -77,18 +117,20 @@ func (suite *DeploysResourceTestSuite) TestCreateWithoutPassedInstancesAndFailed
 	// Should start 1 unit
 	suite.FleetMock.On("CreateUnit", &fleet.Unit{Name: "carousel:abc123:2008.01.02-15.04.05@1.service", Options: expectedOptions}).Return(nil)
 	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2008.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2008.01.02-15.04.05@1.service"), nil)
 
-	suite.Subject.Create(
+	_, _, response, _ := suite.Subject.Create(
 		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
 		mocking.Header(nil),
 		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: false, Timestamp: "2008.01.02-15.04.05"}},
 	)
 
+	suite.waitForDeploy(response.Deploy.ID)
 	suite.FleetMock.Mock.AssertExpectations(suite.T())
 }
 
 func (suite *DeploysResourceTestSuite) TestCreateWithoutPassedInstancesAndMultipleVersionsRunning() {
-	expectedOptions := getUnitOptions(UnitTemplate{"carousel", "abc123", "mmmhm", "2006.01.02-15.04.05"})
+	expectedOptions := defaultUnitOptions("abc123", "2006.01.02-15.04.05")
 	suite.FleetMock.On("Units").Return([]*fleet.Unit{
 		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
 		&fleet.Unit{"running", "running", "abbbbbb", "carousel:abbbbbb:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
@@ -97,21 +139,24 @@ func (suite *DeploysResourceTestSuite) TestCreateWithoutPassedInstancesAndMultip
 	// Should start 1 unit
 	suite.FleetMock.On("CreateUnit", &fleet.Unit{Name: "carousel:abc123:2006.01.02-15.04.05@1.service", Options: expectedOptions}).Return(nil)
 	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2006.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2006.01.02-15.04.05@1.service"), nil)
 
-	suite.Subject.Create(
+	_, _, response, _ := suite.Subject.Create(
 		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
 		mocking.Header(nil),
 		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: false, Timestamp: "2006.01.02-15.04.05"}},
 	)
 
+	suite.waitForDeploy(response.Deploy.ID)
 	suite.FleetMock.Mock.AssertExpectations(suite.T())
 }
 
 func (suite *DeploysResourceTestSuite) TestCreateWithoutDestroyPrevious() {
-	expectedOptions := getUnitOptions(UnitTemplate{"carousel", "abc123", "mmmhm", "2006.01.02-15.04.05"})
+	expectedOptions := defaultUnitOptions("abc123", "2006.01.02-15.04.05")
 	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
 	suite.FleetMock.On("CreateUnit", &fleet.Unit{Name: "carousel:abc123:2006.01.02-15.04.05@1.service", Options: expectedOptions}).Return(nil)
 	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2006.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2006.01.02-15.04.05@1.service"), nil)
 
 	code, _, response, err := suite.Subject.Create(
 		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
@@ -121,15 +166,17 @@ func (suite *DeploysResourceTestSuite) TestCreateWithoutDestroyPrevious() {
 
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 201, code)
-	assert.Equal(suite.T(), nil, response)
+	assert.Equal(suite.T(), "abc123", response.Deploy.Version)
+	suite.waitForDeploy(response.Deploy.ID)
 	suite.FleetMock.Mock.AssertExpectations(suite.T())
 }
 
 func (suite *DeploysResourceTestSuite) TestCreateWithDestroyPreviousAndNoPreviousVersions() {
-	expectedOptions := getUnitOptions(UnitTemplate{"carousel", "abc123", "mmmhm", "2006.01.02-15.04.05"})
+	expectedOptions := defaultUnitOptions("abc123", "2006.01.02-15.04.05")
 	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
 	suite.FleetMock.On("CreateUnit", &fleet.Unit{Name: "carousel:abc123:2006.01.02-15.04.05@1.service", Options: expectedOptions}).Return(nil)
 	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2006.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2006.01.02-15.04.05@1.service"), nil)
 
 	code, _, response, err := suite.Subject.Create(
 		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
@@ -139,7 +186,8 @@ func (suite *DeploysResourceTestSuite) TestCreateWithDestroyPreviousAndNoPreviou
 
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 201, code)
-	assert.Equal(suite.T(), nil, response)
+	assert.Equal(suite.T(), "abc123", response.Deploy.Version)
+	suite.waitForDeploy(response.Deploy.ID)
 	suite.FleetMock.Mock.AssertExpectations(suite.T())
 }
 
@@ -256,6 +304,2894 @@ func (suite *DeploysResourceTestSuite) TestDestroyMultipleInstancesWithTimestamp
 	suite.FleetMock.Mock.AssertExpectations(suite.T())
 }
 
+func (suite *DeploysResourceTestSuite) TestCreateRecordsDeploy() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2006.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2006.01.02-15.04.05@1.service"), nil)
+
+	code, headers, response, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2006.01.02-15.04.05", InstanceCount: 1}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	assert.NotEmpty(suite.T(), response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployPolling, response.Deploy.Status)
+	assert.Equal(suite.T(), "/v1/services/carousel/deploys/"+response.Deploy.ID, headers.Get("Location"))
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+	assert.Equal(suite.T(), "running", record.CurrentState("1").SubState)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateRecordsFailedInstances() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2006.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2006.01.02-15.04.05@1.service", SystemdSubState: "failed"},
+	}, nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2006.01.02-15.04.05", InstanceCount: 1}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateRecordsTimeout() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2006.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2006.01.02-15.04.05@1.service", SystemdSubState: "start-pre"},
+	}, nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2006.01.02-15.04.05", InstanceCount: 1}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployTimedOut, record.Status)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateRecordsFailureCreatingUnits() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(errors.New("fleet is down"))
+
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2006.01.02-15.04.05", InstanceCount: 1}},
+	)
+
+	assert.Equal(suite.T(), 500, code)
+	assert.NotNil(suite.T(), err)
+	records, _ := suite.Store.List("carousel")
+	assert.Len(suite.T(), records, 1)
+	assert.Equal(suite.T(), schema.DeployFailed, records[0].Status)
+	assert.Equal(suite.T(), "fleet is down", records[0].Error)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithDestroyPreviousDestroysPreviousInstances() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: true, Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	assert.Equal(suite.T(), "efefeff", response.Deploy.PreviousVersion.Version)
+	suite.waitForDeploy(response.Deploy.ID)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithRollbackOnFailureRollsBackFailedDeploy() {
+	previousOptions := []*fleet.UnitOption{&fleet.UnitOption{Section: "Service", Name: "ExecStart", Value: "/usr/bin/docker run carousel:efefeff"}}
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", previousOptions},
+	}, nil).Times(1)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil).Times(1)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "failed"},
+	}, nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service").Return(nil).Times(1)
+	suite.FleetMock.On("CreateUnit", &fleet.Unit{Name: "carousel:efefeff:2006.01.02-15.04.05@1.service", Options: previousOptions}).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:efefeff:2006.01.02-15.04.05@1.service", "launched").Return(nil).Times(1)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: true, RollbackOnFailure: true, Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	assert.True(suite.T(), record.RolledBack)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithRollbackOnFailureRollsBackTimedOutDeploy() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "start-pre"},
+	}, nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service").Return(nil).Times(1)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", RollbackOnFailure: true, Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployTimedOut, record.Status)
+	assert.True(suite.T(), record.RolledBack)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithoutRollbackOnFailureLeavesFailedDeploy() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "failed"},
+	}, nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.False(suite.T(), record.RolledBack)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithBatchSizeRollsOutInBatches() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@3.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Times(3)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@2.service", "launched").Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@3.service", "launched").Return(nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return(runningStates(
+		"carousel:abc123:2007.01.02-15.04.05@1.service",
+		"carousel:abc123:2007.01.02-15.04.05@2.service",
+		"carousel:abc123:2007.01.02-15.04.05@3.service",
+	), nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil).Times(1)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@2.service").Return(nil).Times(1)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@3.service").Return(nil).Times(1)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: true, BatchSize: 2, Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithBatchSizeHaltsRolloutWhenBatchFails() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "failed"},
+	}, nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", InstanceCount: 2, BatchSize: 1, Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@2.service", "launched")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithMaxSurgeLaunchesInstancesBeyondThoseBeingReplaced() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Times(3)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@2.service", "launched").Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@3.service", "launched").Return(nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "failed"},
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@2.service", SystemdSubState: "failed"},
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@3.service", SystemdSubState: "failed"},
+	}, nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: true, InstanceCount: 3, MaxSurge: 1, Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithBatchSizeLimitsInstancesBeyondThoseBeingReplaced() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "failed"},
+	}, nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: true, InstanceCount: 3, BatchSize: 1, Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@2.service", "launched")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithMaxSurgeLimitsInstancesBeingReplaced() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@3.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "failed"},
+	}, nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: true, MaxSurge: 1, Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@2.service", "launched")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithNegativeMaxSurge() {
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", MaxSurge: -1}},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithNegativeBatchSize() {
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", BatchSize: -1}},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateCanaryOnlyLaunchesOneInstance() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Canary: true, Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	record := suite.waitForStatus(response.Deploy.ID, schema.DeployCanary)
+	assert.Equal(suite.T(), 2, record.InstanceCount)
+	assert.Equal(suite.T(), "efefeff", record.PreviousVersion.Version)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service")
+}
+
+func (suite *DeploysResourceTestSuite) TestPromote() {
+	suite.Store.Save(suite.canaryRecord())
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil).Times(1)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@2.service", "launched").Return(nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return(runningStates(
+		"carousel:abc123:2007.01.02-15.04.05@1.service",
+		"carousel:abc123:2007.01.02-15.04.05@2.service",
+	), nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@2.service").Return(nil).Times(1)
+
+	code, _, response, err := suite.Subject.Promote(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/promote"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), schema.DeployPolling, response.Deploy.Status)
+	record := suite.waitForDeploy("d3adb33f")
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestPromoteWhenNotCanary() {
+	suite.Store.Save(schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"}))
+
+	code, _, _, err := suite.Subject.Promote(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/promote"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.NotNil(suite.T(), err)
+	assert.Equal(suite.T(), 409, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestPromoteNotFound() {
+	code, _, _, err := suite.Subject.Promote(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/promote"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), store.ErrNotFound, err)
+	assert.Equal(suite.T(), 404, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestConcurrentPromotesOnlyPromoteOnce() {
+	suite.Store.Save(suite.canaryRecord())
+	listing := make(chan bool)
+	listed := make(chan bool)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+	}, nil).Run(func(mock.Arguments) {
+		listing <- true
+		<-listed
+	})
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil).Times(1)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@2.service", "launched").Return(nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return(runningStates(
+		"carousel:abc123:2007.01.02-15.04.05@1.service",
+		"carousel:abc123:2007.01.02-15.04.05@2.service",
+	), nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@2.service").Return(nil).Times(1)
+
+	codes := make(chan int)
+	go func() {
+		code, _, _, _ := suite.Subject.Promote(
+			mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/promote"),
+			mocking.Header(nil),
+			nil,
+		)
+		codes <- code
+	}()
+	<-listing
+
+	code, _, _, err := suite.Subject.Promote(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/promote"),
+		mocking.Header(nil),
+		nil,
+	)
+	close(listed)
+
+	assert.EqualError(suite.T(), err, "Deploy is not a canary waiting to be promoted or aborted.")
+	assert.Equal(suite.T(), 409, code)
+	assert.Equal(suite.T(), 200, <-codes)
+	record := suite.waitForDeploy("d3adb33f")
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestPromoteKeepsCanaryWhenUnitsCantBeListed() {
+	suite.Store.Save(suite.canaryRecord())
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, errors.New("fleet is down"))
+
+	code, _, _, err := suite.Subject.Promote(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/promote"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.NotNil(suite.T(), err)
+	assert.Equal(suite.T(), 500, code)
+	saved, _ := suite.Store.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeployCanary, saved.Status)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "CreateUnit", mockAnyUnit)
+}
+
+func (suite *DeploysResourceTestSuite) TestAbort() {
+	suite.Store.Save(suite.canaryRecord())
+	suite.FleetMock.On("DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service").Return(nil).Times(1)
+
+	code, _, response, err := suite.Subject.Abort(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/abort"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), schema.DeployAborted, response.Deploy.Status)
+	saved, _ := suite.Store.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeployAborted, saved.Status)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestAbortWhenNotCanary() {
+	suite.Store.Save(schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"}))
+
+	code, _, _, err := suite.Subject.Abort(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/abort"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.NotNil(suite.T(), err)
+	assert.Equal(suite.T(), 409, code)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithHealthCheckSucceedsOnceHealthy() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	suite.Subject.Resolver = staticResolver(strings.TrimPrefix(server.URL, "http://"))
+
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil).Times(1)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: true, Timestamp: "2007.01.02-15.04.05", HealthCheck: &schema.HealthCheck{Path: "/health"}}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithHealthCheckUsesServiceHTTPPort() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	suite.Subject.Resolver = portResolver{8080, strings.TrimPrefix(server.URL, "http://")}
+	suite.Settings.Save("carousel", &schema.ServiceSettings{Ports: []int{8080, 9090}})
+
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2007.01.02-15.04.05", HealthCheck: &schema.HealthCheck{Path: "/health"}}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithHealthCheckKeepsPreviousInstancesUntilHealthy() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	suite.Subject.Resolver = staticResolver(strings.TrimPrefix(server.URL, "http://"))
+
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: true, Timestamp: "2007.01.02-15.04.05", HealthCheck: &schema.HealthCheck{Path: "/health"}}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployTimedOut, record.Status)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithBalancerRegistersBeforeDestroyingPrevious() {
+	balancer := suite.managedBalancer(schema.LoadBalancerVulcand)
+	suite.Subject.Resolver = staticResolver("10.0.0.1:49153")
+	var mu sync.Mutex
+	var calls []string
+	record := func(call string) func(mock.Arguments) {
+		return func(mock.Arguments) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, call)
+		}
+	}
+	var created *fleet.Unit
+
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Run(func(args mock.Arguments) { created = args.Get(0).(*fleet.Unit) })
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+	balancer.On("Register", "carousel", "carousel-abc123-2007.01.02-15.04.05-1", "http://10.0.0.1:49153").Return(nil).Run(record("Register"))
+	balancer.On("Deregister", "carousel", "carousel-efefeff-2006.01.02-15.04.05-1").Return(nil).Run(record("Deregister"))
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil).Run(record("DestroyUnit"))
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: true, Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	deployRecord := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeploySucceeded, deployRecord.Status)
+	mu.Lock()
+	assert.Equal(suite.T(), []string{"Register", "Deregister", "DestroyUnit"}, calls)
+	mu.Unlock()
+	for _, option := range created.Options {
+		assert.NotEqual(suite.T(), "ExecStartPost", option.Name)
+	}
+}
+
+func (suite *DeploysResourceTestSuite) TestDestroyWithBalancerDeregistersInstances() {
+	balancer := suite.managedBalancer(schema.LoadBalancerVulcand)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}}}, nil)
+	balancer.On("Deregister", "carousel", "carousel-efefeff-2006.01.02-15.04.05-1").Return(nil).Times(1)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil)
+
+	code, _, _, err := suite.Subject.Destroy(
+		mocking.URL(suite.Service.RootMux, "DELETE", "http://example.com/v1/services/carousel/deploys/efefeff"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 204, code)
+	balancer.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestDestroyWithBalancerListsDeployHistoryOnce() {
+	balancer := suite.managedBalancer(schema.LoadBalancerVulcand)
+	deployStore := &listCountingStore{Store: suite.Store}
+	suite.Subject.Store = deployStore
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@3.service", []*fleet.UnitOption{}},
+	}, nil)
+	balancer.On("Deregister", "carousel", mock.AnythingOfType("string")).Return(nil).Times(3)
+	suite.FleetMock.On("DestroyUnit", mock.AnythingOfType("string")).Return(nil).Times(3)
+
+	code, _, _, _ := suite.Subject.Destroy(
+		mocking.URL(suite.Service.RootMux, "DELETE", "http://example.com/v1/services/carousel/deploys/efefeff"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), 204, code)
+	assert.Equal(suite.T(), 1, deployStore.Lists())
+	balancer.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestStopWithBalancerDeregistersInstances() {
+	balancer := suite.managedBalancer(schema.LoadBalancerVulcand)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"launched", "launched", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	balancer.On("Deregister", "carousel", "carousel-abc123-2007.01.02-15.04.05-1").Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "loaded").Return(nil)
+
+	code, _, _, err := suite.Subject.Stop(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/stop"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	balancer.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestStopWithBalancerListsDeployHistoryOnce() {
+	balancer := suite.managedBalancer(schema.LoadBalancerVulcand)
+	deployStore := &listCountingStore{Store: suite.Store}
+	suite.Subject.Store = deployStore
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"launched", "launched", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"launched", "launched", "", "carousel:abc123:2007.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"launched", "launched", "", "carousel:abc123:2007.01.02-15.04.05@3.service", []*fleet.UnitOption{}},
+	}, nil)
+	balancer.On("Deregister", "carousel", mock.AnythingOfType("string")).Return(nil).Times(3)
+	suite.FleetMock.On("SetUnitTargetState", mock.AnythingOfType("string"), "loaded").Return(nil).Times(3)
+
+	code, _, _, _ := suite.Subject.Stop(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/stop"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), 1, deployStore.Lists())
+	balancer.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestReconcileEndpointsFollowsRescheduledInstances() {
+	balancer := suite.managedBalancer(schema.LoadBalancerVulcand)
+	suite.Subject.Resolver = machineResolver{"abc": "10.0.0.1", "def": "10.0.0.2"}
+	fleetStates := &movingUnit{Fleet: suite.FleetMock, name: "carousel:abc123:2007.01.02-15.04.05@1.service", machineID: "abc"}
+	suite.Subject.Fleet = fleetStates
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"launched", "launched", "abc", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	registered := make(chan string, 2)
+	balancer.On("Register", "carousel", "carousel-abc123-2007.01.02-15.04.05-1", mock.AnythingOfType("string")).Return(nil).Run(func(args mock.Arguments) { registered <- args.String(2) })
+
+	suite.Subject.ReconcileEndpoints()
+	assert.Equal(suite.T(), "http://10.0.0.1:3000", suite.receiveEndpoint(registered))
+	suite.Subject.ReconcileEndpoints()
+	fleetStates.moveTo("def")
+	suite.Subject.ReconcileEndpoints()
+	assert.Equal(suite.T(), "http://10.0.0.2:3000", suite.receiveEndpoint(registered))
+	balancer.AssertNumberOfCalls(suite.T(), "Register", 2)
+}
+
+func (suite *DeploysResourceTestSuite) TestReconcileEndpointsDeregistersStoppedInstances() {
+	balancer := suite.managedBalancer(schema.LoadBalancerVulcand)
+	suite.Subject.Resolver = machineResolver{"abc": "10.0.0.1"}
+	fleetStates := &movingUnit{Fleet: suite.FleetMock, name: "carousel:abc123:2007.01.02-15.04.05@1.service", machineID: "abc"}
+	suite.Subject.Fleet = fleetStates
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"launched", "launched", "abc", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	registered := make(chan string, 1)
+	balancer.On("Register", "carousel", "carousel-abc123-2007.01.02-15.04.05-1", "http://10.0.0.1:3000").Return(nil).Run(func(args mock.Arguments) { registered <- args.String(2) })
+	balancer.On("Deregister", "carousel", "carousel-abc123-2007.01.02-15.04.05-1").Return(nil).Times(1)
+
+	suite.Subject.ReconcileEndpoints()
+	suite.receiveEndpoint(registered)
+	fleetStates.moveTo("")
+	suite.Subject.ReconcileEndpoints()
+
+	balancer.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestReconcileEndpointsKeepsWeightsOfInterruptedShift() {
+	balancer := suite.weightedBalancer(schema.LoadBalancerNginx)
+	suite.Subject.Resolver = staticResolver("10.0.0.1:49153")
+	interrupted := schema.NewDeployRecord(&schema.Deploy{
+		ID:              "d3adb33f",
+		ServiceName:     "carousel",
+		Version:         "abc123",
+		Timestamp:       "2007.01.02-15.04.05",
+		InstanceCount:   1,
+		TrafficShift:    &schema.TrafficShift{Steps: []int{25, 100}},
+		PreviousVersion: &schema.Deploy{ServiceName: "carousel", Version: "efefeff", Timestamp: "2006.01.02-15.04.05", InstanceCount: 1},
+	})
+	interrupted.Status = schema.DeployFailed
+	interrupted.TrafficWeight = 25
+	suite.Store.Save(interrupted)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"launched", "launched", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"launched", "launched", "abc123", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates(
+		"carousel:efefeff:2006.01.02-15.04.05@1.service",
+		"carousel:abc123:2007.01.02-15.04.05@1.service",
+	), nil)
+	registered := make(chan string, 2)
+	balancer.On("RegisterWeighted", "carousel", "carousel-abc123-2007.01.02-15.04.05-1", "http://10.0.0.1:49153", 33).Return(nil).Run(func(args mock.Arguments) { registered <- args.String(1) })
+	balancer.On("Register", "carousel", "carousel-efefeff-2006.01.02-15.04.05-1", "http://10.0.0.1:49153").Return(nil).Run(func(args mock.Arguments) { registered <- args.String(1) })
+
+	suite.Subject.ReconcileEndpoints()
+	suite.receiveEndpoint(registered)
+	suite.receiveEndpoint(registered)
+
+	balancer.AssertExpectations(suite.T())
+	balancer.AssertNotCalled(suite.T(), "Register", "carousel", "carousel-abc123-2007.01.02-15.04.05-1", "http://10.0.0.1:49153")
+}
+
+func (suite *DeploysResourceTestSuite) TestReconcileEndpointsKeepsBlueGreenInstancesDrained() {
+	balancer := suite.weightedBalancer(schema.LoadBalancerNginx)
+	suite.Subject.Resolver = staticResolver("10.0.0.1:49153")
+	ready := schema.NewDeployRecord(&schema.Deploy{
+		ID:              "d3adb33f",
+		ServiceName:     "carousel",
+		Version:         "abc123",
+		Timestamp:       "2007.01.02-15.04.05",
+		InstanceCount:   1,
+		Strategy:        schema.StrategyBlueGreen,
+		PreviousVersion: &schema.Deploy{ServiceName: "carousel", Version: "efefeff", Timestamp: "2006.01.02-15.04.05", InstanceCount: 1},
+	})
+	ready.Status = schema.DeployFailed
+	suite.Store.Save(ready)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"launched", "launched", "abc123", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+	registered := make(chan string, 1)
+	balancer.On("RegisterWeighted", "carousel", "carousel-abc123-2007.01.02-15.04.05-1", "http://10.0.0.1:49153", 0).Return(nil).Run(func(args mock.Arguments) { registered <- args.String(1) })
+
+	suite.Subject.ReconcileEndpoints()
+	suite.receiveEndpoint(registered)
+
+	balancer.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestReconcileEndpointsSkipsLockedServices() {
+	balancer := suite.managedBalancer(schema.LoadBalancerVulcand)
+	suite.Locks.Acquire("carousel", "d3adb33f")
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"launched", "launched", "abc", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+
+	suite.Subject.ReconcileEndpoints()
+
+	balancer.AssertNotCalled(suite.T(), "Register", "carousel", "carousel-abc123-2007.01.02-15.04.05-1", "http://10.0.0.1:3000")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithInvalidHealthCheckPath() {
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", HealthCheck: &schema.HealthCheck{Path: "health"}}},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithNegativeHealthCheckInterval() {
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", HealthCheck: &schema.HealthCheck{Path: "/health", Interval: -1}}},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+	assert.EqualError(suite.T(), err, "The health check interval and threshold must not be negative.")
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "Units")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithNegativeHealthCheckThreshold() {
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", HealthCheck: &schema.HealthCheck{Path: "/health", Threshold: -3}}},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+	assert.EqualError(suite.T(), err, "The health check interval and threshold must not be negative.")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithSchedulingOptions() {
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Service]\nExecStart=/usr/bin/docker run {{.Image}}\n\n[X-Fleet]\n{{.FleetOptions}}\n"})
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", &fleet.Unit{
+		Name: "carousel:abc123:2007.01.02-15.04.05@1.service",
+		Options: []*fleet.UnitOption{
+			&fleet.UnitOption{Section: "Service", Name: "ExecStart", Value: "/usr/bin/docker run mmmhm/carousel:abc123"},
+			&fleet.UnitOption{Section: "X-Fleet", Name: "MachineMetadata", Value: "region=us-east"},
+			&fleet.UnitOption{Section: "X-Fleet", Name: "MachineMetadata", Value: "disk=ssd"},
+			&fleet.UnitOption{Section: "X-Fleet", Name: "MachineOf", Value: "redis.service"},
+		},
+	}).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+
+	code, _, response, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{
+			Version:         "abc123",
+			Timestamp:       "2007.01.02-15.04.05",
+			MachineMetadata: []string{"region=us-east", "disk=ssd"},
+			MachineOf:       "redis.service",
+		}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	suite.waitForDeploy(response.Deploy.ID)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateGlobal() {
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Service]\nExecStart=/usr/bin/docker run {{.Image}}\n\n[X-Fleet]\n{{.FleetOptions}}\n"})
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "", "carousel:efefeff:2006.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", &fleet.Unit{
+		Name: "carousel:abc123:2007.01.02-15.04.05@1.service",
+		Options: []*fleet.UnitOption{
+			&fleet.UnitOption{Section: "Service", Name: "ExecStart", Value: "/usr/bin/docker run mmmhm/carousel:abc123"},
+			&fleet.UnitOption{Section: "X-Fleet", Name: "Global", Value: "true"},
+		},
+	}).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("Machines").Return([]machine.MachineState{{ID: "m1"}, {ID: "m2"}}, nil)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", MachineID: "m1", SystemdSubState: "running"},
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", MachineID: "m2", SystemdSubState: "running"},
+	}, nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil).Times(1)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@2.service").Return(nil).Times(1)
+
+	code, _, response, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2007.01.02-15.04.05", Global: true, DestroyPrevious: true}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	assert.Equal(suite.T(), 1, response.Deploy.InstanceCount)
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateGlobalCanary() {
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Global: true, Canary: true}},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+	assert.Equal(suite.T(), "Global deploys run on every machine and can't be canaries.", err.Error())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateGlobalWithConflicts() {
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Global: true, Conflicts: []string{"redis@*.service"}}},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+	assert.Equal(suite.T(), "Global deploys run on every machine and can't set machine_of or conflicts.", err.Error())
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "Units")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithInvalidMachineMetadata() {
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", MachineMetadata: []string{"region=us-east\nGlobal=true"}}},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+	assert.Equal(suite.T(), `The machine metadata "region=us-east\nGlobal=true" must be a single key=value pair.`, err.Error())
+}
+
+func (suite *DeploysResourceTestSuite) TestScaleUp() {
+	options := []*fleet.UnitOption{&fleet.UnitOption{Section: "Service", Name: "ExecStart", Value: "/usr/bin/docker run mmmhm/carousel:abc123"}}
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@1.service", options},
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@2.service", options},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", &fleet.Unit{Name: "carousel:abc123:2007.01.02-15.04.05@3.service", Options: options}).Return(nil).Times(1)
+	suite.FleetMock.On("CreateUnit", &fleet.Unit{Name: "carousel:abc123:2007.01.02-15.04.05@4.service", Options: options}).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@3.service", "launched").Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@4.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@3.service", "carousel:abc123:2007.01.02-15.04.05@4.service"), nil)
+
+	code, headers, response, err := suite.Subject.Scale(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/services/carousel/scale"),
+		mocking.Header(nil),
+		&ScaleRequest{&Scale{InstanceCount: 4}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	assert.Equal(suite.T(), fmt.Sprintf("/v1/services/carousel/deploys/%s", response.Deploy.ID), headers.Get("Location"))
+	assert.Equal(suite.T(), "abc123", response.Deploy.Version)
+	assert.Equal(suite.T(), "2007.01.02-15.04.05", response.Deploy.Timestamp)
+	assert.Equal(suite.T(), 4, response.Deploy.InstanceCount)
+	assert.Equal(suite.T(), 2, response.Deploy.ScaledFrom)
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "DestroyUnit", mock.AnythingOfType("string"))
+}
+
+func (suite *DeploysResourceTestSuite) TestScaleUpRendersOptionsFromRecordedDeploy() {
+	suite.Store.Save(schema.NewDeployRecord(&schema.Deploy{ID: "aaaa", ServiceName: "carousel", Version: "abc123", Timestamp: "2007.01.02-15.04.05", InstanceCount: 1, Env: map[string]string{"RAILS_ENV": "production"}}))
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Service]\nExecStart=/usr/bin/docker run {{.EnvFlags}} {{.Image}}\n"})
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", &fleet.Unit{
+		Name:    "carousel:abc123:2007.01.02-15.04.05@2.service",
+		Options: []*fleet.UnitOption{&fleet.UnitOption{Section: "Service", Name: "ExecStart", Value: `/usr/bin/docker run -e "RAILS_ENV=production" mmmhm/carousel:abc123`}},
+	}).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@2.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@2.service"), nil)
+
+	_, _, response, err := suite.Subject.Scale(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/services/carousel/scale"),
+		mocking.Header(nil),
+		&ScaleRequest{&Scale{InstanceCount: 2}},
+	)
+
+	assert.Nil(suite.T(), err)
+	suite.waitForDeploy(response.Deploy.ID)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestScaleDownDestroysHighestInstances() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@10.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@10.service").Return(nil).Times(1)
+	suite.FleetMock.On("DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@2.service").Return(nil).Times(1)
+
+	code, _, response, err := suite.Subject.Scale(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/services/carousel/scale"),
+		mocking.Header(nil),
+		&ScaleRequest{&Scale{InstanceCount: 1}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), schema.DeploySucceeded, response.Deploy.Status)
+	assert.Equal(suite.T(), 3, response.Deploy.ScaledFrom)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service")
+	_, err = suite.Locks.Find("carousel")
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+}
+
+func (suite *DeploysResourceTestSuite) TestScaleWithoutRunningVersion() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+
+	code, _, _, err := suite.Subject.Scale(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/services/carousel/scale"),
+		mocking.Header(nil),
+		&ScaleRequest{&Scale{InstanceCount: 2}},
+	)
+
+	assert.Equal(suite.T(), 404, code)
+	assert.Equal(suite.T(), "No running version was found to scale.", err.Error())
+	_, err = suite.Locks.Find("carousel")
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+}
+
+func (suite *DeploysResourceTestSuite) TestScaleWithMultipleVersionsRunning() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+
+	code, _, _, _ := suite.Subject.Scale(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/services/carousel/scale"),
+		mocking.Header(nil),
+		&ScaleRequest{&Scale{InstanceCount: 2}},
+	)
+
+	assert.Equal(suite.T(), 409, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestScaleGlobalService() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{&fleet.UnitOption{Section: "X-Fleet", Name: "Global", Value: "true"}}},
+	}, nil)
+
+	code, _, _, err := suite.Subject.Scale(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/services/carousel/scale"),
+		mocking.Header(nil),
+		&ScaleRequest{&Scale{InstanceCount: 2}},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+	assert.Equal(suite.T(), "Global services run on every machine and can't be scaled.", err.Error())
+}
+
+func (suite *DeploysResourceTestSuite) TestScaleToZero() {
+	code, _, _, _ := suite.Subject.Scale(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/services/carousel/scale"),
+		mocking.Header(nil),
+		&ScaleRequest{&Scale{InstanceCount: 0}},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "Units")
+}
+
+func (suite *DeploysResourceTestSuite) TestRestart() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	units := suite.mockUnitLifecycle("carousel:abc123:2007.01.02-15.04.05@1.service", "carousel:abc123:2007.01.02-15.04.05@2.service")
+
+	code, headers, response, err := suite.Subject.Restart(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/restart"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	assert.Equal(suite.T(), fmt.Sprintf("/v1/services/carousel/deploys/%s", response.Deploy.ID), headers.Get("Location"))
+	assert.True(suite.T(), response.Deploy.Restarted)
+	assert.Equal(suite.T(), 2, response.Deploy.InstanceCount)
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+
+	var targetStates []string
+	for _, call := range suite.FleetMock.Calls {
+		if call.Method == "SetUnitTargetState" {
+			targetStates = append(targetStates, fmt.Sprintf("%s %s", call.Arguments[0], call.Arguments[1]))
+		}
+	}
+	assert.Equal(suite.T(), []string{
+		"carousel:abc123:2007.01.02-15.04.05@1.service inactive",
+		"carousel:abc123:2007.01.02-15.04.05@1.service launched",
+		"carousel:abc123:2007.01.02-15.04.05@2.service inactive",
+		"carousel:abc123:2007.01.02-15.04.05@2.service launched",
+	}, targetStates)
+	assert.Empty(suite.T(), units.launchedEarly())
+	assert.Equal(suite.T(), []string{"running", "dead", "start-pre", "running"}, units.reported("carousel:abc123:2007.01.02-15.04.05@1.service"))
+	assert.Equal(suite.T(), []string{"running", "dead", "start-pre", "running"}, units.reported("carousel:abc123:2007.01.02-15.04.05@2.service"))
+	_, err = suite.Locks.Find("carousel")
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+}
+
+func (suite *DeploysResourceTestSuite) TestRestartFailsWhenInstanceDoesntStop() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "inactive").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+
+	_, _, response, err := suite.Subject.Restart(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/restart"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	assert.Equal(suite.T(), "carousel:abc123:2007.01.02-15.04.05@1.service didn't stop within 100ms.", record.Error)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched")
+}
+
+func (suite *DeploysResourceTestSuite) TestRestartHaltsWhenInstanceFails() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", mock.AnythingOfType("string")).Return(nil)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "failed"},
+	}, nil)
+
+	_, _, response, err := suite.Subject.Restart(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/restart"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@2.service", "inactive")
+}
+
+func (suite *DeploysResourceTestSuite) TestRestartUsesHealthCheckOfRunningVersion() {
+	checked := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checked <- r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	suite.Subject.Resolver = staticResolver(strings.TrimPrefix(server.URL, "http://"))
+
+	suite.Store.Save(schema.NewDeployRecord(&schema.Deploy{ID: "aaaa", ServiceName: "carousel", Version: "abc123", Timestamp: "2007.01.02-15.04.05", InstanceCount: 1, HealthCheck: &schema.HealthCheck{Path: "/health"}}))
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.mockUnitLifecycle("carousel:abc123:2007.01.02-15.04.05@1.service")
+
+	_, _, response, _ := suite.Subject.Restart(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/restart"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+	assert.Equal(suite.T(), "/health", <-checked)
+}
+
+func (suite *DeploysResourceTestSuite) TestRestartWithoutRunningVersion() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+
+	code, _, _, err := suite.Subject.Restart(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/restart"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), 404, code)
+	assert.Equal(suite.T(), "No running version was found to restart.", err.Error())
+}
+
+func (suite *DeploysResourceTestSuite) TestRestartWithMultipleVersionsRunning() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+
+	code, _, _, _ := suite.Subject.Restart(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/restart"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), 409, code)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "SetUnitTargetState", mock.AnythingOfType("string"), mock.AnythingOfType("string"))
+}
+
+func (suite *DeploysResourceTestSuite) TestStop() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"launched", "launched", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"launched", "launched", "", "carousel:abc123:2007.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"launched", "launched", "", "hello-world:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "loaded").Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@2.service", "loaded").Return(nil).Times(1)
+
+	code, _, response, err := suite.Subject.Stop(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/stop"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Len(suite.T(), response.Units, 2)
+	assert.Equal(suite.T(), "loaded", response.Units[0].DesiredState)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "DestroyUnit", mock.AnythingOfType("string"))
+	_, err = suite.Locks.Find("carousel")
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+}
+
+func (suite *DeploysResourceTestSuite) TestStopVersionToInactive() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"launched", "launched", "", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"launched", "launched", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"launched", "launched", "", "carousel:abc123:2008.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "inactive").Return(nil).Times(1)
+
+	code, _, response, err := suite.Subject.Stop(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/stop?version=abc123&timestamp=2007.01.02-15.04.05&state=inactive"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Len(suite.T(), response.Units, 1)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestStopWithInvalidState() {
+	code, _, _, _ := suite.Subject.Stop(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/stop?state=launched"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), 400, code)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "Units")
+}
+
+func (suite *DeploysResourceTestSuite) TestStopWithoutUnits() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+
+	code, _, _, err := suite.Subject.Stop(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/stop"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), 404, code)
+	assert.Equal(suite.T(), "No units were found for the service.", err.Error())
+}
+
+func (suite *DeploysResourceTestSuite) TestStopWhileLocked() {
+	suite.Locks.Acquire("carousel", "f00dcafe")
+
+	code, _, _, _ := suite.Subject.Stop(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/stop"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), 409, code)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "Units")
+}
+
+func (suite *DeploysResourceTestSuite) TestStart() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"loaded", "loaded", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil).Times(1)
+
+	code, _, response, err := suite.Subject.Start(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/start?version=abc123"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), "launched", response.Units[0].DesiredState)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestRollbackToLastSuccessfulDeploy() {
+	good := schema.NewDeployRecord(&schema.Deploy{ID: "aaaa", ServiceName: "carousel", Version: "efefeff", Timestamp: "2006.01.02-15.04.05", InstanceCount: 2, Env: map[string]string{"RAILS_ENV": "production"}, MachineMetadata: []string{"region=us-east"}})
+	good.Status = schema.DeploySucceeded
+	suite.Store.Save(good)
+	bad := schema.NewDeployRecord(&schema.Deploy{ID: "bbbb", ServiceName: "carousel", Version: "abc123", Timestamp: "2007.01.02-15.04.05", InstanceCount: 2})
+	bad.Status = schema.DeploySucceeded
+	bad.CreatedAt = bad.CreatedAt.Add(time.Minute)
+	suite.Store.Save(bad)
+
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "abc123", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "abc123", "carousel:abc123:2007.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Times(2)
+	suite.FleetMock.On("SetUnitTargetState", mock.AnythingOfType("string"), "launched").Return(nil).Times(2)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{}, nil)
+
+	code, headers, response, err := suite.Subject.Rollback(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/rollback"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	assert.Equal(suite.T(), fmt.Sprintf("/v1/services/carousel/deploys/%s", response.Deploy.ID), headers.Get("Location"))
+	assert.Equal(suite.T(), "efefeff", response.Deploy.Version)
+	assert.True(suite.T(), response.Deploy.DestroyPrevious)
+	assert.Equal(suite.T(), 2, response.Deploy.InstanceCount)
+	assert.Equal(suite.T(), "abc123", response.Deploy.PreviousVersion.Version)
+	assert.Equal(suite.T(), "2007.01.02-15.04.05", response.Deploy.PreviousVersion.Timestamp)
+	assert.Equal(suite.T(), map[string]string{"RAILS_ENV": "production"}, response.Deploy.Env)
+	assert.Equal(suite.T(), []string{"region=us-east"}, response.Deploy.MachineMetadata)
+	suite.waitForDeploy(response.Deploy.ID)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestRollbackKeepsSettingsOfPreviousDeploy() {
+	good := schema.NewDeployRecord(&schema.Deploy{
+		ID:          "aaaa",
+		ServiceName: "carousel",
+		Version:     "efefeff",
+		Timestamp:   "2006.01.02-15.04.05",
+		HealthCheck: &schema.HealthCheck{Path: "/health", Threshold: 3},
+		BatchSize:   1,
+	})
+	good.Status = schema.DeploySucceeded
+	suite.Store.Save(good)
+
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "abc123", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "abc123", "carousel:abc123:2007.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", mock.AnythingOfType("string"), "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{}, nil)
+
+	code, _, response, err := suite.Subject.Rollback(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/rollback"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	assert.Equal(suite.T(), &schema.HealthCheck{Path: "/health", Threshold: 3}, response.Deploy.HealthCheck)
+	assert.Equal(suite.T(), 1, response.Deploy.BatchSize)
+	suite.waitForDeploy(response.Deploy.ID)
+}
+
+func (suite *DeploysResourceTestSuite) TestRollbackWithNothingRunningUsesRecordedInstanceCount() {
+	good := schema.NewDeployRecord(&schema.Deploy{ID: "aaaa", ServiceName: "carousel", Version: "efefeff", Timestamp: "2006.01.02-15.04.05", InstanceCount: 3})
+	good.Status = schema.DeploySucceeded
+	suite.Store.Save(good)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Times(3)
+	suite.FleetMock.On("SetUnitTargetState", mock.AnythingOfType("string"), "launched").Return(nil).Times(3)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{}, nil)
+
+	code, _, response, err := suite.Subject.Rollback(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/rollback"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	assert.Equal(suite.T(), 3, response.Deploy.InstanceCount)
+	suite.waitForDeploy(response.Deploy.ID)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestRollbackValidatesRecordedSettings() {
+	good := schema.NewDeployRecord(&schema.Deploy{ID: "aaaa", ServiceName: "carousel", Version: "efefeff", Timestamp: "2006.01.02-15.04.05", Strategy: schema.StrategyBlueGreen})
+	good.Status = schema.DeploySucceeded
+	suite.Store.Save(good)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "abc123", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+
+	code, _, _, err := suite.Subject.Rollback(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/rollback"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.NotNil(suite.T(), err)
+	assert.Equal(suite.T(), 400, code)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "CreateUnit", mockAnyUnit)
+	_, err = suite.Locks.Find("carousel")
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+}
+
+func (suite *DeploysResourceTestSuite) TestRollbackFallsBackToOlderRunningVersion() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "abc123", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", mock.AnythingOfType("string"), "launched").Return(nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{}, nil)
+
+	code, _, response, err := suite.Subject.Rollback(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/rollback"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	assert.Equal(suite.T(), "efefeff", response.Deploy.Version)
+	assert.Equal(suite.T(), "abc123", response.Deploy.PreviousVersion.Version)
+	suite.waitForDeploy(response.Deploy.ID)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestRollbackWithoutKnownGoodVersion() {
+	failed := schema.NewDeployRecord(&schema.Deploy{ID: "aaaa", ServiceName: "carousel", Version: "efefeff", Timestamp: "2006.01.02-15.04.05", InstanceCount: 1})
+	failed.Status = schema.DeployFailed
+	suite.Store.Save(failed)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "abc123", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+
+	code, _, _, err := suite.Subject.Rollback(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/rollback"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.NotNil(suite.T(), err)
+	assert.Equal(suite.T(), 409, code)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "CreateUnit", mockAnyUnit)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWhenServiceLocked() {
+	suite.Locks.Acquire("carousel", "f00dcafe")
+
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123"}},
+	)
+
+	assert.Equal(suite.T(), lock.ErrLocked, err)
+	assert.Equal(suite.T(), 409, code)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "Units")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateHoldsLockUntilDeployFinishes() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{}, nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	held, err := suite.Locks.Find("carousel")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), response.Deploy.ID, held.DeployID)
+	suite.waitForDeploy(response.Deploy.ID)
+	suite.waitForUnlock()
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateReleasesLockWhenRejected() {
+	suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", BatchSize: -1}},
+	)
+
+	_, err := suite.Locks.Find("carousel")
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+}
+
+func (suite *DeploysResourceTestSuite) TestAbortReleasesLock() {
+	suite.Store.Save(suite.canaryRecord())
+	suite.Locks.Acquire("carousel", "d3adb33f")
+	suite.FleetMock.On("DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service").Return(nil)
+
+	suite.Subject.Abort(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/abort"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	_, err := suite.Locks.Find("carousel")
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+}
+
+func (suite *DeploysResourceTestSuite) TestAbortDeregistersCanaryBeforeDestroyingIt() {
+	balancer := suite.managedBalancer(schema.LoadBalancerVulcand)
+	suite.Store.Save(suite.canaryRecord())
+	var mu sync.Mutex
+	var calls []string
+	record := func(call string) func(mock.Arguments) {
+		return func(mock.Arguments) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, call)
+		}
+	}
+	balancer.On("Deregister", "carousel", "carousel-abc123-2007.01.02-15.04.05-1").Return(nil).Run(record("Deregister"))
+	suite.FleetMock.On("DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service").Return(nil).Run(record("DestroyUnit"))
+
+	code, _, _, _ := suite.Subject.Abort(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/abort"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), 200, code)
+	mu.Lock()
+	assert.Equal(suite.T(), []string{"Deregister", "DestroyUnit"}, calls)
+	mu.Unlock()
+}
+
+func (suite *DeploysResourceTestSuite) TestAbortFinishesFollowedCanary() {
+	suite.Store.Save(suite.canaryRecord())
+	feed := suite.Subject.Progress.Open("d3adb33f")
+	suite.FleetMock.On("DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service").Return(nil)
+
+	suite.Subject.Abort(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/abort"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	events, _ := feed.Since(0)
+	if assert.Len(suite.T(), events, 1) {
+		assert.Equal(suite.T(), progress.EventFinished, events[0].Type)
+		assert.Equal(suite.T(), schema.DeployAborted, events[0].Deploy.Status)
+	}
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateDryRun() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@2.service", []*fleet.UnitOption{}},
+	}, nil)
+
+	code, _, response, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys?dry_run=true"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: true, Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Nil(suite.T(), response.Deploy)
+	assert.Equal(suite.T(), 2, response.Plan.Deploy.InstanceCount)
+	assert.Equal(suite.T(), "efefeff", response.Plan.Deploy.PreviousVersion.Version)
+	assert.Contains(suite.T(), response.Plan.UnitFile, "mmmhm/carousel:abc123")
+	assert.Equal(suite.T(), []string{
+		"carousel:abc123:2007.01.02-15.04.05@1.service",
+		"carousel:abc123:2007.01.02-15.04.05@2.service",
+	}, response.Plan.CreateUnits)
+	assert.Equal(suite.T(), []string{
+		"carousel:efefeff:2006.01.02-15.04.05@1.service",
+		"carousel:efefeff:2006.01.02-15.04.05@2.service",
+	}, response.Plan.DestroyUnits)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "CreateUnit", mockAnyUnit)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "SetUnitTargetState", mock.Anything, mock.Anything)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateDryRunDoesNotRecordOrLock() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+
+	suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys?dry_run=true"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123"}},
+	)
+
+	records, _ := suite.Store.List("carousel")
+	assert.Empty(suite.T(), records)
+	_, err := suite.Locks.Find("carousel")
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateDryRunValidatesDeploy() {
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys?dry_run=true"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", BatchSize: -1}},
+	)
+
+	assert.NotNil(suite.T(), err)
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestFollowStreamsProgress() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/carousel/deploys?name=carousel&follow=true", strings.NewReader(`{"deploy":{"version":"abc123","destroy_previous":true,"timestamp":"2007.01.02-15.04.05"}}`))
+	suite.Subject.Follow(w, r)
+
+	body := w.Body.String()
+	assert.Equal(suite.T(), 201, w.Code)
+	assert.Equal(suite.T(), "text/event-stream", w.Header().Get("Content-Type"))
+	assert.True(suite.T(), strings.HasPrefix(body, "event: deploy\n"))
+	assert.Contains(suite.T(), body, "event: unit_created\n")
+	assert.Contains(suite.T(), body, "event: unit_launched\n")
+	assert.Contains(suite.T(), body, "event: state_changed\n")
+	assert.Contains(suite.T(), body, "event: unit_destroyed\n")
+	assert.Contains(suite.T(), body, `"status":"succeeded"`)
+	assert.True(suite.T(), strings.Index(body, "event: unit_destroyed") < strings.Index(body, "event: finished"))
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestFollowStopsWhenClientDisconnects() {
+	polled := make(chan bool, 1)
+	released := make(chan bool)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil).Run(func(mock.Arguments) {
+		select {
+		case polled <- true:
+		default:
+		}
+		<-released
+	})
+
+	w := &closeNotifyingRecorder{httptest.NewRecorder(), make(chan bool)}
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/carousel/deploys?name=carousel&follow=true", strings.NewReader(`{"deploy":{"version":"abc123","timestamp":"2007.01.02-15.04.05"}}`))
+	followed := make(chan bool)
+	go func() {
+		suite.Subject.Follow(w, r)
+		close(followed)
+	}()
+	<-polled
+	close(w.closed)
+
+	select {
+	case <-followed:
+	case <-time.After(time.Second):
+		suite.T().Fatal("Follow didn't return after the client disconnected.")
+	}
+	close(released)
+	assert.Equal(suite.T(), 201, w.Code)
+	assert.False(suite.T(), strings.Contains(w.Body.String(), "event: finished\n"))
+	record := suite.waitForDeploy(strings.TrimPrefix(w.Header().Get("Location"), "/v1/services/carousel/deploys/"))
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+}
+
+func (suite *DeploysResourceTestSuite) TestFollowStreamsFailure() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "failed"},
+	}, nil)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/carousel/deploys?name=carousel&follow=true", strings.NewReader(`{"deploy":{"version":"abc123","timestamp":"2007.01.02-15.04.05"}}`))
+	suite.Subject.Follow(w, r)
+
+	assert.Equal(suite.T(), 201, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "event: finished\n")
+	assert.Contains(suite.T(), w.Body.String(), `"status":"failed"`)
+}
+
+func (suite *DeploysResourceTestSuite) TestFollowWhenRejected() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/carousel/deploys?name=carousel&follow=true", strings.NewReader(`{"deploy":{"version":"abc123","batch_size":-1}}`))
+	suite.Subject.Follow(w, r)
+
+	assert.Equal(suite.T(), 400, w.Code)
+	assert.Equal(suite.T(), "application/json", w.Header().Get("Content-Type"))
+	assert.Contains(suite.T(), w.Body.String(), "The batch size and max surge must not be negative.")
+	_, err := suite.Locks.Find("carousel")
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+}
+
+func (suite *DeploysResourceTestSuite) TestFollowWithInvalidJSON() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/carousel/deploys?name=carousel&follow=true", strings.NewReader(`{"deploy":`))
+	suite.Subject.Follow(w, r)
+
+	assert.Equal(suite.T(), 400, w.Code)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithServiceTemplate() {
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Service]\nExecStart=/usr/bin/docker run --name {{.ContainerName}} {{.Image}}\n"})
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+
+	_, _, response, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys?dry_run=true"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "[Service]\nExecStart=/usr/bin/docker run --name carousel-abc123-2007.01.02-15.04.05-%i mmmhm/carousel:abc123\n", response.Plan.UnitFile)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithNamedTemplate() {
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Service]\nExecStart=/bin/false\n"})
+	suite.Templates.Save(&templates.Template{Name: "worker", Body: "[Service]\nExecStart=/usr/bin/docker run {{.Image}} worker\n"})
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", &fleet.Unit{
+		Name:    "carousel:abc123:2007.01.02-15.04.05@1.service",
+		Options: []*fleet.UnitOption{&fleet.UnitOption{Section: "Service", Name: "ExecStart", Value: "/usr/bin/docker run mmmhm/carousel:abc123 worker"}},
+	}).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+
+	code, _, response, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2007.01.02-15.04.05", Template: "worker"}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	assert.Equal(suite.T(), "worker", response.Deploy.Template)
+	suite.waitForDeploy(response.Deploy.ID)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithMissingTemplate() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Template: "missing"}},
+	)
+
+	assert.Equal(suite.T(), templates.ErrNotFound, err)
+	assert.Equal(suite.T(), 400, code)
+	records, _ := suite.Store.List("carousel")
+	assert.Empty(suite.T(), records)
+	_, err = suite.Locks.Find("carousel")
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithTemplateThatFailsToRender() {
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Service]\nExecStart={{.Missing}}\n"})
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123"}},
+	)
+
+	assert.Contains(suite.T(), fmt.Sprintf("%s", err), "The carousel template could not be rendered")
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithInvalidUnitFile() {
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Service]\nExecStart=/usr/bin/docker run --name {{.Name}} {{.Image}}\nExecStrat=/bin/true\n"})
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+
+	code, _, response, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123"}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 400, code)
+	assert.Nil(suite.T(), response.Deploy)
+	assert.Len(suite.T(), response.Problems, 2)
+	assert.Equal(suite.T(), "ExecStrat", response.Problems[0].Directive)
+	assert.Equal(suite.T(), "ExecStart", response.Problems[1].Directive)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "CreateUnit", mockAnyUnit)
+	records, _ := suite.Store.List("carousel")
+	assert.Empty(suite.T(), records)
+	_, err = suite.Locks.Find("carousel")
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateDryRunWithInvalidUnitFile() {
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Unit]\nDescription={{.Name}}\n"})
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+
+	code, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys?dry_run=true"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123"}},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+	assert.Nil(suite.T(), response.Plan)
+	assert.Equal(suite.T(), "Service", response.Problems[0].Section)
+}
+
+func (suite *DeploysResourceTestSuite) TestFollowWithInvalidUnitFile() {
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Unit]\nDescription={{.Name}}\n"})
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/carousel/deploys?name=carousel&follow=true", strings.NewReader(`{"deploy":{"version":"abc123"}}`))
+	suite.Subject.Follow(w, r)
+
+	assert.Equal(suite.T(), 400, w.Code)
+	assert.Equal(suite.T(), "application/json", w.Header().Get("Content-Type"))
+	assert.Contains(suite.T(), w.Body.String(), `"problems":[{"section":"Service"`)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithEnvAndSecrets() {
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Service]\nExecStart=/usr/bin/docker run {{.EnvFlags}} {{.Image}}\n"})
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", &fleet.Unit{
+		Name:    "carousel:abc123:2007.01.02-15.04.05@1.service",
+		Options: []*fleet.UnitOption{&fleet.UnitOption{Section: "Service", Name: "ExecStart", Value: `/usr/bin/docker run -e "DATABASE_URL=postgres://secret@db/carousel" -e "RAILS_ENV=production" mmmhm/carousel:abc123`}},
+	}).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+
+	code, _, response, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{
+			Version:   "abc123",
+			Timestamp: "2007.01.02-15.04.05",
+			Env:       map[string]string{"RAILS_ENV": "production"},
+			Secrets:   []*schema.SecretRef{{Name: "database-url", Env: "DATABASE_URL"}},
+		}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	suite.waitForDeploy(response.Deploy.ID)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithServiceSettings() {
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Service]\nExecStart=/usr/bin/docker run {{.DockerFlags}} {{.Image}}\n"})
+	suite.Settings.Save("carousel", &schema.ServiceSettings{
+		Ports:         []int{8080},
+		Memory:        "512m",
+		CPUShares:     512,
+		Volumes:       []string{"/var/log/carousel:/app/log"},
+		ExtraHosts:    []string{"db:10.0.0.5"},
+		RestartPolicy: "on-failure:3",
+		Labels:        map[string]string{"team": "web"},
+	})
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", &fleet.Unit{
+		Name:    "carousel:abc123:2007.01.02-15.04.05@1.service",
+		Options: []*fleet.UnitOption{&fleet.UnitOption{Section: "Service", Name: "ExecStart", Value: `/usr/bin/docker run -p 8080 -m 512m --cpu-shares 512 -v "/var/log/carousel:/app/log" --add-host "db:10.0.0.5" --restart=on-failure:3 -l "team=web" mmmhm/carousel:abc123`}},
+	}).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+
+	code, _, response, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	suite.waitForDeploy(response.Deploy.ID)
+	suite.FleetMock.Mock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateDryRunRedactsSecrets() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+
+	code, _, response, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys?dry_run=true"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{
+			Version:   "abc123",
+			Timestamp: "2007.01.02-15.04.05",
+			Secrets:   []*schema.SecretRef{{Name: "database-url", Env: "DATABASE_URL"}},
+		}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Contains(suite.T(), response.Plan.UnitFile, `-p 3000 -e "DATABASE_URL=[REDACTED]" mmmhm/carousel:abc123`)
+	assert.NotContains(suite.T(), response.Plan.UnitFile, "postgres://")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithMissingSecret() {
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Secrets: []*schema.SecretRef{{Name: "api-key", Env: "API_KEY"}}}},
+	)
+
+	assert.EqualError(suite.T(), err, "The api-key secret could not be resolved: Secret not found.")
+	assert.Equal(suite.T(), 400, code)
+	records, _ := suite.Store.List("carousel")
+	assert.Empty(suite.T(), records)
+	suite.FleetMock.Mock.AssertNotCalled(suite.T(), "CreateUnit", mockAnyUnit)
+}
+
+func (suite *DeploysResourceTestSuite) TestIndex() {
+	older := schema.NewDeployRecord(&schema.Deploy{ID: "older", ServiceName: "carousel", Version: "efefeff"})
+	older.CreatedAt = time.Now().Add(-time.Hour)
+	suite.Store.Save(older)
+	suite.Store.Save(schema.NewDeployRecord(&schema.Deploy{ID: "newer", ServiceName: "carousel", Version: "abc123"}))
+	suite.Store.Save(schema.NewDeployRecord(&schema.Deploy{ID: "other", ServiceName: "railsapp", Version: "abc123"}))
+
+	code, _, response, err := suite.Subject.Index(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Len(suite.T(), response.Deploys, 2)
+	assert.Equal(suite.T(), "newer", response.Deploys[0].ID)
+	assert.Equal(suite.T(), "older", response.Deploys[1].ID)
+}
+
+func (suite *DeploysResourceTestSuite) TestIndexWithNoDeploys() {
+	code, _, response, err := suite.Subject.Index(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), &DeploysResponse{Deploys: []*schema.DeployRecord{}}, response)
+}
+
+func (suite *DeploysResourceTestSuite) TestShow() {
+	suite.Store.Save(schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"}))
+
+	code, _, response, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/carousel/deploys/d3adb33f"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), "d3adb33f", response.Deploy.ID)
+	assert.Equal(suite.T(), "abc123", response.Deploy.Version)
+}
+
+func (suite *DeploysResourceTestSuite) TestShowNotFound() {
+	code, _, _, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/carousel/deploys/d3adb33f"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), store.ErrNotFound, err)
+	assert.Equal(suite.T(), 404, code)
+}
+
+// defaultUnitOptions returns the options of carousel's unit when rendered from
+// the default template.
+func defaultUnitOptions(version string, timestamp string) []*fleet.UnitOption {
+	unitFile, _ := templates.Default().Render(templates.NewView(&schema.Deploy{ServiceName: "carousel", Version: version, Timestamp: timestamp}, "mmmhm"))
+	options, _ := getUnitOptions(unitFile)
+	return options
+}
+
+// mockAnyUnit matches any unit passed to the Fleet mock's CreateUnit.
+var mockAnyUnit = mock.AnythingOfType("*schema.Unit")
+
+// managedBalancer adds a mock load balancer with the given name to the
+// subject's balancers, which use vulcand by default.
+func (suite *DeploysResourceTestSuite) managedBalancer(name string) *mocks.LoadBalancer {
+	if suite.Subject.Balancers == nil {
+		suite.Subject.Balancers = balancers.NewRegistry(suite.Settings, schema.LoadBalancerVulcand)
+	}
+	balancer := new(mocks.LoadBalancer)
+	suite.Subject.Balancers.Add(name, balancer)
+	return balancer
+}
+
+// weightedBalancer adds a mock load balancer that supports weights with the
+// given name to the subject's balancers and uses it for the carousel service.
+func (suite *DeploysResourceTestSuite) weightedBalancer(name string) *mocks.WeightedLoadBalancer {
+	if suite.Subject.Balancers == nil {
+		suite.Subject.Balancers = balancers.NewRegistry(suite.Settings, schema.LoadBalancerVulcand)
+	}
+	balancer := new(mocks.WeightedLoadBalancer)
+	suite.Subject.Balancers.Add(name, balancer)
+	suite.Settings.Save("carousel", &schema.ServiceSettings{LoadBalancer: name})
+	return balancer
+}
+
+// shiftingDeploy creates a deploy of abc123 that shifts traffic away from a
+// single running instance of efefeff and waits for it to start shifting.  The
+// weights that the balancer is given are sent on the returned channel.
+func (suite *DeploysResourceTestSuite) shiftingDeploy(balancer *mocks.WeightedLoadBalancer, shift *schema.TrafficShift) (*schema.DeployRecord, chan map[string]int) {
+	weights := make(chan map[string]int, 10)
+	suite.Subject.Resolver = staticResolver("10.0.0.1:49153")
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	balancer.On("RegisterWeighted", "carousel", "carousel-abc123-2007.01.02-15.04.05-1", "http://10.0.0.1:49153", 0).Return(nil)
+	balancer.On("SetWeights", "carousel", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		weights <- args.Get(1).(map[string]int)
+	})
+
+	code, _, response, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2007.01.02-15.04.05", TrafficShift: shift}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	assert.True(suite.T(), response.Deploy.DestroyPrevious)
+	return suite.waitForStatus(response.Deploy.ID, schema.DeployShifting), weights
+}
+
+// blueGreenDeploy creates a blue/green deploy of abc123 alongside a single
+// running instance of efefeff and waits for it to be ready to switch.  The
+// weights that the balancer is given are sent on the returned channel.
+func (suite *DeploysResourceTestSuite) blueGreenDeploy(balancer *mocks.WeightedLoadBalancer, gracePeriod string) (*schema.DeployRecord, chan map[string]int) {
+	weights := make(chan map[string]int, 10)
+	suite.Subject.Resolver = staticResolver("10.0.0.1:49153")
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+	balancer.On("RegisterWeighted", "carousel", "carousel-abc123-2007.01.02-15.04.05-1", "http://10.0.0.1:49153", 0).Return(nil)
+	balancer.On("SetWeights", "carousel", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		weights <- args.Get(1).(map[string]int)
+	})
+
+	code, _, response, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2007.01.02-15.04.05", Strategy: schema.StrategyBlueGreen, GracePeriod: gracePeriod}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 201, code)
+	return suite.waitForStatus(response.Deploy.ID, schema.DeployReady), weights
+}
+
+// switchDeploy requests that traffic be switched for the deploy.
+func (suite *DeploysResourceTestSuite) switchDeploy(id string) (int, *DeployResponse, error) {
+	code, _, response, err := suite.Subject.Switch(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/"+id+"/switch"),
+		mocking.Header(nil),
+		nil,
+	)
+	return code, response, err
+}
+
+// staticResolver resolves every instance to the same address.
+type staticResolver string
+
+func (s staticResolver) Resolve(instance *schema.ServiceInstance, machineID string, port int) (string, error) {
+	return string(s), nil
+}
+
+// machineResolver resolves every instance to the IP of the machine it's on.
+type machineResolver map[string]string
+
+func (r machineResolver) Resolve(instance *schema.ServiceInstance, machineID string, port int) (string, error) {
+	ip, ok := r[machineID]
+	if !ok {
+		return "", errors.New("The address of the instance could not be resolved.")
+	}
+	return fmt.Sprintf("%s:%d", ip, port), nil
+}
+
+// listCountingStore counts how many times a service's deploys are listed.
+type listCountingStore struct {
+	store.Store
+	mutex sync.Mutex
+	lists int
+}
+
+func (s *listCountingStore) List(serviceName string) ([]*schema.DeployRecord, error) {
+	s.mutex.Lock()
+	s.lists++
+	s.mutex.Unlock()
+	return s.Store.List(serviceName)
+}
+
+func (s *listCountingStore) Lists() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lists
+}
+
+// portResolver resolves instances to the address only when they're asked for
+// on the port.
+type portResolver struct {
+	port    int
+	address string
+}
+
+func (p portResolver) Resolve(instance *schema.ServiceInstance, machineID string, port int) (string, error) {
+	if port != p.port {
+		return "", fmt.Errorf("nothing is listening on port %d", port)
+	}
+	return p.address, nil
+}
+
+// runningStates returns a running unit state for each of the given Fleet unit
+// names.
+func runningStates(names ...string) []*fleet.UnitState {
+	var states []*fleet.UnitState
+	for _, name := range names {
+		states = append(states, &fleet.UnitState{Name: name, SystemdSubState: "running"})
+	}
+	return states
+}
+
+// unitLifecycle fakes the states that Fleet reports for running units as their
+// target states change.  A unit is still reported running by the first poll
+// after it's set to inactive and dead by the ones after that, and once it's
+// launched it's reported starting and then running.  It keeps track of the
+// states reported for each unit and of any unit that was launched before it
+// was reported dead.
+type unitLifecycle struct {
+	mutex   sync.Mutex
+	states  []*fleet.UnitState
+	pending map[string][]string
+	history map[string][]string
+	early   []string
+}
+
+// mockUnitLifecycle mocks UnitStates and SetUnitTargetState with a
+// unitLifecycle for the running units.
+func (suite *DeploysResourceTestSuite) mockUnitLifecycle(names ...string) *unitLifecycle {
+	l := &unitLifecycle{states: runningStates(names...), pending: map[string][]string{}, history: map[string][]string{}}
+	suite.FleetMock.On("UnitStates").Return(l.states, nil).Run(func(mock.Arguments) { l.poll() })
+	suite.FleetMock.On("SetUnitTargetState", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil).Run(func(args mock.Arguments) {
+		l.setTargetState(args.String(0), args.String(1))
+	})
+	return l
+}
+
+func (l *unitLifecycle) poll() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, state := range l.states {
+		if pending := l.pending[state.Name]; len(pending) > 0 {
+			state.SystemdSubState = pending[0]
+			l.pending[state.Name] = pending[1:]
+		}
+		history := l.history[state.Name]
+		if len(history) == 0 || history[len(history)-1] != state.SystemdSubState {
+			l.history[state.Name] = append(history, state.SystemdSubState)
+		}
+	}
+}
+
+func (l *unitLifecycle) setTargetState(name string, target string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	switch target {
+	case "inactive":
+		l.pending[name] = []string{"running", "dead"}
+	case "launched":
+		history := l.history[name]
+		if len(history) == 0 || history[len(history)-1] != "dead" {
+			l.early = append(l.early, name)
+		}
+		l.pending[name] = []string{"start-pre", "running"}
+	}
+}
+
+func (l *unitLifecycle) reported(name string) []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.history[name]
+}
+
+func (l *unitLifecycle) launchedEarly() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.early
+}
+
+// movingUnit fakes the state of a single unit that Fleet reports running on a
+// machine until it's moved to another one, or stopped by moving it to none.
+type movingUnit struct {
+	*mocks.Fleet
+	mutex     sync.Mutex
+	name      string
+	machineID string
+}
+
+func (m *movingUnit) UnitStates() ([]*fleet.UnitState, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.machineID == "" {
+		return []*fleet.UnitState{&fleet.UnitState{Name: m.name, SystemdSubState: "failed"}}, nil
+	}
+	return []*fleet.UnitState{&fleet.UnitState{Name: m.name, MachineID: m.machineID, SystemdSubState: "running"}}, nil
+}
+
+func (m *movingUnit) moveTo(machineID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.machineID = machineID
+}
+
+// receiveEndpoint waits for the URL of an endpoint to be registered.
+func (suite *DeploysResourceTestSuite) receiveEndpoint(registered chan string) string {
+	select {
+	case url := <-registered:
+		return url
+	case <-time.After(time.Second):
+		suite.T().Fatal("Endpoint was never registered.")
+		return ""
+	}
+}
+
+// canaryRecord returns the record of a two instance canary deploy whose canary
+// is running and waiting to be promoted.
+func (suite *DeploysResourceTestSuite) canaryRecord() *schema.DeployRecord {
+	record := schema.NewDeployRecord(&schema.Deploy{
+		ID:              "d3adb33f",
+		ServiceName:     "carousel",
+		Version:         "abc123",
+		Timestamp:       "2007.01.02-15.04.05",
+		InstanceCount:   2,
+		Canary:          true,
+		DestroyPrevious: true,
+		PreviousVersion: &schema.Deploy{ServiceName: "carousel", Version: "efefeff", Timestamp: "2006.01.02-15.04.05", InstanceCount: 2},
+	})
+	record.Status = schema.DeployCanary
+	record.Transitions = append(record.Transitions, &schema.StateTransition{Instance: "1", SubState: "running", ObservedAt: record.CreatedAt})
+	return record
+}
+
+// waitForStatus blocks until the deploy's record has the given status.
+func (suite *DeploysResourceTestSuite) waitForStatus(id string, status string) *schema.DeployRecord {
+	for i := 0; i < 200; i++ {
+		record, err := suite.Store.Find("carousel", id)
+		if err == nil && record.Status == status {
+			return record
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	suite.T().Fatalf("Deploy %s never reached %s.", id, status)
+	return nil
+}
+
+// waitForUnlock blocks until the carousel service's lock has been released.
+func (suite *DeploysResourceTestSuite) waitForUnlock() {
+	for i := 0; i < 200; i++ {
+		if _, err := suite.Locks.Find("carousel"); err == lock.ErrNotLocked {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	suite.T().Fatal("Lock was never released.")
+}
+
+// waitForDeploy blocks until the deploy's poller has stopped and its record
+// has reached a final status.
+func (suite *DeploysResourceTestSuite) TestCreateNotifiesWebhooks() {
+	events, done := suite.recordWebhooks()
+	defer done()
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", DestroyPrevious: true, Timestamp: "2007.01.02-15.04.05"}},
+	)
+
+	suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), []string{schema.WebhookDeployStarted, schema.WebhookDeploySucceeded, schema.WebhookInstanceRunning, schema.WebhookPreviousDestroyed}, suite.receiveWebhooks(events, 4))
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateNotifiesWebhooksOfFailedInstances() {
+	events, done := suite.recordWebhooks()
+	defer done()
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2006.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2006.01.02-15.04.05@1.service", SystemdSubState: "failed"},
+	}, nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2006.01.02-15.04.05", InstanceCount: 1}},
+	)
+
+	suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), []string{schema.WebhookDeployFailed, schema.WebhookDeployStarted, schema.WebhookInstanceFailed}, suite.receiveWebhooks(events, 3))
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateNotifiesWebhooksOfTimeout() {
+	events, done := suite.recordWebhooks()
+	defer done()
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2006.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{
+		&fleet.UnitState{Name: "carousel:abc123:2006.01.02-15.04.05@1.service", SystemdSubState: "start-pre"},
+	}, nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2006.01.02-15.04.05", InstanceCount: 1}},
+	)
+
+	suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), []string{schema.WebhookDeployStarted, schema.WebhookDeployTimedOut}, suite.receiveWebhooks(events, 2))
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateNotifiesWebhooksOfFailureCreatingUnits() {
+	events, done := suite.recordWebhooks()
+	defer done()
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(errors.New("fleet is down"))
+
+	suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2006.01.02-15.04.05", InstanceCount: 1}},
+	)
+
+	assert.Equal(suite.T(), []string{schema.WebhookDeployFailed, schema.WebhookDeployStarted}, suite.receiveWebhooks(events, 2))
+}
+
+// recordWebhooks points the resource's webhooks at a server that sends the
+// event of each payload it receives on the returned channel, along with a
+// function that shuts the server down.
+func (suite *DeploysResourceTestSuite) recordWebhooks() (chan string, func()) {
+	events := make(chan string, 20)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events <- r.Header.Get(webhooks.EventHeader)
+	}))
+	suite.Subject.Webhooks = webhooks.NewDispatcher([]*schema.Webhook{{URL: server.URL}}, nil, nil)
+	return events, server.Close
+}
+
+// receiveWebhooks waits for count events to be received and returns them in
+// alphabetical order, since payloads are delivered concurrently.
+func (suite *DeploysResourceTestSuite) receiveWebhooks(events chan string, count int) []string {
+	var received []string
+	for len(received) < count {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		case <-time.After(5 * time.Second):
+			suite.T().Fatalf("Only received webhooks for %v.", received)
+		}
+	}
+	sort.Strings(received)
+	return received
+}
+
+func (suite *DeploysResourceTestSuite) waitForDeploy(id string) *schema.DeployRecord {
+	for i := 0; i < 200; i++ {
+		record, err := suite.Store.Find("carousel", id)
+		if err == nil && record.IsFinished() {
+			return record
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	suite.T().Fatalf("Deploy %s never finished.", id)
+	return nil
+}
+
+func (suite *DeploysResourceTestSuite) TestStopDeregistersFromServiceBalancer() {
+	vulcand := suite.managedBalancer(schema.LoadBalancerVulcand)
+	nginx := suite.managedBalancer(schema.LoadBalancerNginx)
+	suite.Settings.Save("carousel", &schema.ServiceSettings{LoadBalancer: schema.LoadBalancerNginx})
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"launched", "launched", "", "carousel:abc123:2007.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	nginx.On("Deregister", "carousel", "carousel-abc123-2007.01.02-15.04.05-1").Return(nil).Times(1)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "loaded").Return(nil)
+
+	code, _, _, err := suite.Subject.Stop(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/stop"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	nginx.AssertExpectations(suite.T())
+	vulcand.AssertNotCalled(suite.T(), "Deregister", "carousel", "carousel-abc123-2007.01.02-15.04.05-1")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithTrafficShiftShiftsTrafficInSteps() {
+	balancer := suite.weightedBalancer(schema.LoadBalancerNginx)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+	balancer.On("Deregister", "carousel", "carousel-efefeff-2006.01.02-15.04.05-1").Return(nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil)
+
+	record, weights := suite.shiftingDeploy(balancer, &schema.TrafficShift{Steps: []int{25, 100}})
+
+	assert.Equal(suite.T(), map[string]int{"carousel-abc123-2007.01.02-15.04.05-1": 33, "carousel-efefeff-2006.01.02-15.04.05-1": 100}, <-weights)
+	assert.Equal(suite.T(), 25, record.TrafficWeight)
+	suite.FleetMock.AssertNotCalled(suite.T(), "DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service")
+	_, err := suite.Locks.Find("carousel")
+	assert.Nil(suite.T(), err)
+
+	code, _, response, err := suite.Subject.Shift(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/"+record.ID+"/shift"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), schema.DeploySucceeded, response.Deploy.Status)
+	assert.Equal(suite.T(), 100, response.Deploy.TrafficWeight)
+	assert.Equal(suite.T(), map[string]int{"carousel-abc123-2007.01.02-15.04.05-1": 100, "carousel-efefeff-2006.01.02-15.04.05-1": 0}, <-weights)
+	suite.waitForUnlock()
+	suite.FleetMock.AssertExpectations(suite.T())
+	balancer.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithTrafficShiftIntervalShiftsOnSchedule() {
+	balancer := suite.weightedBalancer(schema.LoadBalancerHAProxy)
+	// The previous version is only destroyed once the deploy has been seen
+	// shifting, since the shift could otherwise finish before its status is
+	// checked.
+	shifting := make(chan struct{})
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+	balancer.On("Deregister", "carousel", "carousel-efefeff-2006.01.02-15.04.05-1").Return(nil).Run(func(mock.Arguments) { <-shifting })
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil)
+
+	record, _ := suite.shiftingDeploy(balancer, &schema.TrafficShift{Steps: []int{50, 100}, Interval: "20ms"})
+	close(shifting)
+	record = suite.waitForDeploy(record.ID)
+
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+	assert.Equal(suite.T(), 100, record.TrafficWeight)
+	suite.waitForUnlock()
+	suite.FleetMock.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestAbortWhileShiftingTraffic() {
+	balancer := suite.weightedBalancer(schema.LoadBalancerNginx)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+	balancer.On("Deregister", "carousel", "carousel-abc123-2007.01.02-15.04.05-1").Return(nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service").Return(nil)
+
+	record, weights := suite.shiftingDeploy(balancer, &schema.TrafficShift{})
+	<-weights
+
+	code, _, response, err := suite.Subject.Abort(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/"+record.ID+"/abort"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), schema.DeployAborted, response.Deploy.Status)
+	assert.Equal(suite.T(), 0, response.Deploy.TrafficWeight)
+	assert.Equal(suite.T(), map[string]int{"carousel-abc123-2007.01.02-15.04.05-1": 0, "carousel-efefeff-2006.01.02-15.04.05-1": 100}, <-weights)
+	suite.FleetMock.AssertNotCalled(suite.T(), "DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service")
+	suite.waitForUnlock()
+	suite.FleetMock.AssertExpectations(suite.T())
+	balancer.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestShiftingTrafficShiftsBackWhenInstanceStops() {
+	balancer := suite.weightedBalancer(schema.LoadBalancerNginx)
+	suite.Subject.ShiftCheckInterval = 5 * time.Millisecond
+	// The instance only stops once the deploy has been seen shifting, since the
+	// shift could otherwise be aborted before its status is checked.
+	stopped := make(chan struct{})
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil).Times(1)
+	suite.FleetMock.On("UnitStates").Return([]*fleet.UnitState{&fleet.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "failed"}}, nil).Run(func(mock.Arguments) { <-stopped })
+	balancer.On("Deregister", "carousel", "carousel-abc123-2007.01.02-15.04.05-1").Return(nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service").Return(nil)
+
+	record, _ := suite.shiftingDeploy(balancer, &schema.TrafficShift{})
+	close(stopped)
+	record = suite.waitForDeploy(record.ID)
+
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	assert.True(suite.T(), record.RolledBack)
+	assert.Equal(suite.T(), 0, record.TrafficWeight)
+	assert.Contains(suite.T(), record.Error, "stopped running")
+	suite.waitForUnlock()
+	suite.FleetMock.AssertNotCalled(suite.T(), "DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service")
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithTrafficShiftWithoutPreviousVersion() {
+	balancer := suite.weightedBalancer(schema.LoadBalancerNginx)
+	suite.Subject.Resolver = staticResolver("10.0.0.1:49153")
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+	balancer.On("Register", "carousel", "carousel-abc123-2007.01.02-15.04.05-1", "http://10.0.0.1:49153").Return(nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2007.01.02-15.04.05", TrafficShift: &schema.TrafficShift{}}},
+	)
+
+	record := suite.waitForDeploy(response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+	balancer.AssertExpectations(suite.T())
+	balancer.AssertNotCalled(suite.T(), "SetWeights", "carousel", mock.Anything)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithTrafficShiftWithoutWeightedBalancer() {
+	suite.managedBalancer(schema.LoadBalancerVulcand)
+
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", TrafficShift: &schema.TrafficShift{}}},
+	)
+
+	assert.EqualError(suite.T(), err, "Traffic can only be shifted with a load balancer that supports weights, such as nginx or HAProxy.")
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateCanaryWithTrafficShift() {
+	suite.weightedBalancer(schema.LoadBalancerNginx)
+
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Canary: true, TrafficShift: &schema.TrafficShift{}}},
+	)
+
+	assert.EqualError(suite.T(), err, "Traffic shifting isn't supported for canary or global deploys.")
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithInvalidTrafficSteps() {
+	suite.weightedBalancer(schema.LoadBalancerNginx)
+
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", TrafficShift: &schema.TrafficShift{Steps: []int{50, 25, 100}}}},
+	)
+
+	assert.EqualError(suite.T(), err, "Traffic steps must be percentages between 1 and 100 in increasing order.")
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestFailInterruptedDeploysFailsUnfinishedDeploys() {
+	launching := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123", Timestamp: "2007.01.02-15.04.05"})
+	polling := schema.NewDeployRecord(&schema.Deploy{ID: "f00dcafe", ServiceName: "carousel", Version: "def456", Timestamp: "2007.01.02-15.04.05"})
+	polling.Status = schema.DeployPolling
+	suite.Store.Save(launching)
+	suite.Store.Save(polling)
+
+	err := suite.Subject.FailInterruptedDeploys()
+
+	assert.Nil(suite.T(), err)
+	record, _ := suite.Store.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	assert.Equal(suite.T(), "Deployster restarted while the deploy was launching its instances, so its instances were left as they were.", record.Error)
+	record, _ = suite.Store.Find("carousel", "f00dcafe")
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	assert.Equal(suite.T(), "Deployster restarted while the deploy was waiting for its instances to come online, so its instances were left as they were.", record.Error)
+}
+
+func (suite *DeploysResourceTestSuite) TestFailInterruptedDeploysFailsShiftingDeploys() {
+	shifting := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123", Timestamp: "2007.01.02-15.04.05", TrafficShift: &schema.TrafficShift{}})
+	shifting.Status = schema.DeployShifting
+	shifting.TrafficWeight = 30
+	succeeded := schema.NewDeployRecord(&schema.Deploy{ID: "f00dcafe", ServiceName: "carousel", Version: "efefeff", Timestamp: "2006.01.02-15.04.05"})
+	succeeded.Status = schema.DeploySucceeded
+	suite.Store.Save(shifting)
+	suite.Store.Save(succeeded)
+
+	err := suite.Subject.FailInterruptedDeploys()
+
+	assert.Nil(suite.T(), err)
+	record, _ := suite.Store.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	assert.Equal(suite.T(), "Deployster restarted while the deploy was shifting traffic, so both versions were left running with 30% of traffic on this one.", record.Error)
+	record, _ = suite.Store.Find("carousel", "f00dcafe")
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+}
+
+func (suite *DeploysResourceTestSuite) TestShiftingTrafficToleratesFailuresBelowThreshold() {
+	balancer := suite.weightedBalancer(schema.LoadBalancerNginx)
+	suite.Subject.ShiftCheckInterval = 5 * time.Millisecond
+	suite.Subject.PollTimeout = 5 * time.Second
+	// Once the deploy is shifting, every other health check fails, which never
+	// reaches the threshold of two consecutive failures.
+	var mu sync.Mutex
+	flaky := false
+	checks := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !flaky {
+			return
+		}
+		checks++
+		if checks%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+	suite.Subject.Resolver = staticResolver(address)
+	suite.FleetMock.On("Units").Return([]*fleet.Unit{
+		&fleet.Unit{"running", "running", "efefeff", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*fleet.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("CreateUnit", mockAnyUnit).Return(nil)
+	suite.FleetMock.On("SetUnitTargetState", "carousel:abc123:2007.01.02-15.04.05@1.service", "launched").Return(nil)
+	suite.FleetMock.On("UnitStates").Return(runningStates("carousel:abc123:2007.01.02-15.04.05@1.service"), nil)
+	balancer.On("RegisterWeighted", "carousel", "carousel-abc123-2007.01.02-15.04.05-1", "http://"+address, 0).Return(nil)
+	balancer.On("SetWeights", "carousel", mock.Anything).Return(nil)
+	balancer.On("Deregister", "carousel", "carousel-abc123-2007.01.02-15.04.05-1").Return(nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service").Return(nil)
+
+	_, _, response, _ := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Timestamp: "2007.01.02-15.04.05", TrafficShift: &schema.TrafficShift{}, HealthCheck: &schema.HealthCheck{Path: "/health", Threshold: 2}}},
+	)
+	// Passing the threshold of health checks takes at least their interval.
+	time.Sleep(time.Second)
+	suite.waitForStatus(response.Deploy.ID, schema.DeployShifting)
+	mu.Lock()
+	flaky = true
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	record, _ := suite.Store.Find("carousel", response.Deploy.ID)
+	assert.Equal(suite.T(), schema.DeployShifting, record.Status)
+	mu.Lock()
+	assert.True(suite.T(), checks > 2)
+	mu.Unlock()
+	suite.Subject.Abort(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/"+response.Deploy.ID+"/abort"),
+		mocking.Header(nil),
+		nil,
+	)
+}
+
+func (suite *DeploysResourceTestSuite) TestShiftWhenNotShifting() {
+	suite.Store.Save(suite.canaryRecord())
+
+	code, _, _, err := suite.Subject.Shift(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/shift"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.EqualError(suite.T(), err, "Deploy is not shifting traffic.")
+	assert.Equal(suite.T(), 409, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestShiftNotFound() {
+	code, _, _, _ := suite.Subject.Shift(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/d3adb33f/shift"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), 404, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateBlueGreenWaitsToBeSwitched() {
+	balancer := suite.weightedBalancer(schema.LoadBalancerNginx)
+	balancer.On("Deregister", "carousel", "carousel-efefeff-2006.01.02-15.04.05-1").Return(nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service").Return(nil)
+
+	record, weights := suite.blueGreenDeploy(balancer, "10ms")
+
+	assert.Equal(suite.T(), 0, record.TrafficWeight)
+	balancer.AssertNotCalled(suite.T(), "SetWeights", "carousel", mock.Anything)
+	suite.FleetMock.AssertNotCalled(suite.T(), "DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service")
+	_, err := suite.Locks.Find("carousel")
+	assert.Nil(suite.T(), err)
+
+	code, response, err := suite.switchDeploy(record.ID)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), schema.DeploySwitched, response.Deploy.Status)
+	assert.Equal(suite.T(), 100, response.Deploy.TrafficWeight)
+	assert.Equal(suite.T(), map[string]int{"carousel-abc123-2007.01.02-15.04.05-1": 100, "carousel-efefeff-2006.01.02-15.04.05-1": 0}, <-weights)
+	record = suite.waitForDeploy(record.ID)
+	assert.Equal(suite.T(), schema.DeploySucceeded, record.Status)
+	suite.waitForUnlock()
+	suite.FleetMock.AssertExpectations(suite.T())
+	balancer.AssertExpectations(suite.T())
+}
+
+func (suite *DeploysResourceTestSuite) TestSwitchBackDuringGracePeriod() {
+	balancer := suite.weightedBalancer(schema.LoadBalancerHAProxy)
+	record, weights := suite.blueGreenDeploy(balancer, "1h")
+	suite.switchDeploy(record.ID)
+	<-weights
+
+	code, response, err := suite.switchDeploy(record.ID)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), schema.DeployReady, response.Deploy.Status)
+	assert.Equal(suite.T(), 0, response.Deploy.TrafficWeight)
+	assert.Equal(suite.T(), map[string]int{"carousel-abc123-2007.01.02-15.04.05-1": 0, "carousel-efefeff-2006.01.02-15.04.05-1": 100}, <-weights)
+	suite.FleetMock.AssertNotCalled(suite.T(), "DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service")
+	suite.FleetMock.AssertNotCalled(suite.T(), "DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service")
+	_, err = suite.Locks.Find("carousel")
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *DeploysResourceTestSuite) TestAbortBlueGreen() {
+	balancer := suite.weightedBalancer(schema.LoadBalancerNginx)
+	balancer.On("Deregister", "carousel", "carousel-abc123-2007.01.02-15.04.05-1").Return(nil)
+	suite.FleetMock.On("DestroyUnit", "carousel:abc123:2007.01.02-15.04.05@1.service").Return(nil)
+	record, weights := suite.blueGreenDeploy(balancer, "1h")
+	suite.switchDeploy(record.ID)
+	<-weights
+
+	code, _, response, err := suite.Subject.Abort(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys/"+record.ID+"/abort"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), schema.DeployAborted, response.Deploy.Status)
+	assert.Equal(suite.T(), map[string]int{"carousel-abc123-2007.01.02-15.04.05-1": 0, "carousel-efefeff-2006.01.02-15.04.05-1": 100}, <-weights)
+	suite.FleetMock.AssertNotCalled(suite.T(), "DestroyUnit", "carousel:efefeff:2006.01.02-15.04.05@1.service")
+	suite.waitForUnlock()
+	balancer.AssertExpectations(suite.T())
+
+	code, _, _ = suite.switchDeploy(record.ID)
+	assert.Equal(suite.T(), 409, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestFailInterruptedDeploysFailsBlueGreenDeploys() {
+	ready := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123", Timestamp: "2007.01.02-15.04.05", Strategy: schema.StrategyBlueGreen})
+	ready.Status = schema.DeployReady
+	switched := schema.NewDeployRecord(&schema.Deploy{ID: "f00dcafe", ServiceName: "api", Version: "def456", Timestamp: "2007.01.02-15.04.05", Strategy: schema.StrategyBlueGreen})
+	switched.Status = schema.DeploySwitched
+	switched.TrafficWeight = 100
+	suite.Store.Save(ready)
+	suite.Store.Save(switched)
+
+	err := suite.Subject.FailInterruptedDeploys()
+
+	assert.Nil(suite.T(), err)
+	record, _ := suite.Store.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	assert.Equal(suite.T(), "Deployster restarted while the deploy was waiting to be switched, so both versions were left running with 0% of traffic on this one.", record.Error)
+	record, _ = suite.Store.Find("api", "f00dcafe")
+	assert.Equal(suite.T(), schema.DeployFailed, record.Status)
+	assert.Equal(suite.T(), "Deployster restarted while the deploy was in its grace period, so both versions were left running with 100% of traffic on this one.", record.Error)
+}
+
+func (suite *DeploysResourceTestSuite) TestSwitchWhenNotBlueGreen() {
+	suite.Store.Save(suite.canaryRecord())
+
+	code, _, err := suite.switchDeploy("d3adb33f")
+
+	assert.EqualError(suite.T(), err, "Deploy is not a blue/green deploy waiting to be switched.")
+	assert.Equal(suite.T(), 409, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestSwitchNotFound() {
+	code, _, _ := suite.switchDeploy("d3adb33f")
+
+	assert.Equal(suite.T(), 404, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateBlueGreenWithoutWeightedBalancer() {
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Strategy: schema.StrategyBlueGreen}},
+	)
+
+	assert.EqualError(suite.T(), err, "Traffic can only be switched with a load balancer that supports weights, such as nginx or HAProxy.")
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateBlueGreenWithInvalidGracePeriod() {
+	suite.weightedBalancer(schema.LoadBalancerNginx)
+
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Strategy: schema.StrategyBlueGreen, GracePeriod: "soon"}},
+	)
+
+	assert.EqualError(suite.T(), err, "The grace period \"soon\" must be a duration such as 10m.")
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateBlueGreenCanary() {
+	suite.weightedBalancer(schema.LoadBalancerNginx)
+
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Strategy: schema.StrategyBlueGreen, Canary: true}},
+	)
+
+	assert.EqualError(suite.T(), err, "Blue/green deploys can't be canaries, global, or shift traffic gradually.")
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestCreateWithUnknownStrategy() {
+	code, _, _, err := suite.Subject.Create(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/services/carousel/deploys"),
+		mocking.Header(nil),
+		&DeployRequest{&schema.Deploy{Version: "abc123", Strategy: "red_black"}},
+	)
+
+	assert.EqualError(suite.T(), err, "The strategy \"red_black\" isn't supported.  Use rolling or blue_green.")
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *DeploysResourceTestSuite) TestTrafficWeights() {
+	for _, c := range []struct{ percent, count, previousCount, weight, previousWeight int }{
+		{0, 2, 2, 0, 100},
+		{10, 2, 2, 11, 100},
+		{50, 2, 2, 100, 100},
+		{50, 1, 3, 100, 33},
+		{90, 3, 1, 100, 33},
+		{1, 1, 200, 100, 50},
+		{100, 2, 2, 100, 0},
+	} {
+		weight, previousWeight := trafficWeights(c.percent, c.count, c.previousCount)
+		assert.Equal(suite.T(), c.weight, weight, "%d%% to %d of %d", c.percent, c.count, c.previousCount)
+		assert.Equal(suite.T(), c.previousWeight, previousWeight, "%d%% to %d of %d", c.percent, c.count, c.previousCount)
+	}
+}
+
+// closeNotifyingRecorder is a ResponseRecorder that reports the client as
+// disconnected once closed is closed.
+type closeNotifyingRecorder struct {
+	*httptest.ResponseRecorder
+	closed chan bool
+}
+
+func (r *closeNotifyingRecorder) CloseNotify() <-chan bool {
+	return r.closed
+}
+
 func TestDeploysResourceTestSuite(t *testing.T) {
 	suite.Run(t, new(DeploysResourceTestSuite))
 }
@@ -2,11 +2,22 @@ package server
 
 import (
 	_ "expvar"
+	"log"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"net/url"
-
+	"sync"
+
+	"github.com/bmorton/deployster/balancers"
+	"github.com/bmorton/deployster/health"
+	"github.com/bmorton/deployster/lock"
+	"github.com/bmorton/deployster/progress"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
+	"github.com/bmorton/deployster/webhooks"
 	"github.com/coreos/fleet/client"
 	"github.com/fsouza/go-dockerclient"
 	"github.com/rcrowley/go-tigertonic"
@@ -19,26 +30,60 @@ import (
 // all requests.  An image prefix can be either a private registry address:port
 // or a username on the public registry (basically something that'll be appended
 // to the service name, e.g. mmmmhm/servicename or my.registry:5000/servicename).
+// The store is where the history of every deploy is kept.  Locks keep track of
+// which services have a deploy in progress and Progress collects the events of
+// deploys that are being followed.  Templates holds the unit templates that
+// deploys are launched with, Settings holds the settings that each service's
+// containers are run with, and Secrets resolves the secrets referenced by
+// deploys and tasks.  Balancers holds the load balancers that deployster
+// registers the endpoint of each instance with once the instance is online,
+// instead of leaving it up to the unit template, and picks the one that each
+// service uses.  Webhooks notifies the global and per-service webhooks of deploy
+// and task events.  DockerAPI describes how the Docker API of each machine is
+// reached to find the ports that instances are published on.
 type DeploysterService struct {
 	AppVersion  string
 	Listen      string
 	Username    string
 	Password    string
 	ImagePrefix string
+	Store       store.Store
+	Templates   *templates.Registry
+	Settings    *settings.Registry
+	Secrets     secrets.Provider
+	Balancers   *balancers.Registry
+	Webhooks    *webhooks.Dispatcher
+	DockerAPI   *health.DockerAPI
+	Locks       *lock.Manager
+	Progress    *progress.Hub
 	RootMux     *tigertonic.TrieServeMux
 	Mux         *tigertonic.TrieServeMux
 	Server      *tigertonic.Server
+
+	deploys  *DeploysResource
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 // NewDeploysterService returns a configured DeploysterService, ready to listen
 // for HTTP requests via the provided listen string.
-func NewDeploysterService(listen string, version string, username string, password string, imagePrefix string) *DeploysterService {
+func NewDeploysterService(listen string, version string, username string, password string, imagePrefix string, deployStore store.Store, unitTemplates *templates.Registry, serviceSettings *settings.Registry, secretProvider secrets.Provider, serviceBalancers *balancers.Registry, dispatcher *webhooks.Dispatcher, dockerAPI *health.DockerAPI) *DeploysterService {
 	service := DeploysterService{
 		Listen:      listen,
 		AppVersion:  version,
 		Username:    username,
 		Password:    password,
 		ImagePrefix: imagePrefix,
+		Store:       deployStore,
+		Templates:   unitTemplates,
+		Settings:    serviceSettings,
+		Secrets:     secretProvider,
+		Balancers:   serviceBalancers,
+		Webhooks:    dispatcher,
+		DockerAPI:   dockerAPI,
+		Locks:       lock.NewManager(),
+		Progress:    progress.NewHub(),
+		stop:        make(chan struct{}),
 	}
 	service.RootMux = tigertonic.NewTrieServeMux()
 	service.Mux = tigertonic.NewTrieServeMux()
@@ -56,17 +101,62 @@ func (ds *DeploysterService) ConfigureRoutes() {
 	fleetClient, _ := getFleetHTTPClient()
 
 	dockerClient, _ := docker.NewClient("unix:///var/run/docker.sock")
-	deploys := DeploysResource{fleetClient, ds.ImagePrefix}
+	deploys := &DeploysResource{Fleet: fleetClient, ImagePrefix: ds.ImagePrefix, Store: ds.Store, Templates: ds.Templates, Settings: ds.Settings, Secrets: ds.Secrets, Balancers: ds.Balancers, Locks: ds.Locks, Progress: ds.Progress, Resolver: health.NewDockerResolver(fleetClient, ds.DockerAPI), Webhooks: ds.Webhooks}
+	ds.deploys = deploys
+	locks := LockResource{ds.Locks}
+	unitTemplates := TemplatesResource{ds.Templates, ds.Settings, ds.Secrets, ds.ImagePrefix, ds.Balancers}
+	unitFile := UnitFileResource{ds.Templates, ds.Settings, ds.Secrets, ds.Store, ds.ImagePrefix, ds.Balancers}
+	serviceSettings := SettingsResource{ds.Settings, ds.Balancers}
 	units := UnitsResource{fleetClient}
-	tasks := TasksResource{dockerClient, ds.ImagePrefix}
+	services := ServicesResource{fleetClient}
+	tasks := TasksResource{dockerClient, ds.Settings, ds.Secrets, ds.ImagePrefix, ds.Webhooks}
+	serviceWebhooks := WebhooksResource{ds.Webhooks}
 
 	ds.Mux.Handle("GET", "/version", ds.authenticated(tigertonic.Version(ds.AppVersion)))
-	ds.Mux.Handle("POST", "/services/{name}/deploys", ds.authenticated(tigertonic.Marshaled(deploys.Create)))
-	ds.Mux.Handle("DELETE", "/services/{name}/deploys/{version}", ds.authenticated(tigertonic.Marshaled(deploys.Destroy)))
+	ds.Mux.Handle("GET", "/services", ds.authenticated(tigertonic.Marshaled(services.Index)))
+	ds.Mux.Handle("POST", "/services/{name}/deploys", ds.authenticated(followable(tigertonic.Marshaled(deploys.Create), http.HandlerFunc(deploys.Follow))))
+	ds.Mux.Handle("GET", "/services/{name}/deploys", ds.authenticated(tigertonic.Marshaled(deploys.Index)))
+	ds.Mux.Handle("GET", "/services/{name}/deploys/{id}", ds.authenticated(tigertonic.Marshaled(deploys.Show)))
+	ds.Mux.Handle("POST", "/services/{name}/deploys/{id}/promote", ds.authenticated(tigertonic.Marshaled(deploys.Promote)))
+	ds.Mux.Handle("POST", "/services/{name}/deploys/{id}/abort", ds.authenticated(tigertonic.Marshaled(deploys.Abort)))
+	ds.Mux.Handle("POST", "/services/{name}/deploys/{id}/shift", ds.authenticated(tigertonic.Marshaled(deploys.Shift)))
+	ds.Mux.Handle("POST", "/services/{name}/deploys/{id}/switch", ds.authenticated(tigertonic.Marshaled(deploys.Switch)))
+	ds.Mux.Handle("DELETE", "/services/{name}/deploys/{id}", ds.authenticated(tigertonic.Marshaled(deploys.Destroy)))
+	ds.Mux.Handle("POST", "/services/{name}/rollback", ds.authenticated(tigertonic.Marshaled(deploys.Rollback)))
+	ds.Mux.Handle("PUT", "/services/{name}/scale", ds.authenticated(tigertonic.Marshaled(deploys.Scale)))
+	ds.Mux.Handle("POST", "/services/{name}/restart", ds.authenticated(tigertonic.Marshaled(deploys.Restart)))
+	ds.Mux.Handle("POST", "/services/{name}/stop", ds.authenticated(tigertonic.Marshaled(deploys.Stop)))
+	ds.Mux.Handle("POST", "/services/{name}/start", ds.authenticated(tigertonic.Marshaled(deploys.Start)))
+	ds.Mux.Handle("GET", "/services/{name}/lock", ds.authenticated(tigertonic.Marshaled(locks.Show)))
+	ds.Mux.Handle("DELETE", "/services/{name}/lock", ds.authenticated(tigertonic.Marshaled(locks.Destroy)))
 	ds.Mux.Handle("GET", "/services/{name}/units", ds.authenticated(tigertonic.Marshaled(units.Index)))
+	ds.Mux.Handle("GET", "/services/{name}/unitfile", ds.authenticated(tigertonic.Marshaled(unitFile.Show)))
+	ds.Mux.Handle("GET", "/services/{name}/settings", ds.authenticated(tigertonic.Marshaled(serviceSettings.Show)))
+	ds.Mux.Handle("PUT", "/services/{name}/settings", ds.authenticated(tigertonic.Marshaled(serviceSettings.Update)))
+	ds.Mux.Handle("DELETE", "/services/{name}/settings", ds.authenticated(tigertonic.Marshaled(serviceSettings.Destroy)))
+	ds.Mux.Handle("GET", "/services/{name}/webhooks/deliveries", ds.authenticated(tigertonic.Marshaled(serviceWebhooks.Deliveries)))
+	ds.Mux.Handle("GET", "/templates", ds.authenticated(tigertonic.Marshaled(unitTemplates.Index)))
+	ds.Mux.Handle("POST", "/templates/validate", ds.authenticated(tigertonic.Marshaled(unitTemplates.Validate)))
+	ds.Mux.Handle("GET", "/templates/{name}", ds.authenticated(tigertonic.Marshaled(unitTemplates.Show)))
+	ds.Mux.Handle("PUT", "/templates/{name}", ds.authenticated(tigertonic.Marshaled(unitTemplates.Update)))
+	ds.Mux.Handle("DELETE", "/templates/{name}", ds.authenticated(tigertonic.Marshaled(unitTemplates.Destroy)))
 	ds.Mux.Handle("POST", "/services/{name}/tasks", ds.authenticated(http.HandlerFunc(tasks.Create)))
 }
 
+// Start fails the deploys that deployster was in the middle of when it last
+// stopped and, if it manages load balancers, starts reconciling their endpoints
+// with Fleet in the background until the service is closed.  It's called once,
+// before the server starts listening.
+func (ds *DeploysterService) Start() {
+	err := ds.deploys.FailInterruptedDeploys()
+	if err != nil {
+		log.Println(err)
+	}
+	if ds.Balancers != nil {
+		go ds.deploys.WatchEndpoints(ds.stop)
+	}
+}
+
 // ListenAndServe starts the HTTP server.
 func (ds *DeploysterService) ListenAndServe() error {
 	return ds.Server.ListenAndServe()
@@ -77,8 +167,10 @@ func (ds *DeploysterService) ListenAndServeTLS(certPath string, keyPath string)
 	return ds.Server.ListenAndServeTLS(certPath, keyPath)
 }
 
-// Close gracefully stops listening for new requests
+// Close gracefully stops listening for new requests and stops reconciling
+// endpoints.  It's safe to call more than once.
 func (ds *DeploysterService) Close() error {
+	ds.stopOnce.Do(func() { close(ds.stop) })
 	return ds.Server.Close()
 }
 
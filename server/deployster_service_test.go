@@ -1,6 +1,11 @@
 package server
 
 import (
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"net/http"
@@ -14,7 +19,7 @@ type DeploysterServiceTestSuite struct {
 }
 
 func (suite *DeploysterServiceTestSuite) SetupSuite() {
-	suite.Subject = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm")
+	suite.Subject = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm", store.NewMemoryStore(), templates.NewMemoryRegistry(), settings.NewMemoryRegistry(), secrets.NewMemoryProvider(nil), nil, nil, nil)
 }
 
 func (suite *DeploysterServiceTestSuite) TestGetVersionRequiresAuthentication() {
@@ -33,6 +38,62 @@ func (suite *DeploysterServiceTestSuite) TestPostDeploysRequiresAuthentication()
 	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
 }
 
+func (suite *DeploysterServiceTestSuite) TestFollowDeployRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/deploys?follow=true", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestGetDeploysRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/v1/services/test/deploys", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestGetDeployRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/v1/services/test/deploys/d3adb33f", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestPromoteDeployRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/deploys/d3adb33f/promote", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestAbortDeployRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/deploys/d3adb33f/abort", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestShiftDeployRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/deploys/d3adb33f/shift", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestSwitchDeployRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/deploys/d3adb33f/switch", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
 func (suite *DeploysterServiceTestSuite) TestDeleteDeploysRequiresAuthentication() {
 	w := httptest.NewRecorder()
 	r, _ := http.NewRequest("DELETE", "http://example.com/v1/services/test/deploys/abc123", nil)
@@ -41,6 +102,30 @@ func (suite *DeploysterServiceTestSuite) TestDeleteDeploysRequiresAuthentication
 	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
 }
 
+func (suite *DeploysterServiceTestSuite) TestPostRollbackRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/rollback", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestGetLockRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/v1/services/test/lock", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestDeleteLockRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("DELETE", "http://example.com/v1/services/test/lock", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
 func (suite *DeploysterServiceTestSuite) TestGetUnitsRequiresAuthentication() {
 	w := httptest.NewRecorder()
 	r, _ := http.NewRequest("GET", "http://example.com/v1/services/test/units", nil)
@@ -49,6 +134,142 @@ func (suite *DeploysterServiceTestSuite) TestGetUnitsRequiresAuthentication() {
 	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
 }
 
+func (suite *DeploysterServiceTestSuite) TestGetUnitFileRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/v1/services/test/unitfile?version=abc123", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestGetSettingsRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/v1/services/test/settings", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestPutSettingsRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("PUT", "http://example.com/v1/services/test/settings", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestDeleteSettingsRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("DELETE", "http://example.com/v1/services/test/settings", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestRestartRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/restart", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestStopRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/stop", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestStartRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/start", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestGetServicesRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/v1/services", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestScaleRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("PUT", "http://example.com/v1/services/test/scale", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestGetTemplatesRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/v1/templates", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestGetTemplateRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/v1/templates/default", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestPutTemplateRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("PUT", "http://example.com/v1/templates/default", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestDeleteTemplateRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("DELETE", "http://example.com/v1/templates/default", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestValidateTemplateRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/templates/validate", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestWebhookDeliveriesRequiresAuthentication() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/v1/services/carousel/webhooks/deliveries", nil)
+	suite.Subject.RootMux.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *DeploysterServiceTestSuite) TestStartFailsInterruptedDeploys() {
+	deployStore := store.NewMemoryStore()
+	record := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123", Timestamp: "2007.01.02-15.04.05"})
+	record.Status = schema.DeployPolling
+	deployStore.Save(record)
+	service := NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm", deployStore, templates.NewMemoryRegistry(), settings.NewMemoryRegistry(), secrets.NewMemoryProvider(nil), nil, nil, nil)
+
+	saved, _ := deployStore.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeployPolling, saved.Status)
+
+	service.Start()
+
+	saved, _ = deployStore.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeployFailed, saved.Status)
+}
+
 func TestDeploysterServiceTestSuite(t *testing.T) {
 	suite.Run(t, new(DeploysterServiceTestSuite))
 }
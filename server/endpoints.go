@@ -0,0 +1,200 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"github.com/bmorton/deployster/handlers"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/units"
+	fleet "github.com/coreos/fleet/schema"
+)
+
+// defaultEndpointCheckInterval is how often the endpoints that deployster
+// manages are reconciled with Fleet when the resource doesn't configure it.
+const defaultEndpointCheckInterval time.Duration = 30 * time.Second
+
+// managedEndpoint is an endpoint that the reconciler has seen running on a
+// machine.  The machine is tracked so that an instance that Fleet reschedules
+// onto another machine is registered at its new address.
+type managedEndpoint struct {
+	deploy    *schema.Deploy
+	instance  *schema.ServiceInstance
+	machineID string
+}
+
+// WatchEndpoints reconciles the endpoints that deployster manages with the
+// state of their units every EndpointCheckInterval, or every 30 seconds if it
+// isn't set, until stop is closed.
+func (dr *DeploysResource) WatchEndpoints(stop <-chan struct{}) {
+	interval := dr.EndpointCheckInterval
+	if interval == 0 {
+		interval = defaultEndpointCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		dr.ReconcileEndpoints()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReconcileEndpoints keeps the load balancers that deployster manages in step
+// with Fleet, since instances whose endpoints are managed can't register or
+// deregister themselves from their unit files.  Instances that are running on a
+// machine they weren't seen on before, such as after Fleet reschedules them,
+// are registered once they're online and endpoints whose instances have
+// stopped running are deregistered.  Services that are locked are skipped so
+// that endpoints aren't registered ahead of the deploy that's running.
+func (dr *DeploysResource) ReconcileEndpoints() {
+	allUnits, err := dr.Fleet.Units()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	states, err := dr.Fleet.UnitStates()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	running := runningMachines(states)
+
+	dr.endpointsMutex.Lock()
+	defer dr.endpointsMutex.Unlock()
+	if dr.endpoints == nil {
+		dr.endpoints = make(map[string]*managedEndpoint)
+	}
+
+	seen := make(map[string]bool)
+	for _, serviceName := range units.FindServiceNames(allUnits) {
+		if !dr.Balancers.Manages(serviceName) {
+			continue
+		}
+		if _, err := dr.Locks.Find(serviceName); err == nil {
+			for id, endpoint := range dr.endpoints {
+				if endpoint.instance.Name == serviceName {
+					seen[id] = true
+				}
+			}
+			continue
+		}
+
+		index, err := dr.newDeployIndex(serviceName, allUnits)
+		if err != nil {
+			log.Println(err)
+			for id, endpoint := range dr.endpoints {
+				if endpoint.instance.Name == serviceName {
+					seen[id] = true
+				}
+			}
+			continue
+		}
+		weights := endpointWeights(index.records)
+		for _, unit := range units.FindServiceUnits(serviceName, "", allUnits) {
+			instance := &schema.ServiceInstance{Name: serviceName, Version: unit.Version, Timestamp: unit.Timestamp, Instance: unit.Instance}
+			for _, machineID := range running[instance.FleetUnitName()] {
+				deploy := index.unitDeploy(unit)
+				endpoint := &managedEndpoint{deploy: deploy, instance: instance, machineID: machineID}
+				id := endpoint.id()
+				seen[id] = true
+				if tracked, ok := dr.endpoints[id]; ok && tracked.machineID == machineID {
+					continue
+				}
+				log.Printf("Registering %s on %s once it's online.\n", instance.FleetUnitName(), machineID)
+				dr.endpoints[id] = endpoint
+				dr.registerWhenOnline(deploy, dr.endpointRegistrar(deploy, weights), instance)
+			}
+		}
+	}
+
+	for id, endpoint := range dr.endpoints {
+		if seen[id] {
+			continue
+		}
+		delete(dr.endpoints, id)
+		if registrar := dr.endpointRegistrar(endpoint.deploy, nil); registrar != nil {
+			registrar.DeregisterEndpoint(endpoint.instance, endpoint.globalMachineID())
+		}
+	}
+}
+
+// endpointRegistrar returns the registrar that reconciled endpoints are
+// registered with.  Unlike a deploy's registrar, it registers endpoints with the
+// weight that the service's deploys last left their version with, or a full
+// share of traffic, and doesn't report to a deploy's followers.
+func (dr *DeploysResource) endpointRegistrar(deploy *schema.Deploy, weights map[string]int) *handlers.Registrar {
+	registrar := dr.registrar(deploy)
+	if registrar != nil {
+		registrar.Drained = false
+		registrar.Reporter = nil
+		if weight, ok := weights[deploy.Version+":"+deploy.Timestamp]; ok {
+			registrar.Drained = weight == 0
+			registrar.Weight = weight
+		}
+	}
+	return registrar
+}
+
+// endpointWeights returns the weight of the endpoints of each version:timestamp
+// whose traffic was last weighted by a deploy that shifted or switched traffic,
+// such as a deploy that's still shifting when its lock is released or one that
+// was interrupted by a restart.  The newest deploy that launched or replaced a
+// version decides its weight, and versions that it didn't weight are left out
+// so that they're registered with a full share of traffic.
+func endpointWeights(records []*schema.DeployRecord) map[string]int {
+	weights := make(map[string]int)
+	decided := make(map[string]bool)
+	for _, record := range records {
+		deploy := record.Deploy
+		key := deploy.Version + ":" + deploy.Timestamp
+		var previousKey string
+		if deploy.PreviousVersion != nil {
+			previousKey = deploy.PreviousVersion.Version + ":" + deploy.PreviousVersion.Timestamp
+		}
+
+		if deploy.ShiftsTraffic() || deploy.SwitchesTraffic() {
+			weight, previousWeight := trafficWeights(record.TrafficWeight, deploy.InstanceCount, deploy.PreviousVersion.InstanceCount)
+			if !decided[key] {
+				weights[key] = weight
+			}
+			if !decided[previousKey] {
+				weights[previousKey] = previousWeight
+			}
+		}
+		decided[key] = true
+		if previousKey != "" {
+			decided[previousKey] = true
+		}
+	}
+	return weights
+}
+
+// id returns the ID that the endpoint is registered under.
+func (e *managedEndpoint) id() string {
+	return handlers.EndpointID(e.instance, e.globalMachineID())
+}
+
+// globalMachineID returns the machine that's part of the endpoint's ID, which
+// is only set for the instances of global deploys.
+func (e *managedEndpoint) globalMachineID() string {
+	if e.deploy.Global {
+		return e.machineID
+	}
+	return ""
+}
+
+// runningMachines maps the name of each unit to the machines it's running on.
+func runningMachines(states []*fleet.UnitState) map[string][]string {
+	running := make(map[string][]string)
+	for _, state := range states {
+		if state.SystemdSubState == "running" {
+			running[state.Name] = append(running[state.Name], state.MachineID)
+		}
+	}
+	return running
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// followable routes requests that ask to follow their progress to the follow
+// handler and every other request to the regular handler.  A request asks to
+// follow by accepting `text/event-stream` or passing `follow=true` in the query
+// string, unless it's a dry run.
+func followable(handler http.Handler, follow http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		wantsStream := strings.Contains(r.Header.Get("Accept"), "text/event-stream") || query.Get("follow") == "true"
+		if wantsStream && query.Get("dry_run") != "true" {
+			follow.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// writeServerSentEvent writes a single server-sent event with the given name and
+// the JSON encoding of data as its payload.
+func writeServerSentEvent(w io.Writer, name string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, fmt.Sprintf("event: %s\ndata: %s\n\n", name, payload))
+	return err
+}
+
+// writeError responds with the status code and the error in the same JSON
+// format that Tigertonic uses for errors returned by marshaled handlers.
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{
+		"description": err.Error(),
+		"error":       "error",
+	})
+}
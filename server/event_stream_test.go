@@ -0,0 +1,67 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EventStreamTestSuite struct {
+	suite.Suite
+	Subject http.Handler
+}
+
+func (suite *EventStreamTestSuite) SetupTest() {
+	suite.Subject = followable(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "regular") }),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "follow") }),
+	)
+}
+
+func (suite *EventStreamTestSuite) TestFollowableWithAcceptHeader() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/deploys", nil)
+	r.Header.Set("Accept", "text/event-stream")
+	suite.Subject.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), "follow", w.Body.String())
+}
+
+func (suite *EventStreamTestSuite) TestFollowableWithQueryParam() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/deploys?follow=true", nil)
+	suite.Subject.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), "follow", w.Body.String())
+}
+
+func (suite *EventStreamTestSuite) TestFollowableWithDryRun() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/deploys?follow=true&dry_run=true", nil)
+	suite.Subject.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), "regular", w.Body.String())
+}
+
+func (suite *EventStreamTestSuite) TestFollowableWithoutFollowing() {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "http://example.com/v1/services/test/deploys", nil)
+	suite.Subject.ServeHTTP(w, r)
+
+	assert.Equal(suite.T(), "regular", w.Body.String())
+}
+
+func (suite *EventStreamTestSuite) TestWriteServerSentEvent() {
+	w := httptest.NewRecorder()
+	writeServerSentEvent(w, "deploy", map[string]string{"id": "d3adb33f"})
+
+	assert.Equal(suite.T(), "event: deploy\ndata: {\"id\":\"d3adb33f\"}\n\n", w.Body.String())
+}
+
+func TestEventStreamTestSuite(t *testing.T) {
+	suite.Run(t, new(EventStreamTestSuite))
+}
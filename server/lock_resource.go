@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/bmorton/deployster/lock"
+)
+
+// LockResource is the HTTP resource responsible for inspecting and releasing
+// the lock that a running deploy holds on its service.
+type LockResource struct {
+	Locks *lock.Manager
+}
+
+// LockResponse is the wrapper struct for the JSON payload returned by the Show
+// action.
+type LockResponse struct {
+	Lock *lock.Lock `json:"lock"`
+}
+
+// Show is the GET endpoint for retrieving the lock held on a service, including
+// the ID of the deploy that holds it.
+//
+// This function assumes that it is nested inside `/services/{name}`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (lr *LockResource) Show(u *url.URL, h http.Header, req interface{}) (int, http.Header, *LockResponse, error) {
+	held, err := lr.Locks.Find(u.Query().Get("name"))
+	if err != nil {
+		return http.StatusNotFound, nil, nil, err
+	}
+
+	return http.StatusOK, nil, &LockResponse{Lock: held}, nil
+}
+
+// Destroy is the DELETE endpoint for forcefully releasing the lock held on a
+// service so that new deploys can be started.  The deploy that held the lock
+// isn't stopped.
+//
+// This function assumes that it is nested inside `/services/{name}`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (lr *LockResource) Destroy(u *url.URL, h http.Header, req interface{}) (int, http.Header, interface{}, error) {
+	err := lr.Locks.ForceRelease(u.Query().Get("name"))
+	if err != nil {
+		return http.StatusNotFound, nil, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil, nil
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/bmorton/deployster/lock"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
+	"github.com/rcrowley/go-tigertonic/mocking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LockResourceTestSuite struct {
+	suite.Suite
+	Subject LockResource
+	Locks   *lock.Manager
+	Service *DeploysterService
+}
+
+func (suite *LockResourceTestSuite) SetupSuite() {
+	suite.Service = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm", store.NewMemoryStore(), templates.NewMemoryRegistry(), settings.NewMemoryRegistry(), secrets.NewMemoryProvider(nil), nil, nil, nil)
+}
+
+func (suite *LockResourceTestSuite) SetupTest() {
+	suite.Locks = lock.NewManager()
+	suite.Subject = LockResource{Locks: suite.Locks}
+}
+
+func (suite *LockResourceTestSuite) TestShow() {
+	suite.Locks.Acquire("carousel", "d3adb33f")
+
+	code, _, response, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/carousel/lock"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), "d3adb33f", response.Lock.DeployID)
+}
+
+func (suite *LockResourceTestSuite) TestShowNotLocked() {
+	code, _, _, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/carousel/lock"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+	assert.Equal(suite.T(), 404, code)
+}
+
+func (suite *LockResourceTestSuite) TestDestroy() {
+	suite.Locks.Acquire("carousel", "d3adb33f")
+
+	code, _, _, err := suite.Subject.Destroy(
+		mocking.URL(suite.Service.RootMux, "DELETE", "http://example.com/v1/services/carousel/lock"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 204, code)
+	_, err = suite.Locks.Find("carousel")
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+}
+
+func (suite *LockResourceTestSuite) TestDestroyNotLocked() {
+	code, _, _, err := suite.Subject.Destroy(
+		mocking.URL(suite.Service.RootMux, "DELETE", "http://example.com/v1/services/carousel/lock"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), lock.ErrNotLocked, err)
+	assert.Equal(suite.T(), 404, code)
+}
+
+func TestLockResourceTestSuite(t *testing.T) {
+	suite.Run(t, new(LockResourceTestSuite))
+}
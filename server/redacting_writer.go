@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/bmorton/deployster/secrets"
+)
+
+// maxRedactedLineLength is the amount of output a redactingWriter holds onto
+// while waiting for the end of a line before writing it anyway.
+const maxRedactedLineLength = 32 * 1024
+
+// redactingWriter replaces the value of every secret in an environment with
+// secrets.Redacted before passing output on to the writer it wraps.  Output is
+// redacted a line at a time so that a secret split across writes is still
+// caught, which means that a trailing partial line is only written once the
+// writer is closed.
+type redactingWriter struct {
+	writer io.Writer
+	env    *secrets.Environment
+	mutex  sync.Mutex
+	buffer []byte
+}
+
+// newRedactingWriter creates a redactingWriter that redacts the secrets of env
+// from everything written to w.
+func newRedactingWriter(w io.Writer, env *secrets.Environment) *redactingWriter {
+	return &redactingWriter{writer: w, env: env}
+}
+
+// Write satisfies the io.Writer interface, writing every complete line that's
+// been buffered once it's been redacted.
+func (rw *redactingWriter) Write(p []byte) (int, error) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	rw.buffer = append(rw.buffer, p...)
+	end := bytes.LastIndex(rw.buffer, []byte("\n")) + 1
+	if len(rw.buffer) > maxRedactedLineLength {
+		end = len(rw.buffer)
+	}
+	if end == 0 {
+		return len(p), nil
+	}
+
+	err := rw.write(end)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush satisfies the http.Flusher interface so that a flushWriter wrapping a
+// redactingWriter still flushes the response as output is written.  Buffered
+// output isn't written until it's complete.
+func (rw *redactingWriter) Flush() {
+	if f, ok := rw.writer.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes any partial line that's still buffered once it's been redacted.
+func (rw *redactingWriter) Close() error {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if len(rw.buffer) == 0 {
+		return nil
+	}
+	return rw.write(len(rw.buffer))
+}
+
+// write redacts and writes the first n bytes of the buffer, keeping the rest.
+func (rw *redactingWriter) write(n int) error {
+	_, err := io.WriteString(rw.writer, rw.env.Redact(string(rw.buffer[:n])))
+	rw.buffer = append([]byte(nil), rw.buffer[n:]...)
+	if len(rw.buffer) == 0 {
+		rw.buffer = nil
+	}
+	return err
+}
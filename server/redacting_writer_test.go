@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RedactingWriterTestSuite struct {
+	suite.Suite
+	Env *secrets.Environment
+}
+
+func (suite *RedactingWriterTestSuite) SetupTest() {
+	provider := secrets.NewMemoryProvider(map[string]string{"api-key": "s3cr3t"})
+	suite.Env, _ = secrets.Resolve(provider, map[string]string{"RAILS_ENV": "production"}, []*schema.SecretRef{{Name: "api-key", Env: "API_KEY"}})
+}
+
+func (suite *RedactingWriterTestSuite) TestRedactsSecretsFromLines() {
+	w := httptest.NewRecorder()
+	subject := newRedactingWriter(w, suite.Env)
+	subject.Write([]byte("key=s3cr3t env=production\n"))
+
+	assert.Equal(suite.T(), "key=[REDACTED] env=production\n", w.Body.String())
+}
+
+func (suite *RedactingWriterTestSuite) TestRedactsSecretsSplitAcrossWrites() {
+	w := httptest.NewRecorder()
+	subject := newRedactingWriter(w, suite.Env)
+	subject.Write([]byte("key=s3c"))
+	assert.Equal(suite.T(), "", w.Body.String())
+	subject.Write([]byte("r3t\nnext"))
+
+	assert.Equal(suite.T(), "key=[REDACTED]\n", w.Body.String())
+}
+
+func (suite *RedactingWriterTestSuite) TestCloseWritesPartialLine() {
+	w := httptest.NewRecorder()
+	subject := newRedactingWriter(w, suite.Env)
+	subject.Write([]byte("key=s3cr3t"))
+	subject.Close()
+
+	assert.Equal(suite.T(), "key=[REDACTED]", w.Body.String())
+}
+
+func (suite *RedactingWriterTestSuite) TestWritesLongLinesWithoutWaiting() {
+	w := httptest.NewRecorder()
+	subject := newRedactingWriter(w, suite.Env)
+	subject.Write([]byte(strings.Repeat(".", maxRedactedLineLength+1)))
+
+	assert.Equal(suite.T(), maxRedactedLineLength+1, w.Body.Len())
+}
+
+func (suite *RedactingWriterTestSuite) TestFlushesThroughFlushWriter() {
+	w := httptest.NewRecorder()
+	subject := newFlushWriter(newRedactingWriter(w, suite.Env))
+	subject.Write([]byte("test\n"))
+
+	assert.True(suite.T(), w.Flushed)
+}
+
+func TestRedactingWriterTestSuite(t *testing.T) {
+	suite.Run(t, new(RedactingWriterTestSuite))
+}
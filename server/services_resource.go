@@ -0,0 +1,153 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/bmorton/deployster/clients"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/units"
+	fleet "github.com/coreos/fleet/schema"
+)
+
+const (
+	// ServiceHealthy is the health of a service or version whose units are all
+	// running.
+	ServiceHealthy = "healthy"
+
+	// ServiceDegraded is the health of a service or version with some of its
+	// units running and others that aren't.
+	ServiceDegraded = "degraded"
+
+	// ServiceUnhealthy is the health of a service or version that should be
+	// running but has none of its units running.
+	ServiceUnhealthy = "unhealthy"
+
+	// ServiceStopped is the health of a service or version whose units have
+	// all been stopped.
+	ServiceStopped = "stopped"
+)
+
+// ServicesResource is the HTTP resource responsible for getting an overview of
+// every service that deployster is managing in the cluster.
+type ServicesResource struct {
+	Fleet clients.Fleet
+}
+
+// ServicesResponse is the wrapper struct for the JSON payload returned by the
+// Index action.
+type ServicesResponse struct {
+	Services []*Service `json:"services"`
+}
+
+// Service is the overview of a service that has units in Fleet, with the
+// versions it's running and the aggregate health of their units.
+type Service struct {
+	Name          string            `json:"name"`
+	InstanceCount int               `json:"instance_count"`
+	Running       int               `json:"running"`
+	Failed        int               `json:"failed"`
+	Stopped       int               `json:"stopped"`
+	Health        string            `json:"health"`
+	Versions      []*ServiceVersion `json:"versions"`
+}
+
+// ServiceVersion is the overview of a single deploy of a version of a service,
+// counting its units along with how many of them are running, how many have
+// failed, and how many have been stopped.
+type ServiceVersion struct {
+	Version       string `json:"version"`
+	Timestamp     string `json:"deploy_timestamp"`
+	InstanceCount int    `json:"instance_count"`
+	Running       int    `json:"running"`
+	Failed        int    `json:"failed"`
+	Stopped       int    `json:"stopped"`
+	Health        string `json:"health"`
+}
+
+// Index is the GET endpoint for listing every service that deployster manages,
+// sorted by name.  Each service lists its versions, from oldest to newest, with
+// the number of units each one has, how many of them are running or have failed
+// according to systemd, and how many have been stopped.  A global unit is only counted as running once
+// it's running on every machine that has reported its state.
+func (sr *ServicesResource) Index(u *url.URL, h http.Header, req interface{}) (int, http.Header, *ServicesResponse, error) {
+	allUnits, err := sr.Fleet.Units()
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	states, err := sr.Fleet.UnitStates()
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	unitStates := make(map[string][]*fleet.UnitState)
+	for _, state := range states {
+		unitStates[state.Name] = append(unitStates[state.Name], state)
+	}
+
+	response := &ServicesResponse{Services: []*Service{}}
+	for _, name := range units.FindServiceNames(allUnits) {
+		service := &Service{Name: name, Versions: []*ServiceVersion{}}
+		for _, running := range sortedVersions(units.FindTimestampedServiceVersions(name, allUnits)) {
+			version := &ServiceVersion{Version: running.Version, Timestamp: running.Timestamp}
+			for _, unit := range units.FindServiceUnits(name, running.Version, allUnits) {
+				if unit.Timestamp == running.Timestamp {
+					version.count(unit, unitStates)
+				}
+			}
+			version.Health = aggregateHealth(version.InstanceCount, version.Running, version.Stopped)
+
+			service.InstanceCount += version.InstanceCount
+			service.Running += version.Running
+			service.Failed += version.Failed
+			service.Stopped += version.Stopped
+			service.Versions = append(service.Versions, version)
+		}
+		service.Health = aggregateHealth(service.InstanceCount, service.Running, service.Stopped)
+		response.Services = append(response.Services, service)
+	}
+
+	return http.StatusOK, nil, response, nil
+}
+
+// count adds the unit to the version's totals using the systemd states that
+// Fleet reported for it.
+func (sv *ServiceVersion) count(unit units.VersionedUnit, unitStates map[string][]*fleet.UnitState) {
+	sv.InstanceCount++
+	if unit.DesiredState != "launched" {
+		sv.Stopped++
+	}
+
+	instance := &schema.ServiceInstance{Name: unit.Service, Version: unit.Version, Timestamp: unit.Timestamp, Instance: unit.Instance}
+	states := unitStates[instance.FleetUnitName()]
+	running := len(states) > 0
+	for _, state := range states {
+		if state.SystemdSubState == "failed" {
+			sv.Failed++
+			return
+		}
+		if state.SystemdSubState != "running" {
+			running = false
+		}
+	}
+	if running {
+		sv.Running++
+	}
+}
+
+// aggregateHealth returns the health of units given how many of them there
+// are, how many are running, and how many have been stopped.
+func aggregateHealth(total int, running int, stopped int) string {
+	switch {
+	case total > 0 && running == total:
+		return ServiceHealthy
+	case total > 0 && stopped == total:
+		return ServiceStopped
+	case running > 0:
+		return ServiceDegraded
+	default:
+		return ServiceUnhealthy
+	}
+}
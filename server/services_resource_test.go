@@ -0,0 +1,145 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bmorton/deployster/clients/mocks"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
+	"github.com/coreos/fleet/schema"
+	"github.com/rcrowley/go-tigertonic/mocking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ServicesResourceTestSuite struct {
+	suite.Suite
+	Subject   ServicesResource
+	FleetMock *mocks.Fleet
+	Service   *DeploysterService
+}
+
+func (suite *ServicesResourceTestSuite) SetupSuite() {
+	suite.Service = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm", store.NewMemoryStore(), templates.NewMemoryRegistry(), settings.NewMemoryRegistry(), secrets.NewMemoryProvider(nil), nil, nil, nil)
+}
+
+func (suite *ServicesResourceTestSuite) SetupTest() {
+	suite.FleetMock = new(mocks.Fleet)
+	suite.Subject = ServicesResource{suite.FleetMock}
+}
+
+func (suite *ServicesResourceTestSuite) TestIndexWithNoResults() {
+	suite.FleetMock.On("Units").Return([]*schema.Unit{
+		&schema.Unit{"launched", "launched", "abc123", "vulcand.service", []*schema.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("UnitStates").Return([]*schema.UnitState{}, nil)
+
+	code, _, response, err := suite.Subject.Index(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), &ServicesResponse{Services: []*Service{}}, response)
+}
+
+func (suite *ServicesResourceTestSuite) TestIndex() {
+	suite.FleetMock.On("Units").Return([]*schema.Unit{
+		&schema.Unit{"launched", "launched", "abc123", "railsapp:abc123:2007.01.02-15.04.05@1.service", []*schema.UnitOption{}},
+		&schema.Unit{"launched", "launched", "abc123", "carousel:abc123:2007.01.02-15.04.05@1.service", []*schema.UnitOption{}},
+		&schema.Unit{"launched", "launched", "abc123", "carousel:abc123:2007.01.02-15.04.05@2.service", []*schema.UnitOption{}},
+		&schema.Unit{"launched", "launched", "abc123", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*schema.UnitOption{}},
+		&schema.Unit{"launched", "launched", "abc123", "vulcand.service", []*schema.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("UnitStates").Return([]*schema.UnitState{
+		&schema.UnitState{Name: "railsapp:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "running"},
+		&schema.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "running"},
+		&schema.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@2.service", SystemdSubState: "start-pre"},
+		&schema.UnitState{Name: "carousel:efefeff:2006.01.02-15.04.05@1.service", SystemdSubState: "failed"},
+		&schema.UnitState{Name: "vulcand.service", SystemdSubState: "failed"},
+	}, nil)
+
+	code, _, response, err := suite.Subject.Index(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Len(suite.T(), response.Services, 2)
+
+	carousel := response.Services[0]
+	assert.Equal(suite.T(), "carousel", carousel.Name)
+	assert.Equal(suite.T(), 3, carousel.InstanceCount)
+	assert.Equal(suite.T(), 1, carousel.Running)
+	assert.Equal(suite.T(), 1, carousel.Failed)
+	assert.Equal(suite.T(), ServiceDegraded, carousel.Health)
+	assert.Equal(suite.T(), []*ServiceVersion{
+		&ServiceVersion{Version: "efefeff", Timestamp: "2006.01.02-15.04.05", InstanceCount: 1, Failed: 1, Health: ServiceUnhealthy},
+		&ServiceVersion{Version: "abc123", Timestamp: "2007.01.02-15.04.05", InstanceCount: 2, Running: 1, Health: ServiceDegraded},
+	}, carousel.Versions)
+
+	railsapp := response.Services[1]
+	assert.Equal(suite.T(), "railsapp", railsapp.Name)
+	assert.Equal(suite.T(), ServiceHealthy, railsapp.Health)
+}
+
+func (suite *ServicesResourceTestSuite) TestIndexWithStoppedService() {
+	suite.FleetMock.On("Units").Return([]*schema.Unit{
+		&schema.Unit{"loaded", "loaded", "abc123", "carousel:abc123:2007.01.02-15.04.05@1.service", []*schema.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("UnitStates").Return([]*schema.UnitState{
+		&schema.UnitState{Name: "carousel:abc123:2007.01.02-15.04.05@1.service", SystemdSubState: "dead"},
+	}, nil)
+
+	_, _, response, _ := suite.Subject.Index(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), 1, response.Services[0].Stopped)
+	assert.Equal(suite.T(), ServiceStopped, response.Services[0].Health)
+}
+
+func (suite *ServicesResourceTestSuite) TestIndexWithGlobalService() {
+	suite.FleetMock.On("Units").Return([]*schema.Unit{
+		&schema.Unit{"launched", "launched", "", "logspout:abc123:2007.01.02-15.04.05@1.service", []*schema.UnitOption{}},
+	}, nil)
+	suite.FleetMock.On("UnitStates").Return([]*schema.UnitState{
+		&schema.UnitState{Name: "logspout:abc123:2007.01.02-15.04.05@1.service", MachineID: "m4ch1n3-1", SystemdSubState: "running"},
+		&schema.UnitState{Name: "logspout:abc123:2007.01.02-15.04.05@1.service", MachineID: "m4ch1n3-2", SystemdSubState: "start-pre"},
+	}, nil)
+
+	_, _, response, _ := suite.Subject.Index(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), 0, response.Services[0].Running)
+	assert.Equal(suite.T(), ServiceUnhealthy, response.Services[0].Health)
+}
+
+func (suite *ServicesResourceTestSuite) TestIndexWithFleetError() {
+	suite.FleetMock.On("Units").Return([]*schema.Unit{}, errors.New("Fleet is unavailable."))
+
+	code, _, _, err := suite.Subject.Index(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.NotNil(suite.T(), err)
+	assert.Equal(suite.T(), 500, code)
+}
+
+func TestServicesResourceTestSuite(t *testing.T) {
+	suite.Run(t, new(ServicesResourceTestSuite))
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/bmorton/deployster/balancers"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/settings"
+)
+
+// SettingsResource is the HTTP resource responsible for the settings that each
+// service's containers are run with, such as the ports they publish and the
+// resources they're limited to.  Services can only pick a load balancer that's
+// configured in Balancers.
+type SettingsResource struct {
+	Settings  *settings.Registry
+	Balancers *balancers.Registry
+}
+
+// SettingsRequest is the wrapper struct used to deserialize the JSON payload
+// that is sent for saving a service's settings.
+type SettingsRequest struct {
+	Settings *schema.ServiceSettings `json:"settings"`
+}
+
+// SettingsResponse is the wrapper struct for the JSON payload returned by the
+// Show and Update actions.
+type SettingsResponse struct {
+	Settings *schema.ServiceSettings `json:"settings"`
+}
+
+// Show is the GET endpoint for retrieving the settings of a service.  A service
+// without saved settings responds with empty settings, which run its
+// containers with the defaults.
+//
+// This function assumes that it is nested inside `/services/{name}/settings`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (sr *SettingsResource) Show(u *url.URL, h http.Header, req interface{}) (int, http.Header, *SettingsResponse, error) {
+	return http.StatusOK, nil, &SettingsResponse{Settings: sr.Settings.ForService(u.Query().Get("name"))}, nil
+}
+
+// Update is the PUT endpoint for saving the settings of a service, replacing
+// any existing settings.  The settings apply to every deploy and task that is
+// launched afterwards.  Invalid settings are rejected.
+//
+// This function assumes that it is nested inside `/services/{name}/settings`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (sr *SettingsResource) Update(u *url.URL, h http.Header, req *SettingsRequest) (int, http.Header, *SettingsResponse, error) {
+	if req.Settings == nil {
+		return http.StatusBadRequest, nil, nil, errors.New("Settings must be provided.")
+	}
+
+	err := settings.Validate(req.Settings)
+	if err != nil {
+		return http.StatusBadRequest, nil, nil, err
+	}
+	err = sr.Balancers.Validate(req.Settings.LoadBalancer)
+	if err != nil {
+		return http.StatusBadRequest, nil, nil, err
+	}
+
+	err = sr.Settings.Save(u.Query().Get("name"), req.Settings)
+	if err == settings.ErrInvalidName {
+		return http.StatusBadRequest, nil, nil, err
+	}
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	return http.StatusOK, nil, &SettingsResponse{Settings: req.Settings}, nil
+}
+
+// Destroy is the DELETE endpoint for removing the settings of a service so that
+// its containers are run with the defaults.
+//
+// This function assumes that it is nested inside `/services/{name}/settings`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (sr *SettingsResource) Destroy(u *url.URL, h http.Header, req interface{}) (int, http.Header, interface{}, error) {
+	err := sr.Settings.Delete(u.Query().Get("name"))
+	if err == settings.ErrNotFound {
+		return http.StatusNotFound, nil, nil, err
+	}
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil, nil
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bmorton/deployster/balancers"
+	"github.com/bmorton/deployster/clients/mocks"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
+	"github.com/rcrowley/go-tigertonic/mocking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SettingsResourceTestSuite struct {
+	suite.Suite
+	Subject  SettingsResource
+	Settings *settings.Registry
+	Service  *DeploysterService
+}
+
+func (suite *SettingsResourceTestSuite) SetupSuite() {
+	suite.Service = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm", store.NewMemoryStore(), templates.NewMemoryRegistry(), settings.NewMemoryRegistry(), secrets.NewMemoryProvider(nil), nil, nil, nil)
+}
+
+func (suite *SettingsResourceTestSuite) SetupTest() {
+	suite.Settings = settings.NewMemoryRegistry()
+	suite.Subject = SettingsResource{suite.Settings, balancers.NewRegistry(suite.Settings, schema.LoadBalancerVulcand)}
+}
+
+func (suite *SettingsResourceTestSuite) TestShow() {
+	suite.Settings.Save("carousel", &schema.ServiceSettings{Ports: []int{8080}, Memory: "512m"})
+
+	code, _, response, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/carousel/settings"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), &schema.ServiceSettings{Ports: []int{8080}, Memory: "512m"}, response.Settings)
+}
+
+func (suite *SettingsResourceTestSuite) TestShowWithoutSavedSettings() {
+	code, _, response, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/carousel/settings"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), &schema.ServiceSettings{}, response.Settings)
+}
+
+func (suite *SettingsResourceTestSuite) TestUpdate() {
+	code, _, response, err := suite.Subject.Update(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/services/carousel/settings"),
+		mocking.Header(nil),
+		&SettingsRequest{&schema.ServiceSettings{Ports: []int{8080}, RestartPolicy: "always"}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), []int{8080}, response.Settings.Ports)
+	saved, _ := suite.Settings.Find("carousel")
+	assert.Equal(suite.T(), &schema.ServiceSettings{Ports: []int{8080}, RestartPolicy: "always"}, saved)
+}
+
+func (suite *SettingsResourceTestSuite) TestUpdateWithInvalidSettings() {
+	code, _, _, err := suite.Subject.Update(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/services/carousel/settings"),
+		mocking.Header(nil),
+		&SettingsRequest{&schema.ServiceSettings{Ports: []int{70000}}},
+	)
+
+	assert.Contains(suite.T(), fmt.Sprintf("%s", err), "70000")
+	assert.Equal(suite.T(), 400, code)
+	_, err = suite.Settings.Find("carousel")
+	assert.Equal(suite.T(), settings.ErrNotFound, err)
+}
+
+func (suite *SettingsResourceTestSuite) TestUpdateWithLoadBalancer() {
+	suite.Subject.Balancers.Add(schema.LoadBalancerNginx, new(mocks.LoadBalancer))
+
+	code, _, response, err := suite.Subject.Update(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/services/carousel/settings"),
+		mocking.Header(nil),
+		&SettingsRequest{&schema.ServiceSettings{LoadBalancer: schema.LoadBalancerNginx}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), schema.LoadBalancerNginx, response.Settings.LoadBalancer)
+}
+
+func (suite *SettingsResourceTestSuite) TestUpdateWithUnconfiguredLoadBalancer() {
+	code, _, _, err := suite.Subject.Update(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/services/carousel/settings"),
+		mocking.Header(nil),
+		&SettingsRequest{&schema.ServiceSettings{LoadBalancer: schema.LoadBalancerHAProxy}},
+	)
+
+	assert.EqualError(suite.T(), err, "The haproxy load balancer isn't configured.")
+	assert.Equal(suite.T(), 400, code)
+	_, err = suite.Settings.Find("carousel")
+	assert.Equal(suite.T(), settings.ErrNotFound, err)
+}
+
+func (suite *SettingsResourceTestSuite) TestUpdateWithoutSettings() {
+	code, _, _, _ := suite.Subject.Update(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/services/carousel/settings"),
+		mocking.Header(nil),
+		&SettingsRequest{},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *SettingsResourceTestSuite) TestDestroy() {
+	suite.Settings.Save("carousel", &schema.ServiceSettings{Ports: []int{8080}})
+
+	code, _, _, err := suite.Subject.Destroy(
+		mocking.URL(suite.Service.RootMux, "DELETE", "http://example.com/v1/services/carousel/settings"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 204, code)
+	_, err = suite.Settings.Find("carousel")
+	assert.Equal(suite.T(), settings.ErrNotFound, err)
+}
+
+func (suite *SettingsResourceTestSuite) TestDestroyNotFound() {
+	code, _, _, err := suite.Subject.Destroy(
+		mocking.URL(suite.Service.RootMux, "DELETE", "http://example.com/v1/services/carousel/settings"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), settings.ErrNotFound, err)
+	assert.Equal(suite.T(), 404, code)
+}
+
+func TestSettingsResourceTestSuite(t *testing.T) {
+	suite.Run(t, new(SettingsResourceTestSuite))
+}
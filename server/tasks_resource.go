@@ -8,6 +8,10 @@ import (
 	"time"
 
 	"github.com/bmorton/deployster/clients"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/webhooks"
 	"github.com/fsouza/go-dockerclient"
 )
 
@@ -15,10 +19,16 @@ import (
 // the Docker API in an opinionated and conventional way.  Using the provided
 // ImagePrefix and the payload passed to the Create endpoint, we can construct
 // the image name to pull from the Docker Hub Registry so that the task can be
-// launched.
+// launched.  Tasks are run with the service's Settings, except for its ports and
+// restart policy since tasks don't serve traffic and only run once.  Secrets
+// resolves the secrets that tasks reference.  Webhooks are notified of each
+// task that finishes running along with its exit code.
 type TasksResource struct {
 	Docker      clients.Docker
+	Settings    *settings.Registry
+	Secrets     secrets.Provider
 	ImagePrefix string
+	Webhooks    *webhooks.Dispatcher
 }
 
 // TaskRequest is the top-level wrapper for the Task in the JSON payload sent by
@@ -27,27 +37,39 @@ type TaskRequest struct {
 	Task Task `json:"task"`
 }
 
-// Task is the JSON payload required to launch a new task.
+// Task is the JSON payload required to launch a new task.  Env and the
+// resolved values of Secrets are passed to the container as environment
+// variables.
 type Task struct {
-	Version string `json:"version"`
-	Command string `json:"command"`
+	Version string              `json:"version"`
+	Command string              `json:"command"`
+	Env     map[string]string   `json:"env,omitempty"`
+	Secrets []*schema.SecretRef `json:"secrets,omitempty"`
 }
 
 // defaultTaskTimeout is the amount of time that we allow for a task to run
 // before it is forcefully killed.  This timeout is currently set to 10 minutes.
 const defaultTaskTimeout time.Duration = 600 * time.Second
 
+// timedOutExitCode is the exit code reported for tasks that time out, matching
+// the exit code of the timeout command.
+const timedOutExitCode = 124
+
 // Create handles launching new tasks and streaming the output back over the
 // http.ResponseWriter.  It expects a JSON payload that can be decoded into a
 // TaskRequest.
 //
 // If an error occurs decoding the JSON or creating/running the container, an
-// Internal Server Error will be returned in the response.  However, if an error
-// occurs after this point, we've already sent a 200 OK and started streaming
-// the response body.  This means the task was successfully launched, but the
-// task could have possibly errored out.  At the end of the task output, the
-// exit code of the task will be printed so that it can be handled by the client
-// if necessary.
+// Internal Server Error will be returned in the response.  If the task's
+// secrets can't be resolved, a Bad Request will be returned instead.  The
+// values of secrets are redacted from the task's output and from any error
+// written to the response.  However, if an error occurs after this point, we've
+// already sent a 200 OK and started streaming the response body.  This means
+// the task was successfully launched, but the task could have possibly errored
+// out.  At the end of the task output, the exit code of the task will be
+// printed so that it can be handled by the client if necessary.  Once the task
+// has finished, webhooks are notified of its exit code, which is -1 if it
+// couldn't be determined.
 func (tr *TasksResource) Create(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain")
 	decoder := json.NewDecoder(r.Body)
@@ -58,21 +80,31 @@ func (tr *TasksResource) Create(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, fmt.Sprintf("ERROR: %s\n", err))
 		return
 	}
+	env, err := secrets.Resolve(tr.Secrets, req.Task.Env, req.Task.Secrets)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, fmt.Sprintf("ERROR: %s\n", err))
+		return
+	}
 	serviceName := r.URL.Query().Get("name")
 	taskName := fmt.Sprintf("%s-%s-task", serviceName, req.Task.Version)
 	imageName := fmt.Sprintf("%s/%s:%s", tr.ImagePrefix, serviceName, req.Task.Version)
 
-	container, err := tr.runContainer(taskName, imageName, req.Task.Command)
+	container, err := tr.runContainer(taskName, imageName, req.Task.Command, env.List(), tr.Settings.ForService(serviceName))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, fmt.Sprintf("ERROR: %s\n", err))
+		io.WriteString(w, fmt.Sprintf("ERROR: %s\n", env.Redact(err.Error())))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 
-	err = tr.streamContainerOutputWithTimeout(container.ID, w, defaultTaskTimeout)
+	finished := &webhooks.Task{Version: req.Task.Version, Command: req.Task.Command}
+	output := newRedactingWriter(w, env)
+	finished.ExitCode, err = tr.streamContainerOutputWithTimeout(container.ID, output, defaultTaskTimeout)
+	output.Close()
 	if err != nil {
-		io.WriteString(w, fmt.Sprintf("ERROR: %s\n", err))
+		finished.Error = env.Redact(err.Error())
+		io.WriteString(w, fmt.Sprintf("ERROR: %s\n", finished.Error))
 	}
 
 	err = tr.Docker.RemoveContainer(docker.RemoveContainerOptions{
@@ -82,16 +114,31 @@ func (tr *TasksResource) Create(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		io.WriteString(w, fmt.Sprintf("WARNING: Container could not be cleaned up (%s)\n", err))
 	}
+
+	tr.Webhooks.Notify(&webhooks.Payload{Event: schema.WebhookTaskFinished, ServiceName: serviceName, Version: req.Task.Version, Task: finished})
 }
 
 // runContainer creates and starts a Docker container using the provided task
-// name, image name, and command.
-func (tr *TasksResource) runContainer(taskName string, imageName string, command string) (*docker.Container, error) {
+// name, image name, command, environment, and service settings.
+func (tr *TasksResource) runContainer(taskName string, imageName string, command string, env []string, serviceSettings *schema.ServiceSettings) (*docker.Container, error) {
+	var memory int64
+	if serviceSettings.Memory != "" {
+		bytes, err := settings.MemoryBytes(serviceSettings.Memory)
+		if err != nil {
+			return &docker.Container{}, err
+		}
+		memory = bytes
+	}
+
 	container, err := tr.Docker.CreateContainer(docker.CreateContainerOptions{
 		Name: taskName,
 		Config: &docker.Config{
 			Image:        imageName,
 			Cmd:          []string{command},
+			Env:          env,
+			Memory:       memory,
+			CPUShares:    serviceSettings.CPUShares,
+			Labels:       serviceSettings.Labels,
 			AttachStdout: true,
 			AttachStderr: true,
 		},
@@ -100,7 +147,10 @@ func (tr *TasksResource) runContainer(taskName string, imageName string, command
 		return &docker.Container{}, err
 	}
 
-	err = tr.Docker.StartContainer(container.ID, &docker.HostConfig{})
+	err = tr.Docker.StartContainer(container.ID, &docker.HostConfig{
+		Binds:      serviceSettings.Volumes,
+		ExtraHosts: serviceSettings.ExtraHosts,
+	})
 	if err != nil {
 		return &docker.Container{}, err
 	}
@@ -111,8 +161,9 @@ func (tr *TasksResource) runContainer(taskName string, imageName string, command
 // streamContainerOutput attaches to the container ID's STDOUT/STDERR and
 // streams the output to the provided io.Writer wrapped in a flushWriter so that
 // we can continuously flush the output to the client as its provided from the
-// Docker API.
-func (tr *TasksResource) streamContainerOutput(containerID string, writer io.Writer) error {
+// Docker API.  The container's exit code is returned once it exits, or -1 if
+// it can't be determined.
+func (tr *TasksResource) streamContainerOutput(containerID string, writer io.Writer) (int, error) {
 	fw := newFlushWriter(writer)
 	err := tr.Docker.AttachToContainer(docker.AttachToContainerOptions{
 		Container:    containerID,
@@ -125,41 +176,44 @@ func (tr *TasksResource) streamContainerOutput(containerID string, writer io.Wri
 	})
 
 	if err != nil {
-		return err
+		return -1, err
 	}
 
 	container, err := tr.Docker.InspectContainer(containerID)
 	if err != nil {
-		return err
+		return -1, err
 	}
 	io.WriteString(&fw, fmt.Sprintf("\nExited (%d) %s\n", container.State.ExitCode, container.State.Error))
 
-	return nil
+	return container.State.ExitCode, nil
 }
 
 // streamContainerOutputWithTimeout will spawn two goroutines: one for
 // fulfilling the streamContainerOutput request and one for managing the
-// timeout.
-func (tr *TasksResource) streamContainerOutputWithTimeout(containerID string, writer io.Writer, timeout time.Duration) error {
+// timeout.  A task that times out exits with timedOutExitCode.
+func (tr *TasksResource) streamContainerOutputWithTimeout(containerID string, writer io.Writer, timeout time.Duration) (int, error) {
 	timeoutChan := make(chan bool, 1)
 	go func() {
 		time.Sleep(timeout)
 		timeoutChan <- true
 	}()
 
-	successChan := make(chan error, 1)
+	type result struct {
+		exitCode int
+		err      error
+	}
+	successChan := make(chan result, 1)
 	go func() {
-		successChan <- tr.streamContainerOutput(containerID, writer)
+		exitCode, err := tr.streamContainerOutput(containerID, writer)
+		successChan <- result{exitCode, err}
 	}()
 
 	select {
-	case err := <-successChan:
-		if err != nil {
-			return err
-		}
+	case r := <-successChan:
+		return r.exitCode, r.err
 	case <-timeoutChan:
-		io.WriteString(writer, fmt.Sprintf("\nExited (124) The task timed out after %s. Forcefully removing container.\n", timeout))
+		io.WriteString(writer, fmt.Sprintf("\nExited (%d) The task timed out after %s. Forcefully removing container.\n", timedOutExitCode, timeout))
 	}
 
-	return nil
+	return timedOutExitCode, nil
 }
@@ -2,12 +2,19 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/bmorton/deployster/clients/mocks"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
+	"github.com/bmorton/deployster/webhooks"
 	"github.com/fsouza/go-dockerclient"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -18,18 +25,20 @@ type TasksResourceTestSuite struct {
 	suite.Suite
 	Subject    TasksResource
 	DockerMock *mocks.Docker
+	Settings   *settings.Registry
 	Service    *DeploysterService
 }
 
 var validRequestBody []byte = []byte(`{"task":{"version":"abc123", "command":"bundle exec rake db:migrate"}}`)
 
 func (suite *TasksResourceTestSuite) SetupSuite() {
-	suite.Service = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm")
+	suite.Service = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm", store.NewMemoryStore(), templates.NewMemoryRegistry(), settings.NewMemoryRegistry(), secrets.NewMemoryProvider(nil), nil, nil, nil)
 }
 
 func (suite *TasksResourceTestSuite) SetupTest() {
+	suite.Settings = settings.NewMemoryRegistry()
 	suite.DockerMock = new(mocks.Docker)
-	suite.Subject = TasksResource{suite.DockerMock, "mmmhm"}
+	suite.Subject = TasksResource{suite.DockerMock, suite.Settings, secrets.NewMemoryProvider(map[string]string{"database-url": "postgres://secret@db/carousel"}), "mmmhm", nil}
 }
 
 func (suite *TasksResourceTestSuite) TestCreateTellsDockerToCreateContainer() {
@@ -51,6 +60,110 @@ func (suite *TasksResourceTestSuite) TestCreateTellsDockerToCreateContainer() {
 	})
 }
 
+func (suite *TasksResourceTestSuite) TestCreatePassesEnvironmentToContainer() {
+	suite.setupSuccessfulDockerMock()
+	body := []byte(`{"task":{"version":"abc123", "command":"bundle exec rake db:migrate", "env":{"RAILS_ENV":"production"}, "secrets":[{"name":"database-url","env":"DATABASE_URL"}]}}`)
+	req, _ := http.NewRequest("POST", "http://example.com/services/carousel/tasks?name=carousel", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.Subject.Create(w, req)
+
+	suite.DockerMock.Mock.AssertCalled(suite.T(), "CreateContainer", docker.CreateContainerOptions{
+		Name: "carousel-abc123-task",
+		Config: &docker.Config{
+			Image:        "mmmhm/carousel:abc123",
+			Cmd:          []string{"bundle exec rake db:migrate"},
+			Env:          []string{"DATABASE_URL=postgres://secret@db/carousel", "RAILS_ENV=production"},
+			AttachStdout: true,
+			AttachStderr: true,
+		},
+	})
+}
+
+func (suite *TasksResourceTestSuite) TestCreateAppliesServiceSettingsToContainer() {
+	suite.setupSuccessfulDockerMock()
+	suite.Settings.Save("carousel", &schema.ServiceSettings{
+		Ports:         []int{8080},
+		Memory:        "512m",
+		CPUShares:     512,
+		Volumes:       []string{"/var/log/carousel:/app/log"},
+		ExtraHosts:    []string{"db:10.0.0.5"},
+		RestartPolicy: "always",
+		Labels:        map[string]string{"team": "web"},
+	})
+	req, _ := http.NewRequest("POST", "http://example.com/services/carousel/tasks?name=carousel", bytes.NewBuffer(validRequestBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.Subject.Create(w, req)
+
+	suite.DockerMock.Mock.AssertCalled(suite.T(), "CreateContainer", docker.CreateContainerOptions{
+		Name: "carousel-abc123-task",
+		Config: &docker.Config{
+			Image:        "mmmhm/carousel:abc123",
+			Cmd:          []string{"bundle exec rake db:migrate"},
+			Memory:       512 * 1024 * 1024,
+			CPUShares:    512,
+			Labels:       map[string]string{"team": "web"},
+			AttachStdout: true,
+			AttachStderr: true,
+		},
+	})
+	suite.DockerMock.Mock.AssertCalled(suite.T(), "StartContainer", "c0c0c0c0c0", &docker.HostConfig{
+		Binds:      []string{"/var/log/carousel:/app/log"},
+		ExtraHosts: []string{"db:10.0.0.5"},
+	})
+}
+
+func (suite *TasksResourceTestSuite) TestCreateReturnsBadRequestWhenSecretIsMissing() {
+	body := []byte(`{"task":{"version":"abc123", "command":"bundle exec rake db:migrate", "secrets":[{"name":"api-key","env":"API_KEY"}]}}`)
+	req, _ := http.NewRequest("POST", "http://example.com/services/carousel/tasks?name=carousel", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.Subject.Create(w, req)
+
+	assert.Equal(suite.T(), 400, w.Code)
+	assert.Equal(suite.T(), "ERROR: The api-key secret could not be resolved: Secret not found.\n", w.Body.String())
+	suite.DockerMock.Mock.AssertNotCalled(suite.T(), "CreateContainer", mock.Anything)
+}
+
+func (suite *TasksResourceTestSuite) TestCreateRedactsSecretsFromErrors() {
+	suite.DockerMock.On("CreateContainer", mock.AnythingOfType("docker.CreateContainerOptions")).Return(&docker.Container{}, errors.New("invalid env DATABASE_URL=postgres://secret@db/carousel"))
+	body := []byte(`{"task":{"version":"abc123", "command":"bundle exec rake db:migrate", "secrets":[{"name":"database-url","env":"DATABASE_URL"}]}}`)
+	req, _ := http.NewRequest("POST", "http://example.com/services/carousel/tasks?name=carousel", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.Subject.Create(w, req)
+
+	assert.Equal(suite.T(), 500, w.Code)
+	assert.Equal(suite.T(), "ERROR: invalid env DATABASE_URL=[REDACTED]\n", w.Body.String())
+}
+
+func (suite *TasksResourceTestSuite) TestCreateRedactsSecretsFromOutput() {
+	suite.DockerMock.On("CreateContainer", mock.AnythingOfType("docker.CreateContainerOptions")).Return(&docker.Container{ID: "c0c0c0c0c0"}, nil)
+	suite.DockerMock.On("StartContainer", "c0c0c0c0c0", &docker.HostConfig{}).Return(nil)
+	suite.DockerMock.On("AttachToContainer", mock.AnythingOfType("docker.AttachToContainerOptions")).Return(nil).Run(func(args mock.Arguments) {
+		output := args.Get(0).(docker.AttachToContainerOptions).OutputStream
+		output.Write([]byte("Connecting to postgres://sec"))
+		output.Write([]byte("ret@db/carousel\n"))
+		output.Write([]byte("postgres://secret@db/carousel"))
+	})
+	suite.DockerMock.On("InspectContainer", "c0c0c0c0c0").Return(&docker.Container{}, nil)
+	suite.DockerMock.On("RemoveContainer", mock.AnythingOfType("docker.RemoveContainerOptions")).Return(nil)
+	body := []byte(`{"task":{"version":"abc123", "command":"bundle exec rake db:migrate", "secrets":[{"name":"database-url","env":"DATABASE_URL"}]}}`)
+	req, _ := http.NewRequest("POST", "http://example.com/services/carousel/tasks?name=carousel", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.Subject.Create(w, req)
+
+	assert.Equal(suite.T(), 200, w.Code)
+	assert.Equal(suite.T(), "Connecting to [REDACTED]\n[REDACTED]\nExited (0) \n", w.Body.String())
+}
+
 func (suite *TasksResourceTestSuite) TestCreateTellsDockerToStartContainer() {
 	suite.setupSuccessfulDockerMock()
 	req, _ := http.NewRequest("POST", "http://example.com/services/carousel/tasks?name=carousel", bytes.NewBuffer(validRequestBody))
@@ -69,7 +182,8 @@ func (suite *TasksResourceTestSuite) TestCreateAttachesToContainer() {
 
 	w := httptest.NewRecorder()
 	suite.Subject.Create(w, req)
-	fw := newFlushWriter(w)
+	env, _ := secrets.Resolve(nil, nil, nil)
+	fw := newFlushWriter(newRedactingWriter(w, env))
 
 	suite.DockerMock.Mock.AssertCalled(suite.T(), "AttachToContainer", docker.AttachToContainerOptions{
 		Container:    "c0c0c0c0c0",
@@ -158,13 +272,40 @@ func (suite *TasksResourceTestSuite) TestCreateReturnsExitCodeOnFailure() {
 	assert.Equal(suite.T(), "\nExited (127) Something went wrong\n", w.Body.String())
 }
 
+func (suite *TasksResourceTestSuite) TestCreateNotifiesWebhooksOfExitCode() {
+	payloads := make(chan *webhooks.Payload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhooks.Payload
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads <- &payload
+	}))
+	defer server.Close()
+	suite.Subject.Webhooks = webhooks.NewDispatcher([]*schema.Webhook{{URL: server.URL}}, nil, nil)
+	suite.DockerMock.On("CreateContainer", mock.AnythingOfType("docker.CreateContainerOptions")).Return(&docker.Container{ID: "c0c0c0c0c0"}, nil)
+	suite.DockerMock.On("StartContainer", "c0c0c0c0c0", &docker.HostConfig{}).Return(nil)
+	suite.DockerMock.On("AttachToContainer", mock.AnythingOfType("docker.AttachToContainerOptions")).Return(nil)
+	suite.DockerMock.On("InspectContainer", "c0c0c0c0c0").Return(&docker.Container{State: docker.State{ExitCode: 127}}, nil)
+	suite.DockerMock.On("RemoveContainer", mock.AnythingOfType("docker.RemoveContainerOptions")).Return(nil)
+
+	req, _ := http.NewRequest("POST", "http://example.com/services/carousel/tasks?name=carousel", bytes.NewBuffer(validRequestBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.Subject.Create(w, req)
+
+	payload := <-payloads
+	assert.Equal(suite.T(), schema.WebhookTaskFinished, payload.Event)
+	assert.Equal(suite.T(), "carousel", payload.ServiceName)
+	assert.Equal(suite.T(), &webhooks.Task{Version: "abc123", Command: "bundle exec rake db:migrate", ExitCode: 127}, payload.Task)
+}
+
 func TestTasksResourceTestSuite(t *testing.T) {
 	suite.Run(t, new(TasksResourceTestSuite))
 }
 
 func (suite *TasksResourceTestSuite) setupSuccessfulDockerMock() {
 	suite.DockerMock.On("CreateContainer", mock.AnythingOfType("docker.CreateContainerOptions")).Return(&docker.Container{ID: "c0c0c0c0c0"}, nil)
-	suite.DockerMock.On("StartContainer", "c0c0c0c0c0", &docker.HostConfig{}).Return(nil)
+	suite.DockerMock.On("StartContainer", "c0c0c0c0c0", mock.AnythingOfType("*docker.HostConfig")).Return(nil)
 	suite.DockerMock.On("AttachToContainer", mock.AnythingOfType("docker.AttachToContainerOptions")).Return(nil)
 	suite.DockerMock.On("InspectContainer", "c0c0c0c0c0").Return(&docker.Container{}, nil)
 	suite.DockerMock.On("RemoveContainer", mock.AnythingOfType("docker.RemoveContainerOptions")).Return(nil)
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bmorton/deployster/balancers"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/templates"
+)
+
+// TemplatesResource is the HTTP resource responsible for registering the named
+// unit templates that deploys are launched with.  The ImagePrefix, Settings,
+// and Secrets are used when rendering templates to validate them, and Balancers
+// tells templates whether deployster registers instances with a load balancer
+// itself.
+type TemplatesResource struct {
+	Templates   *templates.Registry
+	Settings    *settings.Registry
+	Secrets     secrets.Provider
+	ImagePrefix string
+	Balancers   *balancers.Registry
+}
+
+// TemplateRequest is the wrapper struct used to deserialize the JSON payload
+// that is sent for registering a template.
+type TemplateRequest struct {
+	Template *templates.Template `json:"template"`
+}
+
+// TemplateResponse is the wrapper struct for the JSON payload returned by the
+// Show and Update actions.
+type TemplateResponse struct {
+	Template *templates.Template `json:"template"`
+}
+
+// TemplateValidationRequest is the wrapper struct used to deserialize the JSON
+// payload that is sent for validating a template.  The deploy is optional and
+// only used to render the template.
+type TemplateValidationRequest struct {
+	Template *templates.Template `json:"template"`
+	Deploy   *schema.Deploy      `json:"deploy"`
+}
+
+// TemplateValidationResponse is the JSON payload returned by the Validate
+// action.
+type TemplateValidationResponse struct {
+	Valid    bool                 `json:"valid"`
+	UnitFile string               `json:"unit_file"`
+	Problems []*templates.Problem `json:"problems"`
+}
+
+// TemplatesResponse is the wrapper struct for the JSON payload returned by the
+// Index action.
+type TemplatesResponse struct {
+	Templates []*templates.Template `json:"templates"`
+}
+
+// Index is the GET endpoint for listing every registered template, including
+// the default template.
+func (tr *TemplatesResource) Index(u *url.URL, h http.Header, req interface{}) (int, http.Header, *TemplatesResponse, error) {
+	return http.StatusOK, nil, &TemplatesResponse{Templates: tr.Templates.List()}, nil
+}
+
+// Show is the GET endpoint for retrieving a single template.
+//
+// This function assumes that it is nested inside `/templates/{name}`
+// and that Tigertonic is extracting the template name and providing it via
+// query params.
+func (tr *TemplatesResource) Show(u *url.URL, h http.Header, req interface{}) (int, http.Header, *TemplateResponse, error) {
+	t, err := tr.Templates.Find(u.Query().Get("name"))
+	if err != nil {
+		return http.StatusNotFound, nil, nil, err
+	}
+
+	return http.StatusOK, nil, &TemplateResponse{Template: t}, nil
+}
+
+// Update is the PUT endpoint for registering a template under the given name,
+// replacing any template that's already registered with it.  A template named
+// after a service is used for all of that service's deploys that don't name a
+// template of their own.  Templates that can't be parsed are rejected.
+//
+// This function assumes that it is nested inside `/templates/{name}`
+// and that Tigertonic is extracting the template name and providing it via
+// query params.
+func (tr *TemplatesResource) Update(u *url.URL, h http.Header, req *TemplateRequest) (int, http.Header, *TemplateResponse, error) {
+	if req.Template == nil {
+		return http.StatusBadRequest, nil, nil, errors.New("A template must be provided.")
+	}
+	req.Template.Name = u.Query().Get("name")
+
+	_, err := req.Template.Parse()
+	if err != nil {
+		return http.StatusBadRequest, nil, nil, err
+	}
+
+	err = tr.Templates.Save(req.Template)
+	if err == templates.ErrInvalidName {
+		return http.StatusBadRequest, nil, nil, err
+	}
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	return http.StatusOK, nil, &TemplateResponse{Template: req.Template}, nil
+}
+
+// Destroy is the DELETE endpoint for unregistering a template.  Deleting a
+// replacement of the default template restores the built-in one.
+//
+// This function assumes that it is nested inside `/templates/{name}`
+// and that Tigertonic is extracting the template name and providing it via
+// query params.
+func (tr *TemplatesResource) Destroy(u *url.URL, h http.Header, req interface{}) (int, http.Header, interface{}, error) {
+	err := tr.Templates.Delete(u.Query().Get("name"))
+	if err == templates.ErrNotFound {
+		return http.StatusNotFound, nil, nil, err
+	}
+	if err == templates.ErrDefault {
+		return http.StatusBadRequest, nil, nil, err
+	}
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil, nil
+}
+
+// Validate is the POST endpoint for checking a template without registering it
+// or deploying with it.  The template is rendered for the given deploy, or for
+// a single instance of an `example` service at version `latest` if no deploy
+// is given, and the rendered unit file is validated.  A template with a name
+// but no body is looked up in the registry.  The values of the deploy's secrets
+// are redacted from the unit file.  The response lists every problem found,
+// including failures to resolve secrets or to parse or render the template.
+func (tr *TemplatesResource) Validate(u *url.URL, h http.Header, req *TemplateValidationRequest) (int, http.Header, *TemplateValidationResponse, error) {
+	if req.Template == nil {
+		return http.StatusBadRequest, nil, nil, errors.New("A template must be provided.")
+	}
+
+	t := req.Template
+	if t.Body == "" && t.Name != "" {
+		registered, err := tr.Templates.Find(t.Name)
+		if err != nil {
+			return http.StatusNotFound, nil, nil, err
+		}
+		t = registered
+	}
+
+	deploy := req.Deploy
+	if deploy == nil {
+		deploy = &schema.Deploy{ServiceName: "example", Version: "latest", InstanceCount: 1}
+	}
+	if deploy.Timestamp == "" {
+		deploy.Timestamp = time.Now().UTC().Format("2006.01.02-15.04.05")
+	}
+
+	response := &TemplateValidationResponse{Problems: []*templates.Problem{}}
+	env, err := secrets.Resolve(tr.Secrets, deploy.Env, deploy.Secrets)
+	if err != nil {
+		response.Problems = append(response.Problems, &templates.Problem{Message: err.Error()})
+		return http.StatusOK, nil, response, nil
+	}
+
+	view := templates.NewView(deploy, tr.ImagePrefix).WithSettings(tr.Settings.ForService(deploy.ServiceName)).WithEnv(env.Redacted().Map())
+	view.ManagedEndpoints = tr.Balancers.Manages(deploy.ServiceName)
+	unitFile, err := t.Render(view)
+	if err != nil {
+		response.Problems = append(response.Problems, &templates.Problem{Message: err.Error()})
+		return http.StatusOK, nil, response, nil
+	}
+
+	response.UnitFile = unitFile
+	response.Problems = templates.Validate(unitFile)
+	response.Valid = len(response.Problems) == 0
+	return http.StatusOK, nil, response, nil
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
+	"github.com/rcrowley/go-tigertonic/mocking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TemplatesResourceTestSuite struct {
+	suite.Suite
+	Subject   TemplatesResource
+	Templates *templates.Registry
+	Settings  *settings.Registry
+	Service   *DeploysterService
+}
+
+func (suite *TemplatesResourceTestSuite) SetupSuite() {
+	suite.Service = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm", store.NewMemoryStore(), templates.NewMemoryRegistry(), settings.NewMemoryRegistry(), secrets.NewMemoryProvider(nil), nil, nil, nil)
+}
+
+func (suite *TemplatesResourceTestSuite) SetupTest() {
+	suite.Settings = settings.NewMemoryRegistry()
+	suite.Templates = templates.NewMemoryRegistry()
+	suite.Subject = TemplatesResource{
+		Templates:   suite.Templates,
+		Settings:    suite.Settings,
+		Secrets:     secrets.NewMemoryProvider(map[string]string{"database-url": "postgres://secret@db/carousel"}),
+		ImagePrefix: "mmmhm",
+	}
+}
+
+func (suite *TemplatesResourceTestSuite) TestIndex() {
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Service]\n"})
+
+	code, _, response, err := suite.Subject.Index(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/templates"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Len(suite.T(), response.Templates, 2)
+	assert.Equal(suite.T(), "carousel", response.Templates[0].Name)
+	assert.Equal(suite.T(), "default", response.Templates[1].Name)
+}
+
+func (suite *TemplatesResourceTestSuite) TestShow() {
+	code, _, response, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/templates/default"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), templates.Default(), response.Template)
+}
+
+func (suite *TemplatesResourceTestSuite) TestShowNotFound() {
+	code, _, _, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/templates/carousel"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), templates.ErrNotFound, err)
+	assert.Equal(suite.T(), 404, code)
+}
+
+func (suite *TemplatesResourceTestSuite) TestUpdate() {
+	code, _, response, err := suite.Subject.Update(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/templates/carousel"),
+		mocking.Header(nil),
+		&TemplateRequest{&templates.Template{Body: "[Service]\nExecStart=/usr/bin/docker run {{.Image}}\n"}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), "carousel", response.Template.Name)
+	saved, _ := suite.Templates.Find("carousel")
+	assert.Equal(suite.T(), "[Service]\nExecStart=/usr/bin/docker run {{.Image}}\n", saved.Body)
+}
+
+func (suite *TemplatesResourceTestSuite) TestUpdateWithParseError() {
+	code, _, _, err := suite.Subject.Update(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/templates/carousel"),
+		mocking.Header(nil),
+		&TemplateRequest{&templates.Template{Body: "{{.Image"}},
+	)
+
+	assert.Contains(suite.T(), fmt.Sprintf("%s", err), "The carousel template could not be parsed")
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *TemplatesResourceTestSuite) TestUpdateWithoutTemplate() {
+	code, _, _, _ := suite.Subject.Update(
+		mocking.URL(suite.Service.RootMux, "PUT", "http://example.com/v1/templates/carousel"),
+		mocking.Header(nil),
+		&TemplateRequest{},
+	)
+
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *TemplatesResourceTestSuite) TestDestroy() {
+	suite.Templates.Save(&templates.Template{Name: "carousel", Body: "[Service]\n"})
+
+	code, _, _, err := suite.Subject.Destroy(
+		mocking.URL(suite.Service.RootMux, "DELETE", "http://example.com/v1/templates/carousel"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 204, code)
+	_, err = suite.Templates.Find("carousel")
+	assert.Equal(suite.T(), templates.ErrNotFound, err)
+}
+
+func (suite *TemplatesResourceTestSuite) TestDestroyNotFound() {
+	code, _, _, err := suite.Subject.Destroy(
+		mocking.URL(suite.Service.RootMux, "DELETE", "http://example.com/v1/templates/carousel"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), templates.ErrNotFound, err)
+	assert.Equal(suite.T(), 404, code)
+}
+
+func (suite *TemplatesResourceTestSuite) TestDestroyBuiltInDefault() {
+	code, _, _, err := suite.Subject.Destroy(
+		mocking.URL(suite.Service.RootMux, "DELETE", "http://example.com/v1/templates/default"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), templates.ErrDefault, err)
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *TemplatesResourceTestSuite) TestValidate() {
+	code, _, response, err := suite.Subject.Validate(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/templates/validate"),
+		mocking.Header(nil),
+		&TemplateValidationRequest{Template: &templates.Template{Body: "[Service]\nExecStart=/usr/bin/docker run --name {{.ContainerName}} {{.Image}}\n"}},
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.True(suite.T(), response.Valid)
+	assert.Empty(suite.T(), response.Problems)
+	assert.Contains(suite.T(), response.UnitFile, "--name example-latest-")
+	assert.Contains(suite.T(), response.UnitFile, "mmmhm/example:latest")
+}
+
+func (suite *TemplatesResourceTestSuite) TestValidateWithDeploy() {
+	_, _, response, _ := suite.Subject.Validate(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/templates/validate"),
+		mocking.Header(nil),
+		&TemplateValidationRequest{
+			Template: &templates.Template{Body: "[Service]\nExecStart=/usr/bin/docker run --name {{.ContainerName}} {{.Image}}\n"},
+			Deploy:   &schema.Deploy{ServiceName: "carousel", Version: "abc123", Timestamp: "2006.01.02-15.04.05"},
+		},
+	)
+
+	assert.Equal(suite.T(), "[Service]\nExecStart=/usr/bin/docker run --name carousel-abc123-2006.01.02-15.04.05-%i mmmhm/carousel:abc123\n", response.UnitFile)
+}
+
+func (suite *TemplatesResourceTestSuite) TestValidateAppliesServiceSettings() {
+	suite.Settings.Save("carousel", &schema.ServiceSettings{Ports: []int{8080}, Memory: "512m"})
+
+	_, _, response, _ := suite.Subject.Validate(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/templates/validate"),
+		mocking.Header(nil),
+		&TemplateValidationRequest{
+			Template: &templates.Template{Body: "[Service]\nExecStart=/usr/bin/docker run {{.DockerFlags}} {{.Image}}\n"},
+			Deploy:   &schema.Deploy{ServiceName: "carousel", Version: "abc123"},
+		},
+	)
+
+	assert.True(suite.T(), response.Valid)
+	assert.Equal(suite.T(), "[Service]\nExecStart=/usr/bin/docker run -p 8080 -m 512m mmmhm/carousel:abc123\n", response.UnitFile)
+}
+
+func (suite *TemplatesResourceTestSuite) TestValidateRedactsSecrets() {
+	_, _, response, _ := suite.Subject.Validate(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/templates/validate"),
+		mocking.Header(nil),
+		&TemplateValidationRequest{
+			Template: &templates.Template{Body: "[Service]\nExecStart=/usr/bin/docker run {{.EnvFlags}} {{.Image}}\n"},
+			Deploy:   &schema.Deploy{ServiceName: "carousel", Version: "abc123", Secrets: []*schema.SecretRef{{Name: "database-url", Env: "DATABASE_URL"}}},
+		},
+	)
+
+	assert.True(suite.T(), response.Valid)
+	assert.Equal(suite.T(), "[Service]\nExecStart=/usr/bin/docker run -e \"DATABASE_URL=[REDACTED]\" mmmhm/carousel:abc123\n", response.UnitFile)
+}
+
+func (suite *TemplatesResourceTestSuite) TestValidateWithMissingSecret() {
+	code, _, response, _ := suite.Subject.Validate(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/templates/validate"),
+		mocking.Header(nil),
+		&TemplateValidationRequest{
+			Template: templates.Default(),
+			Deploy:   &schema.Deploy{ServiceName: "carousel", Version: "abc123", Secrets: []*schema.SecretRef{{Name: "api-key", Env: "API_KEY"}}},
+		},
+	)
+
+	assert.Equal(suite.T(), 200, code)
+	assert.False(suite.T(), response.Valid)
+	assert.Equal(suite.T(), "The api-key secret could not be resolved: Secret not found.", response.Problems[0].Message)
+}
+
+func (suite *TemplatesResourceTestSuite) TestValidateWithProblems() {
+	_, _, response, _ := suite.Subject.Validate(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/templates/validate"),
+		mocking.Header(nil),
+		&TemplateValidationRequest{Template: &templates.Template{Body: "[Service]\nUser=core\n"}},
+	)
+
+	assert.False(suite.T(), response.Valid)
+	assert.Equal(suite.T(), "ExecStart", response.Problems[0].Directive)
+}
+
+func (suite *TemplatesResourceTestSuite) TestValidateWithParseError() {
+	_, _, response, _ := suite.Subject.Validate(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/templates/validate"),
+		mocking.Header(nil),
+		&TemplateValidationRequest{Template: &templates.Template{Name: "carousel", Body: "{{.Image"}},
+	)
+
+	assert.False(suite.T(), response.Valid)
+	assert.Contains(suite.T(), response.Problems[0].Message, "The carousel template could not be parsed")
+}
+
+func (suite *TemplatesResourceTestSuite) TestValidateRegisteredTemplate() {
+	_, _, response, _ := suite.Subject.Validate(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/templates/validate"),
+		mocking.Header(nil),
+		&TemplateValidationRequest{Template: &templates.Template{Name: "default"}},
+	)
+
+	assert.True(suite.T(), response.Valid)
+}
+
+func (suite *TemplatesResourceTestSuite) TestValidateMissingRegisteredTemplate() {
+	code, _, _, err := suite.Subject.Validate(
+		mocking.URL(suite.Service.RootMux, "POST", "http://example.com/v1/templates/validate"),
+		mocking.Header(nil),
+		&TemplateValidationRequest{Template: &templates.Template{Name: "carousel"}},
+	)
+
+	assert.Equal(suite.T(), templates.ErrNotFound, err)
+	assert.Equal(suite.T(), 404, code)
+}
+
+func TestTemplatesResourceTestSuite(t *testing.T) {
+	suite.Run(t, new(TemplatesResourceTestSuite))
+}
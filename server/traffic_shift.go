@@ -0,0 +1,333 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bmorton/deployster/clients"
+	"github.com/bmorton/deployster/handlers"
+	"github.com/bmorton/deployster/health"
+	"github.com/bmorton/deployster/poller"
+	"github.com/bmorton/deployster/progress"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/store"
+)
+
+// defaultShiftCheckInterval is how often the instances of a deploy that's
+// shifting traffic are checked when the resource doesn't configure it.
+const defaultShiftCheckInterval time.Duration = 10 * time.Second
+
+// trafficShift tracks a deploy whose instances are online alongside the
+// previous version while traffic is shifted to them.  Steps can be taken
+// manually, on a schedule, or be cut short by a failed check, so they're
+// serialized by the mutex.  Step is the index of the current traffic step and
+// done is set once the shift has completed or been aborted, at which point stop
+// is closed.
+type trafficShift struct {
+	mutex  sync.Mutex
+	record *schema.DeployRecord
+	step   int
+	done   bool
+	stop   chan struct{}
+}
+
+// Shift is the POST endpoint for moving a deploy that's shifting traffic on to
+// its next traffic step.  Once all traffic has been shifted to the deploy, the
+// previous version is destroyed and the deploy succeeds.  Steps can be taken
+// manually whether or not the deploy also shifts traffic on a schedule.
+//
+// This function assumes that it is nested inside
+// `/services/{name}/deploys/{id}/shift` and that Tigertonic is extracting the
+// service name and deploy ID and providing them via query params.
+func (dr *DeploysResource) Shift(u *url.URL, h http.Header, req interface{}) (int, http.Header, *DeployResponse, error) {
+	shift, status, err := dr.findShift(u.Query().Get("name"), u.Query().Get("id"))
+	if err != nil {
+		return status, nil, nil, err
+	}
+
+	shift.mutex.Lock()
+	defer shift.mutex.Unlock()
+	if shift.done {
+		return http.StatusConflict, nil, nil, errors.New("Deploy is not shifting traffic.")
+	}
+	dr.nextStep(shift)
+
+	return http.StatusOK, nil, &DeployResponse{Deploy: shift.record.Copy()}, nil
+}
+
+// startShift begins shifting traffic to the deploy once all of its instances
+// are online.  Its instances were registered without any traffic, so the first
+// step is taken right away.  The service stays locked until the shift
+// completes or is aborted.  In the meantime, the deploy's instances are checked
+// in the background and steps are taken on the deploy's schedule, if it has
+// one.
+func (dr *DeploysResource) startShift(record *schema.DeployRecord) {
+	shift := &trafficShift{record: record, step: -1, stop: make(chan struct{})}
+	dr.shiftsMutex.Lock()
+	if dr.shifts == nil {
+		dr.shifts = make(map[string]*trafficShift)
+	}
+	dr.shifts[record.ID] = shift
+	dr.shiftsMutex.Unlock()
+
+	shift.mutex.Lock()
+	defer shift.mutex.Unlock()
+	record.Status = schema.DeployShifting
+	dr.nextStep(shift)
+	if shift.done {
+		return
+	}
+	dr.Progress.Publish(record.ID, &progress.Event{Type: progress.EventFinished, Deploy: record.Copy()})
+
+	go dr.monitorShift(shift)
+	if interval := record.TrafficShift.StepInterval(); interval > 0 {
+		go dr.scheduleShift(shift, interval)
+	}
+}
+
+// nextStep shifts the next share of traffic to the deploy and, once all of it
+// has been shifted, destroys the previous version and finishes the deploy.  If
+// the weights can't be changed, the deploy fails and is aborted.  The shift's
+// mutex must be held.
+func (dr *DeploysResource) nextStep(shift *trafficShift) {
+	record := shift.record
+	deploy := record.Deploy
+	steps := deploy.TrafficShift.TrafficSteps()
+	shift.step++
+	percent := steps[shift.step]
+
+	log.Printf("Shifting %d%% of %s traffic to %s.\n", percent, deploy.ServiceName, deploy.Version)
+	err := dr.shiftTraffic(deploy, percent)
+	if err != nil {
+		log.Println(err)
+		dr.abortShift(shift, schema.DeployFailed, err)
+		return
+	}
+	dr.recordWeight(record, percent)
+
+	if percent < 100 {
+		return
+	}
+	dr.destroyPrevious(deploy)
+	dr.endShift(shift, schema.DeploySucceeded, nil)
+}
+
+// abortShift shifts all traffic back to the previous version, destroys the
+// deploy's instances, and finishes the deploy with the given status and the
+// error that caused it to be aborted, if any.  The shift's mutex must be held.
+func (dr *DeploysResource) abortShift(shift *trafficShift, status string, cause error) {
+	dr.shiftBack(shift.record)
+	dr.endShift(shift, status, cause)
+}
+
+// endShift stops tracking the shift and finishes the deploy with the given
+// status and error, releasing the service's lock.
+func (dr *DeploysResource) endShift(shift *trafficShift, status string, cause error) {
+	shift.done = true
+	close(shift.stop)
+	dr.shiftsMutex.Lock()
+	delete(dr.shifts, shift.record.ID)
+	dr.shiftsMutex.Unlock()
+
+	shift.record.Status = status
+	if cause != nil {
+		shift.record.Error = cause.Error()
+	}
+	dr.save(shift.record)
+	dr.finish(shift.record)
+}
+
+// destroyPrevious deregisters and destroys every instance of the deploy's
+// previous version once traffic has moved to the deploy.
+func (dr *DeploysResource) destroyPrevious(deploy *schema.Deploy) {
+	destroyer := &handlers.Destroyer{PreviousVersion: deploy.PreviousVersion, Client: dr.Fleet, Registrar: dr.registrar(deploy), Reporter: dr.Progress.Reporter(deploy.ID), Notifier: dr.notifier(deploy, schema.WebhookPreviousDestroyed)}
+	for i := 1; i <= deploy.PreviousVersion.InstanceCount; i++ {
+		destroyer.Handle(&poller.Event{ServiceInstance: deploy.ServiceInstance(strconv.Itoa(i))})
+	}
+}
+
+// shiftBack sends all traffic back to the previous version and deregisters
+// and destroys the deploy's instances.
+func (dr *DeploysResource) shiftBack(record *schema.DeployRecord) {
+	deploy := record.Deploy
+	log.Printf("Shifting all %s traffic back to %s.\n", deploy.ServiceName, deploy.PreviousVersion.Version)
+	err := dr.shiftTraffic(deploy, 0)
+	if err != nil {
+		log.Println(err)
+	}
+	dr.recordWeight(record, 0)
+
+	destroyer := &handlers.Destroyer{PreviousVersion: deploy, Client: dr.Fleet, Registrar: dr.registrar(deploy), Reporter: dr.Progress.Reporter(deploy.ID)}
+	for i := 1; i <= deploy.InstanceCount; i++ {
+		destroyer.Handle(&poller.Event{ServiceInstance: deploy.ServiceInstance(strconv.Itoa(i))})
+	}
+}
+
+// shiftTraffic weights the endpoints of the deploy and its previous version so
+// that the deploy receives the given percentage of the service's traffic.
+func (dr *DeploysResource) shiftTraffic(deploy *schema.Deploy, percent int) error {
+	balancer, ok := dr.Balancers.ForService(deploy.ServiceName).(clients.WeightedLoadBalancer)
+	if !ok {
+		return errors.New("Traffic can only be shifted with a load balancer that supports weights, such as nginx or HAProxy.")
+	}
+
+	newWeight, previousWeight := trafficWeights(percent, deploy.InstanceCount, deploy.PreviousVersion.InstanceCount)
+	weights := make(map[string]int)
+	for i := 1; i <= deploy.InstanceCount; i++ {
+		weights[handlers.EndpointID(deploy.ServiceInstance(strconv.Itoa(i)), "")] = newWeight
+	}
+	for i := 1; i <= deploy.PreviousVersion.InstanceCount; i++ {
+		weights[handlers.EndpointID(deploy.PreviousVersion.ServiceInstance(strconv.Itoa(i)), "")] = previousWeight
+	}
+	return balancer.SetWeights(deploy.ServiceName, weights)
+}
+
+// recordWeight saves the percentage of traffic that's been shifted to the
+// deploy and reports it to anyone following the deploy.
+func (dr *DeploysResource) recordWeight(record *schema.DeployRecord, percent int) {
+	record.TrafficWeight = percent
+	dr.save(record)
+	dr.Progress.Publish(record.ID, &progress.Event{Type: progress.EventTrafficShifted, TrafficWeight: &percent})
+}
+
+// monitorShift checks the deploy's instances every ShiftCheckInterval, or
+// every 10 seconds if it isn't set, until the shift ends and aborts it as soon
+// as an instance stops running or fails the threshold of consecutive health
+// checks.
+func (dr *DeploysResource) monitorShift(shift *trafficShift) {
+	interval := dr.ShiftCheckInterval
+	if interval == 0 {
+		interval = defaultShiftCheckInterval
+	}
+	deploy := shift.record.Deploy
+	var checker *health.Checker
+	if deploy.HealthCheck != nil {
+		checker = health.NewChecker(deploy.HealthCheck, dr.Resolver)
+		checker.Port = dr.Settings.ForService(deploy.ServiceName).HTTPPort()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shift.stop:
+			return
+		case <-ticker.C:
+		}
+
+		err := dr.checkInstances(deploy, checker)
+		if err == nil {
+			continue
+		}
+		log.Println(err)
+		shift.mutex.Lock()
+		if !shift.done {
+			shift.record.RolledBack = true
+			dr.abortShift(shift, schema.DeployFailed, err)
+		}
+		shift.mutex.Unlock()
+		return
+	}
+}
+
+// checkInstances returns an error if any of the deploy's instances isn't
+// running or, if a checker is given, has failed the threshold of consecutive
+// health checks.  Instances aren't considered unhealthy if Fleet can't be
+// reached.
+func (dr *DeploysResource) checkInstances(deploy *schema.Deploy, checker *health.Checker) error {
+	states, err := dr.Fleet.UnitStates()
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	for i := 1; i <= deploy.InstanceCount; i++ {
+		instance := deploy.ServiceInstance(strconv.Itoa(i))
+		var state *poller.Event
+		for _, s := range states {
+			if s.Name == instance.FleetUnitName() {
+				state = poller.NewEvent(instance, s)
+			}
+		}
+		if state == nil || state.SystemdSubState != "running" {
+			return fmt.Errorf("Traffic was shifted back to the previous version since %s stopped running.", instance.FleetUnitName())
+		}
+		if checker != nil && checker.Unhealthy(state) {
+			return fmt.Errorf("Traffic was shifted back to the previous version since %s failed its health check.", instance.FleetUnitName())
+		}
+	}
+	return nil
+}
+
+// scheduleShift takes a step every interval until the shift ends.
+func (dr *DeploysResource) scheduleShift(shift *trafficShift, interval time.Duration) {
+	for {
+		select {
+		case <-shift.stop:
+			return
+		case <-time.After(interval):
+		}
+
+		shift.mutex.Lock()
+		if !shift.done {
+			dr.nextStep(shift)
+		}
+		shift.mutex.Unlock()
+	}
+}
+
+// findShift returns the shift of a deploy that's shifting traffic along with
+// the status code to respond with if it can't be found or isn't shifting.
+func (dr *DeploysResource) findShift(serviceName string, id string) (*trafficShift, int, error) {
+	record, err := dr.Store.Find(serviceName, id)
+	if err == store.ErrNotFound {
+		return nil, http.StatusNotFound, err
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, err
+	}
+
+	dr.shiftsMutex.Lock()
+	defer dr.shiftsMutex.Unlock()
+	shift, ok := dr.shifts[record.ID]
+	if !ok {
+		return nil, http.StatusConflict, errors.New("Deploy is not shifting traffic.")
+	}
+	return shift, http.StatusOK, nil
+}
+
+// trafficWeights returns the weight of each endpoint of a deploy and of its
+// previous version that sends the deploy the given percentage of traffic.  The
+// side with the larger share gets the default weight and the other is scaled
+// to match, without rounding a share of traffic down to nothing.
+func trafficWeights(percent int, count int, previousCount int) (int, int) {
+	share := percent * previousCount
+	previousShare := (100 - percent) * count
+	largest := share
+	if previousShare > largest {
+		largest = previousShare
+	}
+	if largest == 0 {
+		return clients.DefaultWeight, clients.DefaultWeight
+	}
+	return scaledWeight(share, largest), scaledWeight(previousShare, largest)
+}
+
+// scaledWeight scales the share relative to the largest share.
+func scaledWeight(share int, largest int) int {
+	if share == 0 {
+		return 0
+	}
+	weight := (share*clients.DefaultWeight + largest/2) / largest
+	if weight < 1 {
+		return 1
+	}
+	return weight
+}
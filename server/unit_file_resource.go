@@ -0,0 +1,135 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bmorton/deployster/balancers"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
+	fleet "github.com/coreos/fleet/schema"
+)
+
+// UnitFileResource is the HTTP resource responsible for previewing the unit
+// file that deploys of a service are launched with, rendered exactly as it
+// would be for a deploy.  The service's Settings are applied and the settings
+// of the newest deploy of the version in the Store are used, with the values
+// of secrets resolved by Secrets and then redacted.
+// Balancers tells templates whether deployster registers the service's
+// instances with a load balancer itself.
+type UnitFileResource struct {
+	Templates   *templates.Registry
+	Settings    *settings.Registry
+	Secrets     secrets.Provider
+	Store       store.Store
+	ImagePrefix string
+	Balancers   *balancers.Registry
+}
+
+// UnitFileResponse is the wrapper struct for the JSON payload returned by the
+// Show action.  If the rendered unit file is invalid, only the Problems with it
+// are returned.
+type UnitFileResponse struct {
+	UnitFile *UnitFile            `json:"unit_file,omitempty"`
+	Problems []*templates.Problem `json:"problems,omitempty"`
+}
+
+// UnitFile is a rendered unit file along with the name of the template it was
+// rendered from and the options that are submitted to Fleet for it.
+type UnitFile struct {
+	Template string              `json:"template"`
+	Contents string              `json:"contents"`
+	Options  []*fleet.UnitOption `json:"options"`
+}
+
+// Show is the GET endpoint for rendering the unit file of a version of the
+// service.  The version is required, while the timestamp defaults to the
+// current time and the template defaults to the one the newest deploy of the
+// version used, or else the one a new deploy would use.
+//
+// This function assumes that it is nested inside `/services/{name}/unitfile`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (ur *UnitFileResource) Show(u *url.URL, h http.Header, req interface{}) (int, http.Header, *UnitFileResponse, error) {
+	query := u.Query()
+	deploy := &schema.Deploy{
+		ServiceName:   query.Get("name"),
+		Version:       query.Get("version"),
+		Timestamp:     query.Get("timestamp"),
+		InstanceCount: 1,
+	}
+	if deploy.Version == "" {
+		return http.StatusBadRequest, nil, nil, errors.New("A version must be provided.")
+	}
+	if deploy.Timestamp == "" {
+		deploy.Timestamp = time.Now().UTC().Format("2006.01.02-15.04.05")
+	}
+
+	previous, err := latestDeploy(ur.Store, deploy.ServiceName, deploy.Version)
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	if previous != nil {
+		inheritSettings(deploy, previous)
+	}
+	if template := query.Get("template"); template != "" {
+		deploy.Template = template
+	}
+
+	env, err := secrets.Resolve(ur.Secrets, deploy.Env, deploy.Secrets)
+	if err != nil {
+		return http.StatusBadRequest, nil, nil, err
+	}
+
+	t, contents, err := renderDeployUnitFile(ur.Templates, ur.Settings, ur.ImagePrefix, ur.Balancers, deploy, env.Redacted())
+	if err == templates.ErrNotFound {
+		return http.StatusNotFound, nil, nil, err
+	}
+	if invalid, ok := err.(*templates.ValidationError); ok {
+		return http.StatusBadRequest, nil, &UnitFileResponse{Problems: invalid.Problems}, nil
+	}
+	if err != nil {
+		return http.StatusBadRequest, nil, nil, err
+	}
+
+	options, err := getUnitOptions(contents)
+	if err != nil {
+		return http.StatusBadRequest, nil, nil, err
+	}
+
+	return http.StatusOK, nil, &UnitFileResponse{UnitFile: &UnitFile{Template: t.Name, Contents: contents, Options: options}}, nil
+}
+
+// renderDeployUnitFile renders the unit file of the deploy using the template
+// it should be launched with, applying the settings of its service and passing
+// the given environment to the container, and validates the result.  If the
+// balancers manage the service's load balancer, the template is told that
+// deployster registers the deploy's instances with it.  The template that was
+// used is returned along with the unit file.  A templates.ValidationError is
+// returned if the unit file is invalid.
+func renderDeployUnitFile(registry *templates.Registry, serviceSettings *settings.Registry, imagePrefix string, serviceBalancers *balancers.Registry, deploy *schema.Deploy, env *secrets.Environment) (*templates.Template, string, error) {
+	t, err := registry.ForDeploy(deploy)
+	if err != nil {
+		return nil, "", err
+	}
+
+	view := templates.NewView(deploy, imagePrefix).WithSettings(serviceSettings.ForService(deploy.ServiceName)).WithEnv(env.Map())
+	view.ManagedEndpoints = serviceBalancers.Manages(deploy.ServiceName)
+	unitFile, err := t.Render(view)
+	if err != nil {
+		return nil, "", err
+	}
+
+	problems := templates.Validate(unitFile)
+	if len(problems) > 0 {
+		return nil, "", &templates.ValidationError{Problems: problems}
+	}
+	return t, unitFile, nil
+}
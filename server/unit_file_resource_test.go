@@ -0,0 +1,199 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/bmorton/deployster/balancers"
+	"github.com/bmorton/deployster/clients/mocks"
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
+	"github.com/rcrowley/go-tigertonic/mocking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type UnitFileResourceTestSuite struct {
+	suite.Suite
+	Subject   UnitFileResource
+	Templates *templates.Registry
+	Store     store.Store
+	Settings  *settings.Registry
+	Service   *DeploysterService
+}
+
+func (suite *UnitFileResourceTestSuite) SetupSuite() {
+	suite.Service = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm", store.NewMemoryStore(), templates.NewMemoryRegistry(), settings.NewMemoryRegistry(), secrets.NewMemoryProvider(nil), nil, nil, nil)
+}
+
+func (suite *UnitFileResourceTestSuite) SetupTest() {
+	suite.Settings = settings.NewMemoryRegistry()
+	suite.Templates = templates.NewMemoryRegistry()
+	suite.Store = store.NewMemoryStore()
+	suite.Subject = UnitFileResource{
+		Templates:   suite.Templates,
+		Settings:    suite.Settings,
+		Secrets:     secrets.NewMemoryProvider(map[string]string{"database-url": "postgres://secret@db/railsapp"}),
+		Store:       suite.Store,
+		ImagePrefix: "mmmhm",
+	}
+}
+
+func (suite *UnitFileResourceTestSuite) TestShow() {
+	code, _, response, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/carousel/unitfile?version=abc123&timestamp=2006.01.02-15.04.05"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), "default", response.UnitFile.Template)
+	assert.Contains(suite.T(), response.UnitFile.Contents, "--name carousel-abc123-2006.01.02-15.04.05-%i")
+	assert.Equal(suite.T(), defaultUnitOptions("abc123", "2006.01.02-15.04.05"), response.UnitFile.Options)
+}
+
+func (suite *UnitFileResourceTestSuite) TestShowWithManagedLoadBalancer() {
+	suite.Subject.Balancers = balancers.NewRegistry(suite.Settings, schema.LoadBalancerVulcand)
+	suite.Subject.Balancers.Add(schema.LoadBalancerNginx, new(mocks.LoadBalancer))
+	suite.Settings.Save("carousel", &schema.ServiceSettings{LoadBalancer: schema.LoadBalancerNginx})
+
+	_, _, response, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/carousel/unitfile?version=abc123&timestamp=2006.01.02-15.04.05"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.NotContains(suite.T(), response.UnitFile.Contents, "etcdctl")
+
+	_, _, response, err = suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/railsapp/unitfile?version=abc123&timestamp=2006.01.02-15.04.05"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), response.UnitFile.Contents, "etcdctl")
+}
+
+func (suite *UnitFileResourceTestSuite) TestShowUsesServiceTemplate() {
+	suite.Templates.Save(&templates.Template{Name: "railsapp", Body: "[Service]\nExecStart=/usr/bin/docker run {{.Image}}\n"})
+
+	code, _, response, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/railsapp/unitfile?version=abc123"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), "railsapp", response.UnitFile.Template)
+	assert.Equal(suite.T(), "[Service]\nExecStart=/usr/bin/docker run mmmhm/railsapp:abc123\n", response.UnitFile.Contents)
+	assert.Len(suite.T(), response.UnitFile.Options, 1)
+}
+
+func (suite *UnitFileResourceTestSuite) TestShowRedactsSecretsOfRecordedDeploy() {
+	suite.Store.Save(schema.NewDeployRecord(&schema.Deploy{
+		ID:          "d3adb33f",
+		ServiceName: "railsapp",
+		Version:     "abc123",
+		Env:         map[string]string{"RAILS_ENV": "production"},
+		Secrets:     []*schema.SecretRef{{Name: "database-url", Env: "DATABASE_URL"}},
+	}))
+
+	code, _, response, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/railsapp/unitfile?version=abc123&timestamp=2006.01.02-15.04.05"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Contains(suite.T(), response.UnitFile.Contents, `-p 3000 -e "DATABASE_URL=[REDACTED]" -e "RAILS_ENV=production" mmmhm/railsapp:abc123`)
+	assert.NotContains(suite.T(), response.UnitFile.Contents, "postgres://")
+}
+
+func (suite *UnitFileResourceTestSuite) TestShowUsesSettingsOfRecordedDeploy() {
+	suite.Templates.Save(&templates.Template{Name: "scheduled", Body: "[Service]\nExecStart=/usr/bin/docker run {{.Image}}\n\n[X-Fleet]\n{{.FleetOptions}}\n"})
+	suite.Store.Save(schema.NewDeployRecord(&schema.Deploy{
+		ID:              "d3adb33f",
+		ServiceName:     "railsapp",
+		Version:         "abc123",
+		Template:        "scheduled",
+		MachineMetadata: []string{"region=us-east"},
+		Global:          true,
+	}))
+
+	code, _, response, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/railsapp/unitfile?version=abc123&timestamp=2006.01.02-15.04.05"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Equal(suite.T(), "scheduled", response.UnitFile.Template)
+	assert.Equal(suite.T(), "[Service]\nExecStart=/usr/bin/docker run mmmhm/railsapp:abc123\n\n[X-Fleet]\nMachineMetadata=region=us-east\nGlobal=true\n", response.UnitFile.Contents)
+}
+
+func (suite *UnitFileResourceTestSuite) TestShowWithMissingSecret() {
+	suite.Store.Save(schema.NewDeployRecord(&schema.Deploy{
+		ID:          "d3adb33f",
+		ServiceName: "railsapp",
+		Version:     "abc123",
+		Secrets:     []*schema.SecretRef{{Name: "api-key", Env: "API_KEY"}},
+	}))
+
+	code, _, _, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/railsapp/unitfile?version=abc123"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.EqualError(suite.T(), err, "The api-key secret could not be resolved: Secret not found.")
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *UnitFileResourceTestSuite) TestShowWithoutVersion() {
+	code, _, _, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/railsapp/unitfile"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.NotNil(suite.T(), err)
+	assert.Equal(suite.T(), 400, code)
+}
+
+func (suite *UnitFileResourceTestSuite) TestShowWithMissingTemplate() {
+	code, _, _, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/railsapp/unitfile?version=abc123&template=carousel"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Equal(suite.T(), templates.ErrNotFound, err)
+	assert.Equal(suite.T(), 404, code)
+}
+
+func (suite *UnitFileResourceTestSuite) TestShowWithInvalidUnitFile() {
+	suite.Templates.Save(&templates.Template{Name: "railsapp", Body: "[Service]\nExecStartPre=/bin/true\n"})
+
+	code, _, response, err := suite.Subject.Show(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/railsapp/unitfile?version=abc123"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 400, code)
+	assert.Nil(suite.T(), response.UnitFile)
+	assert.NotEmpty(suite.T(), response.Problems)
+}
+
+func TestUnitFileResourceTestSuite(t *testing.T) {
+	suite.Run(t, new(UnitFileResourceTestSuite))
+}
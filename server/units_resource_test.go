@@ -4,6 +4,10 @@ import (
 	"testing"
 
 	"github.com/bmorton/deployster/clients/mocks"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
 	"github.com/bmorton/deployster/units"
 	"github.com/coreos/fleet/schema"
 	"github.com/rcrowley/go-tigertonic/mocking"
@@ -19,7 +23,7 @@ type UnitsResourceTestSuite struct {
 }
 
 func (suite *UnitsResourceTestSuite) SetupSuite() {
-	suite.Service = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm")
+	suite.Service = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm", store.NewMemoryStore(), templates.NewMemoryRegistry(), settings.NewMemoryRegistry(), secrets.NewMemoryProvider(nil), nil, nil, nil)
 }
 
 func (suite *UnitsResourceTestSuite) SetupTest() {
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/bmorton/deployster/webhooks"
+)
+
+// WebhooksResource is the HTTP resource responsible for inspecting the
+// deliveries of payloads to the webhooks of a service.
+type WebhooksResource struct {
+	Webhooks *webhooks.Dispatcher
+}
+
+// DeliveriesResponse is the wrapper struct for the JSON payload returned by the
+// Deliveries action.
+type DeliveriesResponse struct {
+	Deliveries []*webhooks.Delivery `json:"deliveries"`
+}
+
+// Deliveries is the GET endpoint for listing the latest deliveries of payloads
+// about a service to its webhooks and the global webhooks, newest first.
+//
+// This function assumes that it is nested inside `/services/{name}/webhooks`
+// and that Tigertonic is extracting the service name and providing it via query
+// params.
+func (wr *WebhooksResource) Deliveries(u *url.URL, h http.Header, req interface{}) (int, http.Header, *DeliveriesResponse, error) {
+	return http.StatusOK, nil, &DeliveriesResponse{Deliveries: wr.Webhooks.Deliveries(u.Query().Get("name"))}, nil
+}
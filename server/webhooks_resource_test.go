@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/bmorton/deployster/store"
+	"github.com/bmorton/deployster/templates"
+	"github.com/bmorton/deployster/webhooks"
+	"github.com/rcrowley/go-tigertonic/mocking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type WebhooksResourceTestSuite struct {
+	suite.Suite
+	Subject WebhooksResource
+	Server  *httptest.Server
+	Service *DeploysterService
+}
+
+func (suite *WebhooksResourceTestSuite) SetupSuite() {
+	suite.Service = NewDeploysterService("0.0.0.0:3000", "v1.0", "username", "password", "mmmhm", store.NewMemoryStore(), templates.NewMemoryRegistry(), settings.NewMemoryRegistry(), secrets.NewMemoryProvider(nil), nil, nil, nil)
+}
+
+func (suite *WebhooksResourceTestSuite) SetupTest() {
+	suite.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	suite.Subject = WebhooksResource{webhooks.NewDispatcher([]*schema.Webhook{{URL: suite.Server.URL}}, nil, nil)}
+}
+
+func (suite *WebhooksResourceTestSuite) TearDownTest() {
+	suite.Server.Close()
+}
+
+func (suite *WebhooksResourceTestSuite) TestDeliveries() {
+	suite.Subject.Webhooks.Notify(&webhooks.Payload{Event: schema.WebhookDeployStarted, ServiceName: "carousel"})
+	suite.Subject.Webhooks.Notify(&webhooks.Payload{Event: schema.WebhookDeploySucceeded, ServiceName: "carousel"})
+	suite.Subject.Webhooks.Notify(&webhooks.Payload{Event: schema.WebhookDeployStarted, ServiceName: "photos"})
+
+	code, _, response, err := suite.Subject.Deliveries(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/carousel/webhooks/deliveries"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Len(suite.T(), response.Deliveries, 2)
+	assert.Equal(suite.T(), schema.WebhookDeploySucceeded, response.Deliveries[0].Event)
+	assert.Equal(suite.T(), suite.Server.URL, response.Deliveries[0].URL)
+	assert.False(suite.T(), response.Deliveries[0].CreatedAt.IsZero())
+}
+
+func (suite *WebhooksResourceTestSuite) TestDeliveriesWithoutWebhooks() {
+	suite.Subject = WebhooksResource{}
+
+	code, _, response, err := suite.Subject.Deliveries(
+		mocking.URL(suite.Service.RootMux, "GET", "http://example.com/v1/services/carousel/webhooks/deliveries"),
+		mocking.Header(nil),
+		nil,
+	)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 200, code)
+	assert.Len(suite.T(), response.Deliveries, 0)
+}
+
+func TestWebhooksResourceTestSuite(t *testing.T) {
+	suite.Run(t, new(WebhooksResourceTestSuite))
+}
@@ -0,0 +1,179 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bmorton/deployster/schema"
+)
+
+var (
+	// ErrNotFound is returned when no settings have been saved for the given
+	// service.
+	ErrNotFound = errors.New("Settings not found.")
+
+	// ErrInvalidName is returned when a service name can't safely be used as a
+	// file name.
+	ErrInvalidName = errors.New("Service names must only contain letters, numbers, dashes, underscores, and periods.")
+)
+
+// extension is appended to the name of each service's settings stored on disk.
+const extension = ".json"
+
+// Registry keeps the settings that each service's containers are run with.  If
+// the registry has a directory, every `{name}.json` file in it is loaded when
+// it's created and settings that are saved or deleted are written to or
+// removed from it.
+type Registry struct {
+	dir      string
+	mutex    sync.RWMutex
+	settings map[string][]byte
+}
+
+// NewMemoryRegistry returns an empty Registry that only keeps settings in
+// memory.
+func NewMemoryRegistry() *Registry {
+	return &Registry{settings: make(map[string][]byte)}
+}
+
+// NewRegistry returns a Registry backed by the given directory, creating the
+// directory if it doesn't already exist.  If the directory is blank, settings
+// are only kept in memory.
+func NewRegistry(dir string) (*Registry, error) {
+	r := NewMemoryRegistry()
+	if dir == "" {
+		return r, nil
+	}
+	r.dir = dir
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+extension))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), extension)
+		if !isValidName(name) {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var s schema.ServiceSettings
+		err = json.Unmarshal(data, &s)
+		if err != nil {
+			return nil, err
+		}
+		r.settings[name] = data
+	}
+
+	return r, nil
+}
+
+// Save stores the settings of the service, replacing any existing settings.
+// The settings must be valid.
+func (r *Registry) Save(name string, s *schema.ServiceSettings) error {
+	if !isValidName(name) {
+		return ErrInvalidName
+	}
+	err := Validate(s)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.dir != "" {
+		path := filepath.Join(r.dir, name+extension)
+		err = ioutil.WriteFile(path+".tmp", data, 0644)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(path+".tmp", path)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.settings[name] = data
+	return nil
+}
+
+// Find returns a copy of the settings of the service or ErrNotFound.
+func (r *Registry) Find(name string) (*schema.ServiceSettings, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	data, ok := r.settings[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	var s schema.ServiceSettings
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ForService returns the settings of the service, or empty settings that
+// run its containers with Docker's defaults if none have been saved.
+func (r *Registry) ForService(name string) *schema.ServiceSettings {
+	s, err := r.Find(name)
+	if err != nil {
+		return &schema.ServiceSettings{}
+	}
+	return s
+}
+
+// Delete removes the settings of the service so that its containers are run
+// with the defaults.
+func (r *Registry) Delete(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.settings[name]; !ok {
+		return ErrNotFound
+	}
+
+	if r.dir != "" {
+		err := os.Remove(filepath.Join(r.dir, name+extension))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	delete(r.settings, name)
+	return nil
+}
+
+// isValidName ensures that the name can be used as a file name without escaping
+// the registry's directory.
+func isValidName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
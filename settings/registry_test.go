@@ -0,0 +1,109 @@
+package settings
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RegistryTestSuite struct {
+	suite.Suite
+	Subject *Registry
+	Dir     string
+}
+
+func (suite *RegistryTestSuite) SetupTest() {
+	suite.Dir, _ = ioutil.TempDir("", "deployster-settings")
+	suite.Subject, _ = NewRegistry(suite.Dir)
+}
+
+func (suite *RegistryTestSuite) TearDownTest() {
+	os.RemoveAll(suite.Dir)
+}
+
+func (suite *RegistryTestSuite) TestSaveAndFind() {
+	err := suite.Subject.Save("railsapp", &schema.ServiceSettings{Ports: []int{8080}, Memory: "512m"})
+	assert.Nil(suite.T(), err)
+
+	found, err := suite.Subject.Find("railsapp")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []int{8080}, found.Ports)
+	assert.Equal(suite.T(), "512m", found.Memory)
+}
+
+func (suite *RegistryTestSuite) TestSaveWritesToDirectory() {
+	suite.Subject.Save("railsapp", &schema.ServiceSettings{Ports: []int{8080}})
+
+	data, err := ioutil.ReadFile(filepath.Join(suite.Dir, "railsapp.json"))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), `{"ports":[8080]}`, string(data))
+}
+
+func (suite *RegistryTestSuite) TestSaveInvalidSettings() {
+	err := suite.Subject.Save("railsapp", &schema.ServiceSettings{Ports: []int{0}})
+
+	assert.NotNil(suite.T(), err)
+	_, err = suite.Subject.Find("railsapp")
+	assert.Equal(suite.T(), ErrNotFound, err)
+}
+
+func (suite *RegistryTestSuite) TestSaveInvalidName() {
+	err := suite.Subject.Save("../railsapp", &schema.ServiceSettings{})
+
+	assert.Equal(suite.T(), ErrInvalidName, err)
+}
+
+func (suite *RegistryTestSuite) TestFindReturnsCopy() {
+	suite.Subject.Save("railsapp", &schema.ServiceSettings{Ports: []int{8080}})
+
+	found, _ := suite.Subject.Find("railsapp")
+	found.Ports[0] = 9090
+
+	found, _ = suite.Subject.Find("railsapp")
+	assert.Equal(suite.T(), []int{8080}, found.Ports)
+}
+
+func (suite *RegistryTestSuite) TestForServiceWithoutSettings() {
+	s := suite.Subject.ForService("railsapp")
+
+	assert.Equal(suite.T(), &schema.ServiceSettings{}, s)
+	assert.Equal(suite.T(), schema.DefaultPort, s.HTTPPort())
+}
+
+func (suite *RegistryTestSuite) TestLoadsFromDirectory() {
+	ioutil.WriteFile(filepath.Join(suite.Dir, "carousel.json"), []byte(`{"ports":[5000],"cpu_shares":512}`), 0644)
+
+	registry, err := NewRegistry(suite.Dir)
+
+	assert.Nil(suite.T(), err)
+	found, _ := registry.Find("carousel")
+	assert.Equal(suite.T(), 5000, found.HTTPPort())
+	assert.Equal(suite.T(), int64(512), found.CPUShares)
+}
+
+func (suite *RegistryTestSuite) TestDelete() {
+	suite.Subject.Save("railsapp", &schema.ServiceSettings{Ports: []int{8080}})
+
+	err := suite.Subject.Delete("railsapp")
+
+	assert.Nil(suite.T(), err)
+	_, err = suite.Subject.Find("railsapp")
+	assert.Equal(suite.T(), ErrNotFound, err)
+	_, err = os.Stat(filepath.Join(suite.Dir, "railsapp.json"))
+	assert.True(suite.T(), os.IsNotExist(err))
+}
+
+func (suite *RegistryTestSuite) TestDeleteNotFound() {
+	err := suite.Subject.Delete("railsapp")
+
+	assert.Equal(suite.T(), ErrNotFound, err)
+}
+
+func TestRegistryTestSuite(t *testing.T) {
+	suite.Run(t, new(RegistryTestSuite))
+}
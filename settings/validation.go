@@ -0,0 +1,185 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/bmorton/deployster/schema"
+)
+
+// memoryUnits are the suffixes Docker accepts for memory limits.
+var memoryUnits = map[byte]int64{
+	'b': 1,
+	'k': 1 << 10,
+	'm': 1 << 20,
+	'g': 1 << 30,
+}
+
+// Validate returns an error describing the first problem with the settings, or
+// nil if they're valid.
+func Validate(s *schema.ServiceSettings) error {
+	for _, port := range s.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("The port %d must be between 1 and 65535.", port)
+		}
+	}
+
+	if s.Memory != "" {
+		if _, err := MemoryBytes(s.Memory); err != nil {
+			return err
+		}
+	}
+
+	if s.CPUShares < 0 {
+		return errors.New("The CPU shares must not be negative.")
+	}
+
+	for _, volume := range s.Volumes {
+		parts := strings.Split(volume, ":")
+		if len(parts) < 2 || len(parts) > 3 || !path.IsAbs(parts[0]) || !path.IsAbs(parts[1]) {
+			return fmt.Errorf("The volume %q must be in the form /host/path:/container/path with an optional :ro or :rw.", volume)
+		}
+		if len(parts) == 3 && parts[2] != "ro" && parts[2] != "rw" {
+			return fmt.Errorf("The volume %q must be in the form /host/path:/container/path with an optional :ro or :rw.", volume)
+		}
+	}
+
+	for _, host := range s.ExtraHosts {
+		i := strings.Index(host, ":")
+		if i < 1 || !isHostname(host[:i]) || net.ParseIP(host[i+1:]) == nil {
+			return fmt.Errorf("The extra host %q must be in the form hostname:ip.", host)
+		}
+	}
+
+	if s.RestartPolicy != "" {
+		if _, _, err := RestartPolicy(s.RestartPolicy); err != nil {
+			return err
+		}
+	}
+
+	for name := range s.Labels {
+		if name == "" {
+			return errors.New("Label names must not be blank.")
+		}
+	}
+
+	if s.LoadBalancer != "" && !isLoadBalancer(s.LoadBalancer) {
+		return fmt.Errorf("The load balancer %q must be one of %s.", s.LoadBalancer, strings.Join(schema.LoadBalancers, ", "))
+	}
+
+	for _, hook := range s.Webhooks {
+		err := ValidateWebhook(hook)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateWebhook returns an error describing the first problem with the
+// webhook, or nil if it's valid.
+func ValidateWebhook(hook *schema.Webhook) error {
+	if hook == nil {
+		return errors.New("Webhooks must not be blank.")
+	}
+
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("The webhook URL %q must be an absolute http or https URL.", hook.URL)
+	}
+
+	for _, event := range hook.Events {
+		if !isWebhookEvent(event) {
+			return fmt.Errorf("The webhook event %q must be one of %s.", event, strings.Join(schema.WebhookEvents, ", "))
+		}
+	}
+	return nil
+}
+
+// MemoryBytes converts a Docker memory limit such as `512m` into bytes.
+func MemoryBytes(memory string) (int64, error) {
+	invalid := fmt.Errorf("The memory limit %q must be a number of bytes with an optional b, k, m, or g suffix.", memory)
+	if memory == "" {
+		return 0, invalid
+	}
+
+	multiplier := int64(1)
+	number := memory
+	if unit, ok := memoryUnits[strings.ToLower(memory[len(memory)-1:])[0]]; ok {
+		multiplier = unit
+		number = memory[:len(memory)-1]
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, invalid
+	}
+	return n * multiplier, nil
+}
+
+// RestartPolicy splits a Docker restart policy such as `on-failure:5` into its
+// name and maximum retry count.
+func RestartPolicy(policy string) (string, int, error) {
+	invalid := fmt.Errorf("The restart policy %q must be no, always, or on-failure with an optional :max-retries.", policy)
+
+	parts := strings.SplitN(policy, ":", 2)
+	switch {
+	case len(parts) == 1 && (parts[0] == "no" || parts[0] == "always" || parts[0] == "on-failure"):
+		return parts[0], 0, nil
+	case len(parts) == 2 && parts[0] == "on-failure":
+		retries, err := strconv.Atoi(parts[1])
+		if err != nil || retries < 0 {
+			return "", 0, invalid
+		}
+		return parts[0], retries, nil
+	}
+	return "", 0, invalid
+}
+
+// isHostname returns whether the name is a valid RFC 1123 hostname: dot
+// separated labels of letters, digits, and hyphens that don't begin or end with
+// a hyphen.
+func isHostname(name string) bool {
+	if len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) < 1 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isWebhookEvent returns whether the name is one of the events that webhooks
+// can be notified of.
+func isWebhookEvent(name string) bool {
+	for _, event := range schema.WebhookEvents {
+		if name == event {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoadBalancer returns whether the name is one of the supported load
+// balancers.
+func isLoadBalancer(name string) bool {
+	for _, balancer := range schema.LoadBalancers {
+		if name == balancer {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package settings
+
+import (
+	"testing"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ValidationTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ValidationTestSuite) TestValidSettings() {
+	err := Validate(&schema.ServiceSettings{
+		Ports:         []int{8080, 9090},
+		Memory:        "512m",
+		CPUShares:     512,
+		Volumes:       []string{"/var/log/railsapp:/app/log", "/etc/ssl:/etc/ssl:ro"},
+		ExtraHosts:    []string{"db.internal:10.0.0.5"},
+		RestartPolicy: "on-failure:3",
+		Labels:        map[string]string{"team": "payments"},
+		LoadBalancer:  "nginx",
+		Webhooks: []*schema.Webhook{
+			{URL: "https://ci.example.com/hooks/deployster", Secret: "ci-hook"},
+			{URL: "http://chat.internal/deploys", Events: []string{"deploy_succeeded", "deploy_failed"}},
+		},
+	})
+
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *ValidationTestSuite) TestInvalidSettings() {
+	invalid := []*schema.ServiceSettings{
+		{Ports: []int{70000}},
+		{Memory: "lots"},
+		{Memory: "-5m"},
+		{CPUShares: -1},
+		{Volumes: []string{"relative:/app"}},
+		{Volumes: []string{"/host:/app:rx"}},
+		{ExtraHosts: []string{"db.internal"}},
+		{ExtraHosts: []string{"db.internal:not-an-ip"}},
+		{ExtraHosts: []string{"db internal:10.0.0.5"}},
+		{ExtraHosts: []string{"db\"; rm -rf /:10.0.0.5"}},
+		{ExtraHosts: []string{"-db.internal:10.0.0.5"}},
+		{ExtraHosts: []string{"db..internal:10.0.0.5"}},
+		{RestartPolicy: "sometimes"},
+		{RestartPolicy: "always:3"},
+		{Labels: map[string]string{"": "payments"}},
+		{LoadBalancer: "f5"},
+		{Webhooks: []*schema.Webhook{{URL: "ci.example.com/hooks"}}},
+		{Webhooks: []*schema.Webhook{{URL: "ftp://ci.example.com/hooks"}}},
+		{Webhooks: []*schema.Webhook{{URL: "https://ci.example.com/hooks", Events: []string{"deployed"}}}},
+		{Webhooks: []*schema.Webhook{nil}},
+	}
+
+	for _, s := range invalid {
+		assert.NotNil(suite.T(), Validate(s), "%#v should be invalid", s)
+	}
+}
+
+func (suite *ValidationTestSuite) TestMemoryBytes() {
+	bytes, err := MemoryBytes("512m")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), int64(512*1024*1024), bytes)
+
+	bytes, err = MemoryBytes("1G")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), int64(1024*1024*1024), bytes)
+
+	bytes, err = MemoryBytes("4096")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), int64(4096), bytes)
+}
+
+func (suite *ValidationTestSuite) TestRestartPolicy() {
+	name, retries, err := RestartPolicy("on-failure:5")
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "on-failure", name)
+	assert.Equal(suite.T(), 5, retries)
+}
+
+func TestValidationTestSuite(t *testing.T) {
+	suite.Run(t, new(ValidationTestSuite))
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bmorton/deployster/schema"
+)
+
+// FileStore is a Store that persists each deploy record as a JSON document on
+// disk so that deploy history survives restarts.  Records are laid out as
+// `{dir}/{service name}/{id}.json`.
+type FileStore struct {
+	dir   string
+	mutex sync.RWMutex
+}
+
+// NewFileStore returns a FileStore rooted at the given directory, creating the
+// directory if it doesn't already exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Save writes the record to a temporary file and renames it into place so that
+// readers never see a partially written record.
+func (fs *FileStore) Save(record *schema.DeployRecord) error {
+	path, err := fs.path(record.ServiceName, record.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return writeRecord(path, data)
+}
+
+// SaveIfStatus writes the record like Save if the record on disk has the given
+// status.
+func (fs *FileStore) SaveIfStatus(record *schema.DeployRecord, status string) error {
+	path, err := fs.path(record.ServiceName, record.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	stored, err := readRecord(path)
+	if err != nil {
+		return err
+	}
+	if stored.Status != status {
+		return ErrStatusChanged
+	}
+	return writeRecord(path, data)
+}
+
+// Find reads the record for the given service name and ID from disk.
+func (fs *FileStore) Find(serviceName string, id string) (*schema.DeployRecord, error) {
+	path, err := fs.path(serviceName, id)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	return readRecord(path)
+}
+
+// List reads every record stored for the given service name.
+func (fs *FileStore) List(serviceName string) ([]*schema.DeployRecord, error) {
+	records := []*schema.DeployRecord{}
+	if !isValidKey(serviceName) {
+		return records, errInvalidKey
+	}
+
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	paths, err := filepath.Glob(filepath.Join(fs.dir, serviceName, "*.json"))
+	if err != nil {
+		return records, err
+	}
+
+	for _, path := range paths {
+		record, err := readRecord(path)
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+	sort.Sort(newestFirst(records))
+
+	return records, nil
+}
+
+// Services returns the names of every service with a directory of records.
+func (fs *FileStore) Services() ([]string, error) {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	entries, err := ioutil.ReadDir(fs.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && isValidKey(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// path returns the location on disk of the record with the given service name
+// and ID.
+func (fs *FileStore) path(serviceName string, id string) (string, error) {
+	if !isValidKey(serviceName) || !isValidKey(id) {
+		return "", errInvalidKey
+	}
+	return filepath.Join(fs.dir, serviceName, id+".json"), nil
+}
+
+// writeRecord writes the data to a temporary file and renames it into place.
+func writeRecord(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readRecord decodes the record stored at the given path.
+func readRecord(path string) (*schema.DeployRecord, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record schema.DeployRecord
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// errInvalidKey is returned when a service name or ID can't safely be used as
+// a path component.
+var errInvalidKey = errors.New("Service names and deploy IDs must not be empty or contain path separators.")
+
+// isValidKey ensures that the key can't be used to escape the store's
+// directory.
+func isValidKey(key string) bool {
+	return key != "" && key != "." && key != ".." && !strings.ContainsAny(key, `/\`)
+}
+
+// newestFirst sorts deploy records by descending creation time.
+type newestFirst []*schema.DeployRecord
+
+func (r newestFirst) Len() int           { return len(r) }
+func (r newestFirst) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r newestFirst) Less(i, j int) bool { return r[i].CreatedAt.After(r[j].CreatedAt) }
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type FileStoreTestSuite struct {
+	suite.Suite
+	Subject *FileStore
+	Dir     string
+}
+
+func (suite *FileStoreTestSuite) SetupTest() {
+	suite.Dir, _ = ioutil.TempDir("", "deployster-store")
+	suite.Subject, _ = NewFileStore(suite.Dir)
+}
+
+func (suite *FileStoreTestSuite) TearDownTest() {
+	os.RemoveAll(suite.Dir)
+}
+
+func (suite *FileStoreTestSuite) TestSaveAndFind() {
+	record := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"})
+	err := suite.Subject.Save(record)
+	assert.Nil(suite.T(), err)
+
+	found, err := suite.Subject.Find("carousel", "d3adb33f")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "abc123", found.Version)
+	assert.Equal(suite.T(), schema.DeployLaunching, found.Status)
+}
+
+func (suite *FileStoreTestSuite) TestSaveReplacesExistingRecord() {
+	record := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"})
+	suite.Subject.Save(record)
+	record.Status = schema.DeploySucceeded
+	suite.Subject.Save(record)
+
+	found, _ := suite.Subject.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeploySucceeded, found.Status)
+}
+
+func (suite *FileStoreTestSuite) TestFindMissingRecord() {
+	_, err := suite.Subject.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), ErrNotFound, err)
+}
+
+func (suite *FileStoreTestSuite) TestFindRejectsPathTraversal() {
+	_, err := suite.Subject.Find("..", "d3adb33f")
+	assert.Equal(suite.T(), errInvalidKey, err)
+}
+
+func (suite *FileStoreTestSuite) TestListNewestFirst() {
+	older := schema.NewDeployRecord(&schema.Deploy{ID: "older", ServiceName: "carousel", Version: "abc123"})
+	older.CreatedAt = time.Now().Add(-time.Hour)
+	newer := schema.NewDeployRecord(&schema.Deploy{ID: "newer", ServiceName: "carousel", Version: "def456"})
+	other := schema.NewDeployRecord(&schema.Deploy{ID: "other", ServiceName: "railsapp", Version: "def456"})
+	suite.Subject.Save(older)
+	suite.Subject.Save(newer)
+	suite.Subject.Save(other)
+
+	records, err := suite.Subject.List("carousel")
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), records, 2)
+	assert.Equal(suite.T(), "newer", records[0].ID)
+	assert.Equal(suite.T(), "older", records[1].ID)
+}
+
+func (suite *FileStoreTestSuite) TestListWithNoRecords() {
+	records, err := suite.Subject.List("carousel")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []*schema.DeployRecord{}, records)
+}
+
+func (suite *FileStoreTestSuite) TestRecordsSurviveReopening() {
+	suite.Subject.Save(schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"}))
+
+	reopened, _ := NewFileStore(suite.Dir)
+	found, err := reopened.Find("carousel", "d3adb33f")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "abc123", found.Version)
+	_, err = os.Stat(filepath.Join(suite.Dir, "carousel", "d3adb33f.json"))
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *FileStoreTestSuite) TestSaveIfStatus() {
+	record := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"})
+	suite.Subject.Save(record)
+	record.Status = schema.DeployPolling
+
+	err := suite.Subject.SaveIfStatus(record, schema.DeployLaunching)
+	assert.Nil(suite.T(), err)
+	found, _ := suite.Subject.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeployPolling, found.Status)
+}
+
+func (suite *FileStoreTestSuite) TestSaveIfStatusWhenStatusChanged() {
+	record := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"})
+	suite.Subject.Save(record)
+	record.Status = schema.DeployFailed
+
+	err := suite.Subject.SaveIfStatus(record, schema.DeployCanary)
+	assert.Equal(suite.T(), ErrStatusChanged, err)
+	found, _ := suite.Subject.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeployLaunching, found.Status)
+}
+
+func (suite *FileStoreTestSuite) TestSaveIfStatusMissingRecord() {
+	record := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"})
+	err := suite.Subject.SaveIfStatus(record, schema.DeployLaunching)
+	assert.Equal(suite.T(), ErrNotFound, err)
+}
+
+func (suite *FileStoreTestSuite) TestServices() {
+	suite.Subject.Save(schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"}))
+	suite.Subject.Save(schema.NewDeployRecord(&schema.Deploy{ID: "f00dcafe", ServiceName: "api", Version: "def456"}))
+	suite.Subject.Save(schema.NewDeployRecord(&schema.Deploy{ID: "b4dc0ffe", ServiceName: "carousel", Version: "def456"}))
+
+	names, err := suite.Subject.Services()
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{"api", "carousel"}, names)
+}
+
+func TestFileStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(FileStoreTestSuite))
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/bmorton/deployster/schema"
+)
+
+// MemoryStore is a Store that keeps deploy records in memory.  Records are
+// serialized on the way in and out so that callers never share a record with
+// the store.  History is lost when deployster restarts.
+type MemoryStore struct {
+	records map[string]map[string][]byte
+	mutex   sync.RWMutex
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]map[string][]byte)}
+}
+
+// Save stores a copy of the record.
+func (ms *MemoryStore) Save(record *schema.DeployRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if _, ok := ms.records[record.ServiceName]; !ok {
+		ms.records[record.ServiceName] = make(map[string][]byte)
+	}
+	ms.records[record.ServiceName][record.ID] = data
+
+	return nil
+}
+
+// SaveIfStatus stores a copy of the record if the stored record has the given
+// status.
+func (ms *MemoryStore) SaveIfStatus(record *schema.DeployRecord, status string) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	existing, ok := ms.records[record.ServiceName][record.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	var stored schema.DeployRecord
+	err = json.Unmarshal(existing, &stored)
+	if err != nil {
+		return err
+	}
+	if stored.Status != status {
+		return ErrStatusChanged
+	}
+	ms.records[record.ServiceName][record.ID] = data
+
+	return nil
+}
+
+// Find returns a copy of the record for the given service name and ID.
+func (ms *MemoryStore) Find(serviceName string, id string) (*schema.DeployRecord, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	data, ok := ms.records[serviceName][id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	var record schema.DeployRecord
+	err := json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// List returns copies of every record for the given service name.
+func (ms *MemoryStore) List(serviceName string) ([]*schema.DeployRecord, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	records := []*schema.DeployRecord{}
+	for _, data := range ms.records[serviceName] {
+		var record schema.DeployRecord
+		err := json.Unmarshal(data, &record)
+		if err != nil {
+			return records, err
+		}
+		records = append(records, &record)
+	}
+	sort.Sort(newestFirst(records))
+
+	return records, nil
+}
+
+// Services returns the names of every service with records in memory.
+func (ms *MemoryStore) Services() ([]string, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	names := make([]string, 0, len(ms.records))
+	for name := range ms.records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type MemoryStoreTestSuite struct {
+	suite.Suite
+	Subject *MemoryStore
+}
+
+func (suite *MemoryStoreTestSuite) SetupTest() {
+	suite.Subject = NewMemoryStore()
+}
+
+func (suite *MemoryStoreTestSuite) TestSaveAndFind() {
+	record := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"})
+	err := suite.Subject.Save(record)
+	assert.Nil(suite.T(), err)
+
+	found, err := suite.Subject.Find("carousel", "d3adb33f")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "abc123", found.Version)
+}
+
+func (suite *MemoryStoreTestSuite) TestFindReturnsCopy() {
+	record := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"})
+	suite.Subject.Save(record)
+	record.Status = schema.DeployFailed
+
+	found, _ := suite.Subject.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeployLaunching, found.Status)
+}
+
+func (suite *MemoryStoreTestSuite) TestFindMissingRecord() {
+	_, err := suite.Subject.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), ErrNotFound, err)
+}
+
+func (suite *MemoryStoreTestSuite) TestListNewestFirst() {
+	older := schema.NewDeployRecord(&schema.Deploy{ID: "older", ServiceName: "carousel", Version: "abc123"})
+	older.CreatedAt = time.Now().Add(-time.Hour)
+	newer := schema.NewDeployRecord(&schema.Deploy{ID: "newer", ServiceName: "carousel", Version: "def456"})
+	suite.Subject.Save(older)
+	suite.Subject.Save(newer)
+
+	records, err := suite.Subject.List("carousel")
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), records, 2)
+	assert.Equal(suite.T(), "newer", records[0].ID)
+}
+
+func (suite *MemoryStoreTestSuite) TestSaveIfStatus() {
+	record := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"})
+	suite.Subject.Save(record)
+	record.Status = schema.DeployPolling
+
+	err := suite.Subject.SaveIfStatus(record, schema.DeployLaunching)
+	assert.Nil(suite.T(), err)
+	found, _ := suite.Subject.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeployPolling, found.Status)
+}
+
+func (suite *MemoryStoreTestSuite) TestSaveIfStatusWhenStatusChanged() {
+	record := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"})
+	suite.Subject.Save(record)
+	record.Status = schema.DeployFailed
+
+	err := suite.Subject.SaveIfStatus(record, schema.DeployCanary)
+	assert.Equal(suite.T(), ErrStatusChanged, err)
+	found, _ := suite.Subject.Find("carousel", "d3adb33f")
+	assert.Equal(suite.T(), schema.DeployLaunching, found.Status)
+}
+
+func (suite *MemoryStoreTestSuite) TestSaveIfStatusMissingRecord() {
+	record := schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"})
+	err := suite.Subject.SaveIfStatus(record, schema.DeployLaunching)
+	assert.Equal(suite.T(), ErrNotFound, err)
+}
+
+func (suite *MemoryStoreTestSuite) TestServices() {
+	suite.Subject.Save(schema.NewDeployRecord(&schema.Deploy{ID: "d3adb33f", ServiceName: "carousel", Version: "abc123"}))
+	suite.Subject.Save(schema.NewDeployRecord(&schema.Deploy{ID: "f00dcafe", ServiceName: "api", Version: "def456"}))
+	suite.Subject.Save(schema.NewDeployRecord(&schema.Deploy{ID: "b4dc0ffe", ServiceName: "carousel", Version: "def456"}))
+
+	names, err := suite.Subject.Services()
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{"api", "carousel"}, names)
+}
+
+func TestMemoryStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(MemoryStoreTestSuite))
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/bmorton/deployster/schema"
+)
+
+// ErrNotFound is returned when a deploy record does not exist for the given
+// service name and ID.
+var ErrNotFound = errors.New("Deploy not found.")
+
+// ErrStatusChanged is returned when a record can't be replaced because its
+// status is no longer the one that was expected.
+var ErrStatusChanged = errors.New("Deploy status has changed.")
+
+// Store is the interface required for persisting deploy records so that the
+// progress and outcome of a deploy can be queried after it has been triggered.
+type Store interface {
+	// Save creates or replaces the record using its service name and ID.
+	Save(*schema.DeployRecord) error
+
+	// SaveIfStatus replaces the record only if the stored record still has
+	// the given status, returning ErrStatusChanged otherwise.  It lets a
+	// request claim a deploy without racing other requests.
+	SaveIfStatus(*schema.DeployRecord, string) error
+
+	// Find returns the record for the given service name and ID, or
+	// ErrNotFound if it doesn't exist.
+	Find(string, string) (*schema.DeployRecord, error)
+
+	// List returns all records for the given service name, newest first.
+	List(string) ([]*schema.DeployRecord, error)
+
+	// Services returns the names of every service that has records, sorted
+	// alphabetically.
+	Services() ([]string, error)
+}
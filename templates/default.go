@@ -0,0 +1,37 @@
+package templates
+
+// DefaultName is the name of the template used by services that don't have a
+// template of their own.
+const DefaultName = "default"
+
+// defaultTemplate is the unit file that deployster has always launched
+// services with.  It makes lots of assumptions about how the service is
+// configured and stored.  These assumptions are essentially the conventions
+// that power deployster and are described in more detail in the README.  Unless
+// deployster manages the endpoints of instances itself, and keeps them in step
+// with Fleet, each instance registers its endpoint with vulcand once it starts
+// and removes it when it stops.  It can be replaced by registering a template
+// named `default`.
+const defaultTemplate = `
+[Unit]
+Description={{.Name}}-{{.Version}}-{{.Timestamp}}
+After=docker.service
+
+[Service]
+EnvironmentFile=/etc/environment
+User=core
+TimeoutStartSec=0
+ExecStartPre=/usr/bin/docker pull {{.Image}}
+ExecStartPre=-/usr/bin/docker rm -f {{.ContainerName}}
+ExecStart=/usr/bin/docker run --name {{.ContainerName}} {{.DockerFlags}}{{if .EnvFlags}} {{.EnvFlags}}{{end}} {{.Image}}
+{{if not .ManagedEndpoints}}ExecStartPost=/bin/sh -c "sleep 10; /usr/bin/etcdctl set /vulcand/upstreams/{{.Name}}/endpoints/{{.ContainerName}} http://$COREOS_PRIVATE_IPV4:$(echo $(/usr/bin/docker port {{.ContainerName}} {{.Port}}) | cut -d ':' -f 2)"
+{{end}}ExecStop=/bin/sh -c "{{if not .ManagedEndpoints}}/usr/bin/etcdctl rm '/vulcand/upstreams/{{.Name}}/endpoints/{{.ContainerName}}' ; {{end}}/usr/bin/docker rm -f {{.ContainerName}}"
+{{if .FleetOptions}}
+[X-Fleet]
+{{.FleetOptions}}
+{{end}}`
+
+// Default returns the built-in template.
+func Default() *Template {
+	return &Template{Name: DefaultName, Body: defaultTemplate}
+}
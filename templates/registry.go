@@ -0,0 +1,206 @@
+package templates
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bmorton/deployster/schema"
+)
+
+var (
+	// ErrNotFound is returned when a template with the given name hasn't been
+	// registered.
+	ErrNotFound = errors.New("Template not found.")
+
+	// ErrInvalidName is returned when a template name can't safely be used as
+	// a file name.
+	ErrInvalidName = errors.New("Template names must only contain letters, numbers, dashes, underscores, and periods.")
+
+	// ErrDefault is returned when trying to delete the built-in default
+	// template.
+	ErrDefault = errors.New("The built-in default template can't be deleted.")
+)
+
+// extension is appended to the name of each template stored on disk.
+const extension = ".tmpl"
+
+// Registry keeps the unit templates that deploys can be launched with.  The
+// built-in default template is always registered but can be replaced.  If the
+// registry has a directory, every `{name}.tmpl` file in it is registered when
+// it's created and templates that are saved or deleted are written to or
+// removed from it.
+type Registry struct {
+	dir       string
+	mutex     sync.RWMutex
+	templates map[string]*Template
+}
+
+// NewMemoryRegistry returns a Registry that only keeps templates in memory and
+// has nothing but the default template registered.
+func NewMemoryRegistry() *Registry {
+	return &Registry{templates: map[string]*Template{DefaultName: Default()}}
+}
+
+// NewRegistry returns a Registry backed by the given directory, creating the
+// directory if it doesn't already exist.  If the directory is blank, templates
+// are only kept in memory.
+func NewRegistry(dir string) (*Registry, error) {
+	r := NewMemoryRegistry()
+	if dir == "" {
+		return r, nil
+	}
+	r.dir = dir
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+extension))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		t := &Template{Name: strings.TrimSuffix(filepath.Base(path), extension), Body: string(body)}
+		if !isValidName(t.Name) {
+			continue
+		}
+		if _, err := t.Parse(); err != nil {
+			return nil, err
+		}
+		r.templates[t.Name] = t
+	}
+
+	return r, nil
+}
+
+// Save registers the template, replacing any template with the same name.  The
+// template must be able to be parsed.
+func (r *Registry) Save(t *Template) error {
+	if !isValidName(t.Name) {
+		return ErrInvalidName
+	}
+	if _, err := t.Parse(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.dir != "" {
+		path := filepath.Join(r.dir, t.Name+extension)
+		err := ioutil.WriteFile(path+".tmp", []byte(t.Body), 0644)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(path+".tmp", path)
+		if err != nil {
+			return err
+		}
+	}
+
+	saved := *t
+	r.templates[t.Name] = &saved
+	return nil
+}
+
+// Find returns a copy of the template with the given name or ErrNotFound.
+func (r *Registry) Find(name string) (*Template, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	t, ok := r.templates[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *t
+	return &found, nil
+}
+
+// List returns a copy of every registered template, sorted by name.
+func (r *Registry) List() []*Template {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	list := []*Template{}
+	for _, t := range r.templates {
+		found := *t
+		list = append(list, &found)
+	}
+	sort.Sort(byName(list))
+	return list
+}
+
+// Delete unregisters the template with the given name.  Deleting a replacement
+// of the default template restores the built-in one, but the built-in
+// template itself can't be deleted.
+func (r *Registry) Delete(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	t, ok := r.templates[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if name == DefaultName && t.Body == defaultTemplate {
+		return ErrDefault
+	}
+
+	if r.dir != "" {
+		err := os.Remove(filepath.Join(r.dir, name+extension))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	delete(r.templates, name)
+	if name == DefaultName {
+		r.templates[DefaultName] = Default()
+	}
+	return nil
+}
+
+// ForDeploy returns the template that the deploy should be launched with.  That
+// is the template the deploy names, if any, otherwise the template named after
+// its service, falling back to the default template.
+func (r *Registry) ForDeploy(deploy *schema.Deploy) (*Template, error) {
+	if deploy.Template != "" {
+		return r.Find(deploy.Template)
+	}
+
+	t, err := r.Find(deploy.ServiceName)
+	if err == ErrNotFound {
+		return r.Find(DefaultName)
+	}
+	return t, err
+}
+
+// isValidName ensures that the name can be used as a file name without escaping
+// the registry's directory.
+func isValidName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// byName sorts templates by name.
+type byName []*Template
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byName) Less(i, j int) bool { return s[i].Name < s[j].Name }
@@ -0,0 +1,167 @@
+package templates
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RegistryTestSuite struct {
+	suite.Suite
+	Subject *Registry
+	Dir     string
+}
+
+func (suite *RegistryTestSuite) SetupTest() {
+	suite.Dir, _ = ioutil.TempDir("", "deployster-templates")
+	suite.Subject, _ = NewRegistry(suite.Dir)
+}
+
+func (suite *RegistryTestSuite) TearDownTest() {
+	os.RemoveAll(suite.Dir)
+}
+
+func (suite *RegistryTestSuite) TestDefaultIsRegistered() {
+	found, err := suite.Subject.Find(DefaultName)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), defaultTemplate, found.Body)
+}
+
+func (suite *RegistryTestSuite) TestSaveAndFind() {
+	err := suite.Subject.Save(&Template{Name: "railsapp", Body: "[Service]\nExecStart={{.Image}}\n"})
+	assert.Nil(suite.T(), err)
+
+	found, err := suite.Subject.Find("railsapp")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "[Service]\nExecStart={{.Image}}\n", found.Body)
+}
+
+func (suite *RegistryTestSuite) TestSaveWritesToDirectory() {
+	suite.Subject.Save(&Template{Name: "railsapp", Body: "[Service]\n"})
+
+	body, err := ioutil.ReadFile(filepath.Join(suite.Dir, "railsapp.tmpl"))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "[Service]\n", string(body))
+}
+
+func (suite *RegistryTestSuite) TestSaveWithParseError() {
+	err := suite.Subject.Save(&Template{Name: "railsapp", Body: "{{.Image"})
+
+	assert.NotNil(suite.T(), err)
+	_, err = suite.Subject.Find("railsapp")
+	assert.Equal(suite.T(), ErrNotFound, err)
+}
+
+func (suite *RegistryTestSuite) TestSaveWithInvalidName() {
+	err := suite.Subject.Save(&Template{Name: "../railsapp", Body: "[Service]\n"})
+
+	assert.Equal(suite.T(), ErrInvalidName, err)
+}
+
+func (suite *RegistryTestSuite) TestFindNotFound() {
+	_, err := suite.Subject.Find("railsapp")
+
+	assert.Equal(suite.T(), ErrNotFound, err)
+}
+
+func (suite *RegistryTestSuite) TestNewRegistryLoadsDirectory() {
+	ioutil.WriteFile(filepath.Join(suite.Dir, "railsapp.tmpl"), []byte("[Service]\n"), 0644)
+	ioutil.WriteFile(filepath.Join(suite.Dir, "README"), []byte("not a template"), 0644)
+
+	registry, err := NewRegistry(suite.Dir)
+
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), registry.List(), 2)
+	found, _ := registry.Find("railsapp")
+	assert.Equal(suite.T(), "[Service]\n", found.Body)
+}
+
+func (suite *RegistryTestSuite) TestNewRegistryWithUnparseableTemplate() {
+	ioutil.WriteFile(filepath.Join(suite.Dir, "railsapp.tmpl"), []byte("{{.Image"), 0644)
+
+	_, err := NewRegistry(suite.Dir)
+
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *RegistryTestSuite) TestList() {
+	suite.Subject.Save(&Template{Name: "worker", Body: ""})
+	suite.Subject.Save(&Template{Name: "railsapp", Body: ""})
+
+	list := suite.Subject.List()
+
+	assert.Len(suite.T(), list, 3)
+	assert.Equal(suite.T(), "default", list[0].Name)
+	assert.Equal(suite.T(), "railsapp", list[1].Name)
+	assert.Equal(suite.T(), "worker", list[2].Name)
+}
+
+func (suite *RegistryTestSuite) TestDelete() {
+	suite.Subject.Save(&Template{Name: "railsapp", Body: ""})
+
+	err := suite.Subject.Delete("railsapp")
+
+	assert.Nil(suite.T(), err)
+	_, err = suite.Subject.Find("railsapp")
+	assert.Equal(suite.T(), ErrNotFound, err)
+	_, err = os.Stat(filepath.Join(suite.Dir, "railsapp.tmpl"))
+	assert.True(suite.T(), os.IsNotExist(err))
+}
+
+func (suite *RegistryTestSuite) TestDeleteNotFound() {
+	assert.Equal(suite.T(), ErrNotFound, suite.Subject.Delete("railsapp"))
+}
+
+func (suite *RegistryTestSuite) TestDeleteBuiltInDefault() {
+	assert.Equal(suite.T(), ErrDefault, suite.Subject.Delete(DefaultName))
+}
+
+func (suite *RegistryTestSuite) TestDeleteReplacedDefaultRestoresBuiltIn() {
+	suite.Subject.Save(&Template{Name: DefaultName, Body: "[Service]\n"})
+
+	err := suite.Subject.Delete(DefaultName)
+
+	assert.Nil(suite.T(), err)
+	found, _ := suite.Subject.Find(DefaultName)
+	assert.Equal(suite.T(), defaultTemplate, found.Body)
+}
+
+func (suite *RegistryTestSuite) TestForDeployUsesNamedTemplate() {
+	suite.Subject.Save(&Template{Name: "railsapp", Body: ""})
+	suite.Subject.Save(&Template{Name: "worker", Body: ""})
+
+	found, err := suite.Subject.ForDeploy(&schema.Deploy{ServiceName: "railsapp", Template: "worker"})
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "worker", found.Name)
+}
+
+func (suite *RegistryTestSuite) TestForDeployWithMissingNamedTemplate() {
+	_, err := suite.Subject.ForDeploy(&schema.Deploy{ServiceName: "railsapp", Template: "worker"})
+
+	assert.Equal(suite.T(), ErrNotFound, err)
+}
+
+func (suite *RegistryTestSuite) TestForDeployUsesServiceTemplate() {
+	suite.Subject.Save(&Template{Name: "railsapp", Body: ""})
+
+	found, _ := suite.Subject.ForDeploy(&schema.Deploy{ServiceName: "railsapp"})
+
+	assert.Equal(suite.T(), "railsapp", found.Name)
+}
+
+func (suite *RegistryTestSuite) TestForDeployFallsBackToDefault() {
+	found, _ := suite.Subject.ForDeploy(&schema.Deploy{ServiceName: "railsapp"})
+
+	assert.Equal(suite.T(), DefaultName, found.Name)
+}
+
+func TestRegistryTestSuite(t *testing.T) {
+	suite.Run(t, new(RegistryTestSuite))
+}
@@ -0,0 +1,180 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/bmorton/deployster/schema"
+)
+
+// Template is a named unit file template.  The body is parsed as a Go
+// text/template and rendered with a View for each deploy that uses it.
+type Template struct {
+	Name string `json:"name"`
+	Body string `json:"body"`
+}
+
+// View is the view model that is passed to a template when rendering the unit
+// file of a deploy.  ContainerName includes the `%i` instance specifier so that
+// every instance of the deploy gets its own container.  Port is the port the
+// service serves HTTP on and DockerFlags are the `docker run` flags that publish
+// its Ports and apply the rest of its Settings.  EnvFlags are the `docker run
+// -e` flags that pass Env to the container.  Flags are quoted and escaped for
+// systemd.  FleetOptions are the `[X-Fleet]` directives, one per line, that
+// schedule the deploy's instances.  ManagedEndpoints is set when deployster
+// registers each instance with the load balancer itself, in which case the
+// unit file shouldn't.
+type View struct {
+	Name             string
+	Version          string
+	Timestamp        string
+	ImagePrefix      string
+	Image            string
+	ContainerName    string
+	Port             int
+	Ports            []int
+	InstanceCount    int
+	Settings         *schema.ServiceSettings
+	DockerFlags      string
+	Env              map[string]string
+	EnvFlags         string
+	FleetOptions     string
+	ManagedEndpoints bool
+}
+
+// DefaultPort is the port that the HTTP service of every image is expected to
+// be exposed on unless its settings say otherwise.
+const DefaultPort = schema.DefaultPort
+
+// NewView returns the view of a deploy whose image is stored under the given
+// prefix, run with the default settings.
+func NewView(deploy *schema.Deploy, imagePrefix string) *View {
+	v := &View{
+		Name:          deploy.ServiceName,
+		Version:       deploy.Version,
+		Timestamp:     deploy.Timestamp,
+		ImagePrefix:   imagePrefix,
+		Image:         fmt.Sprintf("%s/%s:%s", imagePrefix, deploy.ServiceName, deploy.Version),
+		ContainerName: fmt.Sprintf("%s-%s-%s-%%i", deploy.ServiceName, deploy.Version, deploy.Timestamp),
+		InstanceCount: deploy.InstanceCount,
+		FleetOptions:  fleetOptions(deploy),
+	}
+	return v.WithSettings(&schema.ServiceSettings{})
+}
+
+// WithSettings sets the settings that the service's containers are run with
+// and returns the view.
+func (v *View) WithSettings(settings *schema.ServiceSettings) *View {
+	v.Settings = settings
+	v.Port = settings.HTTPPort()
+	v.Ports = settings.PublishedPorts()
+	v.DockerFlags = dockerFlags(settings)
+	return v
+}
+
+// WithEnv sets the environment passed to the container and returns the view.
+func (v *View) WithEnv(env map[string]string) *View {
+	v.Env = env
+	v.EnvFlags = envFlags(env)
+	return v
+}
+
+// dockerFlags returns the `docker run` flags for the settings.
+func dockerFlags(settings *schema.ServiceSettings) string {
+	flags := []string{}
+	for _, port := range settings.PublishedPorts() {
+		flags = append(flags, fmt.Sprintf("-p %d", port))
+	}
+	if settings.Memory != "" {
+		flags = append(flags, "-m "+settings.Memory)
+	}
+	if settings.CPUShares > 0 {
+		flags = append(flags, fmt.Sprintf("--cpu-shares %d", settings.CPUShares))
+	}
+	for _, volume := range settings.Volumes {
+		flags = append(flags, fmt.Sprintf(`-v "%s"`, systemdEscaper.Replace(volume)))
+	}
+	for _, host := range settings.ExtraHosts {
+		flags = append(flags, fmt.Sprintf(`--add-host "%s"`, systemdEscaper.Replace(host)))
+	}
+	if settings.RestartPolicy != "" {
+		flags = append(flags, "--restart="+settings.RestartPolicy)
+	}
+
+	names := make([]string, 0, len(settings.Labels))
+	for name := range settings.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flags = append(flags, fmt.Sprintf(`-l "%s=%s"`, systemdEscaper.Replace(name), systemdEscaper.Replace(settings.Labels[name])))
+	}
+
+	return strings.Join(flags, " ")
+}
+
+// fleetOptions returns the `[X-Fleet]` directives for the deploy's scheduling
+// options.
+func fleetOptions(deploy *schema.Deploy) string {
+	options := []string{}
+	for _, metadata := range deploy.MachineMetadata {
+		options = append(options, "MachineMetadata="+metadata)
+	}
+	for _, conflict := range deploy.InstanceConflicts() {
+		options = append(options, "Conflicts="+conflict)
+	}
+	if deploy.MachineOf != "" {
+		options = append(options, "MachineOf="+deploy.MachineOf)
+	}
+	if deploy.Global {
+		options = append(options, "Global=true")
+	}
+	return strings.Join(options, "\n")
+}
+
+// envFlags returns a `-e` flag for every variable, sorted by name.
+func envFlags(env map[string]string) string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	flags := make([]string, len(names))
+	for i, name := range names {
+		flags[i] = fmt.Sprintf(`-e "%s=%s"`, name, systemdEscaper.Replace(env[name]))
+	}
+	return strings.Join(flags, " ")
+}
+
+// systemdEscaper escapes a value so that it can be used inside a double-quoted
+// argument of a systemd command line without being split, unescaped, or having
+// specifiers and variables expanded.
+var systemdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "%", "%%", "$", "$$")
+
+// Parse checks that the body of the template can be parsed.
+func (t *Template) Parse() (*template.Template, error) {
+	parsed, err := template.New(t.Name).Parse(t.Body)
+	if err != nil {
+		return nil, fmt.Errorf("The %s template could not be parsed: %s", t.Name, err)
+	}
+	return parsed, nil
+}
+
+// Render renders the unit file for the given view.
+func (t *Template) Render(view *View) (string, error) {
+	parsed, err := t.Parse()
+	if err != nil {
+		return "", err
+	}
+
+	var unitFile bytes.Buffer
+	err = parsed.Execute(&unitFile, view)
+	if err != nil {
+		return "", fmt.Errorf("The %s template could not be rendered: %s", t.Name, err)
+	}
+	return unitFile.String(), nil
+}
@@ -0,0 +1,141 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TemplateTestSuite struct {
+	suite.Suite
+	View *View
+}
+
+func (suite *TemplateTestSuite) SetupTest() {
+	suite.View = NewView(&schema.Deploy{ServiceName: "railsapp", Version: "abc123", Timestamp: "2006.01.02-15.04.05", InstanceCount: 2}, "mmmhm")
+}
+
+func (suite *TemplateTestSuite) TestNewView() {
+	assert.Equal(suite.T(), "mmmhm/railsapp:abc123", suite.View.Image)
+	assert.Equal(suite.T(), "railsapp-abc123-2006.01.02-15.04.05-%i", suite.View.ContainerName)
+	assert.Equal(suite.T(), 3000, suite.View.Port)
+	assert.Equal(suite.T(), 2, suite.View.InstanceCount)
+}
+
+func (suite *TemplateTestSuite) TestRenderDefault() {
+	unitFile, err := Default().Render(suite.View)
+
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), unitFile, "Description=railsapp-abc123-2006.01.02-15.04.05\n")
+	assert.Contains(suite.T(), unitFile, "ExecStartPre=/usr/bin/docker pull mmmhm/railsapp:abc123\n")
+	assert.Contains(suite.T(), unitFile, "ExecStart=/usr/bin/docker run --name railsapp-abc123-2006.01.02-15.04.05-%i -p 3000 mmmhm/railsapp:abc123\n")
+	assert.Contains(suite.T(), unitFile, "/vulcand/upstreams/railsapp/endpoints/railsapp-abc123-2006.01.02-15.04.05-%i http://$COREOS_PRIVATE_IPV4")
+}
+
+func (suite *TemplateTestSuite) TestRenderDefaultWithManagedEndpoints() {
+	suite.View.ManagedEndpoints = true
+
+	unitFile, err := Default().Render(suite.View)
+
+	assert.Nil(suite.T(), err)
+	assert.NotContains(suite.T(), unitFile, "ExecStartPost")
+	assert.NotContains(suite.T(), unitFile, "etcdctl")
+	assert.Contains(suite.T(), unitFile, "ExecStop=/bin/sh -c \"/usr/bin/docker rm -f railsapp-abc123-2006.01.02-15.04.05-%i\"\n")
+	assert.Empty(suite.T(), Validate(unitFile))
+}
+
+func (suite *TemplateTestSuite) TestRenderDefaultSpreadsInstances() {
+	unitFile, err := Default().Render(suite.View)
+
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), unitFile, "\n[X-Fleet]\nConflicts=%p@*.service\n")
+}
+
+func (suite *TemplateTestSuite) TestRenderDefaultWithSchedulingOptions() {
+	view := NewView(&schema.Deploy{
+		ServiceName:     "railsapp",
+		Version:         "abc123",
+		Timestamp:       "2006.01.02-15.04.05",
+		MachineMetadata: []string{"region=us-east", "disk=ssd"},
+		Conflicts:       []string{"railsapp:*", "postgres@*.service"},
+	}, "mmmhm")
+
+	unitFile, err := Default().Render(view)
+
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), unitFile, "\n[X-Fleet]\nMachineMetadata=region=us-east\nMachineMetadata=disk=ssd\nConflicts=railsapp:*\nConflicts=postgres@*.service\n")
+}
+
+func (suite *TemplateTestSuite) TestRenderDefaultGlobal() {
+	view := NewView(&schema.Deploy{ServiceName: "railsapp", Version: "abc123", Timestamp: "2006.01.02-15.04.05", Global: true}, "mmmhm")
+
+	unitFile, err := Default().Render(view)
+
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), unitFile, "\n[X-Fleet]\nGlobal=true\n")
+	assert.NotContains(suite.T(), unitFile, "Conflicts=")
+}
+
+func (suite *TemplateTestSuite) TestRenderDefaultWithoutConflicts() {
+	view := NewView(&schema.Deploy{ServiceName: "railsapp", Version: "abc123", Timestamp: "2006.01.02-15.04.05", Conflicts: []string{}}, "mmmhm")
+
+	unitFile, err := Default().Render(view)
+
+	assert.Nil(suite.T(), err)
+	assert.NotContains(suite.T(), unitFile, "[X-Fleet]")
+	assert.Empty(suite.T(), Validate(unitFile))
+}
+
+func (suite *TemplateTestSuite) TestRenderDefaultWithEnv() {
+	suite.View.WithEnv(map[string]string{"RAILS_ENV": "production", "GREETING": `say "hi" for $5 at 100%`})
+
+	unitFile, err := Default().Render(suite.View)
+
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), unitFile, `-p 3000 -e "GREETING=say \"hi\" for $$5 at 100%%" -e "RAILS_ENV=production" mmmhm/railsapp:abc123`+"\n")
+}
+
+func (suite *TemplateTestSuite) TestRenderDefaultWithSettings() {
+	suite.View.WithSettings(&schema.ServiceSettings{
+		Ports:         []int{8080, 9090},
+		Memory:        "512m",
+		CPUShares:     512,
+		Volumes:       []string{"/var/log/railsapp:/app/log"},
+		ExtraHosts:    []string{"db.internal:10.0.0.5"},
+		RestartPolicy: "on-failure:3",
+		Labels:        map[string]string{"team": "payments", "owner": "ops"},
+	})
+
+	unitFile, err := Default().Render(suite.View)
+
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), unitFile, `--name railsapp-abc123-2006.01.02-15.04.05-%i -p 8080 -p 9090 -m 512m --cpu-shares 512 -v "/var/log/railsapp:/app/log" --add-host "db.internal:10.0.0.5" --restart=on-failure:3 -l "owner=ops" -l "team=payments" mmmhm/railsapp:abc123`+"\n")
+	assert.Contains(suite.T(), unitFile, "/usr/bin/docker port railsapp-abc123-2006.01.02-15.04.05-%i 8080")
+}
+
+func (suite *TemplateTestSuite) TestRenderDefaultEscapesExtraHosts() {
+	suite.View.WithSettings(&schema.ServiceSettings{ExtraHosts: []string{`db"; rm -rf $HOME:10.0.0.5`}})
+
+	unitFile, err := Default().Render(suite.View)
+
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), unitFile, `--add-host "db\"; rm -rf $$HOME:10.0.0.5"`)
+}
+
+func (suite *TemplateTestSuite) TestRenderWithParseError() {
+	_, err := (&Template{Name: "broken", Body: "{{.Name"}).Render(suite.View)
+
+	assert.Contains(suite.T(), err.Error(), "The broken template could not be parsed")
+}
+
+func (suite *TemplateTestSuite) TestRenderWithExecutionError() {
+	_, err := (&Template{Name: "broken", Body: "{{.Missing}}"}).Render(suite.View)
+
+	assert.Contains(suite.T(), err.Error(), "The broken template could not be rendered")
+}
+
+func TestTemplateTestSuite(t *testing.T) {
+	suite.Run(t, new(TemplateTestSuite))
+}
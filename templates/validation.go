@@ -0,0 +1,131 @@
+package templates
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/coreos/fleet/unit"
+)
+
+// Problem is a single reason that a rendered unit file is invalid.  The
+// section and directive are set when the problem is specific to them.
+type Problem struct {
+	Section   string `json:"section,omitempty"`
+	Directive string `json:"directive,omitempty"`
+	Message   string `json:"message"`
+}
+
+// ValidationError is returned when a rendered unit file has problems that would
+// keep Fleet from launching it correctly.
+type ValidationError struct {
+	Problems []*Problem
+}
+
+// Error summarizes every problem with the unit file.
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		messages[i] = p.Message
+	}
+	return fmt.Sprintf("The rendered unit file is invalid: %s", strings.Join(messages, " "))
+}
+
+// knownDirectives are the directives that may be used in each section of a unit
+// file.  Sections that aren't listed are only allowed if they're extensions
+// whose names begin with `X-`.
+var knownDirectives = map[string][]string{
+	"Unit": {
+		"Description", "Documentation", "Requires", "Requisite", "Wants", "BindsTo", "PartOf",
+		"Conflicts", "Before", "After", "OnFailure", "PropagatesReloadTo", "ReloadPropagatedFrom",
+		"JoinsNamespaceOf", "RequiresMountsFor", "OnFailureJobMode", "IgnoreOnIsolate",
+		"StopWhenUnneeded", "RefuseManualStart", "RefuseManualStop", "AllowIsolate",
+		"DefaultDependencies", "JobTimeoutSec", "JobTimeoutAction", "JobTimeoutRebootArgument",
+		"StartLimitInterval", "StartLimitBurst", "StartLimitAction", "RebootArgument", "SourcePath",
+		"Condition*", "Assert*",
+	},
+	"Service": {
+		"Type", "RemainAfterExit", "GuessMainPID", "PIDFile", "BusName", "BusPolicy",
+		"ExecStart", "ExecStartPre", "ExecStartPost", "ExecReload", "ExecStop", "ExecStopPost",
+		"RestartSec", "TimeoutStartSec", "TimeoutStopSec", "TimeoutSec", "WatchdogSec", "Restart",
+		"SuccessExitStatus", "RestartPreventExitStatus", "RestartForceExitStatus",
+		"PermissionsStartOnly", "RootDirectoryStartOnly", "NonBlocking", "NotifyAccess", "Sockets",
+		"StartLimitInterval", "StartLimitBurst", "StartLimitAction", "FailureAction", "RebootArgument",
+		"FileDescriptorStoreMax", "WorkingDirectory", "RootDirectory", "User", "Group",
+		"SupplementaryGroups", "Nice", "OOMScoreAdjust", "IOSchedulingClass", "IOSchedulingPriority",
+		"CPUSchedulingPolicy", "CPUSchedulingPriority", "CPUSchedulingResetOnFork", "CPUAffinity",
+		"UMask", "Environment", "EnvironmentFile", "StandardInput", "StandardOutput", "StandardError",
+		"TTYPath", "TTYReset", "TTYVHangup", "TTYVTDisallocate", "SyslogIdentifier", "SyslogFacility",
+		"SyslogLevel", "SyslogLevelPrefix", "TimerSlackNSec", "PrivateTmp", "PrivateNetwork",
+		"PrivateDevices", "ProtectSystem", "ProtectHome", "ReadWriteDirectories",
+		"ReadOnlyDirectories", "InaccessibleDirectories", "MountFlags", "Capabilities",
+		"CapabilityBoundingSet", "SecureBits", "NoNewPrivileges", "SystemCallFilter",
+		"SystemCallErrorNumber", "SystemCallArchitectures", "RestrictAddressFamilies", "Personality",
+		"KillMode", "KillSignal", "SendSIGKILL", "SendSIGHUP", "CPUAccounting", "CPUShares",
+		"StartupCPUShares", "CPUQuota", "MemoryAccounting", "MemoryLimit", "BlockIOAccounting",
+		"BlockIOWeight", "StartupBlockIOWeight", "BlockIODeviceWeight", "BlockIOReadBandwidth",
+		"BlockIOWriteBandwidth", "DeviceAllow", "DevicePolicy", "Slice", "Delegate", "Limit*",
+	},
+	"X-Fleet": {
+		"MachineID", "MachineOf", "MachineMetadata", "Conflicts", "Global", "Replaces",
+	},
+	"Install": {
+		"Alias", "WantedBy", "RequiredBy", "Also", "DefaultInstance",
+	},
+}
+
+// dockerName matches the container name given to `docker run`.
+var dockerName = regexp.MustCompile(`docker\s+run\s.*--name[=\s]+(\S+)`)
+
+// Validate checks that the rendered unit file can be parsed, has a `[Service]`
+// section with an `ExecStart` directive, only uses known sections and
+// directives, and follows deployster's conventions.  Every problem found is
+// returned, so an empty result means the unit file is valid.
+func Validate(unitFile string) []*Problem {
+	problems := []*Problem{}
+
+	parsed, err := unit.NewUnitFile(unitFile)
+	if err != nil {
+		return append(problems, &Problem{Message: fmt.Sprintf("The unit file could not be parsed: %s.", err)})
+	}
+
+	if _, ok := parsed.Contents["Service"]; !ok {
+		problems = append(problems, &Problem{Section: "Service", Message: "The unit file must have a [Service] section."})
+	} else if len(parsed.Contents["Service"]["ExecStart"]) == 0 {
+		problems = append(problems, &Problem{Section: "Service", Directive: "ExecStart", Message: "The [Service] section must have an ExecStart directive."})
+	}
+
+	reported := map[string]bool{}
+	for _, option := range parsed.Options {
+		directives, known := knownDirectives[option.Section]
+		if !known && !strings.HasPrefix(option.Section, "X-") && !reported[option.Section] {
+			reported[option.Section] = true
+			problems = append(problems, &Problem{Section: option.Section, Message: fmt.Sprintf("[%s] is not a known section.", option.Section)})
+		}
+		if known && !isKnownDirective(directives, option.Name) {
+			problems = append(problems, &Problem{Section: option.Section, Directive: option.Name, Message: fmt.Sprintf("%s is not a known directive in the [%s] section.", option.Name, option.Section)})
+		}
+	}
+
+	for _, directive := range []string{"ExecStartPre", "ExecStart"} {
+		for _, command := range parsed.Contents["Service"][directive] {
+			match := dockerName.FindStringSubmatch(command)
+			if match != nil && !strings.Contains(match[1], "%i") {
+				problems = append(problems, &Problem{Section: "Service", Directive: directive, Message: fmt.Sprintf("The container name %s must include the %%i instance specifier so that each instance gets its own container.", match[1])})
+			}
+		}
+	}
+
+	return problems
+}
+
+// isKnownDirective checks the name against the directives, which may end in a
+// `*` to allow any directive beginning with the rest of it.
+func isKnownDirective(directives []string, name string) bool {
+	for _, directive := range directives {
+		if directive == name || strings.HasSuffix(directive, "*") && strings.HasPrefix(name, strings.TrimSuffix(directive, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ValidationTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ValidationTestSuite) TestDefaultTemplateIsValid() {
+	unitFile, _ := Default().Render(NewView(&schema.Deploy{ServiceName: "railsapp", Version: "abc123", Timestamp: "2006.01.02-15.04.05"}, "mmmhm"))
+
+	assert.Empty(suite.T(), Validate(unitFile))
+}
+
+func (suite *ValidationTestSuite) TestUnparseableUnitFile() {
+	problems := Validate("ExecStart=/bin/true\n")
+
+	assert.Len(suite.T(), problems, 1)
+	assert.Contains(suite.T(), problems[0].Message, "The unit file could not be parsed")
+}
+
+func (suite *ValidationTestSuite) TestMissingServiceSection() {
+	problems := Validate("[Unit]\nDescription=railsapp\n")
+
+	assert.Equal(suite.T(), []*Problem{{Section: "Service", Message: "The unit file must have a [Service] section."}}, problems)
+}
+
+func (suite *ValidationTestSuite) TestMissingExecStart() {
+	problems := Validate("[Service]\nUser=core\n")
+
+	assert.Equal(suite.T(), []*Problem{{Section: "Service", Directive: "ExecStart", Message: "The [Service] section must have an ExecStart directive."}}, problems)
+}
+
+func (suite *ValidationTestSuite) TestUnknownDirective() {
+	problems := Validate("[Service]\nExecStart=/bin/true\nExecStrat=/bin/true\n")
+
+	assert.Equal(suite.T(), []*Problem{{Section: "Service", Directive: "ExecStrat", Message: "ExecStrat is not a known directive in the [Service] section."}}, problems)
+}
+
+func (suite *ValidationTestSuite) TestWildcardDirectives() {
+	problems := Validate("[Unit]\nConditionPathExists=/etc/environment\n\n[Service]\nExecStart=/bin/true\nLimitNOFILE=4096\n")
+
+	assert.Empty(suite.T(), problems)
+}
+
+func (suite *ValidationTestSuite) TestUnknownSection() {
+	problems := Validate("[Service]\nExecStart=/bin/true\n\n[Fleet]\nGlobal=true\nConflicts=railsapp@*.service\n")
+
+	assert.Equal(suite.T(), []*Problem{{Section: "Fleet", Message: "[Fleet] is not a known section."}}, problems)
+}
+
+func (suite *ValidationTestSuite) TestExtensionSectionsAreAllowed() {
+	problems := Validate("[Service]\nExecStart=/bin/true\n\n[X-Fleet]\nGlobal=true\n\n[X-Custom]\nAnything=goes\n")
+
+	assert.Empty(suite.T(), problems)
+}
+
+func (suite *ValidationTestSuite) TestContainerNameWithoutInstanceSpecifier() {
+	problems := Validate("[Service]\nExecStart=/usr/bin/docker run --name railsapp mmmhm/railsapp:abc123\n")
+
+	assert.Len(suite.T(), problems, 1)
+	assert.Equal(suite.T(), "ExecStart", problems[0].Directive)
+	assert.Contains(suite.T(), problems[0].Message, "The container name railsapp must include the %i instance specifier")
+}
+
+func (suite *ValidationTestSuite) TestValidationErrorSummarizesProblems() {
+	err := &ValidationError{Problems: Validate("[Service]\nUser=core\nExecStrat=/bin/true\n")}
+
+	assert.Equal(suite.T(), "The rendered unit file is invalid: The [Service] section must have an ExecStart directive. ExecStrat is not a known directive in the [Service] section.", err.Error())
+}
+
+func TestValidationTestSuite(t *testing.T) {
+	suite.Run(t, new(ValidationTestSuite))
+}
@@ -2,6 +2,7 @@ package units
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/coreos/fleet/schema"
 )
@@ -78,6 +79,29 @@ func FindTimestampedServiceVersions(serviceName string, units []*schema.Unit) []
 	return versions
 }
 
+// FindServiceNames parses an array of units returned from fleet and collects
+// the names of every service that deployster manages, sorted alphabetically.
+// Units that weren't created by deployster are ignored.
+func FindServiceNames(units []*schema.Unit) []string {
+	uniqueNames := make(map[string]bool)
+
+	for _, u := range units {
+		dereferencedUnit := *u
+		extractable := ExtractableUnit(dereferencedUnit)
+		if extractable.IsManaged() {
+			uniqueNames[extractable.ExtractBaseName()] = true
+		}
+	}
+
+	names := make([]string, 0, len(uniqueNames))
+	for k := range uniqueNames {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
 // shouldIncludeVersion takes an optional version checker and, if specified,
 // ensures that it matches the unitVersion.  If the optional version is left
 // blank, we'll return true.  If the optional version is present and it doesn't
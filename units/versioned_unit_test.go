@@ -84,6 +84,26 @@ func (suite *VersionedUnitTestSuite) TestFindTimestampedServiceVersionsWithMulti
 	assert.Contains(suite.T(), found, expected[0], expected[1])
 }
 
+func (suite *VersionedUnitTestSuite) TestFindServiceNames() {
+	units := []*schema.Unit{
+		&schema.Unit{"running", "running", "m4ch1n3-1d", "notcarousel:efefeff:2006.01.02-15.04.05@1.service", []*schema.UnitOption{}},
+		&schema.Unit{"running", "running", "m4ch1n3-1d", "carousel:efefeff:2006.01.02-15.04.05@1.service", []*schema.UnitOption{}},
+		&schema.Unit{"running", "running", "m4ch1n3-1d", "carousel:abababb:2007.01.02-15.04.05@2.service", []*schema.UnitOption{}},
+		&schema.Unit{"running", "running", "m4ch1n3-1d", "vulcand.service", []*schema.UnitOption{}},
+	}
+
+	found := FindServiceNames(units)
+	assert.Equal(suite.T(), []string{"carousel", "notcarousel"}, found)
+}
+
+func (suite *VersionedUnitTestSuite) TestFindServiceNamesWithNoManagedUnits() {
+	units := []*schema.Unit{
+		&schema.Unit{"running", "running", "m4ch1n3-1d", "vulcand.service", []*schema.UnitOption{}},
+	}
+
+	assert.Empty(suite.T(), FindServiceNames(units))
+}
+
 func TestVersionedUnitTestSuite(t *testing.T) {
 	suite.Run(t, new(VersionedUnitTestSuite))
 }
@@ -0,0 +1,37 @@
+package upstreams
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// invalidServerName matches the characters that HAProxy doesn't allow in the
+// name of a server.
+var invalidServerName = regexp.MustCompile(`[^A-Za-z0-9_.:-]`)
+
+// HAProxy renders a service's endpoints as an HAProxy `backend` section named
+// after the service, with a weighted, health-checked `server` for each
+// endpoint.  HAProxy loads every file in a directory that's passed to it with
+// `-f`.
+type HAProxy struct{}
+
+// NewHAProxyWriter returns a Writer for HAProxy backend configs.
+func NewHAProxyWriter(dir string, reloadCommand string) (*Writer, error) {
+	return NewWriter(dir, HAProxy{}, reloadCommand)
+}
+
+func (HAProxy) Name() string {
+	return "haproxy"
+}
+
+func (HAProxy) Extension() string {
+	return ".cfg"
+}
+
+func (HAProxy) Render(service string, endpoints []Endpoint) string {
+	body := fmt.Sprintf("backend %s\n    mode http\n", service)
+	for _, e := range endpoints {
+		body += fmt.Sprintf("    server %s %s weight %d check\n", invalidServerName.ReplaceAllString(e.ID, "_"), e.Address, e.Weight)
+	}
+	return body
+}
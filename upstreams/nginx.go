@@ -0,0 +1,38 @@
+package upstreams
+
+import "fmt"
+
+// Nginx renders a service's endpoints as an nginx `upstream` block named after
+// the service, meant to be included in the `http` context, e.g. with
+// `include /etc/nginx/upstreams/*.conf;`.  Endpoints with a weight of 0 are
+// marked down.  nginx requires every upstream to have a server, so a service
+// without endpoints gets one that's marked down.
+type Nginx struct{}
+
+// NewNginxWriter returns a Writer for nginx upstream configs.
+func NewNginxWriter(dir string, reloadCommand string) (*Writer, error) {
+	return NewWriter(dir, Nginx{}, reloadCommand)
+}
+
+func (Nginx) Name() string {
+	return "nginx"
+}
+
+func (Nginx) Extension() string {
+	return ".conf"
+}
+
+func (Nginx) Render(service string, endpoints []Endpoint) string {
+	body := fmt.Sprintf("upstream %s {\n", service)
+	for _, e := range endpoints {
+		if e.Weight == 0 {
+			body += fmt.Sprintf("    server %s down;\n", e.Address)
+		} else {
+			body += fmt.Sprintf("    server %s weight=%d;\n", e.Address, e.Weight)
+		}
+	}
+	if len(endpoints) == 0 {
+		body += "    server 127.0.0.1:65535 down;\n"
+	}
+	return body + "}\n"
+}
@@ -0,0 +1,300 @@
+package upstreams
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bmorton/deployster/clients"
+)
+
+// endpointPrefix starts the comment that each endpoint is recorded in at the
+// top of a generated config file, so that the endpoints can be loaded again
+// when deployster restarts.
+const endpointPrefix = "# endpoint "
+
+// ErrInvalidName is returned when a service name can't safely be used as a file
+// name or as the name of an upstream.
+var ErrInvalidName = errors.New("Service names must only contain letters, numbers, dashes, underscores, and periods.")
+
+// validName matches the service names that can be written to a config file.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Endpoint is an instance of a service that a load balancer sends traffic to.
+// The ID is the endpoint's name, such as its container name, Address is the
+// `host:port` it's reachable at, and Weight is its share of the service's
+// traffic, from 0 to clients.DefaultWeight.
+type Endpoint struct {
+	ID      string
+	Address string
+	Weight  int
+}
+
+// Format renders the upstream config of a service for a particular load
+// balancer.  Name identifies the load balancer in errors and Extension is
+// appended to the service name to name its config file.
+type Format interface {
+	Name() string
+	Extension() string
+	Render(service string, endpoints []Endpoint) string
+}
+
+// Writer registers the endpoints of services with a load balancer that reads
+// its upstreams from config files, such as nginx or HAProxy.  Every time an
+// endpoint is registered or deregistered, the service's config file in Dir is
+// regenerated in the given Format and ReloadCommand is run with `sh -c` so that
+// the load balancer picks up the change.  The config file isn't rewritten and
+// the load balancer isn't reloaded if nothing changed.  Endpoints are weighted,
+// so a Writer is a clients.WeightedLoadBalancer.
+type Writer struct {
+	Dir           string
+	Format        Format
+	ReloadCommand string
+	mutex         sync.Mutex
+	services      map[string]map[string]*Endpoint
+}
+
+// NewWriter returns a Writer that writes config files in the format to the
+// given directory, creating the directory if it doesn't already exist.  If
+// reloadCommand is blank, the load balancer is expected to notice changed
+// config files on its own.
+func NewWriter(dir string, format Format, reloadCommand string) (*Writer, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{Dir: dir, Format: format, ReloadCommand: reloadCommand, services: make(map[string]map[string]*Endpoint)}, nil
+}
+
+// Register adds the endpoint to the service's upstream with the default
+// weight, or replaces its address if it's already there while keeping its
+// weight, and reloads the load balancer.
+func (w *Writer) Register(service string, endpoint string, endpointURL string) error {
+	return w.register(service, endpoint, endpointURL, -1)
+}
+
+// RegisterWeighted adds the endpoint to the service's upstream with the given
+// weight, or replaces its address and weight if it's already there, and
+// reloads the load balancer.
+func (w *Writer) RegisterWeighted(service string, endpoint string, endpointURL string, weight int) error {
+	if weight < 0 || weight > clients.DefaultWeight {
+		return fmt.Errorf("The weight %d must be between 0 and %d.", weight, clients.DefaultWeight)
+	}
+	return w.register(service, endpoint, endpointURL, weight)
+}
+
+// SetWeights changes the weights of the service's endpoints and reloads the
+// load balancer once.  Endpoints that aren't registered are ignored.
+func (w *Writer) SetWeights(service string, weights map[string]int) error {
+	for _, weight := range weights {
+		if weight < 0 || weight > clients.DefaultWeight {
+			return fmt.Errorf("The weight %d must be between 0 and %d.", weight, clients.DefaultWeight)
+		}
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	endpoints, err := w.endpoints(service)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for id, weight := range weights {
+		if e, ok := endpoints[id]; ok && e.Weight != weight {
+			e.Weight = weight
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return w.update(service, endpoints)
+}
+
+// register adds or updates the endpoint.  A negative weight keeps the weight of
+// an endpoint that's already registered and gives a new one the default.
+func (w *Writer) register(service string, endpoint string, endpointURL string, weight int) error {
+	address, err := hostPort(endpointURL)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	endpoints, err := w.endpoints(service)
+	if err != nil {
+		return err
+	}
+	e, ok := endpoints[endpoint]
+	if !ok {
+		e = &Endpoint{ID: endpoint, Weight: clients.DefaultWeight}
+		endpoints[endpoint] = e
+	} else if e.Address == address && (weight < 0 || e.Weight == weight) {
+		return nil
+	}
+	e.Address = address
+	if weight >= 0 {
+		e.Weight = weight
+	}
+	return w.update(service, endpoints)
+}
+
+// Deregister removes the endpoint from the service's upstream and reloads the
+// load balancer.  Deregistering an endpoint that isn't registered isn't an
+// error.
+func (w *Writer) Deregister(service string, endpoint string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	endpoints, err := w.endpoints(service)
+	if err != nil {
+		return err
+	}
+	if _, ok := endpoints[endpoint]; !ok {
+		return nil
+	}
+	delete(endpoints, endpoint)
+	return w.update(service, endpoints)
+}
+
+// Endpoints returns the endpoints registered for the service, sorted by ID.
+func (w *Writer) Endpoints(service string) ([]Endpoint, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	endpoints, err := w.endpoints(service)
+	if err != nil {
+		return nil, err
+	}
+	return sorted(endpoints), nil
+}
+
+// endpoints returns the service's endpoints, loading them from its config file
+// the first time they're needed.
+func (w *Writer) endpoints(service string) (map[string]*Endpoint, error) {
+	if !validName.MatchString(service) {
+		return nil, ErrInvalidName
+	}
+	if endpoints, ok := w.services[service]; ok {
+		return endpoints, nil
+	}
+
+	endpoints := make(map[string]*Endpoint)
+	file, err := os.Open(w.path(service))
+	if os.IsNotExist(err) {
+		w.services[service] = endpoints
+		return endpoints, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, endpointPrefix) {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, endpointPrefix))
+		if len(fields) < 2 {
+			continue
+		}
+		e := &Endpoint{ID: fields[0], Address: fields[1], Weight: clients.DefaultWeight}
+		if len(fields) > 2 {
+			if weight, err := strconv.Atoi(fields[2]); err == nil {
+				e.Weight = weight
+			}
+		}
+		endpoints[e.ID] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	w.services[service] = endpoints
+	return endpoints, nil
+}
+
+// update regenerates the service's config file and reloads the load balancer.
+func (w *Writer) update(service string, endpoints map[string]*Endpoint) error {
+	list := sorted(endpoints)
+	contents := fmt.Sprintf("# Generated by deployster for the %s service.  Changes will be overwritten.\n", service)
+	for _, e := range list {
+		contents += fmt.Sprintf("%s%s %s %d\n", endpointPrefix, e.ID, e.Address, e.Weight)
+	}
+	contents += w.Format.Render(service, list)
+
+	// The config is written to a temporary file first so that the load
+	// balancer never reads a partially written one.
+	temp, err := ioutil.TempFile(w.Dir, "."+service)
+	if err != nil {
+		return err
+	}
+	_, err = temp.WriteString(contents)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), w.path(service))
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	return w.reload(service)
+}
+
+// reload runs the ReloadCommand, if there is one.
+func (w *Writer) reload(service string) error {
+	if w.ReloadCommand == "" {
+		return nil
+	}
+	output, err := exec.Command("sh", "-c", w.ReloadCommand).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("The %s upstreams of %s were written but %s could not be reloaded: %s %s", w.Format.Name(), service, w.Format.Name(), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// path returns the path of the service's config file.
+func (w *Writer) path(service string) string {
+	return filepath.Join(w.Dir, service+w.Format.Extension())
+}
+
+// sorted returns copies of the endpoints sorted by ID.
+func sorted(endpoints map[string]*Endpoint) []Endpoint {
+	ids := make([]string, 0, len(endpoints))
+	for id := range endpoints {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	list := make([]Endpoint, len(ids))
+	for i, id := range ids {
+		list[i] = *endpoints[id]
+	}
+	return list
+}
+
+// hostPort returns the `host:port` of an endpoint URL such as
+// `http://10.0.0.1:49153`.
+func hostPort(endpointURL string) (string, error) {
+	parsed, err := url.Parse(endpointURL)
+	if err != nil || parsed.Host == "" {
+		return "", fmt.Errorf("The endpoint URL %q must be in the form http://host:port.", endpointURL)
+	}
+	return parsed.Host, nil
+}
@@ -0,0 +1,171 @@
+package upstreams
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type WriterTestSuite struct {
+	suite.Suite
+	Subject *Writer
+	Dir     string
+}
+
+func (suite *WriterTestSuite) SetupTest() {
+	suite.Dir, _ = ioutil.TempDir("", "deployster-upstreams")
+	suite.Subject, _ = NewNginxWriter(suite.Dir, "")
+}
+
+func (suite *WriterTestSuite) TearDownTest() {
+	os.RemoveAll(suite.Dir)
+}
+
+func (suite *WriterTestSuite) read(name string) string {
+	contents, _ := ioutil.ReadFile(filepath.Join(suite.Dir, name))
+	return string(contents)
+}
+
+func (suite *WriterTestSuite) TestRegisterWritesNginxUpstream() {
+	err := suite.Subject.Register("railsapp", "railsapp-new-2007.01.02-15.04.05-2", "http://10.0.0.2:49154")
+	assert.Nil(suite.T(), err)
+	err = suite.Subject.Register("railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.1:49153")
+	assert.Nil(suite.T(), err)
+
+	contents := suite.read("railsapp.conf")
+	assert.Contains(suite.T(), contents, "upstream railsapp {\n    server 10.0.0.1:49153 weight=100;\n    server 10.0.0.2:49154 weight=100;\n}\n")
+}
+
+func (suite *WriterTestSuite) TestRegisterWritesHAProxyBackend() {
+	suite.Subject, _ = NewHAProxyWriter(suite.Dir, "")
+
+	err := suite.Subject.Register("railsapp", "railsapp-new-2007.01.02-15.04.05-1@abc", "http://10.0.0.1:49153")
+	assert.Nil(suite.T(), err)
+
+	contents := suite.read("railsapp.cfg")
+	assert.Contains(suite.T(), contents, "backend railsapp\n    mode http\n    server railsapp-new-2007.01.02-15.04.05-1_abc 10.0.0.1:49153 weight 100 check\n")
+}
+
+func (suite *WriterTestSuite) TestDeregisterRemovesEndpoint() {
+	suite.Subject.Register("railsapp", "railsapp-old-2006.01.02-15.04.05-1", "http://10.0.0.1:49153")
+	suite.Subject.Register("railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.2:49154")
+
+	err := suite.Subject.Deregister("railsapp", "railsapp-old-2006.01.02-15.04.05-1")
+
+	assert.Nil(suite.T(), err)
+	contents := suite.read("railsapp.conf")
+	assert.NotContains(suite.T(), contents, "10.0.0.1:49153")
+	assert.Contains(suite.T(), contents, "    server 10.0.0.2:49154 weight=100;\n")
+}
+
+func (suite *WriterTestSuite) TestDeregisterLastEndpointMarksUpstreamDown() {
+	suite.Subject.Register("railsapp", "railsapp-old-2006.01.02-15.04.05-1", "http://10.0.0.1:49153")
+
+	err := suite.Subject.Deregister("railsapp", "railsapp-old-2006.01.02-15.04.05-1")
+
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), suite.read("railsapp.conf"), "upstream railsapp {\n    server 127.0.0.1:65535 down;\n}\n")
+}
+
+func (suite *WriterTestSuite) TestDeregisterUnknownEndpoint() {
+	err := suite.Subject.Deregister("railsapp", "railsapp-old-2006.01.02-15.04.05-1")
+
+	assert.Nil(suite.T(), err)
+	assert.Empty(suite.T(), suite.read("railsapp.conf"))
+}
+
+func (suite *WriterTestSuite) TestLoadsEndpointsFromExistingConfig() {
+	suite.Subject.Register("railsapp", "railsapp-old-2006.01.02-15.04.05-1", "http://10.0.0.1:49153")
+
+	restarted, _ := NewNginxWriter(suite.Dir, "")
+	endpoints, err := restarted.Endpoints("railsapp")
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []Endpoint{{ID: "railsapp-old-2006.01.02-15.04.05-1", Address: "10.0.0.1:49153", Weight: 100}}, endpoints)
+}
+
+func (suite *WriterTestSuite) TestReloadsAfterEachChange() {
+	log := filepath.Join(suite.Dir, "reloads")
+	suite.Subject.ReloadCommand = "echo reloaded >> " + log
+
+	suite.Subject.Register("railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.1:49153")
+	suite.Subject.Register("railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.1:49153")
+	suite.Subject.Deregister("railsapp", "railsapp-new-2007.01.02-15.04.05-1")
+
+	assert.Equal(suite.T(), "reloaded\nreloaded\n", suite.read("reloads"))
+}
+
+func (suite *WriterTestSuite) TestReloadFailure() {
+	suite.Subject.ReloadCommand = "echo invalid config >&2; exit 1"
+
+	err := suite.Subject.Register("railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.1:49153")
+
+	assert.EqualError(suite.T(), err, "The nginx upstreams of railsapp were written but nginx could not be reloaded: exit status 1 invalid config")
+	assert.Contains(suite.T(), suite.read("railsapp.conf"), "server 10.0.0.1:49153 weight=100;")
+}
+
+func (suite *WriterTestSuite) TestRegisterWeighted() {
+	err := suite.Subject.RegisterWeighted("railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.1:49153", 0)
+
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), suite.read("railsapp.conf"), "    server 10.0.0.1:49153 down;\n")
+}
+
+func (suite *WriterTestSuite) TestRegisterKeepsWeight() {
+	suite.Subject.RegisterWeighted("railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.1:49153", 25)
+
+	err := suite.Subject.Register("railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.1:49155")
+
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), suite.read("railsapp.conf"), "    server 10.0.0.1:49155 weight=25;\n")
+}
+
+func (suite *WriterTestSuite) TestSetWeights() {
+	suite.Subject.Register("railsapp", "railsapp-old-2006.01.02-15.04.05-1", "http://10.0.0.1:49153")
+	suite.Subject.RegisterWeighted("railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.2:49154", 0)
+	log := filepath.Join(suite.Dir, "reloads")
+	suite.Subject.ReloadCommand = "echo reloaded >> " + log
+
+	err := suite.Subject.SetWeights("railsapp", map[string]int{
+		"railsapp-old-2006.01.02-15.04.05-1":  75,
+		"railsapp-new-2007.01.02-15.04.05-1":  25,
+		"railsapp-gone-2005.01.02-15.04.05-1": 100,
+	})
+
+	assert.Nil(suite.T(), err)
+	contents := suite.read("railsapp.conf")
+	assert.Contains(suite.T(), contents, "    server 10.0.0.1:49153 weight=75;\n")
+	assert.Contains(suite.T(), contents, "    server 10.0.0.2:49154 weight=25;\n")
+	assert.NotContains(suite.T(), contents, "gone")
+	assert.Equal(suite.T(), "reloaded\n", suite.read("reloads"))
+
+	restarted, _ := NewNginxWriter(suite.Dir, "")
+	endpoints, _ := restarted.Endpoints("railsapp")
+	assert.Equal(suite.T(), 25, endpoints[0].Weight)
+}
+
+func (suite *WriterTestSuite) TestSetWeightsWithInvalidWeight() {
+	err := suite.Subject.SetWeights("railsapp", map[string]int{"railsapp-new-2007.01.02-15.04.05-1": 101})
+
+	assert.EqualError(suite.T(), err, "The weight 101 must be between 0 and 100.")
+}
+
+func (suite *WriterTestSuite) TestRegisterWithInvalidServiceName() {
+	err := suite.Subject.Register("../railsapp", "railsapp-new-2007.01.02-15.04.05-1", "http://10.0.0.1:49153")
+
+	assert.Equal(suite.T(), ErrInvalidName, err)
+}
+
+func (suite *WriterTestSuite) TestRegisterWithInvalidURL() {
+	err := suite.Subject.Register("railsapp", "railsapp-new-2007.01.02-15.04.05-1", "10.0.0.1")
+
+	assert.NotNil(suite.T(), err)
+}
+
+func TestWriterTestSuite(t *testing.T) {
+	suite.Run(t, new(WriterTestSuite))
+}
@@ -0,0 +1,114 @@
+package vulcand
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPrefix is the etcd key that vulcand reads its configuration from.
+	DefaultPrefix = "/vulcand"
+
+	// requestTimeout is the amount of time to wait for etcd to respond.
+	requestTimeout time.Duration = 5 * time.Second
+
+	// errorKeyNotFound is the etcd error code returned for a missing key.
+	errorKeyNotFound = 100
+)
+
+// Client registers the endpoints of services with vulcand by writing them to
+// etcd through its HTTP API.  Each endpoint is stored under
+// `{Prefix}/upstreams/{service}/endpoints/{endpoint}` with its URL as the value,
+// which is the same key that the default unit template registers endpoints
+// under when deployster isn't managing them.
+type Client struct {
+	EtcdURL    string
+	Prefix     string
+	HTTPClient *http.Client
+}
+
+// etcdError is the body etcd responds with when a request fails.
+type etcdError struct {
+	ErrorCode int    `json:"errorCode"`
+	Message   string `json:"message"`
+	Cause     string `json:"cause"`
+}
+
+// NewClient returns a Client for the etcd HTTP API at the given URL, such as
+// `http://127.0.0.1:4001`, that uses vulcand's default prefix.
+func NewClient(etcdURL string) *Client {
+	return &Client{
+		EtcdURL:    strings.TrimSuffix(etcdURL, "/"),
+		Prefix:     DefaultPrefix,
+		HTTPClient: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Register sets the URL of the service's endpoint so that vulcand starts
+// sending it traffic.  Registering an endpoint that already exists replaces
+// its URL.
+func (c *Client) Register(service string, endpoint string, endpointURL string) error {
+	body := url.Values{"value": []string{endpointURL}}.Encode()
+	req, err := http.NewRequest("PUT", c.keyURL(service, endpoint), strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return c.do(req, service, endpoint)
+}
+
+// Deregister removes the service's endpoint so that vulcand stops sending it
+// traffic.  Deregistering an endpoint that doesn't exist isn't an error.
+func (c *Client) Deregister(service string, endpoint string) error {
+	req, err := http.NewRequest("DELETE", c.keyURL(service, endpoint), nil)
+	if err != nil {
+		return err
+	}
+
+	err = c.do(req, service, endpoint)
+	if e, ok := err.(*Error); ok && e.Code == errorKeyNotFound {
+		return nil
+	}
+	return err
+}
+
+// Error is returned when etcd rejects a request.
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// do sends the request to etcd and returns an Error if it fails.
+func (c *Client) do(req *http.Request, service string, endpoint string) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+
+	var failure etcdError
+	json.NewDecoder(resp.Body).Decode(&failure)
+	message := fmt.Sprintf("The %s endpoint of %s could not be updated in etcd: %s", endpoint, service, resp.Status)
+	if failure.Message != "" {
+		message = fmt.Sprintf("The %s endpoint of %s could not be updated in etcd: %s", endpoint, service, failure.Message)
+	}
+	return &Error{Code: failure.ErrorCode, Message: message}
+}
+
+// keyURL returns the URL of the etcd key for the service's endpoint.
+func (c *Client) keyURL(service string, endpoint string) string {
+	return fmt.Sprintf("%s/v2/keys%s/upstreams/%s/endpoints/%s", c.EtcdURL, c.Prefix, url.QueryEscape(service), url.QueryEscape(endpoint))
+}
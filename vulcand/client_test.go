@@ -0,0 +1,104 @@
+package vulcand
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeEtcd is a minimal in-memory implementation of etcd's keys API.
+type fakeEtcd struct {
+	mutex sync.Mutex
+	keys  map[string]string
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	key := r.URL.Path[len("/v2/keys"):]
+	switch r.Method {
+	case "PUT":
+		r.ParseForm()
+		f.keys[key] = r.PostForm.Get("value")
+		w.WriteHeader(http.StatusOK)
+	case "DELETE":
+		if _, ok := f.keys[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":100,"message":"Key not found","cause":"` + key + `"}`))
+			return
+		}
+		delete(f.keys, key)
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+type ClientTestSuite struct {
+	suite.Suite
+	Etcd    *fakeEtcd
+	Server  *httptest.Server
+	Subject *Client
+}
+
+func (suite *ClientTestSuite) SetupTest() {
+	suite.Etcd = &fakeEtcd{keys: make(map[string]string)}
+	suite.Server = httptest.NewServer(suite.Etcd)
+	suite.Subject = NewClient(suite.Server.URL + "/")
+}
+
+func (suite *ClientTestSuite) TearDownTest() {
+	suite.Server.Close()
+}
+
+func (suite *ClientTestSuite) TestRegister() {
+	err := suite.Subject.Register("carousel", "carousel-abc123-2006.01.02-15.04.05-1", "http://10.0.0.1:49153")
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "http://10.0.0.1:49153", suite.Etcd.keys["/vulcand/upstreams/carousel/endpoints/carousel-abc123-2006.01.02-15.04.05-1"])
+}
+
+func (suite *ClientTestSuite) TestRegisterWithPrefix() {
+	suite.Subject.Prefix = "/lb"
+
+	suite.Subject.Register("carousel", "carousel-abc123-2006.01.02-15.04.05-1", "http://10.0.0.1:49153")
+
+	assert.Contains(suite.T(), suite.Etcd.keys, "/lb/upstreams/carousel/endpoints/carousel-abc123-2006.01.02-15.04.05-1")
+}
+
+func (suite *ClientTestSuite) TestDeregister() {
+	suite.Etcd.keys["/vulcand/upstreams/carousel/endpoints/carousel-abc123-2006.01.02-15.04.05-1"] = "http://10.0.0.1:49153"
+
+	err := suite.Subject.Deregister("carousel", "carousel-abc123-2006.01.02-15.04.05-1")
+
+	assert.Nil(suite.T(), err)
+	assert.Empty(suite.T(), suite.Etcd.keys)
+}
+
+func (suite *ClientTestSuite) TestDeregisterMissingEndpoint() {
+	err := suite.Subject.Deregister("carousel", "carousel-abc123-2006.01.02-15.04.05-1")
+
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *ClientTestSuite) TestEtcdFailure() {
+	suite.Server.Close()
+	suite.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"errorCode":300,"message":"Raft Internal Error"}`))
+	}))
+	suite.Subject.EtcdURL = suite.Server.URL
+
+	err := suite.Subject.Register("carousel", "carousel-abc123-2006.01.02-15.04.05-1", "http://10.0.0.1:49153")
+
+	assert.EqualError(suite.T(), err, "The carousel-abc123-2006.01.02-15.04.05-1 endpoint of carousel could not be updated in etcd: Raft Internal Error")
+}
+
+func TestClientTestSuite(t *testing.T) {
+	suite.Run(t, new(ClientTestSuite))
+}
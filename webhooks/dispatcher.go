@@ -0,0 +1,300 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+)
+
+const (
+	// DefaultAttempts is the number of times a payload is sent before its
+	// delivery is given up on.
+	DefaultAttempts = 5
+
+	// DefaultBackoff is how long to wait before the first retry of a failed
+	// delivery.  The wait doubles after every attempt.
+	DefaultBackoff time.Duration = 1 * time.Second
+
+	// maxDeliveries is the number of deliveries that are kept in each
+	// service's delivery log.
+	maxDeliveries = 100
+
+	// requestTimeout is the amount of time to wait for a webhook to respond.
+	requestTimeout time.Duration = 10 * time.Second
+)
+
+// The statuses of a delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// The headers that every payload is sent with.  The signature is only sent for
+// webhooks with a secret.
+const (
+	EventHeader     = "X-Deployster-Event"
+	DeliveryHeader  = "X-Deployster-Delivery"
+	SignatureHeader = "X-Deployster-Signature"
+)
+
+// Payload is the JSON body that's sent to webhooks.  Deploy events carry the
+// deploy record, instance events carry the instance and its unit along with
+// the deploy's ID and version, and task events carry the Task.
+type Payload struct {
+	Event       string               `json:"event"`
+	ServiceName string               `json:"service_name"`
+	DeployID    string               `json:"deploy_id,omitempty"`
+	Version     string               `json:"version,omitempty"`
+	Instance    string               `json:"instance,omitempty"`
+	Unit        string               `json:"unit,omitempty"`
+	Deploy      *schema.DeployRecord `json:"deploy,omitempty"`
+	Task        *Task                `json:"task,omitempty"`
+	SentAt      time.Time            `json:"sent_at"`
+}
+
+// Task describes a task that finished running.  ExitCode is 124 if the task
+// timed out and -1 if it couldn't be determined, in which case Error says why.
+type Task struct {
+	Version  string `json:"version"`
+	Command  string `json:"command"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Delivery is the record of a payload being sent to a single webhook.
+type Delivery struct {
+	ID           string    `json:"id"`
+	Event        string    `json:"event"`
+	URL          string    `json:"url"`
+	Status       string    `json:"status"`
+	Attempts     int       `json:"attempts"`
+	ResponseCode int       `json:"response_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Dispatcher sends payloads to the Global webhooks and to those in the
+// settings of the service that each payload is about.  Payloads are sent in
+// the background and each delivery is retried until it succeeds or Attempts
+// have been made, waiting Backoff before the first retry and twice as long
+// before each one after.  Payloads are signed with the value of the webhook's
+// secret, which is resolved with Secrets.  The latest deliveries of each
+// service are kept in memory so that they can be inspected.
+type Dispatcher struct {
+	Global     []*schema.Webhook
+	Settings   *settings.Registry
+	Secrets    secrets.Provider
+	HTTPClient *http.Client
+	Attempts   int
+	Backoff    time.Duration
+
+	mutex      sync.Mutex
+	deliveries map[string][]*Delivery
+}
+
+// NewDispatcher returns a Dispatcher for the given global webhooks that
+// retries deliveries with the default attempts and backoff.
+func NewDispatcher(global []*schema.Webhook, serviceSettings *settings.Registry, secretProvider secrets.Provider) *Dispatcher {
+	return &Dispatcher{
+		Global:     global,
+		Settings:   serviceSettings,
+		Secrets:    secretProvider,
+		HTTPClient: &http.Client{Timeout: requestTimeout},
+		Attempts:   DefaultAttempts,
+		Backoff:    DefaultBackoff,
+		deliveries: make(map[string][]*Delivery),
+	}
+}
+
+// Notify sends the payload to every webhook of its service that wants its
+// event.  It returns without waiting for the payload to be delivered.  A nil
+// Dispatcher doesn't notify anyone.
+func (d *Dispatcher) Notify(payload *Payload) {
+	if d == nil {
+		return
+	}
+
+	hooks := d.webhooks(payload.ServiceName, payload.Event)
+	if len(hooks) == 0 {
+		return
+	}
+	payload.SentAt = time.Now().UTC()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, hook := range hooks {
+		delivery := d.record(payload.ServiceName, payload.Event, hook.URL)
+		go d.deliver(hook, delivery, body)
+	}
+}
+
+// Deliveries returns copies of the latest deliveries of payloads about the
+// service, newest first.
+func (d *Dispatcher) Deliveries(serviceName string) []*Delivery {
+	deliveries := []*Delivery{}
+	if d == nil {
+		return deliveries
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	log := d.deliveries[serviceName]
+	for i := len(log) - 1; i >= 0; i-- {
+		delivery := *log[i]
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries
+}
+
+// Sign returns the signature of the body with the secret, which is sent in the
+// signature header as `sha256={hex digest}`.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhooks returns the global webhooks and the service's webhooks that want
+// the event.
+func (d *Dispatcher) webhooks(serviceName string, event string) []*schema.Webhook {
+	all := d.Global
+	if d.Settings != nil {
+		all = append(all[:len(all):len(all)], d.Settings.ForService(serviceName).Webhooks...)
+	}
+
+	var hooks []*schema.Webhook
+	for _, hook := range all {
+		if hook != nil && hook.Wants(event) {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// record adds a pending delivery to the service's delivery log, dropping the
+// oldest delivery once the log is full.
+func (d *Dispatcher) record(serviceName string, event string, url string) *Delivery {
+	now := time.Now().UTC()
+	delivery := &Delivery{ID: generateDeliveryID(), Event: event, URL: url, Status: DeliveryPending, CreatedAt: now, UpdatedAt: now}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.deliveries == nil {
+		d.deliveries = make(map[string][]*Delivery)
+	}
+	log := append(d.deliveries[serviceName], delivery)
+	if len(log) > maxDeliveries {
+		log = log[len(log)-maxDeliveries:]
+	}
+	d.deliveries[serviceName] = log
+	return delivery
+}
+
+// deliver sends the body to the webhook until it's accepted or the attempts
+// run out, recording the outcome of each attempt.  A webhook whose secret
+// can't be resolved fails without being sent anything.
+func (d *Dispatcher) deliver(hook *schema.Webhook, delivery *Delivery, body []byte) {
+	var signature string
+	if hook.Secret != "" {
+		if d.Secrets == nil {
+			d.update(delivery, DeliveryFailed, 0, 0, fmt.Errorf("The %s secret could not be resolved since no secrets are configured.", hook.Secret))
+			return
+		}
+		secret, err := d.Secrets.Secret(hook.Secret)
+		if err != nil {
+			d.update(delivery, DeliveryFailed, 0, 0, fmt.Errorf("The %s secret could not be resolved: %s", hook.Secret, err))
+			return
+		}
+		signature = Sign(secret, body)
+	}
+
+	attempts := d.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := d.Backoff
+	for attempt := 1; attempt <= attempts; attempt++ {
+		code, err := d.send(hook.URL, delivery, signature, body)
+		if err == nil {
+			d.update(delivery, DeliveryDelivered, attempt, code, nil)
+			return
+		}
+		log.Printf("Delivery %s to %s failed: %s\n", delivery.ID, hook.URL, err)
+		if attempt == attempts {
+			d.update(delivery, DeliveryFailed, attempt, code, err)
+			return
+		}
+		d.update(delivery, DeliveryPending, attempt, code, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// send posts the body to the URL once, returning the status code it responded
+// with and an error unless it was successful.
+func (d *Dispatcher) send(url string, delivery *Delivery, signature string, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	if signature != "" {
+		req.Header.Set(SignatureHeader, signature)
+	}
+
+	client := d.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("The webhook responded with %s.", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// update records the outcome of an attempt to deliver a payload.
+func (d *Dispatcher) update(delivery *Delivery, status string, attempts int, code int, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	delivery.Status = status
+	delivery.Attempts = attempts
+	delivery.ResponseCode = code
+	delivery.Error = ""
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	delivery.UpdatedAt = time.Now().UTC()
+}
+
+// generateDeliveryID returns a random hex-encoded identifier for a delivery.
+func generateDeliveryID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,198 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmorton/deployster/schema"
+	"github.com/bmorton/deployster/secrets"
+	"github.com/bmorton/deployster/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type received struct {
+	Header http.Header
+	Body   []byte
+}
+
+type DispatcherTestSuite struct {
+	suite.Suite
+	Subject  *Dispatcher
+	Settings *settings.Registry
+	Server   *httptest.Server
+
+	mutex    sync.Mutex
+	failures int
+	received []*received
+}
+
+func (suite *DispatcherTestSuite) SetupTest() {
+	suite.failures = 0
+	suite.received = nil
+	suite.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		suite.mutex.Lock()
+		defer suite.mutex.Unlock()
+		suite.received = append(suite.received, &received{Header: r.Header, Body: body})
+		if len(suite.received) <= suite.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	suite.Settings = settings.NewMemoryRegistry()
+	suite.Subject = NewDispatcher(nil, suite.Settings, secrets.NewMemoryProvider(map[string]string{"hook-secret": "s3cret"}))
+	suite.Subject.Backoff = time.Millisecond
+}
+
+func (suite *DispatcherTestSuite) TearDownTest() {
+	suite.Server.Close()
+}
+
+// settled waits for every delivery of the service to stop being pending and
+// returns them.
+func (suite *DispatcherTestSuite) settled(serviceName string) []*Delivery {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries := suite.Subject.Deliveries(serviceName)
+		pending := false
+		for _, delivery := range deliveries {
+			if delivery.Status == DeliveryPending {
+				pending = true
+			}
+		}
+		if !pending || time.Now().After(deadline) {
+			return deliveries
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// failFirst makes the server respond to the first count requests with an
+// error.
+func (suite *DispatcherTestSuite) failFirst(count int) {
+	suite.mutex.Lock()
+	defer suite.mutex.Unlock()
+	suite.failures = count
+}
+
+func (suite *DispatcherTestSuite) requests() []*received {
+	suite.mutex.Lock()
+	defer suite.mutex.Unlock()
+	return append([]*received{}, suite.received...)
+}
+
+func (suite *DispatcherTestSuite) TestNotifySendsSignedPayload() {
+	suite.Settings.Save("carousel", &schema.ServiceSettings{Webhooks: []*schema.Webhook{{URL: suite.Server.URL, Secret: "hook-secret"}}})
+
+	suite.Subject.Notify(&Payload{Event: schema.WebhookDeployStarted, ServiceName: "carousel", DeployID: "abc123", Version: "v2"})
+	deliveries := suite.settled("carousel")
+
+	assert.Len(suite.T(), deliveries, 1)
+	assert.Equal(suite.T(), DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(suite.T(), 1, deliveries[0].Attempts)
+	assert.Equal(suite.T(), 200, deliveries[0].ResponseCode)
+	requests := suite.requests()
+	assert.Len(suite.T(), requests, 1)
+	assert.Equal(suite.T(), "application/json", requests[0].Header.Get("Content-Type"))
+	assert.Equal(suite.T(), schema.WebhookDeployStarted, requests[0].Header.Get(EventHeader))
+	assert.Equal(suite.T(), deliveries[0].ID, requests[0].Header.Get(DeliveryHeader))
+	assert.Equal(suite.T(), Sign("s3cret", requests[0].Body), requests[0].Header.Get(SignatureHeader))
+	var payload Payload
+	json.Unmarshal(requests[0].Body, &payload)
+	assert.Equal(suite.T(), "abc123", payload.DeployID)
+	assert.Equal(suite.T(), "v2", payload.Version)
+}
+
+func (suite *DispatcherTestSuite) TestNotifyWithoutSecretIsUnsigned() {
+	suite.Subject.Global = []*schema.Webhook{{URL: suite.Server.URL}}
+
+	suite.Subject.Notify(&Payload{Event: schema.WebhookDeploySucceeded, ServiceName: "carousel"})
+	suite.settled("carousel")
+
+	requests := suite.requests()
+	assert.Len(suite.T(), requests, 1)
+	assert.Equal(suite.T(), "", requests[0].Header.Get(SignatureHeader))
+}
+
+func (suite *DispatcherTestSuite) TestNotifyRetriesFailedDeliveries() {
+	suite.failFirst(2)
+	suite.Subject.Global = []*schema.Webhook{{URL: suite.Server.URL}}
+
+	suite.Subject.Notify(&Payload{Event: schema.WebhookDeployFailed, ServiceName: "carousel"})
+	deliveries := suite.settled("carousel")
+
+	assert.Equal(suite.T(), DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(suite.T(), 3, deliveries[0].Attempts)
+	assert.Equal(suite.T(), "", deliveries[0].Error)
+	assert.Len(suite.T(), suite.requests(), 3)
+}
+
+func (suite *DispatcherTestSuite) TestNotifyGivesUpAfterAttempts() {
+	suite.failFirst(10)
+	suite.Subject.Attempts = 3
+	suite.Subject.Global = []*schema.Webhook{{URL: suite.Server.URL}}
+
+	suite.Subject.Notify(&Payload{Event: schema.WebhookDeployFailed, ServiceName: "carousel"})
+	deliveries := suite.settled("carousel")
+
+	assert.Equal(suite.T(), DeliveryFailed, deliveries[0].Status)
+	assert.Equal(suite.T(), 3, deliveries[0].Attempts)
+	assert.Equal(suite.T(), 503, deliveries[0].ResponseCode)
+	assert.Equal(suite.T(), "The webhook responded with 503 Service Unavailable.", deliveries[0].Error)
+	assert.Len(suite.T(), suite.requests(), 3)
+}
+
+func (suite *DispatcherTestSuite) TestNotifyFailsWithMissingSecret() {
+	suite.Subject.Global = []*schema.Webhook{{URL: suite.Server.URL, Secret: "missing"}}
+
+	suite.Subject.Notify(&Payload{Event: schema.WebhookDeployStarted, ServiceName: "carousel"})
+	deliveries := suite.settled("carousel")
+
+	assert.Equal(suite.T(), DeliveryFailed, deliveries[0].Status)
+	assert.Equal(suite.T(), 0, deliveries[0].Attempts)
+	assert.Equal(suite.T(), "The missing secret could not be resolved: "+secrets.ErrNotFound.Error(), deliveries[0].Error)
+	assert.Len(suite.T(), suite.requests(), 0)
+}
+
+func (suite *DispatcherTestSuite) TestNotifyFiltersEvents() {
+	suite.Subject.Global = []*schema.Webhook{{URL: suite.Server.URL, Events: []string{schema.WebhookDeploySucceeded}}}
+	suite.Settings.Save("carousel", &schema.ServiceSettings{Webhooks: []*schema.Webhook{{URL: suite.Server.URL, Events: []string{schema.WebhookTaskFinished}}}})
+
+	suite.Subject.Notify(&Payload{Event: schema.WebhookDeployStarted, ServiceName: "carousel"})
+	suite.Subject.Notify(&Payload{Event: schema.WebhookTaskFinished, ServiceName: "carousel"})
+	deliveries := suite.settled("carousel")
+
+	assert.Len(suite.T(), deliveries, 1)
+	assert.Equal(suite.T(), schema.WebhookTaskFinished, deliveries[0].Event)
+}
+
+func (suite *DispatcherTestSuite) TestDeliveriesAreNewestFirstAndLimited() {
+	suite.Subject.Global = []*schema.Webhook{{URL: suite.Server.URL}}
+
+	for i := 0; i < maxDeliveries+5; i++ {
+		suite.Subject.Notify(&Payload{Event: schema.WebhookInstanceRunning, ServiceName: "carousel"})
+	}
+	suite.Subject.Notify(&Payload{Event: schema.WebhookDeploySucceeded, ServiceName: "carousel"})
+	deliveries := suite.settled("carousel")
+
+	assert.Len(suite.T(), deliveries, maxDeliveries)
+	assert.Equal(suite.T(), schema.WebhookDeploySucceeded, deliveries[0].Event)
+	assert.Len(suite.T(), suite.Subject.Deliveries("photos"), 0)
+}
+
+func (suite *DispatcherTestSuite) TestNilDispatcher() {
+	var dispatcher *Dispatcher
+
+	dispatcher.Notify(&Payload{Event: schema.WebhookDeployStarted, ServiceName: "carousel"})
+
+	assert.Len(suite.T(), dispatcher.Deliveries("carousel"), 0)
+}
+
+func TestDispatcherTestSuite(t *testing.T) {
+	suite.Run(t, new(DispatcherTestSuite))
+}